@@ -0,0 +1,14 @@
+//go:build !no_http
+
+package main
+
+import (
+	"github.com/schizoid/internal/api"
+	"github.com/schizoid/pkg/brain"
+)
+
+func init() {
+	serveAPI = func(store *brain.Store, addr string) error {
+		return api.New(store, cfg.API.Token).ListenAndServe(addr)
+	}
+}
@@ -0,0 +1,703 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/joho/godotenv"
+	"github.com/schizoid/internal/config"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/internal/tracing"
+	"github.com/schizoid/pkg/brain"
+	"github.com/schizoid/pkg/corpus"
+	"github.com/schizoid/pkg/ngram"
+	"github.com/schizoid/pkg/watchdog"
+)
+
+type subcommand struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+// subcommands every build has, the platforms add theirs, see frontends
+var subcommands = []subcommand{
+	{"serve", "serve the HTTP API or model service without connecting to Discord", cmdServe},
+	{"import", "train a guild brain on text or chat exports from a file or stdin", cmdImport},
+	{"train", "same as import", cmdImport},
+	{"generate", "generate text from a guild brain", cmdGenerate},
+	{"perplexity", "score how well a guild brain predicts text, one message per line", cmdPerplexity},
+	{"repl", "train and generate interactively, without connecting anywhere", cmdRepl},
+	{"purge-imports", "forget everything a guild brain learned from imports", cmdPurgeImports},
+	{"prune", "forget the rare long n-grams of a guild brain", cmdPrune},
+	{"export", "dump a guild brain as JSON", cmdExport},
+	{"bundle", "pack a guild brain with its settings for moving to another deployment", cmdBundle},
+	{"unbundle", "restore a guild brain packed by bundle", cmdUnbundle},
+	{"migrate", "rewrite every stored brain in the current format", cmdMigrate},
+	{"audit", "export a guild brain's log of admin actions, or verify an export", cmdAudit},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: schizoid [command] [flags]\n\ncommands:\n")
+	for _, cmd := range allSubcommands() {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun 'schizoid <command> -h' for the flags of a command\n")
+}
+
+// allSubcommands lists the platforms built in before everything else
+func allSubcommands() []subcommand {
+	return append(slices.Clone(frontends), subcommands...)
+}
+
+// runCLI dispatches to a subcommand, defaulting to run so the bare binary
+// still starts the bot
+func runCLI(args []string) error {
+	var name = "run"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return nil
+	}
+
+	for _, cmd := range allSubcommands() {
+		if cmd.name == name {
+			return cmd.run(args)
+		}
+	}
+
+	usage()
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// newFlagSet creates the flags for a subcommand, including the shared -config
+// flag
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+
+	defaultPath := os.Getenv("CONFIG_FILE")
+	if defaultPath == "" {
+		defaultPath = "schizoid.toml"
+	}
+
+	return fs, fs.String("config", defaultPath, "path to the config file")
+}
+
+// setup loads the environment and config file shared by all subcommands
+func setup(configPath string) error {
+	if err := godotenv.Load(); err != nil {
+		slog.Error("Failed to load environment", slog.String("err", err.Error()))
+	}
+
+	var err error
+	if cfg, err = loadConfig(configPath); err != nil {
+		return err
+	}
+
+	handler, err := logging.NewHandler(os.Stderr, cfg.Log)
+	if err != nil {
+		return fmt.Errorf("loading config %s: %w", configPath, err)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	if stopTracing, err = tracing.Setup(context.Background(), cfg.Tracing); err != nil {
+		return err
+	}
+
+	denylists.Load(cfg.Storage.DenylistDir)
+
+	generations = watchdog.New("generation", time.Duration(cfg.Watchdog.GenerationSeconds)*time.Second)
+	go generations.Run(context.Background())
+
+	if cfg.Remote.Addr != "" {
+		if dialRemote == nil {
+			return errRemoteLeftOut
+		}
+		if err := dialRemote(cfg.Remote.Addr, cfg.Remote.Token); err != nil {
+			return fmt.Errorf("connecting to model server %s: %w", cfg.Remote.Addr, err)
+		}
+	}
+
+	return nil
+}
+
+// loadConfig reads the config file along with the secrets it names
+func loadConfig(configPath string) (config.Config, error) {
+	loaded, err := config.Load(configPath)
+	if err != nil {
+		return loaded, fmt.Errorf("loading config %s: %w", configPath, err)
+	}
+
+	if err := loaded.ResolveSecrets(context.Background()); err != nil {
+		return loaded, fmt.Errorf("loading config %s: %w", configPath, err)
+	}
+
+	return loaded, nil
+}
+
+func parseGuild(id string) (snowflake.ID, error) {
+	if id == "" {
+		return 0, errors.New("-guild is required")
+	}
+
+	return snowflake.Parse(id)
+}
+
+func cmdServe(args []string) error {
+	fs, configPath := newFlagSet("serve")
+	addrFlag := fs.String("addr", "", "address to serve the API on, overrides the config")
+	listenFlag := fs.String("listen", "", "address to serve the model service on, overrides the config")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	if *addrFlag != "" {
+		cfg.API.Addr = *addrFlag
+	}
+	if *listenFlag != "" {
+		cfg.Remote.Listen = *listenFlag
+	}
+	if cfg.API.Addr == "" && cfg.Remote.Listen == "" {
+		return errors.New("nothing to serve, set api.addr or remote.listen")
+	}
+	if cfg.API.Addr != "" && serveAPI == nil {
+		return errHTTPLeftOut
+	}
+	if cfg.Remote.Listen != "" && serveRemote == nil {
+		return errRemoteLeftOut
+	}
+
+	go denylists.Watch(cfg.Storage.DenylistDir)
+
+	store := brain.NewStore(brainOptions)
+	defer store.Flush(time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second)
+	go store.UnloadIdle(context.Background(), time.Duration(cfg.Storage.UnloadIdleMinutes)*time.Minute)
+	go store.UpkeepDaily(context.Background(), cfg.Storage.RebuildHour, time.Duration(cfg.Storage.RebuildDays)*24*time.Hour)
+
+	errs := make(chan error, 2)
+	if cfg.API.Addr != "" {
+		go func() {
+			errs <- serveAPI(store, cfg.API.Addr)
+		}()
+	}
+	if cfg.Remote.Listen != "" {
+		go func() {
+			errs <- serveRemote(store, cfg.Remote.Listen)
+		}()
+	}
+
+	s := make(chan os.Signal, 1)
+	signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-s:
+		slog.Info("Shutting down", slog.String("signal", sig.String()))
+		return nil
+	}
+}
+
+func cmdImport(args []string) error {
+	fs, configPath := newFlagSet("import")
+	guildFlag := fs.String("guild", "", "ID of the guild brain to train")
+	fileFlag := fs.String("file", "-", "file to import, - for stdin")
+	formatFlag := fs.String("format", "lines", "format of the file: "+strings.Join(corpus.Formats, ", "))
+	authorsFlag := fs.String("authors", "", "file of \"author = user id\" lines mapping export authors to users")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	guildID, err := parseGuild(*guildFlag)
+	if err != nil {
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	var source = "stdin"
+	if *fileFlag != "-" {
+		f, err := os.Open(*fileFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in, source = f, filepath.Base(*fileFlag)
+	}
+
+	records, err := corpus.Read(in, *formatFlag)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", source, err)
+	}
+
+	var authors = make(map[string]snowflake.ID)
+	if *authorsFlag != "" {
+		names, err := corpus.ReadAuthorMap(*authorsFlag)
+		if err != nil {
+			return err
+		}
+
+		for author, id := range names {
+			if authors[author], err = snowflake.Parse(id); err != nil {
+				return fmt.Errorf("invalid user id %q for author %q: %w", id, author, err)
+			}
+		}
+	}
+
+	schizo := brain.Load(guildID, brainOptions(guildID))
+	if err := schizo.TakeSnapshot(brain.SnapshotImport); err != nil {
+		return err
+	}
+
+	imp := schizo.ImportRecords(records, authors, brain.Import{Source: source, Format: *formatFlag, At: time.Now()}, progressPrinter(len(records)))
+
+	if err := schizo.Save(); err != nil {
+		return err
+	}
+	slog.Info("Imported text into brain", slog.Any("guildID", guildID), slog.String("format", imp.Format), slog.Int("messages", imp.Messages), slog.Int("skipped", imp.Skipped), slog.Int("duplicates", imp.Duplicates), slog.Int("authors", imp.Authors))
+
+	return nil
+}
+
+// progressPrinter reports progress through total records on stderr, at most
+// a few times a second
+func progressPrinter(total int) func(done int) {
+	var last time.Time
+
+	return func(done int) {
+		if done < total && time.Since(last) < 200*time.Millisecond {
+			return
+		}
+		last = time.Now()
+
+		fmt.Fprintf(os.Stderr, "\rimported %d/%d messages", done, total)
+		if done == total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+func cmdGenerate(args []string) error {
+	fs, configPath := newFlagSet("generate")
+	guildFlag := fs.String("guild", "", "ID of the guild brain to generate from")
+	seedFlag := fs.String("seed", "", "prompt to reply to")
+	lengthFlag := fs.Int("length", 512, "maximum number of tokens to generate")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	guildID, err := parseGuild(*guildFlag)
+	if err != nil {
+		return err
+	}
+
+	schizo := brain.Load(guildID, brainOptions(guildID))
+	fmt.Println(schizo.FilterOutput(func() string { return schizo.Reply(*seedFlag, *lengthFlag) }))
+
+	return nil
+}
+
+func cmdPerplexity(args []string) error {
+	fs, configPath := newFlagSet("perplexity")
+	guildFlag := fs.String("guild", "", "ID of the guild brain to score with")
+	inFlag := fs.String("in", "-", "file of messages to score, one per line, - for stdin")
+	userFlag := fs.String("user", "", "score against this user's model instead of the guild's")
+	smoothingFlag := fs.Float64("smoothing", -1, "additive smoothing to score with instead of the brain's own")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	guildID, err := parseGuild(*guildFlag)
+	if err != nil {
+		return err
+	}
+
+	var authorID snowflake.ID
+	if *userFlag != "" {
+		if authorID, err = snowflake.Parse(*userFlag); err != nil {
+			return err
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if *inFlag != "-" {
+		f, err := os.Open(*inFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	schizo, err := brain.Read(brain.Path(cfg.Storage.ModelsDir, guildID), brainOptions(guildID))
+	if err != nil {
+		return err
+	}
+	// the brain is never saved, so trying another smoothing leaves it alone
+	if *smoothingFlag >= 0 {
+		schizo.SetSmoothing(*smoothingFlag)
+	}
+
+	var total ngram.Score
+	var messages int
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		score, ok := schizo.Score(authorID, line)
+		if !ok {
+			return fmt.Errorf("nothing was learned from user %s", authorID)
+		}
+		total = total.Add(score)
+		messages++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("messages %d, tokens %d, zero probability %d\n", messages, total.Tokens, total.ZeroProbs)
+	fmt.Printf("log probability %.4f, perplexity %.4f\n", total.LogProb, total.Perplexity())
+
+	return nil
+}
+
+func cmdPurgeImports(args []string) error {
+	fs, configPath := newFlagSet("purge-imports")
+	guildFlag := fs.String("guild", "", "ID of the guild brain to purge")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	guildID, err := parseGuild(*guildFlag)
+	if err != nil {
+		return err
+	}
+
+	schizo := brain.Load(guildID, brainOptions(guildID))
+	if err := schizo.TakeSnapshot(brain.SnapshotPurgeImports); err != nil {
+		return err
+	}
+	purged := schizo.PurgeImports()
+	schizo.RecordAction(0, brain.AuditPurgeImports, fmt.Sprintf("%d messages", purged))
+
+	if err := schizo.Save(); err != nil {
+		return err
+	}
+	slog.Info("Purged imported history", slog.Any("guildID", guildID), slog.Int("messages", purged))
+
+	return nil
+}
+
+func cmdPrune(args []string) error {
+	fs, configPath := newFlagSet("prune")
+	guildFlag := fs.String("guild", "", "ID of the guild brain to prune")
+	kFlag := fs.Int("k", 2, "forget n-grams of the model's full order seen fewer than this many times")
+	fs.Parse(args)
+
+	if *kFlag < 2 {
+		return errors.New("-k must be at least 2")
+	}
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	guildID, err := parseGuild(*guildFlag)
+	if err != nil {
+		return err
+	}
+
+	schizo := brain.Load(guildID, brainOptions(guildID))
+	if err := schizo.TakeSnapshot(brain.SnapshotPrune); err != nil {
+		return err
+	}
+	pruned := schizo.Prune(*kFlag)
+	schizo.RecordAction(0, brain.AuditPrune, fmt.Sprintf("%d n-grams seen fewer than %d times", pruned, *kFlag))
+
+	if err := schizo.Save(); err != nil {
+		return err
+	}
+	slog.Info("Pruned rare n-grams", slog.Any("guildID", guildID), slog.Int("k", *kFlag), slog.Int("ngrams", pruned))
+
+	return nil
+}
+
+func cmdExport(args []string) error {
+	fs, configPath := newFlagSet("export")
+	guildFlag := fs.String("guild", "", "ID of the guild brain to export")
+	outFlag := fs.String("out", "-", "file to write the JSON to, - for stdout")
+	minCountFlag := fs.Int("min-count", 0, "leave out everything counted fewer times than this")
+	epsilonFlag := fs.Float64("epsilon", 0, "privacy budget of the Laplace noise added to every count, 0 for none, smaller is noisier")
+	fs.Parse(args)
+
+	if *epsilonFlag < 0 {
+		return errors.New("-epsilon must not be negative")
+	}
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	guildID, err := parseGuild(*guildFlag)
+	if err != nil {
+		return err
+	}
+
+	schizo, err := brain.Read(brain.Path(cfg.Storage.ModelsDir, guildID), brainOptions(guildID))
+	if err != nil {
+		return err
+	}
+
+	schizo.RecordAction(0, brain.AuditExport, fmt.Sprintf("min count %d, epsilon %g", *minCountFlag, *epsilonFlag))
+	if err := schizo.Save(); err != nil {
+		return err
+	}
+
+	// the stored brain was saved already, so privatizing the export leaves it
+	// alone
+	if *minCountFlag > 0 || *epsilonFlag > 0 {
+		schizo.Privatize(*minCountFlag, *epsilonFlag)
+	}
+
+	data, err := json.MarshalIndent(schizo, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if *outFlag == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	return os.WriteFile(*outFlag, data, 0644)
+}
+
+func cmdBundle(args []string) error {
+	fs, configPath := newFlagSet("bundle")
+	guildFlag := fs.String("guild", "", "ID of the guild brain to pack")
+	outFlag := fs.String("out", "", "file to write the bundle to, defaults to <guild>.bundle")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	guildID, err := parseGuild(*guildFlag)
+	if err != nil {
+		return err
+	}
+
+	if *outFlag == "" {
+		*outFlag = guildID.String() + ".bundle"
+	}
+
+	// the bundle is packed from the file, so the action is saved first to
+	// travel with it
+	schizo, err := brain.Read(brain.Path(cfg.Storage.ModelsDir, guildID), brainOptions(guildID))
+	if err != nil {
+		return err
+	}
+	schizo.RecordAction(0, brain.AuditBundle, *outFlag)
+	if err := schizo.Save(); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*outFlag)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bundle, err := brain.WriteBundle(f, brain.Path(cfg.Storage.ModelsDir, guildID))
+	if err != nil {
+		os.Remove(*outFlag)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	slog.Info("Bundled guild brain", slog.Any("guildID", guildID), slog.String("file", *outFlag), slog.String("backend", bundle.Backend), slog.Int("bytes", len(bundle.Brain)))
+
+	return nil
+}
+
+func cmdUnbundle(args []string) error {
+	fs, configPath := newFlagSet("unbundle")
+	inFlag := fs.String("in", "", "bundle file to restore")
+	guildFlag := fs.String("guild", "", "ID of the guild to restore the brain as, defaults to the one it was bundled from")
+	remapFlag := fs.Bool("remap", false, "allow restoring into another guild than the bundle's, dropping its channel state")
+	forceFlag := fs.Bool("force", false, "replace a brain the guild already has")
+	fs.Parse(args)
+
+	if *inFlag == "" {
+		return errors.New("-in is required")
+	}
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	f, err := os.Open(*inFlag)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bundle, err := brain.ReadBundle(f)
+	if err != nil {
+		return err
+	}
+
+	var guildID = bundle.GuildID
+	if *guildFlag != "" {
+		if guildID, err = parseGuild(*guildFlag); err != nil {
+			return err
+		}
+	}
+
+	fn := brain.Path(cfg.Storage.ModelsDir, guildID)
+	if _, err := os.Stat(fn); err == nil && !*forceFlag {
+		return fmt.Errorf("guild %s already has a brain at %s, pass -force to replace it", guildID, fn)
+	}
+
+	schizo, err := bundle.Unbundle(guildID, brainOptions(guildID), *remapFlag)
+	if err != nil {
+		return err
+	}
+	schizo.RecordAction(0, brain.AuditUnbundle, fmt.Sprintf("bundled from guild %s at %s", bundle.GuildID, bundle.ExportedAt.Format(time.RFC3339)))
+
+	if err := schizo.Save(); err != nil {
+		return err
+	}
+	slog.Info("Restored bundled guild brain", slog.Any("guildID", guildID), slog.Any("bundledFrom", bundle.GuildID), slog.Time("exportedAt", bundle.ExportedAt))
+
+	return nil
+}
+
+func cmdMigrate(args []string) error {
+	fs, configPath := newFlagSet("migrate")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(cfg.Storage.ModelsDir, "*.brain"))
+	if err != nil {
+		return err
+	}
+
+	for _, fn := range files {
+		guildID, err := snowflake.Parse(strings.TrimSuffix(filepath.Base(fn), ".brain"))
+		if err != nil {
+			slog.Error("Failed to migrate brain", slog.String("file", fn), slog.String("err", err.Error()))
+			continue
+		}
+
+		// skip unreadable brains instead of overwriting them with empty ones
+		schizo, err := brain.Read(fn, brainOptions(guildID))
+		if err != nil {
+			slog.Error("Failed to migrate brain", slog.String("file", fn), slog.String("err", err.Error()))
+			continue
+		}
+
+		if err := schizo.Save(); err != nil {
+			slog.Error("Failed to migrate brain", slog.String("file", fn), slog.String("err", err.Error()))
+		}
+	}
+
+	return nil
+}
+
+func cmdAudit(args []string) error {
+	fs, configPath := newFlagSet("audit")
+	guildFlag := fs.String("guild", "", "ID of the guild brain whose audit log to export")
+	outFlag := fs.String("out", "-", "file to write the log to, - for stdout")
+	verifyFlag := fs.String("verify", "", "exported log to verify instead of exporting one")
+	fs.Parse(args)
+
+	if *verifyFlag != "" {
+		f, err := os.Open(*verifyFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		entries, err := brain.ReadAudit(f)
+		if err != nil {
+			return err
+		}
+		if err := brain.VerifyAudit(entries); err != nil {
+			return err
+		}
+
+		var head string
+		if len(entries) > 0 {
+			head = entries[len(entries)-1].Hash
+		}
+		slog.Info("Audit log verified", slog.String("file", *verifyFlag), slog.Int("entries", len(entries)), slog.String("head", head))
+
+		return nil
+	}
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	guildID, err := parseGuild(*guildFlag)
+	if err != nil {
+		return err
+	}
+
+	schizo, err := brain.Read(brain.Path(cfg.Storage.ModelsDir, guildID), brainOptions(guildID))
+	if err != nil {
+		return err
+	}
+	schizo.RecordAction(0, brain.AuditExportLog, "")
+	if err := schizo.Save(); err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *outFlag != "-" {
+		f, err := os.Create(*outFlag)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	return brain.WriteAudit(out, schizo.AuditLog())
+}
@@ -0,0 +1,209 @@
+//go:build !no_discord
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/config"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/discordbot"
+	"github.com/schizoid/internal/logring"
+	"github.com/schizoid/pkg/brain"
+)
+
+// log records kept in memory for operators
+const logRingSize = 1000
+
+func init() {
+	registerFrontend(subcommand{"run", "connect to Discord and start learning (default)", cmdRun})
+}
+
+func cmdRun(args []string) error {
+	fs, configPath := newFlagSet("run")
+	tokenFlag := fs.String("token", "", "Discord bot token, overrides the config")
+	intervalFlag := fs.Int("train-interval", 0, "seconds between history crawls, overrides the config")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	if *tokenFlag != "" {
+		if err := cfg.SetSecret(context.Background(), "token", *tokenFlag); err != nil {
+			return err
+		}
+	}
+	if *intervalFlag > 0 {
+		cfg.TrainIntervalSeconds = *intervalFlag
+	}
+
+	// kept for /admin logs
+	logs := logring.New(slog.Default().Handler(), logRingSize)
+	slog.SetDefault(slog.New(logs))
+
+	// profiling is opt-in since it exposes process internals
+	if cfg.Debug.PprofAddr != "" {
+		go servePprof(cfg.Debug.PprofAddr)
+	}
+
+	// every bot keeps its brains apart, in a store of its own
+	var instances []config.Config
+	var names []string
+	if cfg.Token != "" || len(cfg.Bots) == 0 {
+		instances, names = append(instances, cfg), append(names, "")
+	}
+	for _, app := range cfg.Bots {
+		instances, names = append(instances, cfg.ForBot(app)), append(names, app.Name)
+	}
+
+	var stores []*brain.Store
+	for _, instance := range instances {
+		store := brain.NewStore(func(guildID snowflake.ID) brain.Options {
+			opts := brainOptions(guildID)
+			opts.Dir = instance.Storage.ModelsDir
+			return opts
+		})
+		go store.UnloadIdle(context.Background(), time.Duration(cfg.Storage.UnloadIdleMinutes)*time.Minute)
+		stores = append(stores, store)
+	}
+
+	// panics leave a bundle next to the brains for post-mortems
+	crash.SetDir(cfg.Storage.ModelsDir)
+	crash.AddSection("logs", func(w io.Writer) {
+		for _, record := range logs.Records(slog.LevelDebug, "") {
+			fmt.Fprintln(w, record)
+		}
+	})
+	crash.AddSection("brains", func(w io.Writer) {
+		for i, store := range stores {
+			for _, schizo := range store.All() {
+				fmt.Fprintf(w, "%s %s dirty=%t\n", instances[i].Storage.ModelsDir, schizo.GuildID, schizo.Dirty())
+			}
+		}
+	})
+
+	// the API serves the first bot's brains
+	if cfg.API.Addr != "" {
+		if serveAPI == nil {
+			return errHTTPLeftOut
+		}
+
+		go func() {
+			defer crash.Recover()
+
+			if err := serveAPI(stores[0], cfg.API.Addr); err != nil {
+				slog.Error("API server stopped", slog.String("err", err.Error()))
+			}
+		}()
+	}
+
+	var bots []*discordbot.Bot
+	for i, instance := range instances {
+		bots = append(bots, discordbot.New(instance, stores[i], denylists, logs))
+	}
+
+	// SIGHUP and /admin reload read the config file again, flags still
+	// overriding it
+	var reloadMu sync.Mutex
+	reload := func() error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		loaded, err := loadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		if *tokenFlag != "" {
+			if err := loaded.SetSecret(context.Background(), "token", *tokenFlag); err != nil {
+				return err
+			}
+		}
+		if *intervalFlag > 0 {
+			loaded.TrainIntervalSeconds = *intervalFlag
+		}
+
+		cfgMu.Lock()
+		cfg = loaded
+		cfgMu.Unlock()
+
+		for i, bot := range bots {
+			instance, ok := instanceConfig(loaded, names[i])
+			if !ok {
+				slog.Warn("Bot was removed from the config, it keeps running until restarted", slog.String("bot", names[i]))
+				continue
+			}
+			bot.Reconfigure(instance)
+		}
+
+		slog.Info("Reloaded config", slog.String("file", *configPath))
+		return nil
+	}
+	for _, bot := range bots {
+		bot.SetReload(reload)
+	}
+	go reloadOnHangup(reload)
+
+	if len(bots) == 1 {
+		return bots[0].Run()
+	}
+
+	// each bot shuts down on the same signal, a bot failing leaves the others
+	// running
+	var errs = make([]error, len(instances))
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer crash.Recover()
+
+			if errs[i] = bots[i].Run(); errs[i] != nil {
+				slog.Error("Bot stopped", slog.String("models", instance.Storage.ModelsDir), slog.String("err", errs[i].Error()))
+			}
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// instanceConfig is the config of the bot called name in cfg, the one of
+// the top-level token for an empty name, reporting false if there is none
+func instanceConfig(cfg config.Config, name string) (config.Config, bool) {
+	if name == "" {
+		return cfg, cfg.Token != "" || len(cfg.Bots) == 0
+	}
+
+	for _, app := range cfg.Bots {
+		if app.Name == name {
+			return cfg.ForBot(app), true
+		}
+	}
+
+	return config.Config{}, false
+}
+
+// reloadOnHangup calls reload whenever the process gets SIGHUP
+func reloadOnHangup(reload func() error) {
+	defer crash.Recover()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		if err := reload(); err != nil {
+			slog.Error("Failed to reload config, keeping the old one", slog.String("err", err.Error()))
+		}
+	}
+}
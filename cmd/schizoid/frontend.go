@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/schizoid/pkg/brain"
+)
+
+// Each platform registers its subcommand, and the HTTP API and model service
+// their servers, from a file of their own, so a build tag leaves them and
+// their dependencies out of the binary: no_discord, no_telegram, no_matrix,
+// no_irc, no_slack, no_http and no_remote.
+
+// frontends are the subcommands of the platforms built in
+var frontends []subcommand
+
+func registerFrontend(cmd subcommand) {
+	frontends = append(frontends, cmd)
+}
+
+// set by the HTTP API and the model service when built in, nil otherwise
+var (
+	serveAPI    func(store *brain.Store, addr string) error
+	serveRemote func(store *brain.Store, addr string) error
+	dialRemote  func(addr, token string) error
+)
+
+var (
+	errHTTPLeftOut   = errors.New("api.addr is set but schizoid was built without the HTTP API (no_http)")
+	errRemoteLeftOut = errors.New("remote is configured but schizoid was built without the model service (no_remote)")
+)
@@ -0,0 +1,60 @@
+//go:build !no_irc
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/irc"
+	"github.com/schizoid/pkg/brain"
+)
+
+func init() {
+	registerFrontend(subcommand{"irc", "connect to an IRC server and start learning", cmdIRC})
+}
+
+func cmdIRC(args []string) error {
+	fs, configPath := newFlagSet("irc")
+	serverFlag := fs.String("server", "", "host:port of the server, overrides the config")
+	nickFlag := fs.String("nick", "", "nick to use, overrides the config")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	if *serverFlag != "" {
+		cfg.IRC.Server = *serverFlag
+	}
+	if *nickFlag != "" {
+		cfg.IRC.Nick = *nickFlag
+	}
+	if cfg.IRC.Server == "" || cfg.IRC.Nick == "" {
+		return errors.New("no IRC server configured, set irc.server and irc.nick")
+	}
+	if len(cfg.IRC.Channels) == 0 {
+		return errors.New("no IRC channels configured, set irc.channels")
+	}
+
+	go denylists.Watch(cfg.Storage.DenylistDir)
+
+	store := brain.NewStore(func(channelID snowflake.ID) brain.Options {
+		opts := brainOptions(channelID)
+		opts.Dir = cfg.IRC.ModelsDir
+		return opts
+	})
+	defer store.Flush(time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second)
+	go store.UnloadIdle(context.Background(), time.Duration(cfg.Storage.UnloadIdleMinutes)*time.Minute)
+	go store.UpkeepDaily(context.Background(), cfg.Storage.RebuildHour, time.Duration(cfg.Storage.RebuildDays)*24*time.Hour)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	return irc.New(cfg.IRC, store).Run(ctx)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/config"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/pkg/brain"
+	"github.com/schizoid/pkg/denylist"
+	"github.com/schizoid/pkg/watchdog"
+)
+
+var (
+	cfg = config.Default()
+	// guards cfg once brains load in the background and the config can be
+	// reloaded
+	cfgMu     sync.RWMutex
+	denylists = denylist.NewPacks()
+	// set up with the config, nil until then
+	generations *watchdog.Watchdog
+	// flushes the spans not yet exported, set up with the config
+	stopTracing = func(context.Context) error { return nil }
+)
+
+// how long spans may take to be exported on exit
+const tracingFlushTimeout = 5 * time.Second
+
+// brainOptions derives how a guild's brain is created and stored from the
+// config, applying the guild's model overrides
+func brainOptions(guildID snowflake.ID) brain.Options {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+
+	model := cfg.Model.ForGuild(guildID.String())
+
+	return brain.Options{
+		Dir:                   cfg.Storage.ModelsDir,
+		Snapshots:             cfg.Storage.Snapshots,
+		Backend:               model.Backend,
+		Order:                 model.Order,
+		Smoothing:             model.Smoothing,
+		GoodTuring:            model.SmoothingMethod == config.SmoothingGoodTuring,
+		MaxEntries:            model.MaxEntries,
+		BudgetAction:          model.BudgetAction,
+		Candidates:            model.Candidates,
+		RepetitionPenalty:     model.RepetitionPenalty,
+		SentenceMinLength:     model.SentenceMinLength,
+		PerChannel:            model.PerChannel,
+		Interpolation:         model.Interpolation,
+		EstimateInterpolation: model.EstimateInterpolation,
+		ContextMessages:       model.ContextMessages,
+		Denylists:             denylists,
+		Generations:           generations,
+		ReplyCooldown:         time.Duration(cfg.ReplyCooldownSeconds) * time.Second,
+		SessionTimeout:        time.Duration(cfg.SessionTimeoutSeconds) * time.Second,
+		MessageLog:            cfg.Storage.MessageLog,
+		MessageLogRetention:   time.Duration(cfg.Storage.MessageLogDays) * 24 * time.Hour,
+		// Load already rejected invalid patterns
+		TrainFilters: cfg.Training.CompileFilters(),
+	}
+}
+
+func main() {
+	defer crash.Recover()
+
+	err := runCLI(os.Args[1:])
+
+	ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	if err := stopTracing(ctx); err != nil {
+		slog.Error("Failed to export spans", slog.String("err", err.Error()))
+	}
+	cancel()
+
+	if err != nil {
+		slog.Error("schizoid failed", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+}
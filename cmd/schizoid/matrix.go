@@ -0,0 +1,59 @@
+//go:build !no_matrix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/matrix"
+	"github.com/schizoid/pkg/brain"
+)
+
+func init() {
+	registerFrontend(subcommand{"matrix", "connect to Matrix and start learning", cmdMatrix})
+}
+
+func cmdMatrix(args []string) error {
+	fs, configPath := newFlagSet("matrix")
+	homeserverFlag := fs.String("homeserver", "", "homeserver URL, overrides the config")
+	tokenFlag := fs.String("token", "", "access token, overrides the config")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	if *homeserverFlag != "" {
+		cfg.Matrix.Homeserver = *homeserverFlag
+	}
+	if *tokenFlag != "" {
+		if err := cfg.SetSecret(context.Background(), "matrix.token", *tokenFlag); err != nil {
+			return err
+		}
+	}
+	if cfg.Matrix.Homeserver == "" || cfg.Matrix.Token == "" {
+		return errors.New("no Matrix account configured, set matrix.homeserver and matrix.token")
+	}
+
+	go denylists.Watch(cfg.Storage.DenylistDir)
+
+	store := brain.NewStore(func(roomID snowflake.ID) brain.Options {
+		opts := brainOptions(roomID)
+		opts.Dir = cfg.Matrix.ModelsDir
+		return opts
+	})
+	defer store.Flush(time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second)
+	go store.UnloadIdle(context.Background(), time.Duration(cfg.Storage.UnloadIdleMinutes)*time.Minute)
+	go store.UpkeepDaily(context.Background(), cfg.Storage.RebuildHour, time.Duration(cfg.Storage.RebuildDays)*24*time.Hour)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	return matrix.New(cfg.Matrix.Homeserver, cfg.Matrix.Token, store).Run(ctx)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+)
+
+// servePprof exposes the runtime profiler and expvars on addr so operators
+// can inspect memory growth, CPU usage and counters of live instances
+func servePprof(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	slog.Info("Serving pprof", slog.String("addr", addr))
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		slog.Error("pprof server stopped", slog.String("err", err.Error()))
+	}
+}
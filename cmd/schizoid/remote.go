@@ -0,0 +1,34 @@
+//go:build !no_remote
+
+package main
+
+import (
+	"github.com/schizoid/internal/remote"
+	"github.com/schizoid/pkg/brain"
+)
+
+func init() {
+	serveRemote = func(store *brain.Store, addr string) error {
+		return remote.NewServer(store, cfg.Remote.Token, remoteSecurity()).ListenAndServe(addr)
+	}
+
+	// generation goes through the model server once it is registered
+	dialRemote = func(addr, token string) error {
+		client, err := remote.Dial(addr, token, remoteSecurity())
+		if err != nil {
+			return err
+		}
+		client.Register()
+
+		return nil
+	}
+}
+
+func remoteSecurity() remote.Security {
+	return remote.Security{
+		Insecure: cfg.Remote.Insecure,
+		CertFile: cfg.Remote.CertFile,
+		KeyFile:  cfg.Remote.KeyFile,
+		CAFile:   cfg.Remote.CAFile,
+	}
+}
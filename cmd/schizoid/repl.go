@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/brain"
+	"github.com/schizoid/pkg/corpus"
+)
+
+const replHelp = `type a message to get a reply, or a command:
+  :train <text>    learn a line
+  :load <file>     learn every line of a text file
+  :gen [seed]      continue seed as is, without the reply logic
+  :length <n>      most tokens to generate, currently %d
+  :stats           describe the model
+  :save            save the brain, if it has a file
+  :help            show this
+  :quit            leave, saving first if the brain has a file
+`
+
+func cmdRepl(args []string) error {
+	fs, configPath := newFlagSet("repl")
+	guildFlag := fs.String("guild", "", "ID of a stored guild brain to open")
+	fileFlag := fs.String("file", "", "brain file to open or create, instead of a guild's")
+	trainFlag := fs.String("train", "", "text file to learn before starting, one message per line")
+	orderFlag := fs.Int("order", 0, "order of a newly created model, overrides the config")
+	smoothingFlag := fs.Float64("smoothing", 0, "smoothing of a newly created model, overrides the config")
+	backendFlag := fs.String("backend", "", "generation backend of a newly created brain, overrides the config")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	var guildID snowflake.ID
+	if *guildFlag != "" {
+		var err error
+		if guildID, err = snowflake.Parse(*guildFlag); err != nil {
+			return err
+		}
+	}
+
+	opts := brainOptions(guildID)
+	opts.File = *fileFlag
+	if *orderFlag > 0 {
+		opts.Order = *orderFlag
+	}
+	if *smoothingFlag > 0 {
+		opts.Smoothing = *smoothingFlag
+	}
+	if *backendFlag != "" {
+		opts.Backend = *backendFlag
+	}
+
+	// without a guild or file the brain is a scratchpad that is never saved
+	var saved = guildID != 0 || opts.File != ""
+
+	var schizo *brain.Brain
+	if saved {
+		schizo = brain.Load(guildID, opts)
+	} else {
+		schizo = brain.New(0, opts)
+	}
+
+	r := &repl{brain: schizo, saved: saved, length: 256}
+
+	if *trainFlag != "" {
+		if err := r.load(*trainFlag); err != nil {
+			return err
+		}
+	}
+
+	return r.run(os.Stdin, os.Stdout)
+}
+
+type repl struct {
+	brain  *brain.Brain
+	saved  bool
+	length int
+}
+
+func (r *repl) run(in io.Reader, out io.Writer) error {
+	fmt.Fprintf(out, replHelp, r.length)
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			break
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, ":") {
+			reply := r.brain.FilterOutput(func() string { return r.brain.Reply(line, r.length) })
+			fmt.Fprintf(out, "%s\n  (confidence %.2f)\n", reply, r.brain.Confidence(reply))
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line[1:], " ")
+		arg = strings.TrimSpace(arg)
+
+		switch command {
+		case "train":
+			if r.learn(arg) {
+				fmt.Fprintln(out, "learned")
+			} else {
+				fmt.Fprintln(out, "skipped, the text is denied or filtered")
+			}
+		case "load":
+			if err := r.load(arg); err != nil {
+				fmt.Fprintln(out, err)
+			}
+		case "gen":
+			fmt.Fprintln(out, r.brain.FilterOutput(func() string { return r.brain.Generate(arg, r.length) }))
+		case "length":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				fmt.Fprintln(out, "length must be a positive number")
+				continue
+			}
+			r.length = n
+		case "stats":
+			r.stats(out)
+		case "save":
+			r.save(out)
+		case "help":
+			fmt.Fprintf(out, replHelp, r.length)
+		case "quit", "exit":
+			r.save(out)
+			return nil
+		default:
+			fmt.Fprintf(out, "unknown command :%s, try :help\n", command)
+		}
+	}
+
+	r.save(out)
+	return scanner.Err()
+}
+
+// learn trains the brain on a line from outside any guild, so it counts as
+// imported history like text from the train command
+func (r *repl) learn(text string) bool {
+	if text == "" || !r.brain.AllowsText(text) {
+		return false
+	}
+
+	return r.brain.TrainImported(0, text) == nil
+}
+
+func (r *repl) load(fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	records, err := corpus.Read(f, "lines")
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", fn, err)
+	}
+
+	var learned, skipped int
+	for _, record := range records {
+		if r.learn(record.Text) {
+			learned++
+		} else {
+			skipped++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "learned %d lines from %s, skipped %d\n", learned, fn, skipped)
+	return nil
+}
+
+func (r *repl) stats(out io.Writer) {
+	model := r.brain.Model
+
+	fmt.Fprintf(out, "backend %s, order %d, smoothing %g\n", r.brain.Backend, model.N, model.Smoothing)
+	organic, imported := model.Sizes()
+	total, importedTotal := model.Totals()
+	fmt.Fprintf(out, "%d n-grams over %d tokens learned here, %d over %d tokens imported\n", organic, total, imported, importedTotal)
+	fmt.Fprintf(out, "vocabulary of %d tokens\n", model.Tokenizer.VocabSize())
+	fmt.Fprintf(out, "%d authors, %d entities\n", len(r.brain.Authors), len(r.brain.Entities()))
+}
+
+func (r *repl) save(out io.Writer) {
+	if !r.saved || !r.brain.Dirty() {
+		return
+	}
+
+	if err := r.brain.Save(); err != nil {
+		fmt.Fprintln(out, "failed to save:", err)
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !no_slack
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/slack"
+	"github.com/schizoid/pkg/brain"
+)
+
+func init() {
+	registerFrontend(subcommand{"slack", "serve a Slack app and start learning", cmdSlack})
+}
+
+func cmdSlack(args []string) error {
+	fs, configPath := newFlagSet("slack")
+	addrFlag := fs.String("addr", "", "address to serve the Events API endpoint on, overrides the config")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	if *addrFlag != "" {
+		cfg.Slack.Addr = *addrFlag
+	}
+	if cfg.Slack.SigningSecret == "" {
+		return errors.New("no Slack signing secret configured, set slack.signing_secret")
+	}
+	if cfg.Slack.Token == "" && len(cfg.Slack.Tokens) == 0 {
+		return errors.New("no Slack bot token configured, set slack.token")
+	}
+
+	go denylists.Watch(cfg.Storage.DenylistDir)
+
+	store := brain.NewStore(func(teamID snowflake.ID) brain.Options {
+		opts := brainOptions(teamID)
+		opts.Dir = cfg.Slack.ModelsDir
+		return opts
+	})
+	defer store.Flush(time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second)
+	go store.UnloadIdle(context.Background(), time.Duration(cfg.Storage.UnloadIdleMinutes)*time.Minute)
+	go store.UpkeepDaily(context.Background(), cfg.Storage.RebuildHour, time.Duration(cfg.Storage.RebuildDays)*24*time.Hour)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	return slack.New(cfg.Slack, store).Run(ctx)
+}
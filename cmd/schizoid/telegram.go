@@ -0,0 +1,55 @@
+//go:build !no_telegram
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/telegram"
+	"github.com/schizoid/pkg/brain"
+)
+
+func init() {
+	registerFrontend(subcommand{"telegram", "connect to Telegram and start learning", cmdTelegram})
+}
+
+func cmdTelegram(args []string) error {
+	fs, configPath := newFlagSet("telegram")
+	tokenFlag := fs.String("token", "", "Telegram bot token, overrides the config")
+	fs.Parse(args)
+
+	if err := setup(*configPath); err != nil {
+		return err
+	}
+
+	if *tokenFlag != "" {
+		if err := cfg.SetSecret(context.Background(), "telegram.token", *tokenFlag); err != nil {
+			return err
+		}
+	}
+	if cfg.Telegram.Token == "" {
+		return errors.New("no Telegram token configured, set telegram.token or -token")
+	}
+
+	go denylists.Watch(cfg.Storage.DenylistDir)
+
+	store := brain.NewStore(func(chatID snowflake.ID) brain.Options {
+		opts := brainOptions(chatID)
+		opts.Dir = cfg.Telegram.ModelsDir
+		return opts
+	})
+	defer store.Flush(time.Duration(cfg.ShutdownTimeoutSeconds) * time.Second)
+	go store.UnloadIdle(context.Background(), time.Duration(cfg.Storage.UnloadIdleMinutes)*time.Minute)
+	go store.UpkeepDaily(context.Background(), cfg.Storage.RebuildHour, time.Duration(cfg.Storage.RebuildDays)*24*time.Hour)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	return telegram.New(cfg.Telegram.Token, store).Run(ctx)
+}
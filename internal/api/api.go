@@ -0,0 +1,189 @@
+// Package api serves guild brains over HTTP so other services can train and
+// generate without going through Discord. Generations can also be streamed as
+// server-sent events, for UIs that show text while it is sampled.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/brain"
+)
+
+// requests larger than this are rejected
+const maxBodyBytes = 1 << 20
+
+const (
+	defaultLength = 512
+	maxLength     = 2048
+)
+
+// Server exposes the brains of a store over HTTP.
+type Server struct {
+	brains *brain.Store
+	// bearer token every request must carry, empty to allow anyone
+	token string
+}
+
+// New creates a server for the brains in store.
+func New(store *brain.Store, token string) *Server {
+	return &Server{brains: store, token: token}
+}
+
+// Handler routes the API's endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /guilds/{id}/generate", s.handleGenerate)
+	mux.HandleFunc("POST /guilds/{id}/train", s.handleTrain)
+	mux.HandleFunc("GET /guilds/{id}/stream", s.handleStream)
+	mux.HandleFunc("GET /guilds/{id}/widget", s.handleWidget)
+
+	return s.authorize(mux)
+}
+
+// ListenAndServe serves the API on addr until it fails.
+func (s *Server) ListenAndServe(addr string) error {
+	if s.token == "" {
+		slog.Warn("API has no token, anyone who can reach it can train and generate", slog.String("addr", addr))
+	}
+
+	slog.Info("Serving API", slog.String("addr", addr))
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			// browsers can't set headers on EventSource requests
+			if !ok && r.URL.Query().Has("token") {
+				token, ok = r.URL.Query().Get("token"), true
+			}
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type generateRequest struct {
+	Prompt string `json:"prompt"`
+	Length int    `json:"length"`
+}
+
+type generateResponse struct {
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence"`
+}
+
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	schizo, ok := s.guildBrain(w, r)
+	if !ok {
+		return
+	}
+
+	var req generateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	if req.Length <= 0 {
+		req.Length = defaultLength
+	}
+	req.Length = min(req.Length, maxLength)
+
+	text := schizo.FilterOutput(func() string { return schizo.Reply(req.Prompt, req.Length) })
+
+	writeJSON(w, http.StatusOK, generateResponse{
+		Text:       text,
+		Confidence: schizo.Confidence(text),
+	})
+}
+
+type trainRequest struct {
+	Text  string   `json:"text"`
+	Lines []string `json:"lines"`
+}
+
+type trainResponse struct {
+	Trained int `json:"trained"`
+	Skipped int `json:"skipped"`
+}
+
+func (s *Server) handleTrain(w http.ResponseWriter, r *http.Request) {
+	schizo, ok := s.guildBrain(w, r)
+	if !ok {
+		return
+	}
+
+	var req trainRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	var resp trainResponse
+	for _, line := range append(req.Lines, req.Text) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// the same denylist applies as to messages from Discord
+		if !schizo.AllowsText(line) {
+			resp.Skipped++
+			continue
+		}
+
+		// text from outside the guild counts as imported history
+		if schizo.TrainImported(0, line) != nil {
+			resp.Skipped++
+			continue
+		}
+		resp.Trained++
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) guildBrain(w http.ResponseWriter, r *http.Request) (*brain.Brain, bool) {
+	guildID, err := snowflake.Parse(r.PathValue("id"))
+	if err != nil || guildID == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid guild id"))
+		return nil, false
+	}
+
+	return s.brains.Get(guildID), true
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write API response", slog.String("err", err.Error()))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
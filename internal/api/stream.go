@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/denylist"
+)
+
+type tokenEvent struct {
+	Text string `json:"text"`
+}
+
+// handleStream streams a reply to the prompt query parameter as server-sent
+// events: a token event for every piece of censored text, then a done event
+// holding the whole reply like the generate endpoint returns it. With a
+// persona query parameter the reply impersonates that member instead.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	schizo, ok := s.guildBrain(w, r)
+	if !ok {
+		return
+	}
+
+	var length = defaultLength
+	if v := r.URL.Query().Get("length"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid length"))
+			return
+		}
+		length = min(n, maxLength)
+	}
+
+	var prompt = strings.TrimSpace(r.URL.Query().Get("prompt"))
+	var generate = func(emit func(string) bool) {
+		schizo.Stream(prompt, length, emit)
+	}
+
+	// impersonations can't be streamed, they arrive in one piece
+	if v := r.URL.Query().Get("persona"); v != "" {
+		personaID, err := snowflake.Parse(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid persona"))
+			return
+		}
+
+		text, ok := schizo.Impersonate(personaID, prompt, length)
+		if !ok || schizo.IsOptedOut(personaID) {
+			writeError(w, http.StatusNotFound, errors.New("nothing has been learned from persona"))
+			return
+		}
+
+		text = strings.TrimSpace(strings.TrimPrefix(text, prompt))
+		generate = func(emit func(string) bool) {
+			emit(text)
+		}
+	}
+
+	// pieces are buffered so a slow client never holds up the brain, which
+	// stays locked while generating
+	pieces := make(chan string, length+1)
+	go func() {
+		defer close(pieces)
+
+		generate(func(piece string) bool {
+			if r.Context().Err() != nil {
+				return false
+			}
+
+			pieces <- piece
+			return true
+		})
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	var rc = http.NewResponseController(w)
+	var censor = denylist.NewStream(schizo.OutputTerms())
+	var text strings.Builder
+
+	var send = func(event string, v any) bool {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return false
+		}
+
+		if err := rc.Flush(); err != nil {
+			slog.Error("Failed to flush event stream", slog.String("err", err.Error()))
+			return false
+		}
+
+		return true
+	}
+
+	var sendText = func(piece string) bool {
+		if piece == "" {
+			return true
+		}
+
+		text.WriteString(piece)
+		return send("token", tokenEvent{piece})
+	}
+
+	for piece := range pieces {
+		// the generator notices the request is gone by itself
+		if !sendText(censor.Write(piece)) {
+			return
+		}
+	}
+
+	if !sendText(censor.Flush()) {
+		return
+	}
+
+	send("done", generateResponse{
+		Text:       text.String(),
+		Confidence: schizo.Confidence(text.String()),
+	})
+}
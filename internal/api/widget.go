@@ -0,0 +1,27 @@
+package api
+
+import (
+	_ "embed"
+	"log/slog"
+	"net/http"
+)
+
+// widgetPage shows generations as they stream in, for streamers to add as a
+// browser source in OBS. It takes the stream endpoint's query parameters,
+// plus interval, the seconds between generations.
+//
+//go:embed widget.html
+var widgetPage []byte
+
+func (s *Server) handleWidget(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.guildBrain(w, r); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if _, err := w.Write(widgetPage); err != nil {
+		slog.Error("Failed to write widget", slog.String("err", err.Error()))
+	}
+}
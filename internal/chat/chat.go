@@ -0,0 +1,129 @@
+// Package chat is the platform-independent part of a chat frontend: learning
+// from incoming messages, replying when addressed and forgetting deleted
+// messages. Each platform adapter turns its events into Incoming messages and
+// provides an Outbox to answer through.
+package chat
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/internal/tracing"
+	"github.com/schizoid/pkg/brain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	gatewayLog = logging.For(logging.Gateway)
+	tracer     = otel.Tracer("github.com/schizoid/internal/chat")
+)
+
+// ReplyLength is the most tokens a reply is generated with.
+const ReplyLength = 512
+
+// Incoming is a message arriving from a platform.
+type Incoming struct {
+	brain.Message
+	// whether the message is addressed to the bot, e.g. by mentioning it
+	Addressed bool
+	// the message with the bot's mention removed, what a reply continues
+	Prompt string
+}
+
+// HashID maps a platform's string ID of a channel, user or message onto a
+// snowflake, which is what brains key everything by.
+func HashID(id string) snowflake.ID {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return snowflake.ID(h.Sum64())
+}
+
+// Outbox posts back to the platform a message came from.
+type Outbox interface {
+	// Send posts text in a channel.
+	Send(channelID snowflake.ID, text string) error
+	// React adds an emoji reaction to a message.
+	React(channelID, messageID snowflake.ID, emoji string) error
+}
+
+// HandleMessage learns msg and, when it is addressed to the bot, replies in
+// its channel. Replies the brain isn't confident in are replaced by the
+// guild's low-confidence reaction or dropped. Both are traced as part of ctx.
+func HandleMessage(ctx context.Context, schizo *brain.Brain, msg Incoming, out Outbox) {
+	Learn(ctx, schizo, msg)
+	Reply(ctx, schizo, msg, out)
+}
+
+// Learn is the part of HandleMessage learning msg. Messages have to be learned
+// in the order they were sent, replies can be generated in any order.
+func Learn(ctx context.Context, schizo *brain.Brain, msg Incoming) {
+	if msg.Bot {
+		return
+	}
+
+	schizo.ObserveContext(ctx, msg.Message)
+}
+
+// Reply is the part of HandleMessage replying to msg when it is addressed to
+// the bot.
+func Reply(ctx context.Context, schizo *brain.Brain, msg Incoming, out Outbox) {
+	if msg.Bot || !msg.Addressed || (msg.NSFW && !schizo.GuildSettings().AllowNSFW) {
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "chat.Reply", trace.WithAttributes(tracing.Guild(schizo.GuildID), tracing.Channel(msg.ChannelID)))
+	defer span.End()
+
+	// however often the bot is mentioned, a channel only gets a reply per
+	// cooldown
+	if !schizo.ReplyTurn(msg.ChannelID, time.Now()) {
+		return
+	}
+
+	length := schizo.ChannelSettings(msg.ChannelID).ReplyLength(ReplyLength)
+	reply := schizo.FilterOutput(func() string { return schizo.ConverseContext(ctx, msg.Message, msg.Prompt, length) })
+	if reply == "" {
+		return
+	}
+
+	// stay quiet rather than post gibberish
+	settings := schizo.GuildSettings()
+	if schizo.Confidence(reply) < settings.ConfidenceThreshold {
+		if settings.LowConfidenceReaction != "" {
+			if err := out.React(msg.ChannelID, msg.ID, settings.LowConfidenceReaction); err != nil {
+				gatewayLog.Error("Failed to react", slog.Any("guildID", schizo.GuildID), slog.String("channelID", msg.ChannelID.String()), slog.String("err", err.Error()))
+			}
+		}
+		return
+	}
+
+	_, sending := tracer.Start(ctx, "chat.Send")
+	err := out.Send(msg.ChannelID, reply)
+	sending.End()
+	if err != nil {
+		gatewayLog.Error("Failed to send reply", slog.Any("guildID", schizo.GuildID), slog.String("channelID", msg.ChannelID.String()), slog.String("err", err.Error()))
+		return
+	}
+	schizo.Replied(msg.Message, reply)
+}
+
+// HandleDelete forgets a deleted message.
+func HandleDelete(schizo *brain.Brain, msg brain.Message) {
+	if msg.Bot {
+		return
+	}
+
+	schizo.Forget(msg)
+
+	gatewayLog.Info(
+		"Message was deleted and forgotten",
+		slog.String("messageID", msg.ID.String()),
+		slog.String("channelID", msg.ChannelID.String()),
+		slog.Any("guildID", schizo.GuildID),
+	)
+}
@@ -0,0 +1,894 @@
+// Package config holds schizoid's settings, read from a TOML file with
+// environment overrides.
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/schizoid/internal/secrets"
+)
+
+// Model configures the models of new brains.
+type Model struct {
+	// generation backend registered with textmodel
+	Backend   string  `toml:"backend"`
+	Order     int     `toml:"order"`
+	Smoothing float64 `toml:"smoothing"`
+	// SmoothingAdditive, or SmoothingGoodTuring to discount rare counts
+	// instead
+	SmoothingMethod string `toml:"smoothing_method"`
+	// n-gram counts a brain keeps before its rarest are pruned, 0 for no
+	// limit
+	MaxEntries int `toml:"max_entries"`
+	// what a brain does once it keeps MaxEntries counts: BudgetPrune,
+	// BudgetStop or BudgetDecay
+	BudgetAction string `toml:"budget_action"`
+	// replies generated per reply, the best of which is posted, 1 to post
+	// the only one
+	Candidates int `toml:"candidates"`
+	// what sampling divides a token's probability by for every time it
+	// would repeat what was just generated, 1 for no penalty
+	RepetitionPenalty float64 `toml:"repetition_penalty"`
+	// tokens generated before a reply ends with the sentence it is in, 0 to
+	// run on to the end of text or the length
+	SentenceMinLength int `toml:"sentence_min_length"`
+	// weights of orders 1 to Order mixed into predictions, empty to only
+	// use the highest order seen
+	Interpolation []float64 `toml:"interpolation"`
+	// work the interpolation weights out from a brain's counts when it
+	// loads instead
+	EstimateInterpolation bool `toml:"estimate_interpolation"`
+	// channel messages before the one replied to that replies follow too, 0
+	// to only answer that one
+	ContextMessages int `toml:"context_messages"`
+	// give every channel a model of its own to reply from, so channels
+	// don't talk like each other
+	PerChannel bool `toml:"per_channel"`
+	// per-guild overrides keyed by guild ID, only the values set apply
+	Guilds map[string]Model `toml:"guilds"`
+}
+
+// Smoothing methods of the n-gram model.
+const (
+	SmoothingAdditive   = "additive"
+	SmoothingGoodTuring = "good-turing"
+)
+
+// Formats log records are written in.
+const (
+	LogText = "text"
+	LogJSON = "json"
+)
+
+// What a brain does once it keeps as many counts as its budget allows.
+const (
+	// prune the rarest n-grams, the longest first
+	BudgetPrune = "prune"
+	// stop learning until counts are freed
+	BudgetStop = "stop"
+	// halve every count, so older data fades out in favor of newer
+	BudgetDecay = "decay"
+)
+
+// ForGuild applies a guild's overrides, if any.
+func (m Model) ForGuild(guildID string) Model {
+	out := m
+	out.Guilds = nil
+
+	override, ok := m.Guilds[guildID]
+	if !ok {
+		return out
+	}
+
+	if override.Backend != "" {
+		out.Backend = override.Backend
+	}
+	if override.Order > 0 {
+		out.Order = override.Order
+	}
+	if override.Smoothing > 0 {
+		out.Smoothing = override.Smoothing
+	}
+	if override.SmoothingMethod != "" {
+		out.SmoothingMethod = override.SmoothingMethod
+	}
+	if override.MaxEntries > 0 {
+		out.MaxEntries = override.MaxEntries
+	}
+	if override.BudgetAction != "" {
+		out.BudgetAction = override.BudgetAction
+	}
+	if override.Candidates > 0 {
+		out.Candidates = override.Candidates
+	}
+	if override.ContextMessages > 0 {
+		out.ContextMessages = override.ContextMessages
+	}
+	if override.PerChannel {
+		out.PerChannel = true
+	}
+	if override.RepetitionPenalty > 0 {
+		out.RepetitionPenalty = override.RepetitionPenalty
+	}
+	if override.SentenceMinLength > 0 {
+		out.SentenceMinLength = override.SentenceMinLength
+	}
+	if len(override.Interpolation) > 0 {
+		out.Interpolation = override.Interpolation
+	}
+	if override.EstimateInterpolation {
+		out.EstimateInterpolation = true
+	}
+
+	return out
+}
+
+// Storage locates brains and denylist packs on disk.
+type Storage struct {
+	ModelsDir   string `toml:"models_dir"`
+	DenylistDir string `toml:"denylist_dir"`
+	// brains unused for this long are saved and unloaded until needed
+	// again, 0 to keep them loaded
+	UnloadIdleMinutes int `toml:"unload_idle_minutes"`
+	// snapshots kept per brain from before imports, prunes and purges,
+	// which /rollback restores; 0 to take none
+	Snapshots int `toml:"snapshots"`
+	// keep the messages each brain learns from in a log next to it for
+	// MessageLogDays, so it can be rebuilt from them every RebuildDays, at
+	// RebuildHour UTC; 0 days never rebuilds
+	MessageLog     bool `toml:"message_log"`
+	MessageLogDays int  `toml:"message_log_days"`
+	RebuildDays    int  `toml:"rebuild_days"`
+	RebuildHour    int  `toml:"rebuild_hour"`
+}
+
+// Bot is a further Discord application run by the same process, sharing
+// everything but the token and its brains, like a premium instance next to
+// the free one.
+type Bot struct {
+	// tells the bot apart in logs and names its brains' directory
+	Name  string `toml:"name"`
+	Token string `toml:"token"`
+	// where its brains are kept, a directory named after it in the models
+	// directory if empty
+	ModelsDir string `toml:"models_dir"`
+}
+
+// ForBot returns the config a further bot runs with: this one, with the
+// bot's token and brains.
+func (cfg Config) ForBot(bot Bot) Config {
+	out := cfg
+	out.Token = bot.Token
+	out.Bots = nil
+
+	out.Storage.ModelsDir = bot.ModelsDir
+	if out.Storage.ModelsDir == "" {
+		out.Storage.ModelsDir = filepath.Join(cfg.Storage.ModelsDir, bot.Name)
+	}
+
+	out.refs = maps.Clone(cfg.refs)
+	delete(out.refs, "token")
+	if ref, ok := cfg.refs["bots."+bot.Name+".token"]; ok {
+		out.refs["token"] = ref
+	}
+
+	return out
+}
+
+// Sharding configures running across several gateway shards.
+type Sharding struct {
+	Enabled bool `toml:"enabled"`
+	// 0 uses the shard count recommended by Discord
+	Count int `toml:"count"`
+	// shards run by this process, empty for all of them
+	IDs         []int `toml:"ids"`
+	AutoScaling bool  `toml:"auto_scaling"`
+}
+
+// API configures the HTTP API.
+type API struct {
+	// address to listen on, empty to not serve the API
+	Addr string `toml:"addr"`
+	// bearer token requests must carry, empty to allow anyone
+	Token string `toml:"token"`
+}
+
+// Remote configures running models in a separate process.
+type Remote struct {
+	// address serve hosts the model service on, empty to not host it
+	Listen string `toml:"listen"`
+	// model server that brains with the "remote" backend use
+	Addr string `toml:"addr"`
+	// token the model server requires, empty for none
+	Token string `toml:"token"`
+	// serve and dial in plain text, e.g. on a private network
+	Insecure bool `toml:"insecure"`
+	// certificate and key the model server presents, required unless
+	// insecure
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+	// CA clients verify the model server's certificate with, empty for the
+	// system's
+	CAFile string `toml:"ca_file"`
+}
+
+// Telegram configures the Telegram frontend.
+type Telegram struct {
+	Token string `toml:"token"`
+	// brains of Telegram chats are kept apart from guild brains
+	ModelsDir string `toml:"models_dir"`
+}
+
+// Matrix configures the Matrix frontend.
+type Matrix struct {
+	Homeserver string `toml:"homeserver"`
+	// access token of the bot's account
+	Token string `toml:"token"`
+	// brains of Matrix rooms are kept apart from guild brains
+	ModelsDir string `toml:"models_dir"`
+}
+
+// IRC configures the IRC frontend.
+type IRC struct {
+	// host:port of the server
+	Server   string   `toml:"server"`
+	TLS      bool     `toml:"tls"`
+	Nick     string   `toml:"nick"`
+	Password string   `toml:"password"`
+	Channels []string `toml:"channels"`
+	// brains of IRC channels are kept apart from guild brains
+	ModelsDir string `toml:"models_dir"`
+}
+
+// Slack configures the Slack frontend.
+type Slack struct {
+	// address to serve the Events API endpoint on
+	Addr          string `toml:"addr"`
+	SigningSecret string `toml:"signing_secret"`
+	// bot token of workspaces not listed in Tokens
+	Token string `toml:"token"`
+	// bot tokens by workspace ID, for apps installed in several workspaces
+	Tokens map[string]string `toml:"tokens"`
+	// brains of Slack workspaces are kept apart from guild brains
+	ModelsDir string `toml:"models_dir"`
+}
+
+// Training configures what every brain learns.
+type Training struct {
+	// regular expressions of messages never learned, like other bots'
+	// command prefixes
+	Filters []string `toml:"filters"`
+}
+
+// Jobs configures the queue of background work: crawling history, imports,
+// unlearning members and pruning.
+type Jobs struct {
+	// jobs run at once across every guild
+	Workers int `toml:"workers"`
+	// runs a failing job gets before it is dropped
+	MaxAttempts int `toml:"max_attempts"`
+}
+
+// CompileFilters compiles the training filters, leaving out invalid ones.
+func (t Training) CompileFilters() []*regexp.Regexp {
+	var filters []*regexp.Regexp
+	for _, pattern := range t.Filters {
+		if re, err := regexp.Compile(pattern); err == nil {
+			filters = append(filters, re)
+		}
+	}
+
+	return filters
+}
+
+// Watchdog configures how long work may go without progress before it is
+// cancelled, zero to never cancel it.
+type Watchdog struct {
+	// a page of channel history being crawled
+	CrawlSeconds int `toml:"crawl_seconds"`
+	// a message being generated, from start to end
+	GenerationSeconds int `toml:"generation_seconds"`
+}
+
+// Features switches on the parts of the Discord bot that need more gateway
+// intents, some of them privileged, so minimal deployments ask for as little
+// as they can. Learning and replying are on unless InteractionOnly is set.
+type Features struct {
+	// go without the privileged message content intent: nothing is learned
+	// from or said in channels, only /feed, imports and slash commands work
+	InteractionOnly bool `toml:"interaction_only"`
+	// 👍 and 👎 on the bot's messages reinforce or decay what it said, and
+	// a guild's /trigger emoji has it reply
+	Reactions bool `toml:"reactions"`
+	// privileged, it has to be enabled for the application as well
+	Members         bool `toml:"members"`
+	ScheduledEvents bool `toml:"scheduled_events"`
+	Voice           bool `toml:"voice"`
+}
+
+// Premium reserves parts of the Discord bot for guilds subscribed to the
+// application through Discord's monetization. Without SKUs every guild gets
+// everything.
+type Premium struct {
+	// SKUs whose guild subscription makes a guild premium
+	SKUs []string `toml:"skus"`
+	// slash commands only premium guilds may use
+	Commands []string `toml:"commands"`
+	// most tokens /say, /ask and /impersonate generate in other guilds, 0
+	// for no limit
+	FreeReplyLength int `toml:"free_reply_length"`
+}
+
+// Voice configures speaking generated text in voice channels, which needs
+// the voice feature as well.
+type Voice struct {
+	// shell command turning the text on its stdin into Ogg Opus on its
+	// stdout, 48kHz with 20ms frames; empty to never speak
+	TTSCommand string `toml:"tts_command"`
+	// average time between lines spoken in a voice channel
+	IntervalSeconds int `toml:"interval_seconds"`
+}
+
+// CatchUp configures backfilling the messages sent while the bot was
+// offline.
+type CatchUp struct {
+	// history requests spent catching up, across every guild, 0 to skip
+	// catching up
+	RequestsPerMinute int `toml:"requests_per_minute"`
+}
+
+// RateLimit configures how many replies a single member can ask for, across
+// every guild, however they ask.
+type RateLimit struct {
+	// replies a member can get in a row
+	Burst int `toml:"burst"`
+	// replies a member is allowed more every minute, 0 for no limit
+	PerMinute float64 `toml:"per_minute"`
+}
+
+// Secrets configures settings that name a secret kept elsewhere, see package
+// secrets.
+type Secrets struct {
+	// how often secrets are looked up again to notice rotation, 0 to only
+	// look them up on startup
+	RefreshSeconds int `toml:"refresh_seconds"`
+}
+
+// Log configures what is logged and how, see package logging.
+type Log struct {
+	// least severe level logged: debug, info, warn or error
+	Level string `toml:"level"`
+	// LogText or LogJSON
+	Format string `toml:"format"`
+	// levels of single subsystems instead of Level, by subsystem: gateway,
+	// brain, model or storage
+	Subsystems map[string]string `toml:"subsystems"`
+}
+
+// Tracing configures exporting spans of the message pipeline over OTLP.
+type Tracing struct {
+	// host:port of the OTLP gRPC collector, empty to trace nothing
+	Endpoint string `toml:"endpoint"`
+	// send spans in plain text, e.g. to a collector on localhost
+	Insecure bool `toml:"insecure"`
+	// share of traces kept, from 0 to 1
+	SampleRatio float64 `toml:"sample_ratio"`
+}
+
+// Debug holds opt-in diagnostics.
+type Debug struct {
+	PprofAddr string `toml:"pprof_addr"`
+}
+
+// Config is the complete set of settings.
+type Config struct {
+	Token                  string `toml:"token"`
+	TrainIntervalSeconds   int    `toml:"train_interval_seconds"`
+	ShutdownTimeoutSeconds int    `toml:"shutdown_timeout_seconds"`
+	// least time between replies in a channel, however often the bot is
+	// mentioned, unless the channel sets its own
+	ReplyCooldownSeconds int `toml:"reply_cooldown_seconds"`
+	// how long a member has to follow up on a reply for the next one to
+	// carry on from it, 0 for never
+	SessionTimeoutSeconds int `toml:"session_timeout_seconds"`
+	// Discord user IDs allowed to use the /admin commands
+	Operators []string `toml:"operators"`
+
+	Model     Model     `toml:"model"`
+	Storage   Storage   `toml:"storage"`
+	Training  Training  `toml:"training"`
+	Jobs      Jobs      `toml:"jobs"`
+	Watchdog  Watchdog  `toml:"watchdog"`
+	CatchUp   CatchUp   `toml:"catch_up"`
+	RateLimit RateLimit `toml:"rate_limit"`
+	Features  Features  `toml:"features"`
+	Premium   Premium   `toml:"premium"`
+	Voice     Voice     `toml:"voice"`
+	Sharding  Sharding  `toml:"sharding"`
+	API       API       `toml:"api"`
+	Remote    Remote    `toml:"remote"`
+	Telegram  Telegram  `toml:"telegram"`
+	Matrix    Matrix    `toml:"matrix"`
+	IRC       IRC       `toml:"irc"`
+	Slack     Slack     `toml:"slack"`
+	Secrets   Secrets   `toml:"secrets"`
+	Log       Log       `toml:"log"`
+	Tracing   Tracing   `toml:"tracing"`
+	Debug     Debug     `toml:"debug"`
+	// further Discord applications run next to the one of Token
+	Bots []Bot `toml:"bots"`
+
+	// secret references of the settings resolved by ResolveSecrets, by key
+	refs map[string]string
+}
+
+// Default returns the settings used for anything the file and environment
+// leave unset.
+func Default() Config {
+	return Config{
+		TrainIntervalSeconds:   60,
+		ShutdownTimeoutSeconds: 30,
+		SessionTimeoutSeconds:  300,
+		Model: Model{
+			Backend:         "ngram",
+			Order:           5,
+			Smoothing:       0,
+			SmoothingMethod: SmoothingAdditive,
+			BudgetAction:    BudgetPrune,
+			Candidates:      3,
+			ContextMessages: 4,
+			// enough to break out of "hahahaha" within a few repeats
+			RepetitionPenalty: 1.5,
+			SentenceMinLength: 40,
+		},
+		Storage: Storage{
+			ModelsDir:      "models",
+			DenylistDir:    "denylists",
+			Snapshots:      5,
+			MessageLogDays: 90,
+			RebuildDays:    7,
+			RebuildHour:    4,
+		},
+		Jobs: Jobs{
+			Workers:     4,
+			MaxAttempts: 5,
+		},
+		Watchdog: Watchdog{
+			CrawlSeconds:      300,
+			GenerationSeconds: 30,
+		},
+		CatchUp: CatchUp{
+			RequestsPerMinute: 30,
+		},
+		RateLimit: RateLimit{
+			Burst:     5,
+			PerMinute: 6,
+		},
+		Voice: Voice{
+			IntervalSeconds: 45,
+		},
+		Telegram: Telegram{
+			ModelsDir: "models/telegram",
+		},
+		Matrix: Matrix{
+			ModelsDir: "models/matrix",
+		},
+		IRC: IRC{
+			TLS:       true,
+			Nick:      "schizoid",
+			ModelsDir: "models/irc",
+		},
+		Slack: Slack{
+			Addr:      ":3000",
+			ModelsDir: "models/slack",
+		},
+		Secrets: Secrets{
+			RefreshSeconds: 300,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: LogText,
+		},
+		Tracing: Tracing{
+			SampleRatio: 1,
+		},
+	}
+}
+
+// Load reads the config file at path on top of the defaults, then applies
+// environment overrides. A missing file is not an error.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if _, err := toml.DecodeFile(path, &cfg); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return cfg, err
+	}
+
+	cfg.applyEnv()
+
+	for _, pattern := range cfg.Training.Filters {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return cfg, fmt.Errorf("training filter %q: %w", pattern, err)
+		}
+	}
+
+	for _, model := range append([]Model{cfg.Model}, slices.Collect(maps.Values(cfg.Model.Guilds))...) {
+		switch model.SmoothingMethod {
+		case "", SmoothingAdditive, SmoothingGoodTuring:
+		default:
+			return cfg, fmt.Errorf("unknown smoothing method %q", model.SmoothingMethod)
+		}
+
+		switch model.BudgetAction {
+		case "", BudgetPrune, BudgetStop, BudgetDecay:
+		default:
+			return cfg, fmt.Errorf("unknown budget action %q", model.BudgetAction)
+		}
+	}
+
+	for _, level := range append([]string{cfg.Log.Level}, slices.Collect(maps.Values(cfg.Log.Subsystems))...) {
+		if err := new(slog.Level).UnmarshalText([]byte(level)); err != nil {
+			return cfg, fmt.Errorf("log level %q: %w", level, err)
+		}
+	}
+
+	switch cfg.Log.Format {
+	case LogText, LogJSON:
+	default:
+		return cfg, fmt.Errorf("unknown log format %q", cfg.Log.Format)
+	}
+
+	if cfg.Storage.Snapshots < 0 {
+		return cfg, fmt.Errorf("snapshots must not be negative, not %d", cfg.Storage.Snapshots)
+	}
+
+	if cfg.Storage.MessageLogDays < 1 || cfg.Storage.RebuildDays < 0 {
+		return cfg, fmt.Errorf("message log days must be positive and rebuild days not negative, not %d and %d", cfg.Storage.MessageLogDays, cfg.Storage.RebuildDays)
+	}
+
+	if cfg.Storage.RebuildHour < 0 || cfg.Storage.RebuildHour > 23 {
+		return cfg, fmt.Errorf("rebuild hour %d is not between 0 and 23", cfg.Storage.RebuildHour)
+	}
+
+	if cfg.Remote.Listen != "" && !cfg.Remote.Insecure && (cfg.Remote.CertFile == "" || cfg.Remote.KeyFile == "") {
+		return cfg, errors.New("serving models needs remote.cert_file and remote.key_file, or remote.insecure")
+	}
+
+	if cfg.Jobs.Workers < 1 || cfg.Jobs.MaxAttempts < 1 {
+		return cfg, fmt.Errorf("jobs need at least one worker and attempt, not %d and %d", cfg.Jobs.Workers, cfg.Jobs.MaxAttempts)
+	}
+
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		return cfg, fmt.Errorf("tracing sample ratio %v is not between 0 and 1", cfg.Tracing.SampleRatio)
+	}
+
+	for _, sku := range cfg.Premium.SKUs {
+		if _, err := strconv.ParseUint(sku, 10, 64); err != nil {
+			return cfg, fmt.Errorf("premium SKU %q is not an ID", sku)
+		}
+	}
+
+	var names = make(map[string]bool)
+	for _, bot := range cfg.Bots {
+		if bot.Name == "" {
+			return cfg, errors.New("every bot needs a name")
+		}
+		if names[bot.Name] {
+			return cfg, fmt.Errorf("bot %q is configured twice", bot.Name)
+		}
+		names[bot.Name] = true
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) applyEnv() {
+	envString("DISCORD_TOKEN", &cfg.Token)
+	envInt("TRAIN_INTERVAL_SECONDS", &cfg.TrainIntervalSeconds)
+	envInt("SHUTDOWN_TIMEOUT_SECONDS", &cfg.ShutdownTimeoutSeconds)
+	envInt("REPLY_COOLDOWN_SECONDS", &cfg.ReplyCooldownSeconds)
+	envInt("SESSION_TIMEOUT_SECONDS", &cfg.SessionTimeoutSeconds)
+	envStrings("OPERATORS", &cfg.Operators)
+	envString("MODEL_BACKEND", &cfg.Model.Backend)
+	envInt("MODEL_ORDER", &cfg.Model.Order)
+	envFloat("MODEL_SMOOTHING", &cfg.Model.Smoothing)
+	envString("MODEL_SMOOTHING_METHOD", &cfg.Model.SmoothingMethod)
+	envInt("MODEL_MAX_ENTRIES", &cfg.Model.MaxEntries)
+	envString("MODEL_BUDGET_ACTION", &cfg.Model.BudgetAction)
+	envInt("MODEL_CANDIDATES", &cfg.Model.Candidates)
+	envInt("MODEL_CONTEXT_MESSAGES", &cfg.Model.ContextMessages)
+	envBool("MODEL_PER_CHANNEL", &cfg.Model.PerChannel)
+	envFloat("MODEL_REPETITION_PENALTY", &cfg.Model.RepetitionPenalty)
+	envInt("MODEL_SENTENCE_MIN_LENGTH", &cfg.Model.SentenceMinLength)
+	envFloats("MODEL_INTERPOLATION", &cfg.Model.Interpolation)
+	envBool("MODEL_ESTIMATE_INTERPOLATION", &cfg.Model.EstimateInterpolation)
+	envString("MODELS_DIR", &cfg.Storage.ModelsDir)
+	envString("DENYLIST_DIR", &cfg.Storage.DenylistDir)
+	envInt("UNLOAD_IDLE_MINUTES", &cfg.Storage.UnloadIdleMinutes)
+	envInt("SNAPSHOTS", &cfg.Storage.Snapshots)
+	envBool("MESSAGE_LOG", &cfg.Storage.MessageLog)
+	envInt("MESSAGE_LOG_DAYS", &cfg.Storage.MessageLogDays)
+	envInt("REBUILD_DAYS", &cfg.Storage.RebuildDays)
+	envInt("REBUILD_HOUR", &cfg.Storage.RebuildHour)
+	envInt("JOBS_WORKERS", &cfg.Jobs.Workers)
+	envInt("JOBS_MAX_ATTEMPTS", &cfg.Jobs.MaxAttempts)
+	envInt("WATCHDOG_CRAWL_SECONDS", &cfg.Watchdog.CrawlSeconds)
+	envInt("WATCHDOG_GENERATION_SECONDS", &cfg.Watchdog.GenerationSeconds)
+	envInt("CATCH_UP_REQUESTS_PER_MINUTE", &cfg.CatchUp.RequestsPerMinute)
+	envInt("RATE_LIMIT_BURST", &cfg.RateLimit.Burst)
+	envFloat("RATE_LIMIT_PER_MINUTE", &cfg.RateLimit.PerMinute)
+	envBool("FEATURE_INTERACTION_ONLY", &cfg.Features.InteractionOnly)
+	envBool("FEATURE_REACTIONS", &cfg.Features.Reactions)
+	envBool("FEATURE_MEMBERS", &cfg.Features.Members)
+	envBool("FEATURE_SCHEDULED_EVENTS", &cfg.Features.ScheduledEvents)
+	envBool("FEATURE_VOICE", &cfg.Features.Voice)
+	envStrings("PREMIUM_SKUS", &cfg.Premium.SKUs)
+	envStrings("PREMIUM_COMMANDS", &cfg.Premium.Commands)
+	envInt("PREMIUM_FREE_REPLY_LENGTH", &cfg.Premium.FreeReplyLength)
+	envString("VOICE_TTS_COMMAND", &cfg.Voice.TTSCommand)
+	envInt("VOICE_INTERVAL_SECONDS", &cfg.Voice.IntervalSeconds)
+	envBool("SHARDING_ENABLED", &cfg.Sharding.Enabled)
+	envInt("SHARD_COUNT", &cfg.Sharding.Count)
+	envInts("SHARD_IDS", &cfg.Sharding.IDs)
+	envBool("SHARD_AUTO_SCALING", &cfg.Sharding.AutoScaling)
+	envString("API_ADDR", &cfg.API.Addr)
+	envString("API_TOKEN", &cfg.API.Token)
+	envString("REMOTE_LISTEN", &cfg.Remote.Listen)
+	envString("REMOTE_ADDR", &cfg.Remote.Addr)
+	envString("REMOTE_TOKEN", &cfg.Remote.Token)
+	envBool("REMOTE_INSECURE", &cfg.Remote.Insecure)
+	envString("REMOTE_CERT_FILE", &cfg.Remote.CertFile)
+	envString("REMOTE_KEY_FILE", &cfg.Remote.KeyFile)
+	envString("REMOTE_CA_FILE", &cfg.Remote.CAFile)
+	envString("TELEGRAM_TOKEN", &cfg.Telegram.Token)
+	envString("TELEGRAM_MODELS_DIR", &cfg.Telegram.ModelsDir)
+	envString("MATRIX_HOMESERVER", &cfg.Matrix.Homeserver)
+	envString("MATRIX_TOKEN", &cfg.Matrix.Token)
+	envString("MATRIX_MODELS_DIR", &cfg.Matrix.ModelsDir)
+	envString("IRC_SERVER", &cfg.IRC.Server)
+	envBool("IRC_TLS", &cfg.IRC.TLS)
+	envString("IRC_NICK", &cfg.IRC.Nick)
+	envString("IRC_PASSWORD", &cfg.IRC.Password)
+	envStrings("IRC_CHANNELS", &cfg.IRC.Channels)
+	envString("IRC_MODELS_DIR", &cfg.IRC.ModelsDir)
+	envString("SLACK_ADDR", &cfg.Slack.Addr)
+	envString("SLACK_SIGNING_SECRET", &cfg.Slack.SigningSecret)
+	envString("SLACK_TOKEN", &cfg.Slack.Token)
+	envString("SLACK_MODELS_DIR", &cfg.Slack.ModelsDir)
+	envInt("SECRETS_REFRESH_SECONDS", &cfg.Secrets.RefreshSeconds)
+	envString("LOG_LEVEL", &cfg.Log.Level)
+	envString("LOG_FORMAT", &cfg.Log.Format)
+	envString("TRACING_ENDPOINT", &cfg.Tracing.Endpoint)
+	envBool("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	envFloat("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+	envString("PPROF_ADDR", &cfg.Debug.PprofAddr)
+}
+
+// secrets lists the settings holding credentials by key, the ones that may
+// name a secret kept elsewhere. Slack's per-workspace tokens are resolved
+// apart, map values can't be pointed to.
+func (cfg *Config) secrets() map[string]*string {
+	return map[string]*string{
+		"token":                &cfg.Token,
+		"api.token":            &cfg.API.Token,
+		"remote.token":         &cfg.Remote.Token,
+		"telegram.token":       &cfg.Telegram.Token,
+		"matrix.token":         &cfg.Matrix.Token,
+		"irc.password":         &cfg.IRC.Password,
+		"slack.signing_secret": &cfg.Slack.SigningSecret,
+		"slack.token":          &cfg.Slack.Token,
+	}
+}
+
+// ResolveSecrets replaces every credential naming a secret kept elsewhere
+// with the secret, remembering the reference for SecretRef.
+func (cfg *Config) ResolveSecrets(ctx context.Context) error {
+	cfg.refs = make(map[string]string)
+
+	var resolve = func(key, value string) (string, error) {
+		if !secrets.IsReference(value) {
+			return value, nil
+		}
+
+		secret, err := secrets.Resolve(ctx, value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		cfg.refs[key] = value
+
+		return secret, nil
+	}
+
+	for key, field := range cfg.secrets() {
+		secret, err := resolve(key, *field)
+		if err != nil {
+			return err
+		}
+		*field = secret
+	}
+
+	// a copy, the config may share the map with another
+	tokens := make(map[string]string, len(cfg.Slack.Tokens))
+	for workspace, token := range cfg.Slack.Tokens {
+		secret, err := resolve("slack.tokens."+workspace, token)
+		if err != nil {
+			return err
+		}
+		tokens[workspace] = secret
+	}
+	if cfg.Slack.Tokens != nil {
+		cfg.Slack.Tokens = tokens
+	}
+
+	cfg.Bots = slices.Clone(cfg.Bots)
+	for i, bot := range cfg.Bots {
+		secret, err := resolve("bots."+bot.Name+".token", bot.Token)
+		if err != nil {
+			return err
+		}
+		cfg.Bots[i].Token = secret
+	}
+
+	return nil
+}
+
+// SetSecret sets the credential at key, a key ResolveSecrets resolves, to
+// value, looking it up if it names a secret kept elsewhere.
+func (cfg *Config) SetSecret(ctx context.Context, key, value string) error {
+	field, ok := cfg.secrets()[key]
+	if !ok {
+		return fmt.Errorf("%s is not a credential", key)
+	}
+
+	secret, err := secrets.Resolve(ctx, value)
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	if cfg.refs == nil {
+		cfg.refs = make(map[string]string)
+	}
+	if secrets.IsReference(value) {
+		cfg.refs[key] = value
+	} else {
+		delete(cfg.refs, key)
+	}
+	*field = secret
+
+	return nil
+}
+
+// SecretRef returns the secret reference the setting at key was resolved
+// from, false when the setting held the secret itself.
+func (cfg Config) SecretRef(key string) (string, bool) {
+	ref, ok := cfg.refs[key]
+	return ref, ok
+}
+
+func envString(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = v
+	}
+}
+
+func envInt(key string, dst *int) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Error("Ignoring invalid environment override", slog.String("key", key), slog.String("err", err.Error()))
+		return
+	}
+
+	*dst = n
+}
+
+func envBool(key string, dst *bool) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Error("Ignoring invalid environment override", slog.String("key", key), slog.String("err", err.Error()))
+		return
+	}
+
+	*dst = b
+}
+
+// envInts reads a comma separated list of integers
+func envInts(key string, dst *[]int) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	var ints []int
+	for _, field := range strings.Split(v, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			slog.Error("Ignoring invalid environment override", slog.String("key", key), slog.String("err", err.Error()))
+			return
+		}
+		ints = append(ints, n)
+	}
+
+	*dst = ints
+}
+
+// envStrings reads a comma separated list
+func envStrings(key string, dst *[]string) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	var fields []string
+	for _, field := range strings.Split(v, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	*dst = fields
+}
+
+// envFloats reads a comma separated list of numbers
+func envFloats(key string, dst *[]float64) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	var floats []float64
+	for _, field := range strings.Split(v, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			slog.Error("Ignoring invalid environment override", slog.String("key", key), slog.String("err", err.Error()))
+			return
+		}
+		floats = append(floats, f)
+	}
+
+	*dst = floats
+}
+
+func envFloat(key string, dst *float64) {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		slog.Error("Ignoring invalid environment override", slog.String("key", key), slog.String("err", err.Error()))
+		return
+	}
+
+	*dst = f
+}
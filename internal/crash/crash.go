@@ -0,0 +1,137 @@
+// Package crash writes a bundle describing the process when it panics, so
+// crashes in the field can be debugged after the fact.
+package crash
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// how long a section may take to write, in case it waits on a lock the
+// panicking code left held
+const sectionTimeout = 5 * time.Second
+
+type section struct {
+	name  string
+	write func(w io.Writer)
+}
+
+var (
+	mu       sync.Mutex
+	dir      string
+	sections []section
+)
+
+// SetDir makes panics write crash bundles to dir. Until it is called they
+// aren't written.
+func SetDir(d string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	dir = d
+}
+
+// AddSection includes what write writes in every crash bundle, under name.
+func AddSection(name string, write func(w io.Writer)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	sections = append(sections, section{name, write})
+}
+
+// Recover writes a crash bundle if the goroutine is panicking and then
+// panics again with the same value. It has to be deferred directly, at the
+// top of every goroutine whose panics should leave a bundle.
+func Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if fn, err := Write(r); err != nil {
+		slog.Error("Failed to write crash bundle", slog.String("err", err.Error()))
+	} else if fn != "" {
+		slog.Error("Wrote crash bundle", slog.String("file", fn))
+	}
+
+	panic(r)
+}
+
+// Write writes a crash bundle for the panic value v and returns its file
+// name, which is empty when no directory was set.
+func Write(v any) (string, error) {
+	// taken first so the stacks show the goroutines as the panic left them
+	var stacks = goroutines()
+
+	mu.Lock()
+	var d, extra = dir, sections
+	mu.Unlock()
+
+	if d == "" {
+		return "", nil
+	}
+
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return "", err
+	}
+
+	fn := filepath.Join(d, "crash-"+time.Now().Format("20060102-150405")+".txt")
+	f, err := os.Create(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fmt.Fprintf(f, "== panic ==\n%v\n\n== goroutines ==\n%s\n", v, stacks)
+
+	for _, s := range extra {
+		fmt.Fprintf(f, "\n== %s ==\n", s.name)
+		writeSection(f, s)
+	}
+
+	return fn, f.Close()
+}
+
+// goroutines dumps the stack of every goroutine
+func goroutines() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// writeSection writes a section, giving up on it if it panics as well or
+// takes too long
+func writeSection(w io.Writer, s section) {
+	var buf bytes.Buffer
+	var done = make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Fprintf(&buf, "\n(section failed: %v)\n", r)
+			}
+		}()
+
+		s.write(&buf)
+	}()
+
+	select {
+	case <-done:
+		w.Write(buf.Bytes())
+	case <-time.After(sectionTimeout):
+		fmt.Fprintf(w, "(section timed out after %s)\n", sectionTimeout)
+	}
+}
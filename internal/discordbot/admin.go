@@ -0,0 +1,210 @@
+package discordbot
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/internal/logring"
+)
+
+// log records shown per page of /admin logs
+const logsPerPage = 10
+
+// longer log lines are cut so a page fits in an embed
+const maxLogLine = 300
+
+func logLevelChoices() []discord.ApplicationCommandOptionChoiceString {
+	var choices []discord.ApplicationCommandOptionChoiceString
+	for _, level := range []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError} {
+		choices = append(choices, discord.ApplicationCommandOptionChoiceString{
+			Name:  strings.ToLower(level.String()),
+			Value: level.String(),
+		})
+	}
+
+	return choices
+}
+
+// isOperator reports whether a user runs this deployment, as opposed to
+// administering a guild
+func (b *Bot) isOperator(userID snowflake.ID) bool {
+	return slices.Contains(b.config.Load().Operators, userID.String())
+}
+
+func (b *Bot) handleAdminLogs(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !b.isOperator(e.User().ID) {
+		return e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(i18n.T(interactionLocale(e), "common.operators_only")).
+			SetEphemeral(true).
+			Build(),
+		)
+	}
+
+	var level = slog.LevelInfo
+	if name, ok := data.OptString("level"); ok {
+		level.UnmarshalText([]byte(name))
+	}
+
+	var guild = "0"
+	if id, ok := data.OptString("guild"); ok {
+		if _, err := snowflake.Parse(id); err != nil {
+			return e.CreateMessage(discord.NewMessageCreateBuilder().
+				SetContent(i18n.T(interactionLocale(e), "admin.bad_guild", id)).
+				SetEphemeral(true).
+				Build(),
+			)
+		}
+		guild = id
+	}
+
+	// pages stop at the newest record now, so paging doesn't shift as
+	// more come in
+	var until uint64
+	if records := b.logs.Records(slog.LevelDebug, ""); len(records) > 0 {
+		until = records[len(records)-1].Seq
+	}
+
+	page := b.logsPage(interactionLocale(e), level, guild, until, 0)
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetEmbeds(page.embed).
+		AddActionRow(page.buttons...).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleAdminReload(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	locale := interactionLocale(e)
+
+	var content = i18n.T(locale, "admin.reloaded")
+	if !b.isOperator(e.User().ID) {
+		content = i18n.T(locale, "common.operators_only")
+	} else if b.reload == nil {
+		content = i18n.T(locale, "admin.cannot_reload")
+	} else if err := b.reload(); err != nil {
+		content = i18n.T(locale, "admin.reload_failed", err)
+	} else {
+		gatewayLog.Info("Reloaded config", slog.String("by", e.User().ID.String()))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleAdminLogsPage(data discord.ButtonInteractionData, e *handler.ComponentEvent) error {
+	if !b.isOperator(e.User().ID) {
+		return e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(i18n.T(interactionLocale(e), "common.operators_only")).
+			SetEphemeral(true).
+			Build(),
+		)
+	}
+
+	level, _ := strconv.Atoi(e.Vars["level"])
+	until, _ := strconv.ParseUint(e.Vars["until"], 10, 64)
+	index, _ := strconv.Atoi(e.Vars["page"])
+
+	page := b.logsPage(interactionLocale(e), slog.Level(level), e.Vars["guild"], until, index)
+
+	if err := e.UpdateMessage(discord.NewMessageUpdateBuilder().
+		SetEmbeds(page.embed).
+		ClearContainerComponents().
+		AddActionRow(page.buttons...).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+type logsPage struct {
+	embed   discord.Embed
+	buttons []discord.InteractiveComponent
+}
+
+// logsPage renders the index-th page of records in locale, counting back
+// from the newest one up to until. A guild of 0 shows records of every guild.
+func (b *Bot) logsPage(locale string, level slog.Level, guild string, until uint64, index int) logsPage {
+	var filter = guild
+	if filter == "0" {
+		filter = ""
+	}
+
+	records := slices.DeleteFunc(b.logs.Records(level, filter), func(r logring.Entry) bool { return r.Seq > until })
+	pages := max(1, (len(records)+logsPerPage-1)/logsPerPage)
+	index = min(max(index, 0), pages-1)
+
+	// newest first
+	slices.Reverse(records)
+	records = records[min(index*logsPerPage, len(records)):min((index+1)*logsPerPage, len(records))]
+
+	var lines []string
+	for _, record := range records {
+		lines = append(lines, formatLogLine(record))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, i18n.T(locale, "admin.logs_none"))
+	}
+
+	var scope = i18n.T(locale, "admin.logs_all")
+	if filter != "" {
+		scope = i18n.T(locale, "admin.logs_guild", filter)
+	}
+
+	var customID = func(page int) string {
+		return fmt.Sprintf("/admin/logs/%d/%s/%d/%d", level, guild, until, page)
+	}
+
+	return logsPage{
+		embed: discord.NewEmbedBuilder().
+			SetTitle(i18n.T(locale, "admin.logs_title")).
+			SetDescription(strings.Join(lines, "\n")).
+			SetFooterText(i18n.T(locale, "admin.logs_footer", index+1, pages, level, scope)).
+			Build(),
+		buttons: []discord.InteractiveComponent{
+			discord.NewSecondaryButton(i18n.T(locale, "admin.logs_newer"), customID(index-1)).WithDisabled(index == 0),
+			discord.NewSecondaryButton(i18n.T(locale, "admin.logs_older"), customID(index+1)).WithDisabled(index >= pages-1),
+		},
+	}
+}
+
+func formatLogLine(record logring.Entry) string {
+	line := fmt.Sprintf("`%s` **%s** %s", record.Time.Format("01-02 15:04:05"), record.Level, record.Message)
+	if record.Attrs != "" {
+		line += " `" + strings.ReplaceAll(record.Attrs, "`", "'") + "`"
+	}
+
+	if utf8.RuneCountInString(line) > maxLogLine {
+		line = string([]rune(line)[:maxLogLine-1]) + "…"
+		// keep a cut off code span from swallowing the next line
+		if strings.Count(line, "`")%2 == 1 {
+			line += "`"
+		}
+	}
+
+	return line
+}
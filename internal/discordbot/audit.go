@@ -0,0 +1,53 @@
+package discordbot
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// handleAudit hands server managers the audit log as a file they can verify
+// with the audit command, along with its newest hash to compare later exports
+// against
+func (b *Bot) handleAudit(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	member := e.Member()
+	if member == nil || !member.Permissions.Has(discord.PermissionManageGuild) {
+		return e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(i18n.T(interactionLocale(e), "common.manage_guild_audit")).
+			SetEphemeral(true).
+			Build(),
+		)
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	head := schizo.RecordAction(e.User().ID, brain.AuditExportLog, "")
+	entries := schizo.AuditLog()
+
+	var buffer bytes.Buffer
+	if err := brain.WriteAudit(&buffer, entries); err != nil {
+		return err
+	}
+
+	locale := interactionLocale(e)
+	var content = i18n.T(locale, "audit.exported", len(entries), head.Hash)
+	if err := brain.VerifyAudit(entries); err != nil {
+		content += "\n" + i18n.T(locale, "audit.unverified", err)
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		AddFile(fmt.Sprintf("audit-%s.jsonl", e.GuildID()), "schizoid audit log", &buffer).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
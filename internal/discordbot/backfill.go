@@ -0,0 +1,75 @@
+package discordbot
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// backfillLine describes how far back a watched channel was learned, how many
+// messages are left and how fast they are coming in
+func (b *Bot) backfillLine(locale string, schizo *brain.Brain, channelID snowflake.ID) string {
+	var channel = discord.ChannelMention(channelID)
+
+	var span = schizo.Span(channelID)
+	if span == nil {
+		return i18n.T(locale, "backfillstatus.waiting", channel)
+	}
+
+	var created = channelID.Time()
+	var remaining = span.Start.Sub(created)
+	if span.Crawled || remaining <= time.Minute {
+		return i18n.T(locale, "backfillstatus.done", channel)
+	}
+
+	reached := discord.FormattedTimestampMention(span.Start.Unix(), discord.TimestampStyleShortDate)
+	covered := time.Since(span.Start).Seconds() / time.Since(created).Seconds() * 100
+
+	perMinute, eta, ok := b.crawlRates.rate(channelID, remaining)
+	messages, _ := b.crawlRates.backlog(channelID, remaining)
+	if !ok {
+		return i18n.T(locale, "backfillstatus.measuring", channel, reached, covered)
+	}
+
+	// Discord words the estimate in the reader's language
+	done := discord.FormattedTimestampMention(time.Now().Add(eta).Unix(), discord.TimestampStyleRelative)
+	return i18n.T(locale, "backfillstatus.progress", channel, reached, covered, messages, perMinute, done)
+}
+
+func (b *Bot) handleBackfillStatus(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	locale := interactionLocale(e)
+
+	var channels = schizo.Watched()
+	slices.Sort(channels)
+
+	var sb strings.Builder
+	sb.WriteString(i18n.T(locale, "backfillstatus.title") + "\n")
+
+	if len(channels) == 0 {
+		sb.WriteString(i18n.T(locale, "backfillstatus.none"))
+	}
+
+	for _, channelID := range channels {
+		fmt.Fprintln(&sb, b.backfillLine(locale, schizo, channelID))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(sb.String()).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
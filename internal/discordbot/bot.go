@@ -0,0 +1,516 @@
+// Package discordbot connects guild brains to Discord: it feeds them messages
+// as they arrive, crawls channel history in the background, replies when
+// mentioned and serves the slash commands.
+package discordbot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/disgoorg/disgo"
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/cache"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/gateway"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgo/sharding"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/config"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/internal/jobs"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/internal/logring"
+	"github.com/schizoid/internal/ratelimit"
+	"github.com/schizoid/internal/secrets"
+	"github.com/schizoid/internal/tracing"
+	"github.com/schizoid/pkg/brain"
+	"github.com/schizoid/pkg/denylist"
+	"github.com/schizoid/pkg/watchdog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	gatewayLog = logging.For(logging.Gateway)
+	tracer     = otel.Tracer("github.com/schizoid/internal/discordbot")
+)
+
+// Bot serves every guild it is in from one Discord connection.
+type Bot struct {
+	// swapped whole when the config is reloaded
+	config    atomic.Pointer[config.Config]
+	brains    *brain.Store
+	denylists *denylist.Packs
+	logs      *logring.Handler
+	// cancels crawls of a channel that stopped getting anywhere
+	crawls *watchdog.Watchdog
+	// how fast each channel's history is being crawled
+	crawlRates *crawlRates
+	// the guilds whose history is crawled
+	crawler *crawler
+	// background work, kept until it is done
+	jobs *jobs.Queue
+	// ticks once per request catching up is allowed, nil to skip catching up
+	catchUpBudget <-chan time.Time
+	// replies each member can ask for
+	replyLimit *ratelimit.Limiter
+	// reloads the config for /admin reload, nil if it can't be
+	reload func() error
+
+	// the client each guild's background crawling was started with, so it
+	// stops and starts over with the new one once the bot reconnects
+	guilds   map[snowflake.ID]bot.Client
+	guildsMu sync.Mutex
+
+	// the voice channel each guild is spoken to in
+	voices   map[snowflake.ID]*voiceSession
+	voicesMu sync.Mutex
+
+	// the webhook impersonations are posted through, by channel
+	webhooks   map[snowflake.ID]channelWebhook
+	webhooksMu sync.Mutex
+
+	// how recent replies are generated again, by what they answered
+	regenerations   map[snowflake.ID]regeneration
+	regenerationsMu sync.Mutex
+}
+
+// New creates a bot with the given settings, serving the brains in store
+// and filtering with denylists. Operators read recent records from logs.
+func New(cfg config.Config, store *brain.Store, denylists *denylist.Packs, logs *logring.Handler) *Bot {
+	var catchUpBudget <-chan time.Time
+	if cfg.CatchUp.RequestsPerMinute > 0 {
+		catchUpBudget = time.Tick(time.Minute / time.Duration(cfg.CatchUp.RequestsPerMinute))
+	}
+
+	b := &Bot{
+		brains:        store,
+		denylists:     denylists,
+		logs:          logs,
+		crawls:        watchdog.New("crawl", time.Duration(cfg.Watchdog.CrawlSeconds)*time.Second),
+		crawlRates:    newCrawlRates(),
+		crawler:       newCrawler(),
+		jobs:          jobs.Load(filepath.Join(cfg.Storage.ModelsDir, "jobs.json"), cfg.Jobs.MaxAttempts),
+		catchUpBudget: catchUpBudget,
+		replyLimit:    ratelimit.New(cfg.RateLimit.PerMinute, cfg.RateLimit.Burst),
+		guilds:        make(map[snowflake.ID]bot.Client),
+		voices:        make(map[snowflake.ID]*voiceSession),
+		webhooks:      make(map[snowflake.ID]channelWebhook),
+		regenerations: make(map[snowflake.ID]regeneration),
+	}
+	b.config.Store(&cfg)
+	b.handleJobs()
+
+	return b
+}
+
+// Reconfigure has the bot go by cfg from now on, without reconnecting.
+// Settings that only matter when connecting, like the token, the sharding and
+// the gateway intents the features need, apply once the bot reconnects;
+// slash commands are registered again with that too.
+func (b *Bot) Reconfigure(cfg config.Config) {
+	b.config.Store(&cfg)
+	b.replyLimit.Set(cfg.RateLimit.PerMinute, cfg.RateLimit.Burst)
+	b.brains.Reconfigure()
+}
+
+// SetReload has /admin reload call reload, which reloads the config and
+// reconfigures every bot with it.
+func (b *Bot) SetReload(reload func() error) {
+	b.reload = reload
+}
+
+func (b *Bot) retrieveGuildBrain(client bot.Client, id snowflake.ID) *brain.Brain {
+	b.guildsMu.Lock()
+	defer b.guildsMu.Unlock()
+
+	// without message content there is no history to crawl and no channel
+	// to revive
+	if b.guilds[id] != client && !b.config.Load().Features.InteractionOnly {
+		b.guilds[id] = client
+
+		// what was sent from when the bot stopped listening until now is
+		// caught up with, noted before anything newer is learned
+		if b.catchUpBudget != nil {
+			b.brains.Get(id).MarkDowntime(snowflake.New(time.Now()))
+		}
+		go b.startCrawling(client, id)
+		go b.reviveChannels(client, id)
+		go b.postScheduled(client, id)
+	}
+
+	return b.brains.Get(id)
+}
+
+// serves reports whether client is still the one the guild's background work
+// runs with
+func (b *Bot) serves(client bot.Client, guildID snowflake.ID) bool {
+	b.guildsMu.Lock()
+	defer b.guildsMu.Unlock()
+
+	return b.guilds[guildID] == client
+}
+
+// Run connects to Discord and runs until interrupted, saving every brain
+// before it returns.
+func (b *Bot) Run() error {
+	if b.denylists != nil {
+		go b.denylists.Watch(b.config.Load().Storage.DenylistDir)
+	}
+
+	go b.crawls.Run(context.Background())
+	b.jobs.Run(b.config.Load().Jobs.Workers)
+	go b.scheduleCrawls()
+	go b.scheduleRebuilds()
+
+	r := handler.New()
+	r.Use(b.requirePremium)
+	r.Use(b.limitReplies)
+
+	r.SlashCommand("/watchchannel", b.handleWatchChannel)
+	r.SlashCommand("/unwatchchannel", b.handleUnwatchChannel)
+	r.Autocomplete("/unwatchchannel", b.handleWatchedAutocomplete)
+	r.Autocomplete("/rollback", b.handleSnapshotAutocomplete)
+	r.SlashCommand("/logchannel", b.handleLogChannel)
+	r.SlashCommand("/confidence", b.handleConfidence)
+	r.SlashCommand("/trigger", b.handleTrigger)
+	r.SlashCommand("/denylist", b.handleDenylist)
+	r.SlashCommand("/redact", b.handleRedact)
+	r.SlashCommand("/nsfw", b.handleNSFW)
+	r.SlashCommand("/blockuser", b.handleBlockUser)
+	r.SlashCommand("/global", b.handleGlobal)
+	r.SlashCommand("/blocklist", b.handleBlocklist)
+	r.SlashCommand("/links", b.handleLinks)
+	r.SlashCommand("/pii", b.handlePII)
+	r.SlashCommand("/attachments", b.handleAttachments)
+	r.SlashCommand("/voice/join", b.handleVoiceJoin)
+	r.SlashCommand("/voice/leave", b.handleVoiceLeave)
+	r.SlashCommand("/decoding", b.handleDecoding)
+	r.SlashCommand("/trainfilter", b.handleTrainFilter)
+	r.SlashCommand("/style", b.handleStyle)
+	r.SlashCommand("/perplexity", b.handlePerplexity)
+	r.SlashCommand("/optout", b.handleOptOut)
+	r.SlashCommand("/impersonate", b.handleImpersonate)
+	r.SlashCommand("/say", b.handleSay)
+	r.SlashCommand("/ask", b.handleAsk)
+	r.SlashCommand("/entities", b.handleEntities)
+	r.SlashCommand("/necromancer", b.handleNecromancer)
+	r.SlashCommand("/coverage", b.handleCoverage)
+	r.SlashCommand("/budget", b.handleBudget)
+	r.SlashCommand("/crawl/status", b.handleCrawlStatus)
+	r.SlashCommand("/backfillstatus", b.handleBackfillStatus)
+	r.SlashCommand("/imports", b.handleImports)
+	r.SlashCommand("/feed", b.handleFeed)
+	r.SlashCommand("/feeds", b.handleFeeds)
+	r.SlashCommand("/unfeed", b.handleUnfeed)
+	r.SlashCommand("/import", b.handleImport)
+	r.SlashCommand("/playground", b.handlePlayground)
+	r.SlashCommand("/config", b.handleConfig)
+	r.SlashCommand("/privacy", b.handlePrivacy)
+	r.SlashCommand("/audit", b.handleAudit)
+	r.SlashCommand("/prune", b.handlePrune)
+	r.SlashCommand("/rollback", b.handleRollback)
+	r.ButtonComponent("/consent/accept", b.handleConsentAccept)
+	r.ButtonComponent("/consent/configure", b.handleConsentConfigure)
+	r.ButtonComponent("/regenerate/{key}", b.handleRegenerate)
+	r.SlashCommand("/admin/logs", b.handleAdminLogs)
+	r.SlashCommand("/admin/reload", b.handleAdminReload)
+	r.ButtonComponent("/admin/logs/{level}/{guild}/{until}/{page}", b.handleAdminLogsPage)
+
+	// brains are flushed on every exit path, after the gateway is closed so
+	// nothing is trained while saving
+	defer b.brains.Flush(time.Duration(b.config.Load().ShutdownTimeoutSeconds) * time.Second)
+	// running jobs finish first, the rest is kept for the next start
+	defer b.jobs.Drain(time.Duration(b.config.Load().ShutdownTimeoutSeconds) * time.Second)
+
+	s := make(chan os.Signal, 1)
+	signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+
+	// a rotated token invalidates the connection, so the bot reconnects with
+	// the new one
+	rotated := make(chan string, 1)
+	if ref, ok := b.config.Load().SecretRef("token"); ok {
+		refresh := time.Duration(b.config.Load().Secrets.RefreshSeconds) * time.Second
+		go secrets.Watch(context.Background(), ref, b.config.Load().Token, refresh, func(token string) { rotated <- token })
+	}
+
+	var token = b.config.Load().Token
+	for {
+		client, err := b.connect(token, r)
+		if err != nil {
+			return err
+		}
+
+		log.Print("schizoid is now running. Press CTRL-C to exit.")
+
+		select {
+		case sig := <-s:
+			gatewayLog.Info("Shutting down", slog.String("signal", sig.String()))
+			client.Close(context.TODO())
+			return nil
+		case token = <-rotated:
+			gatewayLog.Info("Reconnecting with the rotated token")
+			client.Close(context.TODO())
+		}
+	}
+}
+
+// connect opens a connection to Discord with token and registers the slash
+// commands
+func (b *Bot) connect(token string, r handler.Router) (bot.Client, error) {
+	// minimal deployments ask for as few privileged intents as they can
+	subscribed, listeners := b.subscriptions()
+	gatewayLog.Info("Subscribing to gateway events", slog.Int64("intents", int64(subscribed)), slog.Int("listeners", len(listeners)))
+
+	var intents = gateway.WithIntents(subscribed)
+
+	var connection bot.ConfigOpt
+	if b.config.Load().Sharding.Enabled {
+		connection = bot.WithShardManagerConfigOpts(b.shardingOpts(intents)...)
+	} else {
+		connection = bot.WithGatewayConfigOpts(
+			intents,
+			gateway.WithRateLimiter(gateway.NewRateLimiter()),
+		)
+	}
+
+	client, err := disgo.New(token,
+		bot.WithCacheConfigOpts(
+			cache.WithCaches(cache.FlagsAll),
+		),
+		connection,
+		bot.WithLogger(gatewayLog),
+		bot.WithEventListeners(listeners...),
+		bot.WithEventListeners(r),
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("creating client: %w", err)
+	}
+
+	if b.config.Load().Sharding.Enabled {
+		err = client.OpenShardManager(context.TODO())
+	} else {
+		err = client.OpenGateway(context.TODO())
+	}
+	if err != nil {
+		client.Close(context.TODO())
+		return nil, fmt.Errorf("opening gateway: %w", err)
+	}
+
+	if _, err = client.Rest().SetGlobalCommands(client.ApplicationID(), b.commands()); err != nil {
+		client.Close(context.TODO())
+		return nil, fmt.Errorf("registering commands: %w", err)
+	}
+
+	return client, nil
+}
+
+// shardingOpts configures the shard manager from config, leaving anything
+// unset to the values recommended by Discord
+func (b *Bot) shardingOpts(gatewayOpts ...gateway.ConfigOpt) []sharding.ConfigOpt {
+	opts := []sharding.ConfigOpt{
+		sharding.WithAutoScaling(b.config.Load().Sharding.AutoScaling),
+		sharding.WithGatewayConfigOpts(gatewayOpts...),
+	}
+
+	if b.config.Load().Sharding.Count > 0 {
+		opts = append(opts, sharding.WithShardCount(b.config.Load().Sharding.Count))
+	}
+
+	if len(b.config.Load().Sharding.IDs) > 0 {
+		opts = append(opts, sharding.WithShardIDs(b.config.Load().Sharding.IDs...))
+	}
+
+	gatewayLog.Info("Running sharded", slog.Int("shardCount", b.config.Load().Sharding.Count), slog.Any("shardIDs", b.config.Load().Sharding.IDs))
+
+	return opts
+}
+
+// trainInterval is the time between crawls of a guild's history, read anew
+// each time so a reloaded config applies
+func (b *Bot) trainInterval() time.Duration {
+	var interval = time.Duration(b.config.Load().TrainIntervalSeconds) * time.Second
+	if interval <= 0 {
+		return 60 * time.Second
+	}
+
+	return interval
+}
+
+// how often channels are checked for having gone silent
+const reviveInterval = 10 * time.Minute
+
+// reviveChannels posts conversation starters in the guild's dead channels
+func (b *Bot) reviveChannels(client bot.Client, guildID snowflake.ID) {
+	defer crash.Recover()
+
+	for {
+		time.Sleep(reviveInterval)
+
+		// the bot reconnected and started over with another client
+		if !b.serves(client, guildID) {
+			return
+		}
+
+		// an unloaded brain's channels are idle by definition, reviving
+		// them is left until it is used again
+		schizo := b.brains.Loaded(guildID)
+		if schizo == nil || !schizo.Consented(b.policy()) {
+			continue
+		}
+
+		for _, channelID := range schizo.DeadChannels(time.Now()) {
+			if isNSFW(client, channelID) && !schizo.GuildSettings().AllowNSFW {
+				continue
+			}
+
+			starter := schizo.FilterOutput(func() string {
+				return liveEmoji(client, guildID, schizo.Revive(channelID, time.Now(), 256))
+			})
+			if starter == "" {
+				continue
+			}
+
+			if _, err := createMessage(client, channelID, discord.NewMessageCreateBuilder().
+				SetContent(starter).
+				SetAllowedMentions(&discord.AllowedMentions{}).
+				Build(),
+			); err != nil {
+				gatewayLog.Error("Failed to revive channel", slog.Any("guildID", guildID), slog.String("channelID", channelID.String()), slog.String("err", err.Error()))
+				continue
+			}
+
+			gatewayLog.Info("Revived dead channel", slog.Any("guildID", guildID), slog.String("channelID", channelID.String()))
+		}
+	}
+}
+
+// observeSomeMessages feeds the brain a page of a channel's history from
+// around the start of what it has learned. The request is abandoned once the
+// watchdog cancels task.
+func (b *Bot) observeSomeMessages(client bot.Client, schizo *brain.Brain, channelID snowflake.ID, task *watchdog.Task) {
+	defer crash.Recover()
+
+	// a full brain learns nothing, which would pass for the history running
+	// out
+	if !schizo.IsWhitelisted(channelID) || schizo.Full() {
+		return
+	}
+
+	var span = schizo.Span(channelID)
+
+	if span == nil {
+		return
+	}
+
+	ctx, crawl := tracer.Start(task.Context(), "discord.Crawl", trace.WithAttributes(tracing.Guild(schizo.GuildID), tracing.Channel(channelID)))
+	defer crawl.End()
+
+	var msgID = span.StartID
+
+	_, fetching := tracer.Start(ctx, "discord.GetMessages")
+	var messages, err = getMessages(ctx, client, channelID, msgID, msgID, msgID, 25)
+	fetching.End()
+
+	if err != nil {
+		gatewayLog.Error("Failed to crawl channel", slog.Any("guildID", schizo.GuildID), slog.String("channelID", channelID.String()), slog.String("err", err.Error()))
+		return
+	}
+
+	var start = span.Start
+
+	for _, msg := range messages {
+		if !task.Alive() {
+			return
+		}
+		schizo.ObserveContext(ctx, toBrainMessage(client, msg))
+	}
+
+	span = schizo.Span(channelID)
+	// a page without anything older means the history ran out
+	if !span.Start.Before(start) && schizo.FinishCrawl(channelID) {
+		gatewayLog.Info("Finished crawling channel", slog.Any("guildID", schizo.GuildID), slog.String("channelID", channelID.String()))
+		notify(client, schizo, "crawled", discord.ChannelMention(channelID))
+	}
+	b.crawlRates.record(channelID, len(messages), start.Sub(span.Start), time.Now())
+	gatewayLog.Info("Trained:", slog.Any("guildID", schizo.GuildID), slog.String("channelID", channelID.String()), slog.Time("start", span.Start), slog.Time("end", span.End),
+		slog.String("progress", b.crawlStatus(i18n.Fallback, schizo, channelID)))
+}
+
+// isNSFW reports whether a channel is marked as age-restricted, or is a
+// thread in one. Channels missing from the cache are fetched, and those that
+// can't be are taken for age-restricted, since learning from one can't be
+// taken back as easily as skipping it.
+func isNSFW(client bot.Client, channelID snowflake.ID) bool {
+	var channel discord.Channel
+	if cached, ok := client.Caches().Channel(channelID); ok {
+		channel = cached
+	} else {
+		fetched, err := client.Rest().GetChannel(channelID)
+		if err != nil {
+			gatewayLog.Warn("Failed to fetch channel, taking it for age-restricted", slog.String("channelID", channelID.String()), slog.String("err", err.Error()))
+			return true
+		}
+		channel = fetched
+	}
+
+	switch channel := channel.(type) {
+	case discord.GuildThread:
+		// threads don't say, their channel does
+		return isNSFW(client, *channel.ParentID())
+	case discord.GuildForumChannel:
+		return channel.NSFW
+	case discord.GuildMediaChannel:
+		return channel.NSFW
+	case discord.GuildMessageChannel:
+		return channel.NSFW()
+	}
+
+	return false
+}
+
+// toBrainMessage converts a Discord message, collecting every name its author
+// goes by
+func toBrainMessage(client bot.Client, msg discord.Message) brain.Message {
+	names := []string{msg.Author.Username}
+
+	if msg.Author.GlobalName != nil {
+		names = append(names, *msg.Author.GlobalName)
+	}
+
+	if msg.Member != nil && msg.Member.Nick != nil {
+		names = append(names, *msg.Member.Nick)
+	}
+
+	var attachments, stickers []string
+	for _, attachment := range msg.Attachments {
+		attachments = append(attachments, attachment.Filename)
+	}
+	for _, sticker := range msg.StickerItems {
+		stickers = append(stickers, sticker.Name)
+	}
+
+	return brain.Message{
+		ID:          msg.ID,
+		ChannelID:   msg.ChannelID,
+		AuthorID:    msg.Author.ID,
+		AuthorNames: names,
+		Bot:         msg.Author.Bot,
+		NSFW:        isNSFW(client, msg.ChannelID),
+		Content:     msg.Content,
+		CreatedAt:   msg.CreatedAt,
+		Attachments: attachments,
+		Stickers:    stickers,
+	}
+}
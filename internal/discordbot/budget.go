@@ -0,0 +1,58 @@
+package discordbot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// budgetBar renders share, from 0 to 1, as a bar as wide as the coverage one
+func budgetBar(share float64) string {
+	filled := min(coverageWidth, int(share*coverageWidth+0.5))
+	return strings.Repeat("█", filled) + strings.Repeat("░", coverageWidth-filled)
+}
+
+func (b *Bot) handleBudget(_ discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	budget := schizo.Budget()
+	locale := interactionLocale(e)
+
+	var sb strings.Builder
+	fmt.Fprintln(&sb, i18n.T(locale, "budget.title"))
+
+	if budget.Max <= 0 {
+		sb.WriteString(i18n.T(locale, "budget.uncapped", budget.Entries))
+	} else {
+		share := float64(budget.Entries) / float64(budget.Max)
+		fmt.Fprintf(&sb, "`%s`\n", budgetBar(share))
+		fmt.Fprintln(&sb, i18n.T(locale, "budget.usage", budget.Entries, budget.Max, share*100))
+
+		switch budget.Action {
+		case brain.BudgetStop:
+			if schizo.Full() {
+				sb.WriteString(i18n.T(locale, "budget.spent"))
+			} else {
+				sb.WriteString(i18n.T(locale, "budget.stop"))
+			}
+		case brain.BudgetDecay:
+			sb.WriteString(i18n.T(locale, "budget.decay"))
+		default:
+			sb.WriteString(i18n.T(locale, "budget.prune"))
+		}
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(sb.String()).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package discordbot
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/brain"
+	"github.com/schizoid/pkg/watchdog"
+)
+
+// the most messages Discord hands out per history request
+const catchUpPageSize = 100
+
+// missedChannel is a gap in a watched channel's history
+type missedChannel struct {
+	id  snowflake.ID
+	gap brain.Gap
+	// when the channel last had a message, zero when unknown
+	active time.Time
+}
+
+// missedChannels lists the gaps of the watched channels, those of the most
+// recently active channels first. Channels missing from the cache are caught
+// up last, in case they missed something; gaps the cache shows nothing was
+// sent in are closed right away.
+func missedChannels(client bot.Client, schizo *brain.Brain) []missedChannel {
+	var missed []missedChannel
+
+	for _, channelID := range schizo.Watched() {
+		for _, gap := range schizo.Gaps(channelID) {
+			channel := missedChannel{id: channelID, gap: gap}
+
+			if cached, ok := client.Caches().GuildMessageChannel(channelID); ok {
+				last := cached.LastMessageID()
+				if last == nil || *last <= gap.After {
+					schizo.FillGap(channelID, gap, gap.Before)
+					continue
+				}
+				channel.active = last.Time()
+			}
+
+			missed = append(missed, channel)
+		}
+	}
+
+	slices.SortStableFunc(missed, func(a, b missedChannel) int { return b.active.Compare(a.active) })
+
+	return missed
+}
+
+// catchUp learns the messages a guild's watched channels got while the bot
+// was offline, before crawling goes back to older history. Requests come out
+// of the catch-up budget shared by every guild. Messages arriving meanwhile
+// are learned as they come, so each gap ends when the bot came back; what a
+// catch-up cut short leaves is caught up with the next time.
+func (b *Bot) catchUp(client bot.Client, guildID snowflake.ID) {
+	if b.catchUpBudget == nil {
+		return
+	}
+
+	schizo := b.brains.Get(guildID)
+	// a full brain learns nothing, the gaps wait until there is room again
+	if !schizo.Consented(b.policy()) || schizo.Full() {
+		return
+	}
+
+	for _, channel := range missedChannels(client, schizo) {
+		if isNSFW(client, channel.id) && !schizo.GuildSettings().AllowNSFW {
+			continue
+		}
+
+		task, ok := b.crawls.Start(context.Background(), channel.id.String())
+		if !ok {
+			continue
+		}
+
+		learned := b.catchUpChannel(client, schizo, channel, task)
+		b.crawls.Done(task)
+
+		gatewayLog.Info("Caught up with channel", slog.Any("guildID", guildID), slog.String("channelID", channel.id.String()), slog.Int("messages", learned))
+	}
+}
+
+// catchUpChannel learns the messages in a channel's gap a page at a time,
+// recording its progress after each, and reports how many it went through
+func (b *Bot) catchUpChannel(client bot.Client, schizo *brain.Brain, channel missedChannel, task *watchdog.Task) int {
+	var learned int
+	var gap = channel.gap
+
+	for {
+		<-b.catchUpBudget
+
+		messages, err := getMessages(task.Context(), client, channel.id, 0, 0, gap.After, catchUpPageSize)
+		if err != nil {
+			gatewayLog.Error("Failed to catch up with channel", slog.Any("guildID", schizo.GuildID), slog.String("channelID", channel.id.String()), slog.String("err", err.Error()))
+			return learned
+		}
+
+		// pages come newest first, spans grow from the oldest
+		slices.SortFunc(messages, func(a, b discord.Message) int { return cmp.Compare(a.ID, b.ID) })
+
+		var upTo = gap.After
+		for _, msg := range messages {
+			if msg.ID >= gap.Before {
+				schizo.FillGap(channel.id, gap, gap.Before)
+				return learned
+			}
+			if !task.Alive() || schizo.Full() {
+				schizo.FillGap(channel.id, gap, upTo)
+				return learned
+			}
+
+			schizo.ObserveMissed(toBrainMessage(client, msg))
+			upTo = msg.ID
+			learned++
+		}
+
+		if len(messages) < catchUpPageSize {
+			schizo.FillGap(channel.id, gap, gap.Before)
+			return learned
+		}
+
+		schizo.FillGap(channel.id, gap, upTo)
+		gap.After = upTo
+	}
+}
@@ -0,0 +1,1510 @@
+package discordbot
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/internal/jobs"
+	"github.com/schizoid/pkg/brain"
+	"github.com/schizoid/pkg/ngram"
+)
+
+// commands are registered globally on startup
+var commands = []discord.ApplicationCommandCreate{
+	discord.SlashCommandCreate{
+		Name:        "watchchannel",
+		Description: "let schizoid learn from a channel",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionChannel{
+				Name:        "channel",
+				Description: "Channel to learn from",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "unwatchchannel",
+		Description: "stop schizoid learning from a channel, keeping what it learned",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:         "channel",
+				Description:  "Watched channel to stop learning from",
+				Required:     true,
+				Autocomplete: true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "logchannel",
+		Description: "post notices about what schizoid learns from in a channel",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionChannel{
+				Name:         "channel",
+				Description:  "Channel to post in, leave empty to stop",
+				ChannelTypes: []discord.ChannelType{discord.ChannelTypeGuildText},
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "confidence",
+		Description: "stay quiet instead of posting replies schizoid is unsure of",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionFloat{
+				Name:        "threshold",
+				Description: "Minimum confidence (0-1) a reply needs to be posted, 0 to always reply",
+				Required:    true,
+				MinValue:    &minConfidence,
+				MaxValue:    &maxConfidence,
+			},
+			discord.ApplicationCommandOptionString{
+				Name:        "reaction",
+				Description: "Emoji to react with instead of replying, leave empty to stay silent",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "trigger",
+		Description: "choose an emoji that makes schizoid reply to the message it is reacted onto",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "emoji",
+				Description: "Emoji to react with, e.g. 🧠, leave empty to turn it off",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "denylist",
+		Description: "filter a language's denylist out of what schizoid learns and says",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "pack",
+				Description: "Locale of the denylist pack, e.g. en",
+				Required:    true,
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "enabled",
+				Description: "Whether the pack applies to this server",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "redact",
+		Description: "learn from messages with denied words redacted instead of skipping them",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionBool{
+				Name:        "enabled",
+				Description: "Whether denied words are redacted rather than the whole message skipped",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "nsfw",
+		Description: "let schizoid learn from and reply in age-restricted channels",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionBool{
+				Name:        "enabled",
+				Description: "Whether age-restricted channels are treated like any other",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "global",
+		Description: "share what schizoid learns here with other servers that opted in, and talk like all of them",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionBool{
+				Name:        "enabled",
+				Description: "Whether this server contributes to and generates from the shared brain",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "blocklist",
+		Description: "list or edit the words schizoid never says in this server",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "add",
+				Description: "Word or phrase to keep out of generated messages",
+			},
+			discord.ApplicationCommandOptionString{
+				Name:        "remove",
+				Description: "Word or phrase to allow again",
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "resample",
+				Description: "Whether to generate again instead of censoring when a message contains blocked words",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "links",
+		Description: "choose what happens to links and invites in messages schizoid learns",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionInt{
+				Name:        "mode",
+				Description: "What to do with links",
+				Required:    true,
+				Choices: []discord.ApplicationCommandOptionChoiceInt{
+					{Name: "learn them like any other text", Value: int(brain.LinksKeep)},
+					{Name: "remove them", Value: int(brain.LinksRemove)},
+					{Name: "redact them, so they are never said", Value: int(brain.LinksRedact)},
+				},
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "pii",
+		Description: "choose whether emails, phone numbers and long numbers are redacted before learning",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionBool{
+				Name:        "redact",
+				Description: "Whether personal data is redacted, which it is by default",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "voice",
+		Description: "have schizoid speak generated lines in a voice channel",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "join",
+				Description: "join the voice channel you are in and speak every so often",
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "leave",
+				Description: "stop speaking and leave the voice channel",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "attachments",
+		Description: "choose whether the names of attached files and stickers are learned",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionBool{
+				Name:        "enabled",
+				Description: "Whether attachments and stickers are learned, so messages without text are too",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "decoding",
+		Description: "choose between sampled replies and steadier ones from beam search",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "mode",
+				Description: "How replies are generated",
+				Required:    true,
+				Choices: []discord.ApplicationCommandOptionChoiceString{
+					{Name: "sample, chaotic and different every time", Value: "sample"},
+					{Name: "beam search, more coherent and predictable", Value: "beam"},
+				},
+			},
+			discord.ApplicationCommandOptionInt{
+				Name:        "width",
+				Description: "How many continuations beam search keeps, 4 by default",
+				Required:    false,
+				MinValue:    &minBeamWidth,
+				MaxValue:    &maxBeamWidth,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "trainfilter",
+		Description: "list or edit the patterns of messages schizoid never learns, like other bots' commands",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "add",
+				Description: "Regular expression of messages to skip, e.g. ^[!?]\\w+",
+				MaxLength:   &maxTrainFilterLength,
+			},
+			discord.ApplicationCommandOptionString{
+				Name:        "remove",
+				Description: "Pattern to learn matching messages again",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "style",
+		Description: "show the statistical fingerprint schizoid learned for a user",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionUser{
+				Name:        "user",
+				Description: "User to describe",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "perplexity",
+		Description: "score how much a message sounds like this server",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "text",
+				Description: "Message to score",
+				Required:    true,
+			},
+			discord.ApplicationCommandOptionUser{
+				Name:        "user",
+				Description: "Score against what schizoid learned from this user instead",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "optout",
+		Description: "stop schizoid from learning from your messages",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionBool{
+				Name:        "enabled",
+				Description: "True to opt out, false to let schizoid learn from you again",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "blockuser",
+		Description: "keep schizoid from learning a member's messages, like a spammer's, or list who is kept out",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionUser{
+				Name:        "user",
+				Description: "Member to block or unblock, leave out to list the blocked ones",
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "blocked",
+				Description: "False to let schizoid learn from the member again",
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "forget",
+				Description: "Also unlearn what was already learned from the member",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "impersonate",
+		Description: "generate a message in the style of a user",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionUser{
+				Name:        "user",
+				Description: "User to imitate",
+				Required:    true,
+			},
+			discord.ApplicationCommandOptionString{
+				Name:        "prompt",
+				Description: "Text for the imitation to start with",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "ask",
+		Description: "ask schizoid a question, which it answers about what the question is about",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "question",
+				Description: "What to ask",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "say",
+		Description: "generate a message, the way to talk to schizoid without mentioning it",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "prompt",
+				Description: "Text to reply to",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "entities",
+		Description: "list or edit the names schizoid keeps whole when generating",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "add",
+				Description: "Name to keep whole",
+			},
+			discord.ApplicationCommandOptionString{
+				Name:        "remove",
+				Description: "Name to stop treating as a single token",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "feed",
+		Description: "teach schizoid a phrase, which can be unlearned later",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:        "text",
+				Description: "Phrase to learn",
+				Required:    true,
+				MaxLength:   &maxFeedLength,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "feeds",
+		Description: "list who fed schizoid phrases, or unlearn a member's",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionUser{
+				Name:        "purge",
+				Description: "Member whose phrases to unlearn, yourself or anyone with Manage Server",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "unfeed",
+		Description: "unlearn a phrase fed to schizoid by its receipt",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionInt{
+				Name:        "id",
+				Description: "Receipt /feed gave the phrase, yours or anyone's with Manage Server",
+				Required:    true,
+				MinValue:    &minFeedID,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "imports",
+		Description: "list, weigh or purge the history imported from outside the server",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionFloat{
+				Name:        "weight",
+				Description: "How much imported history counts relative to messages learned here, 1 for the same",
+				MinValue:    &minImportWeight,
+				MaxValue:    &maxImportWeight,
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "purge",
+				Description: "Forget all imported history",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "coverage",
+		Description: "show which part of a channel's history schizoid has learned",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionChannel{
+				Name:        "channel",
+				Description: "Channel to show",
+				Required:    true,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "budget",
+		Description: "show how close schizoid's memory of this server is to its cap",
+	},
+	discord.SlashCommandCreate{
+		Name:        "crawl",
+		Description: "follow schizoid learning the history of watched channels",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "status",
+				Description: "show how far each channel's history was crawled and how long the rest will take",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionChannel{
+						Name:        "channel",
+						Description: "Only show this channel",
+					},
+				},
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "backfillstatus",
+		Description: "show how far back schizoid learned each watched channel and how much is left",
+	},
+	discord.SlashCommandCreate{
+		Name:        "necromancer",
+		Description: "post a conversation starter in watched channels that went quiet",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionInt{
+				Name:        "hours",
+				Description: "Hours of silence before a channel gets a starter, 0 to disable",
+				Required:    true,
+				MinValue:    &minSilenceHours,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "playground",
+		Description: "reply to every message in one channel, with a cooldown per member",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionChannel{
+				Name:         "channel",
+				Description:  "Channel to reply in, leave empty to disable",
+				ChannelTypes: []discord.ChannelType{discord.ChannelTypeGuildText},
+			},
+			discord.ApplicationCommandOptionInt{
+				Name:        "cooldown",
+				Description: "Seconds each member waits between replies",
+				MinValue:    &minPlaygroundCooldown,
+				MaxValue:    &maxPlaygroundCooldown,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "config",
+		Description: "show or change how schizoid behaves in a channel",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionChannel{
+				Name:         "channel",
+				Description:  "Channel to configure",
+				Required:     true,
+				ChannelTypes: []discord.ChannelType{discord.ChannelTypeGuildText},
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "learn",
+				Description: "Whether schizoid learns from the channel",
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "autoreply",
+				Description: "Whether schizoid replies without being mentioned",
+			},
+			discord.ApplicationCommandOptionFloat{
+				Name:        "chance",
+				Description: "Chance (0-1) of replying to a message when replying unprompted",
+				MinValue:    &minReplyChance,
+				MaxValue:    &maxReplyChance,
+			},
+			discord.ApplicationCommandOptionInt{
+				Name:        "length",
+				Description: "Most tokens a reply is generated with, 0 for the default",
+				MinValue:    &minReplyLength,
+				MaxValue:    &maxReplyLength,
+			},
+			discord.ApplicationCommandOptionInt{
+				Name:        "cooldown",
+				Description: "Least seconds between replies, however often schizoid is mentioned, 0 for the default",
+				MinValue:    &minReplyCooldown,
+				MaxValue:    &maxReplyCooldown,
+			},
+			discord.ApplicationCommandOptionInt{
+				Name:        "post",
+				Description: "Post unprompted every this many minutes, 0 to never",
+				MinValue:    &minPostInterval,
+				MaxValue:    &maxPostInterval,
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "random",
+				Description: "Whether posts come at random times around the interval instead of like clockwork",
+			},
+			discord.ApplicationCommandOptionInt{
+				Name:        "quiet_start",
+				Description: "Hour of the day (UTC) from which schizoid doesn't post unprompted",
+				MinValue:    &minHour,
+				MaxValue:    &maxHour,
+			},
+			discord.ApplicationCommandOptionInt{
+				Name:        "quiet_end",
+				Description: "Hour of the day (UTC) unprompted posts resume, the same as quiet_start for no quiet hours",
+				MinValue:    &minHour,
+				MaxValue:    &maxHour,
+			},
+			discord.ApplicationCommandOptionBool{
+				Name:        "digest",
+				Description: "Whether schizoid posts a mashup summary of the channel's day once a day",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "audit",
+		Description: "export the tamper-evident log of admin actions taken on schizoid's data",
+	},
+	discord.SlashCommandCreate{
+		Name:        "import",
+		Description: "learn history exported from another platform or a text file",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionAttachment{
+				Name:        "file",
+				Description: "Export or text file to learn, one message per line for text",
+				Required:    true,
+			},
+			discord.ApplicationCommandOptionString{
+				Name:        "format",
+				Description: "Format of the file, lines by default",
+				Choices:     formatChoices(),
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "privacy",
+		Description: "show the privacy notice and whether it was accepted",
+	},
+	discord.SlashCommandCreate{
+		Name:        "admin",
+		Description: "tools for the operators running this bot",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "logs",
+				Description: "show the bot's most recent log records",
+				Options: []discord.ApplicationCommandOption{
+					discord.ApplicationCommandOptionString{
+						Name:        "level",
+						Description: "Least severe level to show, info by default",
+						Choices:     logLevelChoices(),
+					},
+					discord.ApplicationCommandOptionString{
+						Name:        "guild",
+						Description: "Only show records about this guild ID",
+					},
+				},
+			},
+			discord.ApplicationCommandOptionSubCommand{
+				Name:        "reload",
+				Description: "read the config file again, like SIGHUP does",
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "prune",
+		Description: "forget rare phrases so one-off messages can't be repeated word for word",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionInt{
+				Name:        "k",
+				Description: "Forget phrases seen fewer than this many times",
+				Required:    true,
+				MinValue:    &minPruneCount,
+				MaxValue:    &maxPruneCount,
+			},
+		},
+	},
+	discord.SlashCommandCreate{
+		Name:        "rollback",
+		Description: "list the snapshots taken before imports, prunes and purges, or restore one",
+		Options: []discord.ApplicationCommandOption{
+			discord.ApplicationCommandOptionString{
+				Name:         "snapshot",
+				Description:  "Snapshot to restore, undoing everything learned and changed since",
+				Autocomplete: true,
+			},
+		},
+	},
+}
+
+var (
+	minConfidence = 0.0
+	maxConfidence = 1.0
+
+	minSilenceHours = 0
+
+	minImportWeight = 0.0
+	maxImportWeight = 10.0
+
+	// the most slowmode Discord allows is 6 hours
+	minPlaygroundCooldown = 5
+	maxPlaygroundCooldown = 6 * 60 * 60
+
+	minPruneCount = 2
+	maxPruneCount = 100
+
+	maxTrainFilterLength = brain.MaxTrainFilterLength
+
+	maxFeedLength = brain.MaxFeedLength
+	minFeedID     = 1
+
+	minReplyChance = 0.0
+	maxReplyChance = 1.0
+
+	minReplyLength = 0
+	maxReplyLength = chat.ReplyLength
+
+	minReplyCooldown = 0
+	maxReplyCooldown = 60 * 60
+
+	minPostInterval = 0
+	maxPostInterval = 7 * 24 * 60
+
+	minHour = 0
+	maxHour = 23
+
+	minBeamWidth = 2
+	maxBeamWidth = ngram.MaxBeamWidth
+)
+
+// beam search keeps this many continuations unless told otherwise
+const defaultBeamWidth = 4
+
+// canManage reports whether the member running a command has the Manage Server
+// permission, which changing how schizoid learns and talks takes
+func canManage(e *handler.CommandEvent) bool {
+	member := e.Member()
+	return member != nil && member.Permissions.Has(discord.PermissionManageGuild)
+}
+
+// hasOption reports whether a command was given any of the options
+func hasOption(data discord.SlashCommandInteractionData, names ...string) bool {
+	return slices.ContainsFunc(names, func(name string) bool {
+		_, ok := data.Option(name)
+		return ok
+	})
+}
+
+// refuseManage tells a member without the Manage Server permission that the
+// command needs it, key naming the refusal
+func refuseManage(e *handler.CommandEvent, key string) error {
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(i18n.T(interactionLocale(e), key)).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleWatchChannel(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	channel := data.Channel("channel")
+	schizo.WhitelistChannel(channel.ID)
+	schizo.RememberName(channel.Name)
+	notify(e.Client(), schizo, "watched", discord.ChannelMention(channel.ID), discord.UserMention(e.User().ID))
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(i18n.T(interactionLocale(e), "watchchannel.added", channel.Name)).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleConfidence(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	threshold := data.Float("threshold")
+	reaction := data.String("reaction")
+	schizo.SetConfidenceThreshold(threshold, reaction)
+
+	var content = i18n.T(interactionLocale(e), "confidence.enabled", threshold)
+	if threshold == 0 {
+		content = i18n.T(interactionLocale(e), "confidence.disabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleDenylist(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	pack := data.String("pack")
+	enabled := data.Bool("enabled")
+
+	var content string
+	if !b.denylists.Has(pack) {
+		content = i18n.T(interactionLocale(e), "denylist.unknown", pack, strings.Join(b.denylists.Available(), ", "))
+	} else {
+		schizo.SetDenylistPack(pack, enabled)
+		if enabled {
+			content = i18n.T(interactionLocale(e), "denylist.enabled", pack)
+		} else {
+			content = i18n.T(interactionLocale(e), "denylist.disabled", pack)
+		}
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleRedact(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	enabled := data.Bool("enabled")
+	schizo.SetRedactDenied(enabled)
+
+	var content = i18n.T(interactionLocale(e), "redact.disabled")
+	if enabled {
+		content = i18n.T(interactionLocale(e), "redact.enabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleNSFW(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	enabled := data.Bool("enabled")
+	schizo.SetAllowNSFW(enabled)
+
+	var content = i18n.T(interactionLocale(e), "nsfw.disabled")
+	if enabled {
+		content = i18n.T(interactionLocale(e), "nsfw.enabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleGlobal(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	enabled := data.Bool("enabled")
+	schizo.SetShareGlobal(enabled)
+
+	var content = i18n.T(interactionLocale(e), "global.disabled")
+	if enabled {
+		content = i18n.T(interactionLocale(e), "global.enabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleBlocklist(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	// anyone can see the blocked words, only managers change them
+	if !canManage(e) && hasOption(data, "add", "remove", "resample") {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	locale := interactionLocale(e)
+
+	var lines []string
+	if term, ok := data.OptString("add"); ok {
+		if schizo.BlockTerm(term) {
+			lines = append(lines, i18n.T(locale, "blocklist.added", term))
+		} else {
+			lines = append(lines, i18n.T(locale, "blocklist.already", term))
+		}
+	}
+
+	if term, ok := data.OptString("remove"); ok {
+		if schizo.UnblockTerm(term) {
+			lines = append(lines, i18n.T(locale, "blocklist.removed", term))
+		} else {
+			lines = append(lines, i18n.T(locale, "blocklist.unknown", term))
+		}
+	}
+
+	if resample, ok := data.OptBool("resample"); ok {
+		schizo.SetResampleBlocked(resample)
+	}
+
+	if terms := schizo.Blocklist(); len(terms) == 0 {
+		lines = append(lines, i18n.T(locale, "blocklist.none"))
+	} else {
+		lines = append(lines, i18n.T(locale, "blocklist.list", strings.Join(terms, ", ")))
+	}
+
+	if schizo.GuildSettings().ResampleBlocked {
+		lines = append(lines, i18n.T(locale, "blocklist.resample"))
+	} else {
+		lines = append(lines, i18n.T(locale, "blocklist.censor"))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(strings.Join(lines, "\n")).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleLinks(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	handling := brain.LinkHandling(data.Int("mode"))
+	schizo.SetLinkHandling(handling)
+
+	var content string
+	switch handling {
+	case brain.LinksRemove:
+		content = i18n.T(interactionLocale(e), "links.remove")
+	case brain.LinksRedact:
+		content = i18n.T(interactionLocale(e), "links.redact")
+	default:
+		content = i18n.T(interactionLocale(e), "links.keep")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleAttachments(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	enabled := data.Bool("enabled")
+	schizo.SetLearnAttachments(enabled)
+
+	var content = i18n.T(interactionLocale(e), "attachments.disabled")
+	if enabled {
+		content = i18n.T(interactionLocale(e), "attachments.enabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handlePII(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	redact := data.Bool("redact")
+	schizo.SetKeepPII(!redact)
+
+	var content = i18n.T(interactionLocale(e), "pii.disabled")
+	if redact {
+		content = i18n.T(interactionLocale(e), "pii.enabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleDecoding(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+
+	var content = i18n.T(interactionLocale(e), "decoding.sample")
+	if data.String("mode") == "beam" {
+		width, ok := data.OptInt("width")
+		if !ok {
+			width = defaultBeamWidth
+		}
+		schizo.SetBeamWidth(width)
+		content = i18n.T(interactionLocale(e), "decoding.beam", width)
+	} else {
+		schizo.SetBeamWidth(0)
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleTrainFilter(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	// anyone can see the filters, only managers change them
+	if !canManage(e) && hasOption(data, "add", "remove") {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	locale := interactionLocale(e)
+
+	var lines []string
+	if pattern, ok := data.OptString("add"); ok {
+		if added, err := schizo.AddTrainFilter(pattern); err != nil {
+			lines = append(lines, i18n.T(locale, "trainfilter.invalid", err))
+		} else if added {
+			lines = append(lines, i18n.T(locale, "trainfilter.added", pattern))
+		} else {
+			lines = append(lines, i18n.T(locale, "trainfilter.already", pattern))
+		}
+	}
+
+	if pattern, ok := data.OptString("remove"); ok {
+		if schizo.RemoveTrainFilter(pattern) {
+			lines = append(lines, i18n.T(locale, "trainfilter.removed", pattern))
+		} else {
+			lines = append(lines, i18n.T(locale, "trainfilter.unknown", pattern))
+		}
+	}
+
+	if filters := schizo.TrainFilters(); len(filters) == 0 {
+		lines = append(lines, i18n.T(locale, "trainfilter.none"))
+	} else {
+		lines = append(lines, i18n.T(locale, "trainfilter.title"))
+		for _, filter := range filters {
+			lines = append(lines, "`"+filter+"`")
+		}
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(strings.Join(lines, "\n")).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handlePerplexity(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	text := data.String("text")
+	locale := interactionLocale(e)
+
+	var whom = i18n.T(locale, "perplexity.server")
+	var authorID snowflake.ID
+	if user, ok := data.OptUser("user"); ok {
+		whom, authorID = user.Username, user.ID
+	}
+
+	var content string
+	if score, ok := schizo.Score(authorID, text); !ok {
+		content = i18n.T(locale, "common.nothing_learned", whom)
+	} else if score.Tokens == score.ZeroProbs {
+		content = i18n.T(locale, "perplexity.unseen", whom)
+	} else if score.ZeroProbs > 0 {
+		content = i18n.T(locale, "perplexity.score_unseen", whom, score.Perplexity(), score.LogProb, score.Tokens-score.ZeroProbs, score.ZeroProbs)
+	} else {
+		content = i18n.T(locale, "perplexity.score", whom, score.Perplexity(), score.LogProb, score.Tokens)
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleStyle(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	user := data.User("user")
+	locale := interactionLocale(e)
+
+	var content string
+	if schizo.IsOptedOut(user.ID) {
+		content = i18n.T(locale, "common.opted_out", user.Username)
+	} else if report := schizo.Style(user.ID); report == nil {
+		content = i18n.T(locale, "common.nothing_learned", user.Username)
+	} else {
+		var sb strings.Builder
+		fmt.Fprintln(&sb, i18n.T(locale, "style.title", user.Username))
+		fmt.Fprintln(&sb, i18n.T(locale, "style.messages", report.Messages))
+		fmt.Fprintln(&sb, i18n.T(locale, "style.length", report.AverageLength))
+
+		if len(report.Distinctive) > 0 {
+			var quoted []string
+			for _, ngram := range report.Distinctive {
+				quoted = append(quoted, "`"+strings.ReplaceAll(ngram, "`", "'")+"`")
+			}
+			fmt.Fprintln(&sb, i18n.T(locale, "style.distinctive", strings.Join(quoted, ", ")))
+		}
+
+		if len(report.Emoji) > 0 {
+			fmt.Fprintln(&sb, i18n.T(locale, "style.emoji", strings.Join(report.Emoji, " ")))
+		}
+
+		content = sb.String()
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleOptOut(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	optedOut := data.Bool("enabled")
+	schizo.SetOptOut(e.User().ID, optedOut)
+	if optedOut {
+		notify(e.Client(), schizo, "opted_out", discord.UserMention(e.User().ID))
+	} else {
+		notify(e.Client(), schizo, "opted_in", discord.UserMention(e.User().ID))
+	}
+
+	var content = i18n.T(interactionLocale(e), "optout.disabled")
+	if optedOut {
+		content = i18n.T(interactionLocale(e), "optout.enabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleBlockUser(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	locale := interactionLocale(e)
+
+	var lines []string
+	if member := e.Member(); member == nil || !member.Permissions.Has(discord.PermissionManageGuild) {
+		lines = append(lines, i18n.T(locale, "common.manage_guild_block"))
+	} else if user, ok := data.OptUser("user"); ok {
+		blocked, ok := data.OptBool("blocked")
+		if !ok {
+			blocked = true
+		}
+
+		switch {
+		case !schizo.SetBlocked(user.ID, blocked) && blocked:
+			lines = append(lines, i18n.T(locale, "blockuser.already", user.ID))
+		case blocked:
+			lines = append(lines, i18n.T(locale, "blockuser.blocked", user.ID))
+		default:
+			lines = append(lines, i18n.T(locale, "blockuser.unblocked", user.ID))
+		}
+
+		if data.Bool("forget") {
+			b.enqueue(jobForgetUser, "forget/"+e.GuildID().String()+"/"+user.ID.String(), jobs.High, forgetUserJob{GuildID: *e.GuildID(), UserID: user.ID, By: e.User().ID})
+			lines = append(lines, i18n.T(locale, "blockuser.forgetting"))
+		}
+	} else if blocked := schizo.BlockedList(); len(blocked) == 0 {
+		lines = append(lines, i18n.T(locale, "blockuser.none"))
+	} else {
+		lines = append(lines, i18n.T(locale, "blockuser.title"))
+		for _, userID := range blocked {
+			lines = append(lines, fmt.Sprintf("<@%s>", userID))
+		}
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(strings.Join(lines, "\n")).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleImpersonate(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	user := data.User("user")
+
+	var learned bool
+	var impersonate = func() string {
+		var out string
+		out, learned = schizo.Impersonate(user.ID, data.String("prompt"), b.replyLength(e.ApplicationCommandInteraction, 512))
+		return liveEmoji(e.Client(), *e.GuildID(), out)
+	}
+
+	var content string
+	var posted bool
+	locale := interactionLocale(e)
+	if schizo.IsOptedOut(user.ID) {
+		content = i18n.T(locale, "common.opted_out", user.Username)
+	} else if out := schizo.FilterOutput(impersonate); !learned {
+		content = i18n.T(locale, "common.nothing_learned", user.Username)
+	} else if out == "" {
+		content = i18n.T(locale, "impersonate.nothing_to_say", user.Username)
+	} else {
+		// the imitation goes out under the user's name and avatar, leaving
+		// the command to be acknowledged, unless the bot can't use webhooks
+		name, avatarURL := user.EffectiveName(), user.EffectiveAvatarURL()
+		if member, ok := data.OptMember("user"); ok {
+			name, avatarURL = member.EffectiveName(), member.EffectiveAvatarURL()
+		}
+
+		content = out
+		if err := b.postAs(e.Client(), e.Channel().ID(), name, avatarURL, out); err != nil {
+			gatewayLog.Warn("Failed to impersonate through a webhook", slog.Any("guildID", e.GuildID()), slog.String("channelID", e.Channel().ID().String()), slog.String("err", err.Error()))
+		} else {
+			content, posted = i18n.T(locale, "impersonate.posted", name), true
+		}
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		SetEphemeral(posted).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleSay(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	prompt := data.String("prompt")
+	length := schizo.ChannelSettings(e.Channel().ID()).ReplyLength(chat.ReplyLength)
+	length = b.replyLength(e.ApplicationCommandInteraction, length)
+
+	generate := func(schizo *brain.Brain) string {
+		return schizo.ReplyIn(e.Channel().ID(), prompt, length)
+	}
+
+	var content string
+	message := discord.NewMessageCreateBuilder().
+		SetAllowedMentions(&discord.AllowedMentions{})
+	if !schizo.Consented(b.policy()) {
+		content = i18n.T(interactionLocale(e), "common.consent_required")
+	} else if isNSFW(e.Client(), e.Channel().ID()) && !schizo.GuildSettings().AllowNSFW {
+		content = i18n.T(interactionLocale(e), "common.nsfw_refused")
+	} else if !schizo.ReplyTurn(e.Channel().ID(), time.Now()) {
+		content = i18n.T(interactionLocale(e), "common.cooldown")
+	} else if content = schizo.FilterOutput(func() string {
+		return liveEmoji(e.Client(), *e.GuildID(), generate(schizo))
+	}); content == "" {
+		content = i18n.T(interactionLocale(e), "common.nothing_to_say")
+	} else {
+		message.AddActionRow(b.offerRegenerate(e.ID(), regeneration{userID: e.User().ID, generate: generate}))
+	}
+
+	if err := e.CreateMessage(message.
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleAsk(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	question := data.String("question")
+	length := schizo.ChannelSettings(e.Channel().ID()).ReplyLength(chat.ReplyLength)
+	length = b.replyLength(e.ApplicationCommandInteraction, length)
+
+	generate := func(schizo *brain.Brain) string {
+		return schizo.Ask(e.Channel().ID(), question, length)
+	}
+	// the question is quoted since slash commands don't show it
+	quote := "> " + strings.ReplaceAll(question, "\n", " ") + "\n"
+
+	var content string
+	message := discord.NewMessageCreateBuilder().
+		SetAllowedMentions(&discord.AllowedMentions{})
+	if !schizo.Consented(b.policy()) {
+		content = i18n.T(interactionLocale(e), "common.consent_required")
+	} else if isNSFW(e.Client(), e.Channel().ID()) && !schizo.GuildSettings().AllowNSFW {
+		content = i18n.T(interactionLocale(e), "common.nsfw_refused")
+	} else if !schizo.ReplyTurn(e.Channel().ID(), time.Now()) {
+		content = i18n.T(interactionLocale(e), "common.cooldown")
+	} else if answer := schizo.FilterOutput(func() string {
+		return liveEmoji(e.Client(), *e.GuildID(), generate(schizo))
+	}); answer == "" {
+		content = i18n.T(interactionLocale(e), "common.no_idea")
+	} else {
+		content = quote + answer
+		message.AddActionRow(b.offerRegenerate(e.ID(), regeneration{userID: e.User().ID, prefix: quote, generate: generate}))
+	}
+
+	if err := e.CreateMessage(message.
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleEntities(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	// anyone can see the entities, only managers change them
+	if !canManage(e) && hasOption(data, "add", "remove") {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	locale := interactionLocale(e)
+
+	var lines []string
+	if name, ok := data.OptString("add"); ok {
+		if utf8.RuneCountInString(name) < brain.MinEntityLength {
+			lines = append(lines, i18n.T(locale, "entities.too_short", brain.MinEntityLength))
+		} else {
+			schizo.AddEntity(name)
+			lines = append(lines, i18n.T(locale, "entities.added", name))
+		}
+	}
+
+	if name, ok := data.OptString("remove"); ok {
+		if schizo.RemoveEntity(name) {
+			lines = append(lines, i18n.T(locale, "entities.removed", name))
+		} else {
+			lines = append(lines, i18n.T(locale, "entities.unknown", name))
+		}
+	}
+
+	if entities := schizo.Entities(); len(entities) == 0 {
+		lines = append(lines, i18n.T(locale, "entities.none"))
+	} else {
+		lines = append(lines, i18n.T(locale, "entities.list", strings.Join(entities, ", ")))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(strings.Join(lines, "\n")).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleNecromancer(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	hours := data.Int("hours")
+	schizo.SetNecromancer(time.Duration(hours) * time.Hour)
+
+	var content = i18n.T(interactionLocale(e), "necromancer.enabled", hours)
+	if hours == 0 {
+		content = i18n.T(interactionLocale(e), "necromancer.disabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleImports(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	// anyone can see what was imported, only managers change it
+	if _, ok := data.OptFloat("weight"); (ok || data.Bool("purge")) && !canManage(e) {
+		return refuseManage(e, "common.manage_guild_imports")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	locale := interactionLocale(e)
+
+	var lines []string
+	if weight, ok := data.OptFloat("weight"); ok {
+		schizo.SetImportWeight(weight)
+		lines = append(lines, i18n.T(locale, "imports.weight", weight))
+	}
+
+	if data.Bool("purge") {
+		if err := schizo.TakeSnapshot(brain.SnapshotPurgeImports); err != nil {
+			gatewayLog.Error("Failed to take snapshot", slog.Any("guildID", schizo.GuildID), slog.String("err", err.Error()))
+			lines = append(lines, i18n.T(locale, "imports.snapshot_failed"))
+		} else {
+			purged := schizo.PurgeImports()
+			schizo.RecordAction(e.User().ID, brain.AuditPurgeImports, fmt.Sprintf("%d messages", purged))
+			notify(e.Client(), schizo, "purged_imports", purged, discord.UserMention(e.User().ID))
+			lines = append(lines, i18n.T(locale, "imports.purged", purged))
+		}
+	}
+
+	if imports := schizo.ImportLog(); len(imports) == 0 {
+		lines = append(lines, i18n.T(locale, "imports.none"))
+	} else {
+		lines = append(lines, i18n.T(locale, "imports.title"))
+		for _, imp := range imports {
+			lines = append(lines, i18n.T(locale, "imports.entry",
+				discordTime(imp.At), imp.Source, imp.Format, imp.Messages, imp.Skipped, imp.Duplicates, imp.Authors))
+		}
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(strings.Join(lines, "\n")).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handlePrune(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_prune")
+	}
+
+	b.retrieveGuildBrain(e.Client(), *e.GuildID())
+
+	// pruning a large brain takes a while, the response follows once it's
+	// done
+	if err := e.DeferCreateMessage(false); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	b.enqueue(jobPrune, "prune/"+e.GuildID().String(), jobs.Normal, pruneJob{
+		GuildID:  *e.GuildID(),
+		K:        data.Int("k"),
+		By:       e.User().ID,
+		Response: response{ApplicationID: e.ApplicationID(), Token: e.Token()},
+	})
+
+	return nil
+}
+
+func (b *Bot) handlePlayground(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	previous := schizo.GuildSettings().PlaygroundChannel
+
+	var content = i18n.T(interactionLocale(e), "playground.disabled")
+	if channel, ok := data.OptChannel("channel"); ok {
+		cooldown := brain.DefaultPlaygroundCooldown
+		if seconds, ok := data.OptInt("cooldown"); ok {
+			cooldown = time.Duration(seconds) * time.Second
+		}
+
+		schizo.SetPlayground(channel.ID, cooldown)
+		setSlowmode(e.Client(), channel.ID, cooldown)
+		content = i18n.T(interactionLocale(e), "playground.enabled", channel.ID, cooldown)
+	} else {
+		schizo.SetPlayground(0, 0)
+	}
+
+	if previous != 0 && previous != schizo.GuildSettings().PlaygroundChannel {
+		setSlowmode(e.Client(), previous, 0)
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+// setSlowmode matches a channel's slowmode to the playground cooldown, so
+// members see how long they have to wait. Without the permission to manage
+// the channel the cooldown is only enforced by the bot.
+func setSlowmode(client bot.Client, channelID snowflake.ID, cooldown time.Duration) {
+	seconds := int(cooldown.Seconds())
+
+	if _, err := client.Rest().UpdateChannel(channelID, discord.GuildTextChannelUpdate{RateLimitPerUser: &seconds}); err != nil {
+		client.Logger().Warn("Failed to set playground slowmode", slog.String("channelID", channelID.String()), slog.Any("err", err))
+	}
+}
@@ -0,0 +1,109 @@
+package discordbot
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/i18n"
+)
+
+func (b *Bot) handleConfig(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	channel := data.Channel("channel")
+	settings := schizo.ChannelSettings(channel.ID)
+
+	if learn, ok := data.OptBool("learn"); ok && learn != schizo.IsWhitelisted(channel.ID) {
+		schizo.SetLearning(channel.ID, learn)
+		if learn {
+			schizo.RememberName(channel.Name)
+			notify(e.Client(), schizo, "watched", discord.ChannelMention(channel.ID), discord.UserMention(e.User().ID))
+		} else {
+			notify(e.Client(), schizo, "unwatched", discord.ChannelMention(channel.ID), discord.UserMention(e.User().ID))
+		}
+	}
+
+	var changed bool
+	if autoReply, ok := data.OptBool("autoreply"); ok {
+		settings.AutoReply, changed = autoReply, true
+	}
+	if chance, ok := data.OptFloat("chance"); ok {
+		settings.ReplyChance, changed = chance, true
+	}
+	if length, ok := data.OptInt("length"); ok {
+		settings.MaxLength, changed = length, true
+	}
+	if seconds, ok := data.OptInt("cooldown"); ok {
+		settings.Cooldown, changed = time.Duration(seconds)*time.Second, true
+	}
+	if minutes, ok := data.OptInt("post"); ok {
+		settings.PostInterval, changed = time.Duration(minutes)*time.Minute, true
+	}
+	if random, ok := data.OptBool("random"); ok {
+		settings.PostJitter, changed = random, true
+	}
+	if hour, ok := data.OptInt("quiet_start"); ok {
+		settings.QuietStart, changed = hour, true
+	}
+	if hour, ok := data.OptInt("quiet_end"); ok {
+		settings.QuietEnd, changed = hour, true
+	}
+	if digest, ok := data.OptBool("digest"); ok {
+		settings.Digest, changed = digest, true
+	}
+	if changed {
+		schizo.SetChannelSettings(channel.ID, settings)
+	}
+
+	locale := interactionLocale(e)
+
+	var learning = "config.ignored"
+	if schizo.IsWhitelisted(channel.ID) {
+		learning = "config.learned"
+	}
+
+	var summary = i18n.T(locale, learning+"_mentioned", channel.ID)
+	if settings.AutoReply {
+		summary = i18n.T(locale, learning+"_auto", channel.ID, settings.ReplyChance*100)
+	}
+
+	var lines = []string{
+		summary,
+		i18n.T(locale, "config.length", settings.ReplyLength(chat.ReplyLength)),
+	}
+	if cooldown := schizo.ReplyCooldown(channel.ID); cooldown > 0 {
+		lines = append(lines, i18n.T(locale, "config.cooldown", cooldown))
+	}
+	if settings.PostInterval > 0 {
+		var posts = "config.posts"
+		if settings.PostJitter {
+			posts = "config.posts_random"
+		}
+
+		if settings.QuietStart != settings.QuietEnd {
+			lines = append(lines, i18n.T(locale, posts+"_quiet", settings.PostInterval, settings.QuietStart, settings.QuietEnd))
+		} else {
+			lines = append(lines, i18n.T(locale, posts, settings.PostInterval))
+		}
+	}
+	if settings.Digest {
+		lines = append(lines, i18n.T(locale, "config.digest"))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(strings.Join(lines, "\n")).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package discordbot
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// versions of the privacy notice, bumped whenever it changes in a way guilds
+// have to accept again. Keeping a message log is news to guilds that accepted
+// the notice without it.
+const (
+	policyVersion           = 1
+	policyVersionMessageLog = 2
+)
+
+// policy is the version of the privacy notice guilds have to accept
+func (b *Bot) policy() int {
+	if b.config.Load().Storage.MessageLog {
+		return policyVersionMessageLog
+	}
+
+	return policyVersion
+}
+
+// notice is the privacy notice guilds have to accept
+func (b *Bot) notice(locale string) string {
+	if storage := b.config.Load().Storage; storage.MessageLog {
+		return i18n.T(locale, "privacy.notice_message_log", storage.MessageLogDays)
+	}
+
+	return i18n.T(locale, "privacy.notice")
+}
+
+func (b *Bot) noticeMessage(locale string) discord.MessageCreate {
+	return discord.NewMessageCreateBuilder().
+		SetContent(b.notice(locale)).
+		AddActionRow(
+			discord.NewPrimaryButton(i18n.T(locale, "privacy.accept"), "/consent/accept"),
+			discord.NewSecondaryButton(i18n.T(locale, "privacy.configure"), "/consent/configure"),
+		).
+		Build()
+}
+
+// promptConsent posts the privacy notice in a channel, unless the guild was
+// already shown the current version
+func (b *Bot) promptConsent(client bot.Client, schizo *brain.Brain, guildID snowflake.ID, channelID snowflake.ID) {
+	if !schizo.NoticeDue(b.policy()) {
+		return
+	}
+
+	if _, err := createMessage(client, channelID, b.noticeMessage(guildLocale(client, guildID))); err != nil {
+		gatewayLog.Error("Failed to post privacy notice", slog.Any("guildID", guildID), slog.String("channelID", channelID.String()), slog.String("err", err.Error()))
+	}
+}
+
+func (b *Bot) handlePrivacy(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	settings := schizo.GuildSettings()
+
+	locale := interactionLocale(e)
+	message := b.noticeMessage(locale)
+	if schizo.Consented(b.policy()) {
+		message = discord.NewMessageCreateBuilder().
+			SetContent(i18n.T(locale, "privacy.accepted", b.notice(locale), settings.ConsentedBy, discordTime(settings.ConsentedAt))).
+			SetAllowedMentions(&discord.AllowedMentions{}).
+			Build()
+	}
+
+	if err := e.CreateMessage(message); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleConsentAccept(data discord.ButtonInteractionData, e *handler.ComponentEvent) error {
+	member := e.Member()
+	if member == nil || !member.Permissions.Has(discord.PermissionManageGuild) {
+		return e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(i18n.T(interactionLocale(e), "common.manage_guild_accept")).
+			SetEphemeral(true).
+			Build(),
+		)
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	now := time.Now()
+	version := b.policy()
+	schizo.AcceptPolicy(version, member.User.ID, now)
+	schizo.RecordAction(member.User.ID, brain.AuditAcceptPolicy, fmt.Sprintf("version %d", version))
+
+	if err := e.UpdateMessage(discord.NewMessageUpdateBuilder().
+		SetContent(i18n.T(interactionLocale(e), "privacy.accepted", b.notice(interactionLocale(e)), member.User.ID, discordTime(now))).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		ClearContainerComponents().
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleConsentConfigure(data discord.ButtonInteractionData, e *handler.ComponentEvent) error {
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(i18n.T(interactionLocale(e), "privacy.configure_help")).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package discordbot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// width of the coverage timeline in characters
+const coverageWidth = 30
+
+// coverageBar renders a channel's life from from to to as a bar, filled where
+// the span covers it
+func coverageBar(from, to time.Time, span *brain.TrainedSpan) string {
+	var total = to.Sub(from)
+	var sb strings.Builder
+
+	for i := range coverageWidth {
+		// the middle of the cell decides whether it counts as covered
+		t := from.Add(time.Duration((float64(i) + 0.5) / coverageWidth * float64(total)))
+
+		if span != nil && span.DuringSpan(t) {
+			sb.WriteRune('█')
+		} else {
+			sb.WriteRune('░')
+		}
+	}
+
+	return sb.String()
+}
+
+func discordTime(t time.Time) string {
+	return fmt.Sprintf("<t:%d:f>", t.Unix())
+}
+
+func (b *Bot) handleCoverage(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	channel := data.Channel("channel")
+
+	var now = time.Now()
+	var created = channel.ID.Time()
+	var span = schizo.Span(channel.ID)
+	locale := interactionLocale(e)
+
+	var sb strings.Builder
+	fmt.Fprintln(&sb, i18n.T(locale, "coverage.title", channel.ID))
+
+	if !schizo.IsWhitelisted(channel.ID) {
+		fmt.Fprintln(&sb, i18n.T(locale, "coverage.unwatched"))
+	}
+
+	fmt.Fprintf(&sb, "`%s`\n", coverageBar(created, now, span))
+	fmt.Fprintln(&sb, i18n.T(locale, "coverage.lifetime", discordTime(created)))
+
+	if span == nil {
+		sb.WriteString(i18n.T(locale, "coverage.none"))
+	} else {
+		covered := span.End.Sub(span.Start).Seconds() / now.Sub(created).Seconds()
+		fmt.Fprintln(&sb, i18n.T(locale, "coverage.learned", discordTime(span.Start), discordTime(span.End), covered*100))
+
+		// the crawler works backwards from the start, new messages extend the end
+		if span.Start.Sub(created) > time.Minute {
+			fmt.Fprintln(&sb, i18n.T(locale, "coverage.missing", discordTime(created), discordTime(span.Start)))
+		}
+		sb.WriteString(i18n.T(locale, "coverage.quiet", discordTime(span.End)))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(sb.String()).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
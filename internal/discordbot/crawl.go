@@ -0,0 +1,169 @@
+package discordbot
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// how much each crawled page moves the rate, so the estimate follows rate
+// limits and quiet stretches of history without jumping on every page
+const rateSmoothing = 0.3
+
+// crawlRate is how fast the backfill of one channel has been going lately
+type crawlRate struct {
+	// messages learned and history covered per second of crawling
+	messages float64
+	history  float64
+	last     time.Time
+}
+
+// crawlRates tracks the backfill throughput of every channel being crawled.
+type crawlRates struct {
+	mu       sync.Mutex
+	channels map[snowflake.ID]*crawlRate
+}
+
+func newCrawlRates() *crawlRates {
+	return &crawlRates{channels: make(map[snowflake.ID]*crawlRate)}
+}
+
+// record notes that a page of messages covering covered of a channel's
+// history was crawled at now. The first page only starts the clock.
+func (c *crawlRates) record(channelID snowflake.ID, messages int, covered time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rate := c.channels[channelID]
+	if rate == nil {
+		c.channels[channelID] = &crawlRate{last: now}
+		return
+	}
+
+	elapsed := now.Sub(rate.last).Seconds()
+	rate.last = now
+	if elapsed <= 0 {
+		return
+	}
+
+	pageMessages := float64(messages) / elapsed
+	pageHistory := covered.Seconds() / elapsed
+
+	if rate.history == 0 && rate.messages == 0 {
+		rate.messages, rate.history = pageMessages, pageHistory
+		return
+	}
+
+	rate.messages += rateSmoothing * (pageMessages - rate.messages)
+	rate.history += rateSmoothing * (pageHistory - rate.history)
+}
+
+// rate reports a channel's messages per minute and how long the rest of its
+// history, remaining, will take to crawl at that pace. It reports false until
+// there are two pages to measure or while the crawl isn't moving.
+func (c *crawlRates) rate(channelID snowflake.ID, remaining time.Duration) (float64, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rate := c.channels[channelID]
+	if rate == nil || rate.history <= 0 {
+		return 0, 0, false
+	}
+
+	return rate.messages * 60, time.Duration(remaining.Seconds() / rate.history * float64(time.Second)), true
+}
+
+// backlog estimates how many messages the rest of a channel's history,
+// remaining, holds, going by how densely the pages crawled lately were packed.
+// It reports false when rate does.
+func (c *crawlRates) backlog(channelID snowflake.ID, remaining time.Duration) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rate := c.channels[channelID]
+	if rate == nil || rate.history <= 0 {
+		return 0, false
+	}
+
+	return int(remaining.Seconds() * rate.messages / rate.history), true
+}
+
+// crawlStatus describes in locale how far the backfill of a channel got and
+// how long the rest should take
+func (b *Bot) crawlStatus(locale string, schizo *brain.Brain, channelID snowflake.ID) string {
+	var span = schizo.Span(channelID)
+	if span == nil {
+		return i18n.T(locale, "crawl.none")
+	}
+
+	var created = channelID.Time()
+	var remaining = span.Start.Sub(created)
+	if remaining <= time.Minute {
+		return i18n.T(locale, "crawl.done")
+	}
+
+	covered := time.Since(span.Start).Seconds() / time.Since(created).Seconds()
+	status := i18n.T(locale, "crawl.covered", covered*100)
+
+	perMinute, eta, ok := b.crawlRates.rate(channelID, remaining)
+	if !ok {
+		return i18n.T(locale, "crawl.measuring", status)
+	}
+
+	return i18n.T(locale, "crawl.rate", status, perMinute, formatETA(locale, eta))
+}
+
+// formatETA rounds an estimate to the unit that matters at its size
+func formatETA(locale string, eta time.Duration) string {
+	switch {
+	case eta < time.Minute:
+		return i18n.T(locale, "crawl.eta_seconds")
+	case eta < time.Hour:
+		return i18n.T(locale, "crawl.eta_minutes", int(eta.Minutes()))
+	case eta < 48*time.Hour:
+		return i18n.T(locale, "crawl.eta_hours", int(eta.Hours()))
+	default:
+		return i18n.T(locale, "crawl.eta_days", int(eta.Hours()/24))
+	}
+}
+
+func (b *Bot) handleCrawlStatus(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+
+	var channels = schizo.Channels()
+	if channel, ok := data.OptChannel("channel"); ok {
+		channels = []snowflake.ID{channel.ID}
+	}
+
+	locale := interactionLocale(e)
+
+	var sb strings.Builder
+	fmt.Fprintln(&sb, i18n.T(locale, "backfillstatus.title"))
+
+	if len(channels) == 0 {
+		sb.WriteString(i18n.T(locale, "backfillstatus.none"))
+	}
+
+	for _, channelID := range channels {
+		fmt.Fprintf(&sb, "<#%s>: %s\n", channelID, b.crawlStatus(locale, schizo, channelID))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(sb.String()).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package discordbot
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/jobs"
+)
+
+// crawler keeps the guilds whose history is crawled once they caught up with
+// what they missed. Pages of it are crawled as jobs, one at a time per
+// channel.
+type crawler struct {
+	mu sync.Mutex
+	// by the client they were caught up with
+	guilds map[snowflake.ID]bot.Client
+}
+
+func newCrawler() *crawler {
+	return &crawler{guilds: make(map[snowflake.ID]bot.Client)}
+}
+
+// add has the guild's history crawled with client from the next round on
+func (c *crawler) add(client bot.Client, guildID snowflake.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.guilds[guildID] = client
+}
+
+// remove stops crawling the guild's history, unless it was added again with
+// another client
+func (c *crawler) remove(client bot.Client, guildID snowflake.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.guilds[guildID] == client {
+		delete(c.guilds, guildID)
+	}
+}
+
+// snapshot lists the guilds being crawled, to go through without holding
+// the lock
+func (c *crawler) snapshot() map[snowflake.ID]bot.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var guilds = make(map[snowflake.ID]bot.Client, len(c.guilds))
+	for guildID, client := range c.guilds {
+		guilds[guildID] = client
+	}
+
+	return guilds
+}
+
+// client is the one the guild is crawled with, false while it isn't
+func (c *crawler) client(guildID snowflake.ID) (bot.Client, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	client, ok := c.guilds[guildID]
+	return client, ok
+}
+
+// startCrawling catches up with what the guild missed while the bot was
+// offline, then has the scheduler crawl its older history
+func (b *Bot) startCrawling(client bot.Client, guildID snowflake.ID) {
+	defer crash.Recover()
+
+	// what was missed while offline comes before older history
+	b.catchUp(client, guildID)
+
+	if b.serves(client, guildID) {
+		b.crawler.add(client, guildID)
+	}
+}
+
+// scheduleCrawls queues a page of every watched channel of the guilds being
+// crawled once per train interval
+func (b *Bot) scheduleCrawls() {
+	defer crash.Recover()
+
+	if seconds := b.config.Load().TrainIntervalSeconds; seconds <= 0 {
+		gatewayLog.Error("Invalid train interval, falling back to 60 seconds", slog.Int("seconds", seconds))
+	}
+
+	for {
+		for guildID, client := range b.crawler.snapshot() {
+			// the bot reconnected and started over with another client
+			if !b.serves(client, guildID) {
+				b.crawler.remove(client, guildID)
+				continue
+			}
+
+			// crawling pauses while the brain is unloaded for being idle
+			schizo := b.brains.Loaded(guildID)
+			if schizo == nil || !schizo.Consented(b.policy()) {
+				continue
+			}
+
+			// a channel whose last page is still queued or crawled is
+			// left to it
+			for _, channelID := range schizo.Channels() {
+				b.enqueue(jobBackfill, "backfill/"+channelID.String(), jobs.Low, backfillJob{GuildID: guildID, ChannelID: channelID})
+			}
+		}
+
+		time.Sleep(b.trainInterval())
+	}
+}
+
+// runBackfill crawls a page of a channel's history, unless its guild stopped
+// being crawled meanwhile; the scheduler queues it again if it starts over
+func (b *Bot) runBackfill(ctx context.Context, job jobs.Job) error {
+	var page backfillJob
+	if err := job.Decode(&page); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	client, ok := b.crawler.client(page.GuildID)
+	schizo := b.brains.Loaded(page.GuildID)
+	if !ok || schizo == nil {
+		return nil
+	}
+
+	// catching up with the channel is left to finish or be cancelled
+	task, ok := b.crawls.Start(ctx, page.ChannelID.String())
+	if !ok {
+		return nil
+	}
+	defer b.crawls.Done(task)
+
+	b.observeSomeMessages(client, schizo, page.ChannelID, task)
+	return nil
+}
@@ -0,0 +1,56 @@
+package discordbot
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// customEmoji matches custom emoji markup, capturing the name and ID
+var customEmoji = regexp.MustCompile(`<a?:(\w+):(\d+)>`)
+
+// spaceRun matches what is left around an emoji that was dropped
+var spaceRun = regexp.MustCompile(`[ \t]{2,}`)
+
+// liveEmoji fixes up the custom emoji in generated text to those the guild
+// still has. Emoji learned before they were deleted show up as broken
+// markup, so one that was re-uploaded under the same name is swapped for
+// the new one and the rest are dropped.
+func liveEmoji(client bot.Client, guildID snowflake.ID, text string) string {
+	var dropped bool
+	text = customEmoji.ReplaceAllStringFunc(text, func(markup string) string {
+		match := customEmoji.FindStringSubmatch(markup)
+		if id, err := snowflake.Parse(match[2]); err == nil {
+			if _, ok := client.Caches().Emoji(guildID, id); ok {
+				return markup
+			}
+		}
+
+		if emoji, ok := emojiNamed(client, guildID, match[1]); ok {
+			return emoji.Mention()
+		}
+
+		dropped = true
+		return ""
+	})
+
+	if !dropped {
+		return text
+	}
+	return strings.TrimSpace(spaceRun.ReplaceAllString(text, " "))
+}
+
+// emojiNamed looks up a guild's custom emoji by name
+func emojiNamed(client bot.Client, guildID snowflake.ID, name string) (discord.Emoji, bool) {
+	var found discord.Emoji
+	var ok bool
+	client.Caches().EmojisForEach(guildID, func(emoji discord.Emoji) {
+		if !ok && emoji.Name == name {
+			found, ok = emoji, true
+		}
+	})
+	return found, ok
+}
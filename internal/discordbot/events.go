@@ -0,0 +1,154 @@
+package discordbot
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/tracing"
+	"github.com/schizoid/pkg/brain"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// reacted onto playground messages sent during the author's cooldown and
+// mentions beyond the rate limit
+const cooldownReaction = "⏳"
+
+// outbox answers through the Discord REST API
+type outbox struct {
+	client  bot.Client
+	guildID snowflake.ID
+	// returns the button regenerating what is sent, nil to send it without
+	regenerate func() discord.InteractiveComponent
+}
+
+func (o outbox) Send(channelID snowflake.ID, text string) error {
+	if text = liveEmoji(o.client, o.guildID, text); text == "" {
+		return nil
+	}
+
+	// learned mentions come out whole, but never ping anyone
+	message := discord.NewMessageCreateBuilder().
+		SetContent(text).
+		SetAllowedMentions(&discord.AllowedMentions{})
+	if o.regenerate != nil {
+		message.AddActionRow(o.regenerate())
+	}
+
+	_, err := createMessage(o.client, channelID, message.Build())
+	return err
+}
+
+func (o outbox) React(channelID, messageID snowflake.ID, emoji string) error {
+	return o.client.Rest().AddReaction(channelID, messageID, emoji)
+}
+
+func (b *Bot) onMessageCreate(event *events.MessageCreate) {
+	if event.Message.Author.Bot {
+		return
+	}
+
+	mentioned_users := event.Message.Mentions
+	mentioned := slices.ContainsFunc(mentioned_users, func(u discord.User) bool { return u.ID == event.Client().ID() })
+
+	// the brain stays unloaded until a message is learned or answered
+	if !mentioned && !b.brains.Watches(*event.GuildID, event.ChannelID) {
+		return
+	}
+
+	ctx, span := tracer.Start(context.Background(), "discord.MessageCreate", trace.WithAttributes(tracing.Guild(*event.GuildID), tracing.Channel(event.ChannelID)))
+	defer span.End()
+
+	var schizo = b.retrieveGuildBrain(event.Client(), *event.GuildID)
+
+	// nothing is learned or said until an admin accepts the privacy notice
+	if !schizo.Consented(b.policy()) {
+		b.promptConsent(event.Client(), schizo, *event.GuildID, event.ChannelID)
+		return
+	}
+
+	var msg = chat.Incoming{Message: toBrainMessage(event.Client(), event.Message)}
+
+	// respond if bot is mentioned, as often as the rate limit allows
+	if mentioned {
+		if ok, _ := b.replyLimit.Allow(event.Message.Author.ID, time.Now()); ok {
+			msg.Addressed = true
+			msg.Prompt = strings.NewReplacer(
+				"<@"+event.Client().ID().String()+">", "",
+				"<@!"+event.Client().ID().String()+">", "",
+			).Replace(event.Message.Content)
+		} else if err := event.Client().Rest().AddReaction(event.ChannelID, event.MessageID, cooldownReaction); err != nil {
+			event.Client().Logger().Error("Failed to react", slog.String("channelID", event.ChannelID.String()), slog.Any("err", err))
+		}
+	}
+
+	// channels set to reply unprompted answer a share of their messages
+	if settings := schizo.ChannelSettings(event.ChannelID); !msg.Addressed && settings.AutoReply && rand.Float64() < settings.ReplyChance {
+		msg.Addressed = true
+		msg.Prompt = event.Message.Content
+	}
+
+	// every message in the playground gets a reply, as often as the member's
+	// cooldown allows
+	if event.ChannelID == schizo.GuildSettings().PlaygroundChannel {
+		if schizo.PlaygroundTurn(event.Message.Author.ID, time.Now()) {
+			if !msg.Addressed {
+				msg.Addressed = true
+				msg.Prompt = event.Message.Content
+			}
+		} else {
+			msg.Addressed = false
+			if err := event.Client().Rest().AddReaction(event.ChannelID, event.MessageID, cooldownReaction); err != nil {
+				event.Client().Logger().Error("Failed to react", slog.String("channelID", event.ChannelID.String()), slog.Any("err", err))
+			}
+		}
+	}
+
+	// events arrive one at a time, so replies are generated on the side to
+	// answer several mentions at once without holding up learning
+	chat.Learn(ctx, schizo, msg)
+	if msg.Addressed {
+		go func() {
+			defer crash.Recover()
+			chat.Reply(ctx, schizo, msg, outbox{event.Client(), *event.GuildID, b.regenerateReply(msg, msg.AuthorID)})
+		}()
+	}
+}
+
+// regenerateReply offers userID to generate the reply to msg again, like
+// chat.Reply does
+func (b *Bot) regenerateReply(msg chat.Incoming, userID snowflake.ID) func() discord.InteractiveComponent {
+	return func() discord.InteractiveComponent {
+		return b.offerRegenerate(msg.ID, regeneration{
+			userID: userID,
+			generate: func(schizo *brain.Brain) string {
+				length := schizo.ChannelSettings(msg.ChannelID).ReplyLength(chat.ReplyLength)
+				return schizo.Converse(msg.Message, msg.Prompt, length)
+			},
+		})
+	}
+}
+
+func (b *Bot) onMessageDelete(event *events.MessageDelete) {
+	if event.Message.Author.Bot {
+		return
+	}
+
+	// only messages from channels that were watched were learned
+	if !b.brains.Learned(*event.GuildID, event.ChannelID) {
+		return
+	}
+
+	var schizo = b.retrieveGuildBrain(event.Client(), *event.GuildID)
+
+	chat.HandleDelete(schizo, toBrainMessage(event.Client(), event.Message))
+}
@@ -0,0 +1,85 @@
+package discordbot
+
+import (
+	"slices"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/gateway"
+)
+
+// feature is a part of the bot with the gateway intents and event listeners
+// it needs, subscribed to only when enabled
+type feature struct {
+	enabled   bool
+	intents   gateway.Intents
+	listeners []bot.EventListener
+}
+
+// features lists what the bot can do over the gateway. Learning and replying
+// in channels is on unless the bot is interaction-only, the rest is switched
+// on in the config.
+func (b *Bot) features() []feature {
+	var enabled = b.config.Load().Features
+
+	return []feature{
+		{
+			enabled: true,
+			// channels are cached from the guild events, for age
+			// restrictions and catching up, and emoji so replies only
+			// use the ones the guild still has
+			intents: gateway.IntentGuilds | gateway.IntentGuildExpressions,
+		},
+		{
+			enabled: !enabled.InteractionOnly,
+			intents: gateway.IntentGuildMessages | gateway.IntentMessageContent,
+			listeners: []bot.EventListener{
+				bot.NewListenerFunc(b.onMessageCreate),
+				bot.NewListenerFunc(b.onMessageDelete),
+			},
+		},
+		{
+			enabled: enabled.Reactions,
+			// votes on the bot's messages reward what it said, and the
+			// trigger emoji has it reply
+			intents: gateway.IntentGuildMessageReactions,
+			listeners: []bot.EventListener{
+				bot.NewListenerFunc(b.onReactionAdd),
+				bot.NewListenerFunc(b.onReactionRemove),
+			},
+		},
+		{enabled: enabled.Members, intents: gateway.IntentGuildMembers},
+		{enabled: enabled.ScheduledEvents, intents: gateway.IntentGuildScheduledEvents},
+		{enabled: enabled.Voice, intents: gateway.IntentGuildVoiceStates},
+	}
+}
+
+// subscriptions collects the intents and listeners of the enabled features
+func (b *Bot) subscriptions() (gateway.Intents, []bot.EventListener) {
+	var intents gateway.Intents
+	var listeners []bot.EventListener
+
+	for _, feature := range b.features() {
+		if !feature.enabled {
+			continue
+		}
+
+		intents |= feature.intents
+		listeners = append(listeners, feature.listeners...)
+	}
+
+	return intents, listeners
+}
+
+// commands that only make sense when the bot reads channels
+var messageCommands = []string{"watchchannel", "coverage", "crawl", "necromancer", "playground", "config", "trigger"}
+
+// commands lists the slash commands to register, leaving out those needing
+// channel messages when the bot is interaction-only and those speaking when
+// it can't
+func (b *Bot) commands() []discord.ApplicationCommandCreate {
+	return slices.DeleteFunc(slices.Clone(commands), func(command discord.ApplicationCommandCreate) bool {
+		return (b.config.Load().Features.InteractionOnly && slices.Contains(messageCommands, command.CommandName())) ||
+			(!b.canSpeak() && slices.Contains(voiceCommands, command.CommandName()))
+	})
+}
@@ -0,0 +1,128 @@
+package discordbot
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+func (b *Bot) handleFeed(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	text := strings.TrimSpace(data.String("text"))
+	locale := interactionLocale(e)
+
+	var content string
+	if !schizo.Consented(b.policy()) {
+		content = i18n.T(locale, "common.consent_required_learn")
+	} else if text == "" {
+		content = i18n.T(locale, "feed.empty")
+	} else {
+		switch id, err := schizo.Feed(e.User().ID, text, time.Now()); {
+		case err == nil:
+			content = i18n.T(locale, "feed.learned", id, id)
+		case errors.Is(err, brain.ErrFeedCooldown):
+			content = i18n.T(locale, "feed.cooldown", brain.FeedCooldown)
+		case errors.Is(err, brain.ErrFeedBlocked):
+			content = i18n.T(locale, "feed.denied")
+		case errors.Is(err, brain.ErrOptedOut):
+			content = i18n.T(locale, "feed.opted_out")
+		case errors.Is(err, brain.ErrBlocked):
+			content = i18n.T(locale, "feed.blocked")
+		case errors.Is(err, brain.ErrFull):
+			content = i18n.T(locale, "feed.full")
+		}
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleFeeds(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	locale := interactionLocale(e)
+
+	var lines []string
+	if user, ok := data.OptUser("purge"); ok {
+		member := e.Member()
+		if user.ID != e.User().ID && (member == nil || !member.Permissions.Has(discord.PermissionManageGuild)) {
+			lines = append(lines, i18n.T(locale, "common.manage_guild_unfeed"))
+		} else {
+			purged := schizo.PurgeFeeds(user.ID)
+			schizo.RecordAction(e.User().ID, brain.AuditPurgeFeeds, fmt.Sprintf("%d phrases fed by %s", purged, user.ID))
+			lines = append(lines, i18n.T(locale, "feeds.purged", purged, user.ID))
+		}
+	}
+
+	counts := schizo.FeedCounts()
+	if len(counts) == 0 {
+		lines = append(lines, i18n.T(locale, "feeds.none"))
+	} else {
+		lines = append(lines, i18n.T(locale, "feeds.title"))
+
+		authors := slices.Collect(maps.Keys(counts))
+		slices.SortFunc(authors, func(a, b snowflake.ID) int { return counts[b] - counts[a] })
+		for _, authorID := range authors {
+			lines = append(lines, fmt.Sprintf("<@%s>: %d", authorID, counts[authorID]))
+		}
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(strings.Join(lines, "\n")).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
+
+func (b *Bot) handleUnfeed(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	id := data.Int("id")
+	locale := interactionLocale(e)
+
+	var content = i18n.T(locale, "unfeed.unlearned", id)
+	feed, ok := schizo.FeedByID(id)
+	member := e.Member()
+	if !ok {
+		content = i18n.T(locale, "unfeed.unknown", id)
+	} else if feed.AuthorID != e.User().ID && (member == nil || !member.Permissions.Has(discord.PermissionManageGuild)) {
+		content = i18n.T(locale, "common.manage_guild_unfeed")
+	} else if !schizo.Unfeed(id) {
+		content = i18n.T(locale, "unfeed.already", id)
+	} else {
+		schizo.RecordAction(e.User().ID, brain.AuditUnfeed, fmt.Sprintf("phrase #%d fed by %s", id, feed.AuthorID))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		SetEphemeral(true).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
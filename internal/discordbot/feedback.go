@@ -0,0 +1,85 @@
+package discordbot
+
+import (
+	"log/slog"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// reactions on the bot's messages that reward what it said
+const (
+	upvoteReaction   = "👍"
+	downvoteReaction = "👎"
+)
+
+// vote tells how a reaction rates a message, reporting false for reactions
+// that aren't votes
+func vote(emoji string) (good bool, ok bool) {
+	switch emoji {
+	case upvoteReaction:
+		return true, true
+	case downvoteReaction:
+		return false, true
+	}
+	return false, false
+}
+
+func (b *Bot) onReactionAdd(event *events.GuildMessageReactionAdd) {
+	if event.MessageAuthorID == nil || *event.MessageAuthorID != event.Client().ID() {
+		b.onTrigger(event)
+		return
+	}
+
+	if good, ok := vote(event.Emoji.Reaction()); ok {
+		b.reward(event.Client(), event.GuildID, event.ChannelID, event.MessageID, event.UserID, good)
+	}
+}
+
+func (b *Bot) onReactionRemove(event *events.GuildMessageReactionRemove) {
+	// taking a vote back undoes it
+	if good, ok := vote(event.Emoji.Reaction()); ok {
+		b.reward(event.Client(), event.GuildID, event.ChannelID, event.MessageID, event.UserID, !good)
+	}
+}
+
+// reward feeds a vote on one of the bot's messages back into the guild's
+// brain
+func (b *Bot) reward(client bot.Client, guildID, channelID, messageID, userID snowflake.ID, good bool) {
+	if userID == client.ID() {
+		return
+	}
+
+	message, err := reactedMessage(client, channelID, messageID)
+	if err != nil {
+		gatewayLog.Error("Failed to fetch voted message", slog.Any("guildID", guildID), slog.String("messageID", messageID.String()), slog.String("err", err.Error()))
+		return
+	}
+
+	if message.Author.ID != client.ID() {
+		return
+	}
+
+	schizo := b.retrieveGuildBrain(client, guildID)
+	if !schizo.Consented(b.policy()) {
+		return
+	}
+
+	schizo.Reward(message.Content, good)
+}
+
+// reactedMessage looks up a message reacted to, from the cache if it's still
+// there
+func reactedMessage(client bot.Client, channelID, messageID snowflake.ID) (discord.Message, error) {
+	if message, ok := client.Caches().Message(channelID, messageID); ok {
+		return message, nil
+	}
+
+	message, err := client.Rest().GetMessage(channelID, messageID)
+	if err != nil {
+		return discord.Message{}, err
+	}
+	return *message, nil
+}
@@ -0,0 +1,148 @@
+package discordbot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/internal/jobs"
+	"github.com/schizoid/pkg/brain"
+	"github.com/schizoid/pkg/corpus"
+)
+
+// attachments larger than this are refused
+const maxImportBytes = 25 << 20
+
+// how often the response shows the import's progress
+const importProgressInterval = 2 * time.Second
+
+var importHTTP = &http.Client{Timeout: time.Minute}
+
+func formatChoices() []discord.ApplicationCommandOptionChoiceString {
+	var choices []discord.ApplicationCommandOptionChoiceString
+	for _, format := range corpus.Formats {
+		choices = append(choices, discord.ApplicationCommandOptionChoiceString{Name: format, Value: format})
+	}
+	return choices
+}
+
+func (b *Bot) handleImport(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	var refusal string
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	attachment := data.Attachment("file")
+
+	switch {
+	case e.Member() == nil || !e.Member().Permissions.Has(discord.PermissionManageGuild):
+		refusal = i18n.T(interactionLocale(e), "common.manage_guild_import")
+	case !schizo.Consented(b.policy()):
+		refusal = i18n.T(interactionLocale(e), "common.consent_required_learn")
+	case attachment.Size > maxImportBytes:
+		refusal = i18n.T(interactionLocale(e), "import.too_large", attachment.Filename, maxImportBytes>>20)
+	}
+
+	if refusal != "" {
+		if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(refusal).
+			SetEphemeral(true).
+			Build(),
+		); err != nil {
+			e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+			return err
+		}
+		return nil
+	}
+
+	if err := e.DeferCreateMessage(false); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	format := data.String("format")
+	if format == "" {
+		format = "lines"
+	}
+
+	b.enqueue(jobImport, "", jobs.Normal, importJob{
+		GuildID:  *e.GuildID(),
+		URL:      attachment.URL,
+		Filename: attachment.Filename,
+		Format:   format,
+		Response: response{ApplicationID: e.ApplicationID(), Token: e.Token()},
+	})
+
+	return nil
+}
+
+// runImport downloads and learns an export, keeping the deferred response up
+// to date with its progress. Failed downloads are retried, exports that
+// can't be read aren't.
+func (b *Bot) runImport(ctx context.Context, job jobs.Job) error {
+	var imp importJob
+	if err := job.Decode(&imp); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	// the import goes on without a response to update
+	var update = func(key string, args ...any) {
+		if client, ok := b.guildClient(imp.GuildID); ok {
+			imp.Response.update(client, i18n.T(guildLocale(client, imp.GuildID), key, args...))
+		}
+	}
+
+	records, err := downloadCorpus(ctx, imp.URL, imp.Format)
+	if err != nil {
+		update("import.unreadable", imp.Filename, err)
+		return err
+	}
+
+	var last = time.Now()
+	var progress = func(done int) {
+		if time.Since(last) < importProgressInterval {
+			return
+		}
+		last = time.Now()
+
+		update("import.progress", imp.Filename, done, len(records))
+	}
+
+	schizo := b.brains.Get(imp.GuildID)
+	if err := schizo.TakeSnapshot(brain.SnapshotImport); err != nil {
+		update("import.snapshot_failed", imp.Filename, err)
+		return err
+	}
+	learned := schizo.ImportRecords(records, nil, brain.Import{Source: imp.Filename, Format: imp.Format, At: time.Now()}, progress)
+
+	update("import.done", learned.Messages, imp.Filename, learned.Skipped, learned.Duplicates)
+
+	return nil
+}
+
+func downloadCorpus(ctx context.Context, url, format string) ([]corpus.Record, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	resp, err := importHTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading attachment: %s", resp.Status)
+	}
+
+	records, err := corpus.Read(io.LimitReader(resp.Body, maxImportBytes), format)
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	return records, nil
+}
@@ -0,0 +1,144 @@
+package discordbot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/internal/jobs"
+	"github.com/schizoid/pkg/brain"
+)
+
+// kinds of the jobs the bot queues
+const (
+	jobBackfill   = "backfill"
+	jobForgetUser = "forget_user"
+	jobImport     = "import"
+	jobPrune      = "prune"
+	jobRebuild    = "rebuild"
+)
+
+// backfillJob crawls a page of a channel's history
+type backfillJob struct {
+	GuildID   snowflake.ID `json:"guild_id"`
+	ChannelID snowflake.ID `json:"channel_id"`
+}
+
+// forgetUserJob unlearns a member, on behalf of By
+type forgetUserJob struct {
+	GuildID snowflake.ID `json:"guild_id"`
+	UserID  snowflake.ID `json:"user_id"`
+	By      snowflake.ID `json:"by"`
+}
+
+// response is the deferred response to the command a job was queued by,
+// which the job updates for as long as Discord lets it
+type response struct {
+	ApplicationID snowflake.ID `json:"application_id"`
+	Token         string       `json:"token"`
+}
+
+// importJob learns an export attached to /import
+type importJob struct {
+	GuildID  snowflake.ID `json:"guild_id"`
+	URL      string       `json:"url"`
+	Filename string       `json:"filename"`
+	Format   string       `json:"format"`
+	Response response     `json:"response"`
+}
+
+// pruneJob forgets the n-grams of a guild seen fewer than K times, on behalf
+// of By
+type pruneJob struct {
+	GuildID  snowflake.ID `json:"guild_id"`
+	K        int          `json:"k"`
+	By       snowflake.ID `json:"by"`
+	Response response     `json:"response"`
+}
+
+// rebuildJob relearns a guild's brain from its message log if it is due,
+// and otherwise drops what it forgot or keeps no longer from the log
+type rebuildJob struct {
+	GuildID snowflake.ID `json:"guild_id"`
+}
+
+// handleJobs has the queue run the bot's jobs
+func (b *Bot) handleJobs() {
+	b.jobs.Handle(jobBackfill, b.runBackfill)
+	b.jobs.Handle(jobForgetUser, b.runForgetUser)
+	b.jobs.Handle(jobImport, b.runImport)
+	b.jobs.Handle(jobPrune, b.runPrune)
+	b.jobs.Handle(jobRebuild, b.runRebuild)
+}
+
+// enqueue queues a job, reporting false if an alike one is queued already or
+// it couldn't be queued
+func (b *Bot) enqueue(kind, key string, priority jobs.Priority, payload any) bool {
+	queued, err := b.jobs.Enqueue(kind, key, priority, payload)
+	if err != nil {
+		gatewayLog.Error("Failed to queue job", slog.String("kind", kind), slog.String("err", err.Error()))
+	}
+
+	return queued
+}
+
+// guildClient is the client the guild is served with, false until the bot
+// heard from it
+func (b *Bot) guildClient(guildID snowflake.ID) (bot.Client, bool) {
+	b.guildsMu.Lock()
+	defer b.guildsMu.Unlock()
+
+	client, ok := b.guilds[guildID]
+	return client, ok
+}
+
+// update replaces the content of a job's deferred response
+func (r response) update(client bot.Client, content string) {
+	if _, err := client.Rest().UpdateInteractionResponse(r.ApplicationID, r.Token, discord.NewMessageUpdateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		gatewayLog.Error("error on sending response", slog.Any("err", err))
+	}
+}
+
+func (b *Bot) runForgetUser(ctx context.Context, job jobs.Job) error {
+	var forget forgetUserJob
+	if err := job.Decode(&forget); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	schizo := b.brains.Get(forget.GuildID)
+	forgotten := schizo.ForgetUser(forget.UserID)
+	schizo.RecordAction(forget.By, brain.AuditForgetUser, fmt.Sprintf("%d messages of %s", forgotten, forget.UserID))
+
+	if client, ok := b.guildClient(forget.GuildID); ok {
+		notify(client, schizo, "forgot_user", forgotten, discord.UserMention(forget.UserID), discord.UserMention(forget.By))
+	}
+
+	return nil
+}
+
+func (b *Bot) runPrune(ctx context.Context, job jobs.Job) error {
+	var prune pruneJob
+	if err := job.Decode(&prune); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	schizo := b.brains.Get(prune.GuildID)
+	if err := schizo.TakeSnapshot(brain.SnapshotPrune); err != nil {
+		return err
+	}
+	pruned := schizo.Prune(prune.K)
+	schizo.RecordAction(prune.By, brain.AuditPrune, fmt.Sprintf("%d n-grams seen fewer than %d times", pruned, prune.K))
+
+	if client, ok := b.guildClient(prune.GuildID); ok {
+		prune.Response.update(client, i18n.T(guildLocale(client, prune.GuildID), "prune.done", pruned, prune.K))
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package discordbot
+
+import (
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+)
+
+// localized is what command and component events share about where they
+// came from
+type localized interface {
+	Locale() discord.Locale
+	GuildLocale() *discord.Locale
+}
+
+// interactionLocale is the language to answer an interaction in, the guild's
+// preferred one, or the member's own outside of guilds
+func interactionLocale(e localized) string {
+	if locale := e.GuildLocale(); locale != nil {
+		return locale.Code()
+	}
+
+	return e.Locale().Code()
+}
+
+// guildLocale is the preferred language of a guild, for messages that don't
+// answer an interaction
+func guildLocale(client bot.Client, guildID snowflake.ID) string {
+	if guild, ok := client.Caches().Guild(guildID); ok && guild.PreferredLocale != "" {
+		return guild.PreferredLocale
+	}
+
+	return i18n.Fallback
+}
@@ -0,0 +1,73 @@
+package discordbot
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// colour of the notices in log channels
+const noticeColor = 0x5865f2
+
+// notify posts a notice about what the bot learns from in the guild's log
+// channel, if it has one. The notice is titled by the message event in the
+// log table and described by event_detail formatted with args. It is posted
+// on the side, so commands don't wait for it.
+func notify(client bot.Client, schizo *brain.Brain, event string, args ...any) {
+	channelID := schizo.GuildSettings().LogChannel
+	if channelID == 0 {
+		return
+	}
+
+	locale := guildLocale(client, schizo.GuildID)
+	embed := discord.NewEmbedBuilder().
+		SetTitle(i18n.T(locale, "log."+event)).
+		SetDescription(i18n.T(locale, "log."+event+"_detail", args...)).
+		SetColor(noticeColor).
+		SetTimestamp(time.Now()).
+		Build()
+
+	go func() {
+		defer crash.Recover()
+
+		if _, err := createMessage(client, channelID, discord.NewMessageCreateBuilder().
+			SetEmbeds(embed).
+			SetAllowedMentions(&discord.AllowedMentions{}).
+			Build(),
+		); err != nil {
+			gatewayLog.Warn("Failed to post to log channel", slog.Any("guildID", schizo.GuildID), slog.String("channelID", channelID.String()), slog.String("err", err.Error()))
+		}
+	}()
+}
+
+func (b *Bot) handleLogChannel(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+
+	var content string
+	if member := e.Member(); member == nil || !member.Permissions.Has(discord.PermissionManageGuild) {
+		content = i18n.T(interactionLocale(e), "common.manage_guild_log")
+	} else if channel, ok := data.OptChannel("channel"); ok {
+		schizo.SetLogChannel(channel.ID)
+		content = i18n.T(interactionLocale(e), "logchannel.enabled", discord.ChannelMention(channel.ID))
+		notify(e.Client(), schizo, "enabled", discord.UserMention(e.User().ID))
+	} else {
+		schizo.SetLogChannel(0)
+		content = i18n.T(interactionLocale(e), "logchannel.disabled")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package discordbot
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+)
+
+// premiumSKUs parses the SKUs of the premium guild subscriptions, which the
+// config already checked are IDs
+func (b *Bot) premiumSKUs() []snowflake.ID {
+	var skus []snowflake.ID
+	for _, sku := range b.config.Load().Premium.SKUs {
+		skus = append(skus, snowflake.MustParse(sku))
+	}
+
+	return skus
+}
+
+// premium reports whether the guild an interaction came from has an active
+// subscription to a premium SKU. Discord sends the entitlements along with
+// every interaction, so nothing needs to be looked up. Every guild is premium
+// when no SKUs are configured.
+func (b *Bot) premium(interaction discord.Interaction) bool {
+	skus := b.premiumSKUs()
+	if len(skus) == 0 {
+		return true
+	}
+
+	guildID := interaction.GuildID()
+	if guildID == nil {
+		return false
+	}
+
+	var now = time.Now()
+	for _, entitlement := range interaction.Entitlements() {
+		if entitlement.Deleted || entitlement.GuildID == nil || *entitlement.GuildID != *guildID {
+			continue
+		}
+
+		// subscriptions that ran out without being renewed end
+		if entitlement.EndsAt != nil && !now.Before(*entitlement.EndsAt) {
+			continue
+		}
+
+		if slices.Contains(skus, entitlement.SkuID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// requirePremium answers the premium commands used in other guilds with an
+// invitation to subscribe instead of running them
+func (b *Bot) requirePremium(next handler.Handler) handler.Handler {
+	return func(e *handler.InteractionEvent) error {
+		command, ok := e.Interaction.(discord.ApplicationCommandInteraction)
+		if !ok || !slices.Contains(b.config.Load().Premium.Commands, command.Data.CommandName()) || b.premium(command) {
+			return next(e)
+		}
+
+		message := discord.NewMessageCreateBuilder().
+			SetContent(i18n.T(interactionLocale(command), "premium.required", command.Data.CommandName())).
+			SetEphemeral(true)
+		if skus := b.premiumSKUs(); len(skus) > 0 {
+			message.AddActionRow(discord.NewPremiumButton(skus[0]))
+		}
+
+		if err := e.CreateMessage(message.Build()); err != nil {
+			e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+			return err
+		}
+
+		return nil
+	}
+}
+
+// replyLength caps the length of replies to interactions from guilds without
+// premium
+func (b *Bot) replyLength(interaction discord.Interaction, length int) int {
+	if free := b.config.Load().Premium.FreeReplyLength; free > 0 && !b.premium(interaction) {
+		return min(length, free)
+	}
+
+	return length
+}
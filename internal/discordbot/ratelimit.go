@@ -0,0 +1,53 @@
+package discordbot
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/i18n"
+)
+
+// the commands generating a reply, which count against the rate limit
+var replyCommands = []string{"say", "ask", "impersonate"}
+
+// asksForReply reports whether an interaction has the bot generate a reply
+func asksForReply(interaction discord.Interaction) bool {
+	switch interaction := interaction.(type) {
+	case discord.ApplicationCommandInteraction:
+		return slices.Contains(replyCommands, interaction.Data.CommandName())
+	case discord.ComponentInteraction:
+		return strings.HasPrefix(interaction.Data.CustomID(), "/regenerate/")
+	}
+
+	return false
+}
+
+// limitReplies turns away members asking for replies faster than the rate
+// limit allows, so nobody can keep the bot busy on their own
+func (b *Bot) limitReplies(next handler.Handler) handler.Handler {
+	return func(e *handler.InteractionEvent) error {
+		if !asksForReply(e.Interaction) {
+			return next(e)
+		}
+
+		ok, wait := b.replyLimit.Allow(e.User().ID, time.Now())
+		if ok {
+			return next(e)
+		}
+
+		if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(i18n.T(interactionLocale(e), "ratelimit.limited", wait.Round(time.Second))).
+			SetEphemeral(true).
+			Build(),
+		); err != nil {
+			e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+			return err
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+package discordbot
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/jobs"
+	"github.com/schizoid/pkg/brain"
+)
+
+// scheduleRebuilds queues the upkeep of every loaded brain's message log on
+// the store's daily schedule, at the hour the config picks
+func (b *Bot) scheduleRebuilds() {
+	defer crash.Recover()
+
+	hour := func() int { return b.config.Load().Storage.RebuildHour }
+	b.brains.ScheduleUpkeep(context.Background(), hour, func(guildID snowflake.ID, _ time.Time) {
+		b.enqueue(jobRebuild, "rebuild/"+guildID.String(), jobs.Low, rebuildJob{GuildID: guildID})
+	})
+}
+
+func (b *Bot) runRebuild(ctx context.Context, job jobs.Job) error {
+	var rebuild rebuildJob
+	if err := job.Decode(&rebuild); err != nil {
+		return jobs.Permanent(err)
+	}
+
+	// unloaded meanwhile
+	if b.brains.Loaded(rebuild.GuildID) == nil {
+		return nil
+	}
+
+	storage := b.config.Load().Storage
+	rebuilt, err := b.brains.Upkeep(rebuild.GuildID, time.Duration(storage.RebuildDays)*24*time.Hour, time.Now())
+	if errors.Is(err, brain.ErrCannotRebuild) {
+		return jobs.Permanent(err)
+	}
+	if err != nil || rebuilt == nil {
+		return err
+	}
+
+	if client, ok := b.guildClient(rebuild.GuildID); ok {
+		notify(client, rebuilt, "rebuilt", storage.MessageLogDays)
+	}
+
+	return nil
+}
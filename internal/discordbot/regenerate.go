@@ -0,0 +1,110 @@
+package discordbot
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// replies can be generated again for this long after they were posted,
+// until then what they answered is kept in memory
+const regenerateWindow = time.Hour
+
+// regeneration is how a posted reply is generated again
+type regeneration struct {
+	// who asked for the reply, the only one who may regenerate it
+	userID snowflake.ID
+	// put in front of every version of the reply, like the question /ask
+	// quotes
+	prefix string
+	// generates the reply, unfiltered
+	generate func(schizo *brain.Brain) string
+	offered  time.Time
+}
+
+// offerRegenerate remembers how to generate a reply again and returns the
+// button doing so, to attach to the reply. key tells replies apart, like
+// the ID of the message or interaction they answer.
+func (b *Bot) offerRegenerate(key snowflake.ID, reg regeneration) discord.InteractiveComponent {
+	b.regenerationsMu.Lock()
+	defer b.regenerationsMu.Unlock()
+
+	now := time.Now()
+	for id, old := range b.regenerations {
+		if now.Sub(old.offered) > regenerateWindow {
+			delete(b.regenerations, id)
+		}
+	}
+
+	reg.offered = now
+	b.regenerations[key] = reg
+
+	return discord.NewSecondaryButton("", "/regenerate/"+key.String()).
+		WithEmoji(discord.ComponentEmoji{Name: "🔄"})
+}
+
+func (b *Bot) regeneration(key snowflake.ID) (regeneration, bool) {
+	b.regenerationsMu.Lock()
+	defer b.regenerationsMu.Unlock()
+
+	reg, ok := b.regenerations[key]
+	if !ok || time.Since(reg.offered) > regenerateWindow {
+		return regeneration{}, false
+	}
+
+	return reg, true
+}
+
+// handleRegenerate replaces a reply with a new one generated from the same
+// prompt
+func (b *Bot) handleRegenerate(data discord.ButtonInteractionData, e *handler.ComponentEvent) error {
+	key, _ := snowflake.Parse(e.Vars["key"])
+	reg, ok := b.regeneration(key)
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+
+	var refusal string
+	switch {
+	case !ok:
+		refusal = i18n.T(interactionLocale(e), "regenerate.expired")
+	case e.User().ID != reg.userID:
+		refusal = i18n.T(interactionLocale(e), "regenerate.not_yours")
+	case !schizo.Consented(b.policy()):
+		refusal = i18n.T(interactionLocale(e), "common.consent_required")
+	case !schizo.ReplyTurn(e.Channel().ID(), time.Now()):
+		refusal = i18n.T(interactionLocale(e), "common.cooldown")
+	}
+
+	var reply string
+	if refusal == "" {
+		reply = schizo.FilterOutput(func() string {
+			return liveEmoji(e.Client(), *e.GuildID(), reg.generate(schizo))
+		})
+		if reply == "" {
+			refusal = i18n.T(interactionLocale(e), "common.nothing_to_say")
+		}
+	}
+
+	if refusal != "" {
+		return e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(refusal).
+			SetEphemeral(true).
+			Build(),
+		)
+	}
+
+	if err := e.UpdateMessage(discord.NewMessageUpdateBuilder().
+		SetContent(reg.prefix + reply).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
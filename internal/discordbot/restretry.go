@@ -0,0 +1,101 @@
+package discordbot
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// how often a Discord request is tried before giving up; rate limits are
+// waited out by disgo and don't count
+const restAttempts = 4
+
+// the delay before the first retry, doubled for each further one up to
+// restMaxBackoff; each retry waits a random share of it so requests failing
+// together don't retry together
+const (
+	restBackoff    = 500 * time.Millisecond
+	restMaxBackoff = 10 * time.Second
+)
+
+// restRetries counts Discord requests tried again and restGaveUp the ones
+// still failing after every attempt, by operation. Both are served with the
+// other expvars at /debug/vars.
+var (
+	restRetries = expvar.NewMap("discord_rest_retries")
+	restGaveUp  = expvar.NewMap("discord_rest_gave_up")
+)
+
+// permanentRESTError reports whether trying a request again can't help:
+// Discord refused it, or the caller stopped waiting
+func permanentRESTError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var restErr rest.Error
+	if errors.As(err, &restErr) && restErr.Response != nil {
+		status := restErr.Response.StatusCode
+		return status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+	}
+
+	// the connection failed or Discord had trouble of its own
+	return false
+}
+
+// retryREST calls a Discord request until it succeeds, fails for good or
+// runs out of attempts, backing off between tries
+func retryREST[T any](ctx context.Context, op string, call func() (T, error)) (T, error) {
+	var backoff = restBackoff
+	for attempt := 1; ; attempt++ {
+		result, err := call()
+		if err == nil || permanentRESTError(err) {
+			return result, err
+		}
+
+		if attempt == restAttempts {
+			restGaveUp.Add(op, 1)
+			gatewayLog.Error("Discord request kept failing, giving up", slog.String("op", op), slog.Int("attempts", attempt), slog.String("err", err.Error()))
+			return result, err
+		}
+
+		restRetries.Add(op, 1)
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(rand.N(backoff) + 1):
+		}
+		backoff = min(backoff*2, restMaxBackoff)
+	}
+}
+
+// createMessage posts a message, retrying failures. A nonce keeps a retry of
+// a message that did arrive from posting it twice.
+func createMessage(client bot.Client, channelID snowflake.ID, message discord.MessageCreate) (*discord.Message, error) {
+	if message.Nonce == "" {
+		message.Nonce = strconv.FormatUint(rand.Uint64(), 36)
+		message.EnforceNonce = true
+	}
+
+	return retryREST(context.Background(), "create_message", func() (*discord.Message, error) {
+		return client.Rest().CreateMessage(channelID, message)
+	})
+}
+
+// getMessages fetches a page of a channel's history, retrying failures until
+// ctx is done
+func getMessages(ctx context.Context, client bot.Client, channelID, around, before, after snowflake.ID, limit int) ([]discord.Message, error) {
+	return retryREST(ctx, "get_messages", func() ([]discord.Message, error) {
+		return client.Rest().GetMessages(channelID, around, before, after, limit, rest.WithCtx(ctx))
+	})
+}
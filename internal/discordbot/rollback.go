@@ -0,0 +1,111 @@
+package discordbot
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// snapshotChoices suggests the snapshots whose name contains what was typed
+// so far, the newest first
+func snapshotChoices(schizo *brain.Brain, typed string) []discord.AutocompleteChoice {
+	var choices []discord.AutocompleteChoice
+	for _, snapshot := range schizo.Snapshots() {
+		name := snapshot.Reason + ", " + snapshot.At.Format("2006-01-02 15:04 UTC")
+		if !strings.Contains(snapshot.Name, strings.ToLower(typed)) && !strings.Contains(name, typed) {
+			continue
+		}
+
+		choices = append(choices, discord.AutocompleteChoiceString{Name: name, Value: snapshot.Name})
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+	}
+
+	return choices
+}
+
+func (b *Bot) handleSnapshotAutocomplete(e *handler.AutocompleteEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	typed := e.Data.String(e.Data.Focused().Name)
+
+	return e.AutocompleteResult(snapshotChoices(schizo, typed))
+}
+
+// handleRollback lists the snapshots of the guild's brain, or restores the
+// one picked
+func (b *Bot) handleRollback(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	locale := interactionLocale(e)
+
+	member := e.Member()
+	if member == nil || !member.Permissions.Has(discord.PermissionManageGuild) {
+		return e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(i18n.T(locale, "common.manage_guild_rollback")).
+			SetEphemeral(true).
+			Build(),
+		)
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+
+	name, ok := data.OptString("snapshot")
+	if !ok {
+		var lines = []string{i18n.T(locale, "rollback.title")}
+		snapshots := schizo.Snapshots()
+		if len(snapshots) == 0 {
+			lines = append(lines, i18n.T(locale, "rollback.none"))
+		}
+		for _, snapshot := range snapshots {
+			lines = append(lines, i18n.T(locale, "rollback.entry", snapshot.Name, snapshot.Reason, discordTime(snapshot.At), float64(snapshot.Size)/(1<<20)))
+		}
+
+		if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(strings.Join(lines, "\n")).
+			SetEphemeral(true).
+			Build(),
+		); err != nil {
+			e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+			return err
+		}
+		return nil
+	}
+
+	// reading a large brain back takes longer than an interaction may go
+	// unanswered
+	if err := e.DeferCreateMessage(false); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	go func() {
+		defer crash.Recover()
+
+		var content = i18n.T(locale, "rollback.restored", name)
+		restored, err := b.brains.Restore(*e.GuildID(), name)
+		switch {
+		case errors.Is(err, brain.ErrNoSnapshot):
+			content = i18n.T(locale, "rollback.unknown", name)
+		case err != nil:
+			gatewayLog.Error("Failed to restore snapshot", slog.Any("guildID", *e.GuildID()), slog.String("snapshot", name), slog.String("err", err.Error()))
+			content = i18n.T(locale, "rollback.failed", name)
+		default:
+			restored.RecordAction(e.User().ID, brain.AuditRollback, name)
+			notify(e.Client(), restored, "rolled_back", name, discord.UserMention(e.User().ID))
+		}
+
+		if _, err := e.UpdateInteractionResponse(discord.NewMessageUpdateBuilder().
+			SetContent(content).
+			Build(),
+		); err != nil {
+			e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		}
+	}()
+
+	return nil
+}
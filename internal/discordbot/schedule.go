@@ -0,0 +1,95 @@
+package discordbot
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// how often channels are checked for a scheduled post being due
+const scheduleInterval = time.Minute
+
+// most tokens a line of a digest is generated with
+const digestLineLength = 200
+
+// postScheduled posts unprompted in the guild's channels set to, keeping the
+// server alive, and their daily digests
+func (b *Bot) postScheduled(client bot.Client, guildID snowflake.ID) {
+	defer crash.Recover()
+
+	for {
+		time.Sleep(scheduleInterval)
+
+		// the bot reconnected and started over with another client
+		if !b.serves(client, guildID) {
+			return
+		}
+
+		// an unloaded brain has no schedule to keep, one that posts is kept
+		// loaded so quiet servers still get their posts
+		schizo := b.brains.Loaded(guildID)
+		if schizo == nil || !schizo.Consented(b.policy()) || !schizo.PostsScheduled() {
+			continue
+		}
+		b.brains.Get(guildID)
+
+		for _, channelID := range schizo.DuePosts(time.Now()) {
+			if isNSFW(client, channelID) && !schizo.GuildSettings().AllowNSFW {
+				continue
+			}
+
+			length := schizo.ChannelSettings(channelID).ReplyLength(chat.ReplyLength)
+			post := schizo.FilterOutput(func() string {
+				return liveEmoji(client, guildID, schizo.ReplyIn(channelID, "", length))
+			})
+			if post == "" {
+				continue
+			}
+
+			if _, err := createMessage(client, channelID, discord.NewMessageCreateBuilder().
+				SetContent(post).
+				SetAllowedMentions(&discord.AllowedMentions{}).
+				Build(),
+			); err != nil {
+				gatewayLog.Error("Failed to post on schedule", slog.Any("guildID", guildID), slog.String("channelID", channelID.String()), slog.String("err", err.Error()))
+			}
+		}
+
+		for _, channelID := range schizo.DueDigests(time.Now()) {
+			b.postDigest(client, schizo, channelID)
+		}
+	}
+}
+
+// postDigest posts a channel's mashup of the day
+func (b *Bot) postDigest(client bot.Client, schizo *brain.Brain, channelID snowflake.ID) {
+	if isNSFW(client, channelID) && !schizo.GuildSettings().AllowNSFW {
+		return
+	}
+
+	var lines = []string{i18n.T(guildLocale(client, schizo.GuildID), "digest.title", discord.ChannelMention(channelID))}
+	for _, line := range schizo.Digest(channelID, time.Now(), digestLineLength) {
+		if line = schizo.FilterOutput(func() string { return liveEmoji(client, schizo.GuildID, line) }); line != "" {
+			lines = append(lines, "- "+line)
+		}
+	}
+	if len(lines) == 1 {
+		return
+	}
+
+	if _, err := createMessage(client, channelID, discord.NewMessageCreateBuilder().
+		SetContent(strings.Join(lines, "\n")).
+		SetAllowedMentions(&discord.AllowedMentions{}).
+		Build(),
+	); err != nil {
+		gatewayLog.Error("Failed to post digest", slog.Any("guildID", schizo.GuildID), slog.String("channelID", channelID.String()), slog.String("err", err.Error()))
+	}
+}
@@ -0,0 +1,88 @@
+package discordbot
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/events"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/i18n"
+)
+
+// reaction turns emoji as typed into the form reactions are compared and
+// added in, name:id for custom emoji
+func reaction(emoji string) string {
+	emoji = strings.TrimSpace(emoji)
+	if match := customEmoji.FindStringSubmatch(emoji); match != nil {
+		return match[1] + ":" + match[2]
+	}
+	return emoji
+}
+
+// onTrigger replies to a message the guild's trigger emoji was reacted onto,
+// as if the bot was mentioned in it
+func (b *Bot) onTrigger(event *events.GuildMessageReactionAdd) {
+	if event.UserID == event.Client().ID() || event.Member.User.Bot {
+		return
+	}
+
+	schizo := b.retrieveGuildBrain(event.Client(), event.GuildID)
+	trigger := schizo.GuildSettings().TriggerReaction
+	if trigger == "" || event.Emoji.Reaction() != trigger || !schizo.Consented(b.policy()) {
+		return
+	}
+
+	if ok, _ := b.replyLimit.Allow(event.UserID, time.Now()); !ok {
+		return
+	}
+
+	message, err := reactedMessage(event.Client(), event.ChannelID, event.MessageID)
+	if err != nil {
+		gatewayLog.Error("Failed to fetch triggering message", slog.Any("guildID", event.GuildID), slog.String("messageID", event.MessageID.String()), slog.String("err", err.Error()))
+		return
+	}
+
+	var msg = chat.Incoming{
+		Message:   toBrainMessage(event.Client(), message),
+		Addressed: true,
+		Prompt:    message.Content,
+	}
+
+	go func() {
+		defer crash.Recover()
+		chat.Reply(context.Background(), schizo, msg, outbox{event.Client(), event.GuildID, b.regenerateReply(msg, event.UserID)})
+	}()
+}
+
+func (b *Bot) handleTrigger(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	emoji := reaction(data.String("emoji"))
+	schizo.SetTriggerReaction(emoji)
+
+	var content = i18n.T(interactionLocale(e), "trigger.disabled")
+	if emoji != "" {
+		content = i18n.T(interactionLocale(e), "trigger.enabled", data.String("emoji"))
+	}
+	if !b.config.Load().Features.Reactions {
+		content += " " + i18n.T(interactionLocale(e), "trigger.reactions_off")
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package discordbot
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/pkg/brain"
+)
+
+// Discord shows at most this many autocomplete suggestions
+const maxAutocompleteChoices = 25
+
+// channelName is how a channel is called as far as the cache knows, its ID
+// otherwise
+func channelName(client bot.Client, channelID snowflake.ID) string {
+	if channel, ok := client.Caches().Channel(channelID); ok {
+		return "#" + channel.Name()
+	}
+
+	return channelID.String()
+}
+
+// watchedChoices suggests the channels a guild learns from whose name
+// contains what was typed so far, for options that only make sense for them.
+// Channel options can't be narrowed down, so those take the ID as a string.
+func watchedChoices(client bot.Client, schizo *brain.Brain, typed string) []discord.AutocompleteChoice {
+	typed = strings.ToLower(strings.TrimPrefix(typed, "#"))
+
+	var choices []discord.AutocompleteChoice
+	for _, channelID := range schizo.Watched() {
+		if !schizo.IsWhitelisted(channelID) {
+			continue
+		}
+
+		name := channelName(client, channelID)
+		if !strings.Contains(strings.ToLower(name), typed) && !strings.HasPrefix(channelID.String(), typed) {
+			continue
+		}
+
+		choices = append(choices, discord.AutocompleteChoiceString{Name: name, Value: channelID.String()})
+	}
+
+	slices.SortFunc(choices, func(a, b discord.AutocompleteChoice) int {
+		return strings.Compare(a.ChoiceName(), b.ChoiceName())
+	})
+	if len(choices) > maxAutocompleteChoices {
+		choices = choices[:maxAutocompleteChoices]
+	}
+
+	return choices
+}
+
+func (b *Bot) handleWatchedAutocomplete(e *handler.AutocompleteEvent) error {
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+	typed := e.Data.String(e.Data.Focused().Name)
+
+	return e.AutocompleteResult(watchedChoices(e.Client(), schizo, typed))
+}
+
+func (b *Bot) handleUnwatchChannel(data discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	if !canManage(e) {
+		return refuseManage(e, "common.manage_guild_settings")
+	}
+
+	schizo := b.retrieveGuildBrain(e.Client(), *e.GuildID())
+
+	var content string
+	channelID, err := snowflake.Parse(data.String("channel"))
+	if err != nil || !schizo.IsWhitelisted(channelID) {
+		content = i18n.T(interactionLocale(e), "unwatchchannel.unknown")
+	} else {
+		schizo.SetLearning(channelID, false)
+		notify(e.Client(), schizo, "unwatched", discord.ChannelMention(channelID), discord.UserMention(e.User().ID))
+		content = i18n.T(interactionLocale(e), "unwatchchannel.removed", channelName(e.Client(), channelID))
+	}
+
+	if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+		SetContent(content).
+		Build(),
+	); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,325 @@
+package discordbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/handler"
+	"github.com/disgoorg/disgo/voice"
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/i18n"
+	"github.com/schizoid/internal/tts"
+	"github.com/schizoid/pkg/brain"
+)
+
+// how long joining a voice channel may take
+const voiceJoinTimeout = 10 * time.Second
+
+// how long a line may take to synthesize
+const ttsTimeout = 30 * time.Second
+
+// voiceCommands are only registered when the bot can speak
+var voiceCommands = []string{"voice"}
+
+// spokenMarkup is chat markup that makes no sense read out
+var spokenMarkup = regexp.MustCompile(`<[^<>\s]+>`)
+
+var (
+	errNotInVoice     = errors.New("not in a voice channel")
+	errAlreadyInVoice = errors.New("already in a voice channel")
+)
+
+// voiceSession is the bot speaking in one of a guild's voice channels
+type voiceSession struct {
+	channelID snowflake.ID
+	cancel    context.CancelFunc
+	// closed once the connection is closed
+	done chan struct{}
+}
+
+// speaker provides the frames of the lines being spoken to a voice
+// connection, which sends silence while there are none
+type speaker struct {
+	mu     sync.Mutex
+	frames [][]byte
+}
+
+func (s *speaker) ProvideOpusFrame() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.frames) == 0 {
+		return nil, nil
+	}
+
+	frame := s.frames[0]
+	s.frames = s.frames[1:]
+	return frame, nil
+}
+
+func (s *speaker) Close() {}
+
+// say queues the frames of a line
+func (s *speaker) say(frames [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.frames = append(s.frames, frames...)
+}
+
+// speaking reports whether frames are left to send
+func (s *speaker) speaking() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.frames) > 0
+}
+
+// canSpeak reports whether voice channels can be joined at all
+func (b *Bot) canSpeak() bool {
+	return b.config.Load().Features.Voice && b.config.Load().Voice.TTSCommand != ""
+}
+
+func (b *Bot) handleVoiceJoin(_ discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	var refusal string
+	guildID := *e.GuildID()
+	schizo := b.retrieveGuildBrain(e.Client(), guildID)
+	state, inVoice := e.Client().Caches().VoiceState(guildID, e.User().ID)
+
+	switch {
+	case !schizo.Consented(b.policy()):
+		refusal = i18n.T(interactionLocale(e), "common.consent_required")
+	case !inVoice || state.ChannelID == nil:
+		refusal = i18n.T(interactionLocale(e), "voice.join_first")
+	case b.voiceChannel(guildID) != 0:
+		refusal = i18n.T(interactionLocale(e), "voice.busy", discord.ChannelMention(b.voiceChannel(guildID)))
+	}
+
+	if refusal != "" {
+		if err := e.CreateMessage(discord.NewMessageCreateBuilder().
+			SetContent(refusal).
+			SetEphemeral(true).
+			Build(),
+		); err != nil {
+			e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+			return err
+		}
+		return nil
+	}
+
+	if err := e.DeferCreateMessage(false); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	go func() {
+		defer crash.Recover()
+
+		var content = i18n.T(interactionLocale(e), "voice.joined", discord.ChannelMention(*state.ChannelID))
+		if err := b.joinVoice(e.Client(), schizo, *state.ChannelID); errors.Is(err, errAlreadyInVoice) {
+			content = i18n.T(interactionLocale(e), "voice.busy", discord.ChannelMention(b.voiceChannel(guildID)))
+		} else if err != nil {
+			gatewayLog.Error("Failed to join voice channel", slog.Any("guildID", guildID), slog.String("channelID", state.ChannelID.String()), slog.String("err", err.Error()))
+			content = i18n.T(interactionLocale(e), "voice.failed", discord.ChannelMention(*state.ChannelID))
+		}
+
+		if _, err := e.UpdateInteractionResponse(discord.NewMessageUpdateBuilder().
+			SetContent(content).
+			Build(),
+		); err != nil {
+			e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		}
+	}()
+
+	return nil
+}
+
+func (b *Bot) handleVoiceLeave(_ discord.SlashCommandInteractionData, e *handler.CommandEvent) error {
+	// disconnecting can take longer than an interaction may go unanswered
+	if err := e.DeferCreateMessage(false); err != nil {
+		e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		return err
+	}
+
+	go func() {
+		defer crash.Recover()
+
+		var content = i18n.T(interactionLocale(e), "voice.left")
+		if err := b.leaveVoice(*e.GuildID()); errors.Is(err, errNotInVoice) {
+			content = i18n.T(interactionLocale(e), "voice.absent")
+		}
+
+		if _, err := e.UpdateInteractionResponse(discord.NewMessageUpdateBuilder().
+			SetContent(content).
+			Build(),
+		); err != nil {
+			e.Client().Logger().Error("error on sending response", slog.Any("err", err))
+		}
+	}()
+
+	return nil
+}
+
+// voiceChannel returns the channel the bot speaks in in a guild, zero for
+// none
+func (b *Bot) voiceChannel(guildID snowflake.ID) snowflake.ID {
+	b.voicesMu.Lock()
+	defer b.voicesMu.Unlock()
+
+	if session := b.voices[guildID]; session != nil {
+		return session.channelID
+	}
+	return 0
+}
+
+// joinVoice connects to a voice channel and starts speaking there. A guild
+// has a single voice connection, so the bot has to leave first to move.
+func (b *Bot) joinVoice(client bot.Client, schizo *brain.Brain, channelID snowflake.ID) error {
+	guildID := schizo.GuildID
+	ctx, stop := context.WithCancel(context.Background())
+	session := &voiceSession{channelID: channelID, cancel: stop, done: make(chan struct{})}
+
+	b.voicesMu.Lock()
+	if b.voices[guildID] != nil {
+		b.voicesMu.Unlock()
+		stop()
+		return errAlreadyInVoice
+	}
+	b.voices[guildID] = session
+	b.voicesMu.Unlock()
+
+	conn := client.VoiceManager().CreateConn(guildID)
+
+	openCtx, cancel := context.WithTimeout(ctx, voiceJoinTimeout)
+	defer cancel()
+
+	// the bot only talks, so it doesn't listen either
+	if err := conn.Open(openCtx, channelID, false, true); err != nil {
+		conn.Close(openCtx)
+		close(session.done)
+		b.dropVoice(guildID, session)
+		stop()
+		return fmt.Errorf("opening voice connection: %w", err)
+	}
+
+	go b.speak(ctx, client, conn, schizo, session)
+
+	return nil
+}
+
+// leaveVoice stops speaking in a guild, returning once disconnected
+func (b *Bot) leaveVoice(guildID snowflake.ID) error {
+	b.voicesMu.Lock()
+	session := b.voices[guildID]
+	delete(b.voices, guildID)
+	b.voicesMu.Unlock()
+
+	if session == nil {
+		return errNotInVoice
+	}
+
+	session.cancel()
+	<-session.done
+
+	return nil
+}
+
+// dropVoice forgets a session that ended by itself
+func (b *Bot) dropVoice(guildID snowflake.ID, session *voiceSession) {
+	b.voicesMu.Lock()
+	defer b.voicesMu.Unlock()
+
+	if b.voices[guildID] == session {
+		delete(b.voices, guildID)
+	}
+}
+
+// speak reads out a generated line every so often until the bot is told to
+// leave, disconnected or left alone in the channel
+func (b *Bot) speak(ctx context.Context, client bot.Client, conn voice.Conn, schizo *brain.Brain, session *voiceSession) {
+	defer crash.Recover()
+
+	defer close(session.done)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), voiceJoinTimeout)
+		defer cancel()
+		conn.Close(ctx)
+	}()
+
+	spk := &speaker{}
+	conn.SetOpusFrameProvider(spk)
+
+	for {
+		if !spk.speaking() {
+			b.sayLine(ctx, spk, schizo)
+		}
+
+		var interval = time.Duration(b.config.Load().Voice.IntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = 45 * time.Second
+		}
+
+		// lines come at random so the bot blurts rather than recites
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval/2 + rand.N(interval)):
+		}
+
+		if !listened(client, schizo.GuildID, session.channelID) {
+			gatewayLog.Info("Leaving voice channel", slog.Any("guildID", schizo.GuildID), slog.String("channelID", session.channelID.String()))
+			b.dropVoice(schizo.GuildID, session)
+			return
+		}
+	}
+}
+
+// sayLine generates a line and queues it to be spoken
+func (b *Bot) sayLine(ctx context.Context, spk *speaker, schizo *brain.Brain) {
+	line := schizo.FilterOutput(func() string { return schizo.Reply("", chat.ReplyLength) })
+	line = strings.Join(strings.Fields(spokenMarkup.ReplaceAllString(line, "")), " ")
+	if line == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ttsTimeout)
+	defer cancel()
+
+	frames, err := tts.Synthesize(ctx, b.config.Load().Voice.TTSCommand, line)
+	if err != nil {
+		gatewayLog.Error("Failed to synthesize speech", slog.Any("guildID", schizo.GuildID), slog.String("err", err.Error()))
+		return
+	}
+
+	spk.say(frames)
+}
+
+// listened reports whether the bot is still in a voice channel with anyone
+// else
+func listened(client bot.Client, guildID, channelID snowflake.ID) bool {
+	var self, others bool
+	client.Caches().VoiceStatesForEach(guildID, func(state discord.VoiceState) {
+		if state.ChannelID == nil || *state.ChannelID != channelID {
+			return
+		}
+
+		if state.UserID == client.ID() {
+			self = true
+		} else {
+			others = true
+		}
+	})
+
+	return self && others
+}
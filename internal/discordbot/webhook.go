@@ -0,0 +1,96 @@
+package discordbot
+
+import (
+	"fmt"
+
+	"github.com/disgoorg/disgo/bot"
+	"github.com/disgoorg/disgo/discord"
+	"github.com/disgoorg/disgo/rest"
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// name of the webhooks impersonations are posted through
+const webhookName = "schizoid"
+
+// marks impersonated names as the bot's, on top of the app tag Discord puts
+// on every webhook message
+const impersonationSuffix = " (schizoid)"
+
+// the longest name a webhook message can go by
+const maxWebhookUsername = 80
+
+// channelWebhook is the webhook the bot posts through in a channel
+type channelWebhook struct {
+	id    snowflake.ID
+	token string
+}
+
+// webhook returns the bot's webhook in channelID, creating it the first
+// time
+func (b *Bot) webhook(client bot.Client, channelID snowflake.ID) (channelWebhook, error) {
+	b.webhooksMu.Lock()
+	defer b.webhooksMu.Unlock()
+
+	if hook, ok := b.webhooks[channelID]; ok {
+		return hook, nil
+	}
+
+	hooks, err := client.Rest().GetWebhooks(channelID)
+	if err != nil {
+		return channelWebhook{}, fmt.Errorf("listing webhooks: %w", err)
+	}
+
+	for _, hook := range hooks {
+		if incoming, ok := hook.(discord.IncomingWebhook); ok && incoming.User.ID == client.ID() && incoming.Token != "" {
+			b.webhooks[channelID] = channelWebhook{id: incoming.ID(), token: incoming.Token}
+			return b.webhooks[channelID], nil
+		}
+	}
+
+	created, err := client.Rest().CreateWebhook(channelID, discord.WebhookCreate{Name: webhookName})
+	if err != nil {
+		return channelWebhook{}, fmt.Errorf("creating webhook: %w", err)
+	}
+
+	b.webhooks[channelID] = channelWebhook{id: created.ID(), token: created.Token}
+	return b.webhooks[channelID], nil
+}
+
+// postAs posts content in a channel under someone else's name and avatar
+// through the bot's webhook, with the name marked as the bot's
+func (b *Bot) postAs(client bot.Client, channelID snowflake.ID, name, avatarURL, content string) error {
+	var params rest.CreateWebhookMessageParams
+
+	// threads post through their parent channel's webhook
+	if channel, ok := client.Caches().Channel(channelID); ok {
+		if thread, ok := channel.(discord.GuildThread); ok {
+			params.ThreadID = channelID
+			channelID = *thread.ParentID()
+		}
+	}
+
+	hook, err := b.webhook(client, channelID)
+	if err != nil {
+		return err
+	}
+
+	if runes := []rune(name); len(runes)+len(impersonationSuffix) > maxWebhookUsername {
+		name = string(runes[:maxWebhookUsername-len(impersonationSuffix)])
+	}
+
+	if _, err = client.Rest().CreateWebhookMessage(hook.id, hook.token, discord.WebhookMessageCreate{
+		Content:         content,
+		Username:        name + impersonationSuffix,
+		AvatarURL:       avatarURL,
+		AllowedMentions: &discord.AllowedMentions{},
+	}, params); err != nil {
+		// the webhook may have been deleted, the next post looks it up again
+		b.webhooksMu.Lock()
+		delete(b.webhooks, channelID)
+		b.webhooksMu.Unlock()
+
+		return fmt.Errorf("posting through webhook: %w", err)
+	}
+
+	return nil
+}
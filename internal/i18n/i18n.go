@@ -0,0 +1,107 @@
+// Package i18n translates what the bot says in guilds.
+//
+// Translations live in locales/<locale>.toml, named after a Discord locale
+// like de or pt-BR, with a table per command holding fmt format strings. A
+// translation only has to carry the messages it changes, everything else
+// falls back to English. Adding a language is a matter of dropping a new file
+// next to en.toml and rebuilding.
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Fallback is the locale every message is written in.
+const Fallback = "en"
+
+//go:embed locales/*.toml
+var files embed.FS
+
+var catalogs = load()
+
+func load() map[string]map[string]string {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	catalogs := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		locale := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+
+		var tables map[string]map[string]string
+		if _, err := toml.DecodeFS(files, "locales/"+entry.Name(), &tables); err != nil {
+			// a broken translation shouldn't keep the bot from starting, its
+			// messages are shown in English instead
+			slog.Error("Failed to load translation", slog.String("locale", locale), slog.String("err", err.Error()))
+			continue
+		}
+
+		messages := make(map[string]string)
+		for table, keys := range tables {
+			for key, message := range keys {
+				messages[table+"."+key] = message
+			}
+		}
+		catalogs[locale] = messages
+	}
+
+	if _, ok := catalogs[Fallback]; !ok {
+		panic("i18n: no " + Fallback + " translation")
+	}
+
+	return catalogs
+}
+
+// Locales lists the locales that have a translation.
+func Locales() []string {
+	var locales []string
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+
+	return locales
+}
+
+// lookup finds key for locale, trying the locale itself, then its language
+// without the region (pt-BR falls back to pt), then English
+func lookup(locale, key string) (string, bool) {
+	candidates := []string{locale}
+	if language, _, ok := strings.Cut(locale, "-"); ok {
+		candidates = append(candidates, language)
+	}
+	candidates = append(candidates, Fallback)
+
+	for _, candidate := range candidates {
+		if message, ok := catalogs[candidate][key]; ok {
+			return message, true
+		}
+	}
+
+	return "", false
+}
+
+// T formats the message key, like "nsfw.enabled", in locale with args. A key
+// missing from every translation is returned as is, so it shows up in chat
+// rather than an empty message.
+func T(locale, key string, args ...any) string {
+	message, ok := lookup(locale, key)
+	if !ok {
+		slog.Warn("Missing translation", slog.String("key", key))
+		return key
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf(message, args...)
+}
@@ -0,0 +1,259 @@
+// Package irc is an IRC frontend for the same brains the Discord bot uses.
+// Every channel the bot is configured to join gets its own brain and is
+// learned from right away; the bot replies when a message addresses it by
+// nick. IRC has no message IDs, deletions or reactions, so nothing is ever
+// forgotten and low-confidence replies are just dropped.
+package irc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/config"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/pkg/brain"
+)
+
+var gatewayLog = logging.For(logging.Gateway)
+
+// how long to wait before reconnecting after losing the server
+const retryDelay = 30 * time.Second
+
+// Bot serves IRC channels with the brains in a store.
+type Bot struct {
+	config config.IRC
+	brains *brain.Store
+
+	conn *conn
+	// current nick, which may differ from the configured one if that was taken
+	nick string
+}
+
+// New creates a bot for the server and channels in cfg.
+func New(cfg config.IRC, store *brain.Store) *Bot {
+	return &Bot{config: cfg, brains: store}
+}
+
+// channelID maps a channel onto the ID its brain is stored under. Channel
+// names are case-insensitive and only unique within a network.
+func (b *Bot) channelID(channel string) snowflake.ID {
+	return chat.HashID(b.config.Server + "/" + strings.ToLower(channel))
+}
+
+// userID maps a nick onto the ID its author profile is kept under. Nicks
+// aren't registered accounts, so whoever uses a nick shares its profile.
+func (b *Bot) userID(nick string) snowflake.ID {
+	return chat.HashID(b.config.Server + "/" + strings.ToLower(nick))
+}
+
+func isChannel(target string) bool {
+	return target != "" && strings.IndexByte("#&", target[0]) >= 0
+}
+
+// Run stays connected to the server, reconnecting whenever the connection
+// drops, until ctx is done.
+func (b *Bot) Run(ctx context.Context) error {
+	for {
+		err := b.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		gatewayLog.Error("Lost connection to IRC", slog.String("server", b.config.Server), slog.String("err", err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// session connects, registers and handles lines until the connection fails
+func (b *Bot) session(ctx context.Context) error {
+	c, err := dial(b.config.Server, b.config.TLS)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// unblock readLine once ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		c.send("QUIT :shutting down")
+		c.Close()
+	})
+	defer stop()
+
+	b.conn = c
+	b.nick = b.config.Nick
+
+	if b.config.Password != "" {
+		c.send("PASS %s", b.config.Password)
+	}
+	c.send("NICK %s", b.nick)
+	c.send("USER %s 0 * :schizoid", b.nick)
+
+	for {
+		l, err := c.readLine()
+		if err != nil {
+			return err
+		}
+
+		b.onLine(l)
+	}
+}
+
+func (b *Bot) onLine(l line) {
+	switch l.command {
+	case "PING":
+		b.conn.send("PONG :%s", l.param(0))
+	case "001":
+		// registered, the server may have shortened the nick
+		b.nick = l.param(0)
+		gatewayLog.Info("schizoid is now running on IRC", slog.String("server", b.config.Server), slog.String("nick", b.nick))
+
+		for _, channel := range b.config.Channels {
+			b.conn.send("JOIN %s", channel)
+
+			// joining a channel is the operator's choice to learn from it
+			schizo := b.brains.Get(b.channelID(channel))
+			if !schizo.IsWhitelisted(b.channelID(channel)) {
+				schizo.WhitelistChannel(b.channelID(channel))
+			}
+		}
+	case "433":
+		// nick in use while registering
+		b.nick += "_"
+		b.conn.send("NICK %s", b.nick)
+	case "NICK":
+		if strings.EqualFold(l.nick, b.nick) {
+			b.nick = l.param(0)
+		}
+	case "PRIVMSG":
+		b.onPrivmsg(l.nick, l.param(0), l.param(1))
+	}
+}
+
+// outbox answers in IRC channels, addressing the sender by nick
+type outbox struct {
+	conn    *conn
+	channel string
+	sender  string
+}
+
+func (o outbox) Send(_ snowflake.ID, text string) error {
+	return o.conn.privmsg(o.channel, o.sender+": "+text)
+}
+
+func (o outbox) React(_, _ snowflake.ID, _ string) error {
+	return nil
+}
+
+func (b *Bot) onPrivmsg(sender, target, text string) {
+	// only channels have brains
+	if sender == "" || strings.EqualFold(sender, b.nick) || !isChannel(target) {
+		return
+	}
+
+	// CTCP, of which only actions are chat
+	if strings.HasPrefix(text, "\x01") {
+		action, ok := strings.CutPrefix(strings.Trim(text, "\x01"), "ACTION ")
+		if !ok {
+			return
+		}
+		text = action
+	}
+
+	text = strings.TrimSpace(stripFormatting(text))
+	if text == "" {
+		return
+	}
+
+	schizo := b.brains.Get(b.channelID(target))
+
+	if command, ok := strings.CutPrefix(text, "!"); ok && b.onCommand(schizo, target, sender, command) {
+		return
+	}
+
+	prompt, addressed := b.addressed(text)
+	var now = time.Now()
+	var incoming = chat.Incoming{
+		Message: brain.Message{
+			ID:          snowflake.New(now),
+			ChannelID:   b.channelID(target),
+			AuthorID:    b.userID(sender),
+			AuthorNames: []string{sender},
+			Content:     text,
+			CreatedAt:   now,
+		},
+		Addressed: addressed,
+		Prompt:    prompt,
+	}
+
+	chat.HandleMessage(context.Background(), schizo, incoming, outbox{b.conn, target, sender})
+}
+
+// addressed reports whether text mentions the bot's nick, returning it with
+// the mention removed
+func (b *Bot) addressed(text string) (string, bool) {
+	// the usual "nick: message" form
+	if len(text) > len(b.nick) && strings.EqualFold(text[:len(b.nick)], b.nick) {
+		if rest := text[len(b.nick):]; strings.ContainsAny(rest[:1], ":,") {
+			return strings.TrimSpace(rest[1:]), true
+		}
+	}
+
+	lower, nick := strings.ToLower(text), strings.ToLower(b.nick)
+	for i := strings.Index(lower, nick); i >= 0; {
+		end := i + len(nick)
+		if (i == 0 || !isNickChar(lower[i-1])) && (end == len(lower) || !isNickChar(lower[end])) {
+			return strings.TrimSpace(text[:i] + text[end:]), true
+		}
+
+		next := strings.Index(lower[end:], nick)
+		if next < 0 {
+			break
+		}
+		i = end + next
+	}
+
+	return text, false
+}
+
+func isNickChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || isDigit(c) || strings.IndexByte("-_[]\\`^{}|", c) >= 0
+}
+
+// onCommand handles a !command, reporting whether it was one
+func (b *Bot) onCommand(schizo *brain.Brain, channel, sender, command string) bool {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return false
+	}
+
+	var authorID = b.userID(sender)
+	var reply string
+
+	switch fields[0] {
+	case "optout":
+		schizo.SetOptOut(authorID, true)
+		reply = "schizoid will no longer learn from your messages, and your style profile was deleted."
+	case "optin":
+		schizo.SetOptOut(authorID, false)
+		reply = "schizoid will learn from your messages again."
+	default:
+		return false
+	}
+
+	err := outbox{b.conn, channel, sender}.Send(b.channelID(channel), reply)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		gatewayLog.Error("Failed to answer command", slog.String("command", fields[0]), slog.String("err", err.Error()))
+	}
+
+	return true
+}
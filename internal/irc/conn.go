@@ -0,0 +1,189 @@
+package irc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// servers disconnect clients that send lines faster than this
+const sendInterval = 500 * time.Millisecond
+
+// the most bytes of text in one PRIVMSG, leaving room for the prefix the
+// server adds when relaying it within the 512 byte line limit
+const maxTextBytes = 400
+
+// line is a parsed IRC protocol line
+type line struct {
+	// nick of the sender, empty for server messages
+	nick    string
+	command string
+	params  []string
+}
+
+// parseLine splits a raw line, dropping any IRCv3 tags
+func parseLine(raw string) line {
+	var l line
+
+	if strings.HasPrefix(raw, "@") {
+		_, raw, _ = strings.Cut(raw, " ")
+	}
+
+	if strings.HasPrefix(raw, ":") {
+		var prefix string
+		prefix, raw, _ = strings.Cut(raw[1:], " ")
+		l.nick, _, _ = strings.Cut(prefix, "!")
+	}
+
+	raw, trailing, hasTrailing := strings.Cut(raw, " :")
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		return l
+	}
+
+	l.command = strings.ToUpper(fields[0])
+	l.params = fields[1:]
+	if hasTrailing {
+		l.params = append(l.params, trailing)
+	}
+
+	return l
+}
+
+// param returns the i-th parameter or an empty string
+func (l line) param(i int) string {
+	if i < len(l.params) {
+		return l.params[i]
+	}
+	return ""
+}
+
+// conn is a connection to an IRC server
+type conn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	mu       sync.Mutex
+	lastSend time.Time
+}
+
+func dial(addr string, useTLS bool) (*conn, error) {
+	var c net.Conn
+	var err error
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if useTLS {
+		c, err = tls.DialWithDialer(dialer, "tcp", addr, nil)
+	} else {
+		c, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{Conn: c, reader: bufio.NewReader(c)}, nil
+}
+
+func (c *conn) readLine() (line, error) {
+	raw, err := c.reader.ReadString('\n')
+	if err != nil {
+		return line{}, err
+	}
+
+	return parseLine(strings.TrimRight(raw, "\r\n")), nil
+}
+
+// send writes a line, pacing lines so the server doesn't kick the bot for
+// flooding
+func (c *conn) send(format string, args ...any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if wait := sendInterval - time.Since(c.lastSend); wait > 0 {
+		time.Sleep(wait)
+	}
+	c.lastSend = time.Now()
+
+	// line breaks would inject commands
+	text := strings.NewReplacer("\r", " ", "\n", " ").Replace(fmt.Sprintf(format, args...))
+
+	_, err := fmt.Fprintf(c.Conn, "%s\r\n", text)
+	return err
+}
+
+// privmsg sends text to target, split over as many lines as it needs
+func (c *conn) privmsg(target, text string) error {
+	for _, para := range strings.Split(text, "\n") {
+		for _, chunk := range splitText(strings.TrimSpace(para), maxTextBytes) {
+			if err := c.send("PRIVMSG %s :%s", target, chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// splitText breaks text into chunks of at most limit bytes, preferring to
+// break at spaces and never inside a character
+func splitText(text string, limit int) []string {
+	var chunks []string
+
+	for len(text) > limit {
+		cut := limit
+		for cut > 0 && text[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		if space := strings.LastIndexByte(text[:cut], ' '); space > 0 {
+			cut = space
+		}
+
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimLeft(text[cut:], " ")
+	}
+
+	if text != "" {
+		chunks = append(chunks, text)
+	}
+
+	return chunks
+}
+
+// stripFormatting removes mIRC bold, color and other formatting codes
+func stripFormatting(text string) string {
+	var sb strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case 0x02, 0x0F, 0x11, 0x16, 0x1D, 0x1E, 0x1F:
+		case 0x03:
+			// a foreground color of up to two digits, optionally followed by
+			// a comma and the background color
+			next := skipDigits(text, i+1)
+			if next+1 < len(text) && text[next] == ',' && isDigit(text[next+1]) {
+				next = skipDigits(text, next+1)
+			}
+			i = next - 1
+		default:
+			sb.WriteByte(text[i])
+		}
+	}
+
+	return sb.String()
+}
+
+// skipDigits returns the index after up to two digits starting at i
+func skipDigits(text string, i int) int {
+	for n := 0; n < 2 && i < len(text) && isDigit(text[i]); n++ {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,353 @@
+// Package jobs runs background work that outlives the command asking for it,
+// like crawling a page of history, importing a corpus or unlearning a member.
+// Jobs are kept in a file until they are done, so the ones a restart
+// interrupts run again once it is back. Failed jobs are retried with a
+// growing delay, the most urgent ones first.
+package jobs
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/schizoid/internal/crash"
+	"github.com/schizoid/internal/logging"
+)
+
+var brainLog = logging.For(logging.Brain)
+
+// Priority orders the jobs waiting to run, the highest first.
+type Priority int
+
+const (
+	// work nobody waits for, like crawling history
+	Low Priority = iota
+	// work a member asked for and follows, like an import
+	Normal
+	// work owed to members, like unlearning them
+	High
+)
+
+// the first retry waits this long, every further one twice as long as the
+// one before up to maxBackoff
+const (
+	minBackoff = 10 * time.Second
+	maxBackoff = time.Hour
+)
+
+// Job is a piece of background work.
+type Job struct {
+	ID   uint64 `json:"id"`
+	Kind string `json:"kind"`
+	// a job is queued once at a time for a key, empty for no limit
+	Key      string          `json:"key,omitempty"`
+	Priority Priority        `json:"priority"`
+	Payload  json.RawMessage `json:"payload"`
+	// failed runs so far
+	Attempts int `json:"attempts"`
+	// the job waits until then after failing
+	After time.Time `json:"after"`
+}
+
+// Decode unmarshals the job's payload into v.
+func (j Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+// Handler does the work of a job, returning an error to have it retried.
+type Handler func(ctx context.Context, job Job) error
+
+// errPermanent marks errors retrying won't get past
+type errPermanent struct{ err error }
+
+func (e errPermanent) Error() string { return e.err.Error() }
+func (e errPermanent) Unwrap() error { return e.err }
+
+// Permanent wraps an error of a job retrying won't fix, dropping the job
+// right away.
+func Permanent(err error) error {
+	return errPermanent{err}
+}
+
+// Queue keeps jobs until a worker has done them.
+type Queue struct {
+	path        string
+	maxAttempts int
+
+	mu       sync.Mutex
+	waiting  []*Job
+	running  map[uint64]*Job
+	nextID   uint64
+	handlers map[string]Handler
+	draining bool
+
+	// signalled when a job may have become ready
+	wake chan struct{}
+	// running workers
+	workers sync.WaitGroup
+}
+
+// Load creates a queue kept in the file at path, holding the jobs left there
+// when the process last stopped. A missing or unreadable file leaves the
+// queue empty; an empty path keeps it in memory.
+func Load(path string, maxAttempts int) *Queue {
+	q := &Queue{
+		path:        path,
+		maxAttempts: max(maxAttempts, 1),
+		running:     make(map[uint64]*Job),
+		handlers:    make(map[string]Handler),
+		wake:        make(chan struct{}, 1),
+	}
+
+	if path == "" {
+		return q
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &q.waiting)
+	}
+	if err != nil {
+		brainLog.Error("Failed to load job queue, starting empty", slog.String("file", path), slog.String("err", err.Error()))
+		q.waiting = nil
+		return q
+	}
+
+	for _, job := range q.waiting {
+		q.nextID = max(q.nextID, job.ID)
+	}
+	if len(q.waiting) > 0 {
+		brainLog.Info("Resuming queued jobs", slog.String("file", path), slog.Int("jobs", len(q.waiting)))
+	}
+
+	return q
+}
+
+// Handle has jobs of kind done by h. Handlers are registered before Run.
+func (q *Queue) Handle(kind string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.handlers[kind] = h
+}
+
+// Enqueue queues a job of kind with payload, which is stored as JSON. It
+// reports false without queueing anything if a job with the same non-empty
+// key is waiting or running, or the queue is draining.
+func (q *Queue) Enqueue(kind, key string, priority Priority, payload any) (bool, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("encoding %s job: %w", kind, err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.draining || (key != "" && q.queued(key)) {
+		return false, nil
+	}
+
+	q.nextID++
+	q.waiting = append(q.waiting, &Job{ID: q.nextID, Kind: kind, Key: key, Priority: priority, Payload: data})
+	q.save()
+	q.signal()
+
+	return true, nil
+}
+
+// queued reports whether a job with key is waiting or running. The caller
+// holds the lock.
+func (q *Queue) queued(key string) bool {
+	if slices.ContainsFunc(q.waiting, func(job *Job) bool { return job.Key == key }) {
+		return true
+	}
+
+	for _, job := range q.running {
+		if job.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Len reports how many jobs are waiting or running.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.waiting) + len(q.running)
+}
+
+// Run has workers do the queued jobs until Drain is called.
+func (q *Queue) Run(workers int) {
+	for range max(workers, 1) {
+		q.workers.Add(1)
+		go q.work()
+	}
+}
+
+// Drain stops workers taking on new jobs and waits up to timeout for the
+// running ones to finish, reporting whether they did. Jobs left over run
+// again when the queue is next loaded.
+func (q *Queue) Drain(timeout time.Duration) bool {
+	q.mu.Lock()
+	q.draining = true
+	q.mu.Unlock()
+	q.signal()
+
+	var done = make(chan struct{})
+	go func() {
+		q.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		brainLog.Warn("Timed out draining job queue, the rest runs after a restart", slog.Int("jobs", q.Len()))
+		return false
+	}
+}
+
+func (q *Queue) work() {
+	defer q.workers.Done()
+	defer crash.Recover()
+
+	for {
+		job, ok := q.next()
+		if !ok {
+			return
+		}
+
+		q.finish(job, q.run(job))
+	}
+}
+
+// next blocks until a job is ready and takes it, reporting false once the
+// queue is draining
+func (q *Queue) next() (*Job, bool) {
+	for {
+		q.mu.Lock()
+		if q.draining {
+			q.mu.Unlock()
+			// the other workers learn of it too
+			q.signal()
+			return nil, false
+		}
+
+		var now = time.Now()
+		var ready = -1
+		var wait = maxBackoff
+		for i, job := range q.waiting {
+			if delay := job.After.Sub(now); delay > 0 {
+				wait = min(wait, delay)
+				continue
+			}
+			if ready < 0 || job.Priority > q.waiting[ready].Priority {
+				ready = i
+			}
+		}
+
+		if ready >= 0 {
+			job := q.waiting[ready]
+			q.waiting = slices.Delete(q.waiting, ready, ready+1)
+			q.running[job.ID] = job
+			q.mu.Unlock()
+			return job, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// run hands a job to its handler
+func (q *Queue) run(job *Job) error {
+	q.mu.Lock()
+	h := q.handlers[job.Kind]
+	q.mu.Unlock()
+
+	if h == nil {
+		return Permanent(fmt.Errorf("no handler for %s jobs", job.Kind))
+	}
+
+	return h(context.Background(), *job)
+}
+
+// finish drops a job that is done or out of attempts, and queues it again
+// for later otherwise
+func (q *Queue) finish(job *Job, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.running, job.ID)
+
+	if err != nil {
+		job.Attempts++
+
+		var permanent errPermanent
+		if errors.As(err, &permanent) || job.Attempts >= q.maxAttempts {
+			brainLog.Error("Dropping failed job", slog.String("kind", job.Kind), slog.Int("attempts", job.Attempts), slog.String("err", err.Error()))
+		} else {
+			backoff := min(minBackoff<<min(job.Attempts-1, 16), maxBackoff)
+			job.After = time.Now().Add(backoff)
+			q.waiting = append(q.waiting, job)
+			brainLog.Warn("Job failed, retrying later", slog.String("kind", job.Kind), slog.Int("attempts", job.Attempts), slog.Duration("backoff", backoff), slog.String("err", err.Error()))
+		}
+	}
+
+	q.save()
+	q.signal()
+}
+
+// signal wakes a worker waiting for a job without blocking
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the waiting and running jobs to the queue's file. The caller
+// holds the lock.
+func (q *Queue) save() {
+	if q.path == "" {
+		return
+	}
+
+	var jobs = slices.Clone(q.waiting)
+	for _, job := range q.running {
+		jobs = append(jobs, job)
+	}
+	slices.SortFunc(jobs, func(a, b *Job) int { return cmp.Compare(a.ID, b.ID) })
+
+	data, err := json.Marshal(jobs)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(q.path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(q.path+".tmp", data, 0644)
+	}
+	if err == nil {
+		err = os.Rename(q.path+".tmp", q.path)
+	}
+	if err != nil {
+		brainLog.Error("Failed to save job queue", slog.String("file", q.path), slog.String("err", err.Error()))
+	}
+}
@@ -0,0 +1,143 @@
+// Package logging sets up slog from the config: the least severe level
+// logged, text or JSON output and levels of single subsystems. Packages log
+// through the logger of their subsystem, which tags each record with it.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+
+	"github.com/schizoid/internal/config"
+)
+
+// key of the attribute naming the subsystem a record comes from
+const subsystemKey = "subsystem"
+
+// Subsystems records are tagged with.
+const (
+	// connections to chat platforms and the commands coming through them
+	Gateway = "gateway"
+	// learning, replying and guild settings
+	Brain = "brain"
+	// n-gram models and the text model backends
+	Model = "model"
+	// saving and loading brains
+	Storage = "storage"
+)
+
+var subsystems = []string{Gateway, Brain, Model, Storage}
+
+// For returns the logger of a subsystem. It hands records to the default
+// logger as it is when they are logged, so packages can keep it in a
+// variable from before logging is set up.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&deferred{attrs: []slog.Attr{slog.String(subsystemKey, subsystem)}})
+}
+
+// NewHandler creates the handler writing records to w as cfg says, which
+// config.Load already checked apart from the subsystem names.
+func NewHandler(w io.Writer, cfg config.Log) (slog.Handler, error) {
+	var h = &levels{levels: make(map[string]slog.Level)}
+	h.level.UnmarshalText([]byte(cfg.Level))
+
+	var lowest = h.level
+	for subsystem, name := range cfg.Subsystems {
+		if !slices.Contains(subsystems, subsystem) {
+			return nil, fmt.Errorf("unknown log subsystem %q", subsystem)
+		}
+
+		var level slog.Level
+		level.UnmarshalText([]byte(name))
+		h.levels[subsystem] = level
+		lowest = min(lowest, level)
+	}
+
+	// the output takes whatever the subsystems let through
+	var opts = &slog.HandlerOptions{Level: lowest}
+	if cfg.Format == config.LogJSON {
+		h.next = slog.NewJSONHandler(w, opts)
+	} else {
+		h.next = slog.NewTextHandler(w, opts)
+	}
+
+	return h, nil
+}
+
+// levels drops records below the level of the subsystem they come from
+type levels struct {
+	next   slog.Handler
+	level  slog.Level
+	levels map[string]slog.Level
+}
+
+func (h *levels) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *levels) Handle(ctx context.Context, record slog.Record) error {
+	return h.next.Handle(ctx, record)
+}
+
+func (h *levels) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := *h
+	out.next = h.next.WithAttrs(attrs)
+	for _, a := range attrs {
+		if level, ok := h.levels[a.Value.String()]; ok && a.Key == subsystemKey {
+			out.level = level
+		}
+	}
+	return &out
+}
+
+func (h *levels) WithGroup(name string) slog.Handler {
+	out := *h
+	out.next = h.next.WithGroup(name)
+	return &out
+}
+
+// deferred passes records on to the default handler of the moment
+type deferred struct {
+	attrs []slog.Attr
+	group string
+}
+
+func (h *deferred) handler() slog.Handler {
+	var next = slog.Default().Handler().WithAttrs(h.attrs)
+	if h.group != "" {
+		next = next.WithGroup(h.group)
+	}
+	return next
+}
+
+func (h *deferred) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler().Enabled(ctx, level)
+}
+
+func (h *deferred) Handle(ctx context.Context, record slog.Record) error {
+	return h.handler().Handle(ctx, record)
+}
+
+func (h *deferred) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if h.group != "" {
+		// attributes after a group belong in it, which only the default
+		// handler can keep track of
+		return h.handler().WithAttrs(attrs)
+	}
+
+	out := *h
+	out.attrs = append(slices.Clip(h.attrs), attrs...)
+	return &out
+}
+
+func (h *deferred) WithGroup(name string) slog.Handler {
+	if h.group != "" {
+		return h.handler().WithGroup(name)
+	}
+
+	out := *h
+	out.group = name
+	return &out
+}
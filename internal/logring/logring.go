@@ -0,0 +1,161 @@
+// Package logring keeps the most recent log records in memory, so operators
+// can read them without access to the host's output.
+package logring
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a log record as kept in the ring.
+type Entry struct {
+	// increases by one with every record, to page through the ring
+	Seq     uint64
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	// attributes formatted as key=value pairs
+	Attrs string
+	// value of the record's guildID attribute, if any
+	GuildID string
+}
+
+// String formats the entry like a line of text log output.
+func (e Entry) String() string {
+	line := e.Time.Format(time.RFC3339) + " " + e.Level.String() + " " + e.Message
+	if e.Attrs != "" {
+		line += " " + e.Attrs
+	}
+
+	return line
+}
+
+// ring is shared by a handler and every handler derived from it
+type ring struct {
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	seq     uint64
+}
+
+// Handler passes records on to another handler and keeps the last ones it
+// saw.
+type Handler struct {
+	next slog.Handler
+	ring *ring
+	// attributes added through WithAttrs, already formatted, and the
+	// guildID among them, if any
+	attrs   []string
+	guildID string
+	group   string
+}
+
+// New creates a handler keeping the last size records and passing every
+// record on to next.
+func New(next slog.Handler, size int) *Handler {
+	size = max(size, 1)
+
+	return &Handler{
+		next: next,
+		ring: &ring{entries: make([]Entry, 0, size)},
+	}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	var entry = Entry{
+		Time:    record.Time,
+		Level:   record.Level,
+		Message: record.Message,
+		GuildID: h.guildID,
+	}
+
+	var attrs = slices.Clone(h.attrs)
+	record.Attrs(func(a slog.Attr) bool {
+		if a.Key == "guildID" {
+			entry.GuildID = a.Value.String()
+		}
+		attrs = append(attrs, h.format(a))
+		return true
+	})
+	entry.Attrs = strings.Join(attrs, " ")
+
+	h.ring.add(entry)
+
+	return h.next.Handle(ctx, record)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := *h
+	out.next = h.next.WithAttrs(attrs)
+	out.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		if a.Key == "guildID" {
+			out.guildID = a.Value.String()
+		}
+		out.attrs = append(out.attrs, h.format(a))
+	}
+	return &out
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	out := *h
+	out.next = h.next.WithGroup(name)
+	if out.group != "" {
+		name = out.group + "." + name
+	}
+	out.group = name
+	return &out
+}
+
+// format writes an attribute as key=value, qualified by the current group
+func (h *Handler) format(a slog.Attr) string {
+	var key = a.Key
+	if h.group != "" {
+		key = h.group + "." + key
+	}
+
+	return fmt.Sprintf("%s=%v", key, a.Value.Resolve().Any())
+}
+
+func (r *ring) add(entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	entry.Seq = r.seq
+
+	if len(r.entries) < cap(r.entries) {
+		r.entries = append(r.entries, entry)
+		return
+	}
+
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+}
+
+// Records lists the kept records at or above level, oldest first. A guildID
+// other than empty only keeps the records about that guild.
+func (h *Handler) Records(level slog.Level, guildID string) []Entry {
+	h.ring.mu.Lock()
+	defer h.ring.mu.Unlock()
+
+	var out []Entry
+	for i := range h.ring.entries {
+		entry := h.ring.entries[(h.ring.next+i)%len(h.ring.entries)]
+		if entry.Level < level || (guildID != "" && entry.GuildID != guildID) {
+			continue
+		}
+		out = append(out, entry)
+	}
+
+	return out
+}
@@ -0,0 +1,147 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// how long /sync waits for new events before returning empty
+const syncTimeout = 30 * time.Second
+
+// only messages and redactions are of interest
+const syncFilter = `{"room":{"timeline":{"limit":50,"types":["m.room.message","m.room.redaction"]},"state":{"types":[]},"ephemeral":{"types":[]},"account_data":{"types":[]}},"presence":{"types":[]},"account_data":{"types":[]}}`
+
+type event struct {
+	Type           string `json:"type"`
+	EventID        string `json:"event_id"`
+	Sender         string `json:"sender"`
+	OriginServerTS int64  `json:"origin_server_ts"`
+	// rooms before version 11 put this outside the content
+	Redacts string       `json:"redacts"`
+	Content eventContent `json:"content"`
+}
+
+type eventContent struct {
+	MsgType    string          `json:"msgtype"`
+	Body       string          `json:"body"`
+	Redacts    string          `json:"redacts"`
+	NewContent json.RawMessage `json:"m.new_content"`
+	Mentions   struct {
+		UserIDs []string `json:"user_ids"`
+	} `json:"m.mentions"`
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []event `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+type powerLevels struct {
+	Users        map[string]int `json:"users"`
+	UsersDefault int            `json:"users_default"`
+}
+
+// api calls the Matrix client-server API
+type api struct {
+	homeserver string
+	token      string
+	http       *http.Client
+	txn        int64
+}
+
+func (a *api) do(ctx context.Context, method, path string, query url.Values, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := strings.TrimSuffix(a.homeserver, "/") + "/_matrix/client/v3" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var matrixErr struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&matrixErr)
+		return fmt.Errorf("%s %s: %s %s", method, path, resp.Status, matrixErr.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (a *api) whoami(ctx context.Context) (string, error) {
+	var resp struct {
+		UserID string `json:"user_id"`
+	}
+	err := a.do(ctx, http.MethodGet, "/account/whoami", nil, nil, &resp)
+	return resp.UserID, err
+}
+
+func (a *api) sync(ctx context.Context, since string) (syncResponse, error) {
+	query := url.Values{
+		"timeout": {fmt.Sprint(syncTimeout.Milliseconds())},
+		"filter":  {syncFilter},
+	}
+	if since != "" {
+		query.Set("since", since)
+	}
+
+	var resp syncResponse
+	err := a.do(ctx, http.MethodGet, "/sync", query, nil, &resp)
+	return resp, err
+}
+
+func (a *api) join(ctx context.Context, roomID string) error {
+	return a.do(ctx, http.MethodPost, "/join/"+url.PathEscape(roomID), nil, struct{}{}, nil)
+}
+
+func (a *api) send(ctx context.Context, roomID, eventType string, content any) error {
+	a.txn++
+	txnID := fmt.Sprintf("schizoid-%d-%d", time.Now().UnixNano(), a.txn)
+
+	return a.do(ctx, http.MethodPut, "/rooms/"+url.PathEscape(roomID)+"/send/"+eventType+"/"+txnID, nil, content, nil)
+}
+
+func (a *api) powerLevels(ctx context.Context, roomID string) (powerLevels, error) {
+	var levels powerLevels
+	err := a.do(ctx, http.MethodGet, "/rooms/"+url.PathEscape(roomID)+"/state/m.room.power_levels", nil, nil, &levels)
+	return levels, err
+}
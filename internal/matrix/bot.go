@@ -0,0 +1,254 @@
+// Package matrix is a Matrix frontend for the same brains the Discord bot
+// uses. Every room gets its own brain, learning once a moderator sends !watch
+// in it, the way guild brains learn from whitelisted channels. The bot joins
+// any room it is invited to. Redacted messages are forgotten as long as they
+// are among the most recent ones the bot saw.
+package matrix
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/pkg/brain"
+)
+
+var gatewayLog = logging.For(logging.Gateway)
+
+// how long to back off after a failed sync
+const retryDelay = 5 * time.Second
+
+// how many messages are remembered so their redactions can be forgotten
+const recentMessages = 10000
+
+// power level needed to change a room's settings, moderator by default
+const adminLevel = 50
+
+// Bot serves Matrix rooms with the brains in a store.
+type Bot struct {
+	api    *api
+	brains *brain.Store
+	userID string
+
+	// messages by event ID, oldest first in order
+	recent map[string]brain.Message
+	order  []string
+}
+
+// New creates a bot logging into homeserver with an access token.
+func New(homeserver, token string, store *brain.Store) *Bot {
+	return &Bot{
+		api: &api{
+			homeserver: homeserver,
+			token:      token,
+			http:       &http.Client{Timeout: syncTimeout + 10*time.Second},
+		},
+		brains: store,
+		recent: make(map[string]brain.Message),
+	}
+}
+
+// localpart is the user name in a Matrix ID like @name:server
+func localpart(userID string) string {
+	name, _, _ := strings.Cut(strings.TrimPrefix(userID, "@"), ":")
+	return name
+}
+
+// Run syncs with the homeserver until ctx is done.
+func (b *Bot) Run(ctx context.Context) error {
+	userID, err := b.api.whoami(ctx)
+	if err != nil {
+		return err
+	}
+	b.userID = userID
+
+	gatewayLog.Info("schizoid is now running on Matrix", slog.String("user", userID))
+
+	// the first sync only catches up, so old mentions aren't answered
+	var since string
+	for {
+		resp, err := b.api.sync(ctx, since)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			gatewayLog.Error("Failed to sync with Matrix", slog.String("err", err.Error()))
+			time.Sleep(retryDelay)
+			continue
+		}
+
+		for roomID := range resp.Rooms.Invite {
+			if err := b.api.join(ctx, roomID); err != nil {
+				gatewayLog.Error("Failed to join room", slog.String("room", roomID), slog.String("err", err.Error()))
+			}
+		}
+
+		if since != "" {
+			for roomID, room := range resp.Rooms.Join {
+				for _, ev := range room.Timeline.Events {
+					b.onEvent(ctx, roomID, ev)
+				}
+			}
+		}
+
+		since = resp.NextBatch
+	}
+}
+
+// outbox answers in Matrix rooms. Rooms and events are hashed into brain
+// IDs, so it keeps the ones it is answering.
+type outbox struct {
+	ctx     context.Context
+	api     *api
+	roomID  string
+	eventID string
+}
+
+func (o outbox) Send(_ snowflake.ID, text string) error {
+	return o.api.send(o.ctx, o.roomID, "m.room.message", map[string]string{
+		"msgtype": "m.text",
+		"body":    text,
+	})
+}
+
+func (o outbox) React(_, _ snowflake.ID, emoji string) error {
+	return o.api.send(o.ctx, o.roomID, "m.reaction", map[string]any{
+		"m.relates_to": map[string]string{
+			"rel_type": "m.annotation",
+			"event_id": o.eventID,
+			"key":      emoji,
+		},
+	})
+}
+
+func (b *Bot) onEvent(ctx context.Context, roomID string, ev event) {
+	if ev.Sender == b.userID {
+		return
+	}
+
+	switch ev.Type {
+	case "m.room.message":
+		// edits arrive as new messages, learning them would count the text twice
+		if ev.Content.NewContent != nil || ev.Content.Body == "" {
+			return
+		}
+		if ev.Content.MsgType != "m.text" && ev.Content.MsgType != "m.emote" {
+			return
+		}
+
+		b.onMessage(ctx, roomID, ev)
+	case "m.room.redaction":
+		redacts := ev.Redacts
+		if redacts == "" {
+			redacts = ev.Content.Redacts
+		}
+
+		b.onRedaction(roomID, redacts)
+	}
+}
+
+func (b *Bot) onMessage(ctx context.Context, roomID string, ev event) {
+	schizo := b.brains.Get(chat.HashID(roomID))
+
+	if command, ok := strings.CutPrefix(ev.Content.Body, "!"); ok {
+		if fields := strings.Fields(command); len(fields) > 0 && b.onCommand(ctx, schizo, roomID, ev, fields[0]) {
+			return
+		}
+	}
+
+	var msg = brain.Message{
+		ID:          chat.HashID(ev.EventID),
+		ChannelID:   chat.HashID(roomID),
+		AuthorID:    chat.HashID(ev.Sender),
+		AuthorNames: []string{localpart(ev.Sender)},
+		Content:     ev.Content.Body,
+		CreatedAt:   time.UnixMilli(ev.OriginServerTS),
+	}
+	b.remember(ev.EventID, msg)
+
+	var name = localpart(b.userID)
+	var incoming = chat.Incoming{
+		Message: msg,
+		Addressed: slices.Contains(ev.Content.Mentions.UserIDs, b.userID) ||
+			strings.Contains(ev.Content.Body, b.userID) ||
+			strings.Contains(strings.ToLower(ev.Content.Body), strings.ToLower(name)),
+		Prompt: strings.NewReplacer(b.userID, "", name+":", "", name, "").Replace(ev.Content.Body),
+	}
+
+	chat.HandleMessage(ctx, schizo, incoming, outbox{ctx, b.api, roomID, ev.EventID})
+}
+
+// remember keeps a message around so a later redaction can forget it
+func (b *Bot) remember(eventID string, msg brain.Message) {
+	b.recent[eventID] = msg
+	b.order = append(b.order, eventID)
+
+	if len(b.order) > recentMessages {
+		delete(b.recent, b.order[0])
+		b.order = b.order[1:]
+	}
+}
+
+func (b *Bot) onRedaction(roomID, eventID string) {
+	msg, ok := b.recent[eventID]
+	if !ok {
+		return
+	}
+	delete(b.recent, eventID)
+
+	chat.HandleDelete(b.brains.Get(chat.HashID(roomID)), msg)
+}
+
+// isAdmin reports whether the sender may change a room's settings
+func (b *Bot) isAdmin(ctx context.Context, roomID, userID string) bool {
+	levels, err := b.api.powerLevels(ctx, roomID)
+	if err != nil {
+		gatewayLog.Error("Failed to look up power levels", slog.String("err", err.Error()))
+		return false
+	}
+
+	level, ok := levels.Users[userID]
+	if !ok {
+		level = levels.UsersDefault
+	}
+
+	return level >= adminLevel
+}
+
+// onCommand handles a !command, reporting whether it was one
+func (b *Bot) onCommand(ctx context.Context, schizo *brain.Brain, roomID string, ev event, command string) bool {
+	var reply string
+
+	switch command {
+	case "watch":
+		if !b.isAdmin(ctx, roomID, ev.Sender) {
+			reply = "Only room moderators can do that."
+			break
+		}
+
+		schizo.WhitelistChannel(chat.HashID(roomID))
+		reply = "schizoid will learn from this room."
+	case "optout":
+		schizo.SetOptOut(chat.HashID(ev.Sender), true)
+		reply = "schizoid will no longer learn from your messages, and your style profile was deleted."
+	case "optin":
+		schizo.SetOptOut(chat.HashID(ev.Sender), false)
+		reply = "schizoid will learn from your messages again."
+	default:
+		return false
+	}
+
+	err := outbox{ctx, b.api, roomID, ev.EventID}.Send(chat.HashID(roomID), reply)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		gatewayLog.Error("Failed to answer command", slog.String("command", command), slog.String("err", err.Error()))
+	}
+
+	return true
+}
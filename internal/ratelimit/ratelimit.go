@@ -0,0 +1,98 @@
+// Package ratelimit keeps anyone from taking more than their share of
+// something, with a token bucket per key.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// how often buckets that refilled completely are dropped
+const sweepInterval = time.Minute
+
+// Limiter hands out tokens that refill at a steady rate, up to a burst, per
+// key. A Limiter without a rate allows everything. It is safe for concurrent
+// use.
+type Limiter struct {
+	mu sync.Mutex
+	// tokens refilled per second
+	rate  float64
+	burst float64
+
+	buckets map[snowflake.ID]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// New creates a limiter allowing burst uses in a row, refilled by perMinute
+// every minute. It allows everything when perMinute or burst isn't positive.
+func New(perMinute float64, burst int) *Limiter {
+	l := &Limiter{buckets: make(map[snowflake.ID]*bucket)}
+	l.Set(perMinute, burst)
+
+	return l
+}
+
+// Set changes the rate and burst like New takes them. Keys keep the tokens
+// they have left, up to the new burst.
+func (l *Limiter) Set(perMinute float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if perMinute <= 0 || burst <= 0 {
+		l.rate, l.burst = 0, 0
+		clear(l.buckets)
+		return
+	}
+
+	l.rate = perMinute / 60
+	l.burst = float64(burst)
+}
+
+// Allow takes a token from key's bucket at now. Without one left it reports
+// false along with how long until the next one.
+func (l *Limiter) Allow(key snowflake.ID, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate == 0 {
+		return true, 0
+	}
+
+	if now.Sub(l.swept) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that would be full by now, a new one is the same
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
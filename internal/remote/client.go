@@ -0,0 +1,113 @@
+package remote
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/pkg/textmodel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var modelLog = logging.For(logging.Model)
+
+// Backend is the name remote models are registered under.
+const Backend = "remote"
+
+// how long a single call may take before it's abandoned
+const callTimeout = 10 * time.Second
+
+// Client talks to a model server.
+type Client struct {
+	conn  *grpc.ClientConn
+	token string
+}
+
+// Dial connects to the model server at addr, secured as security says. The
+// connection is established lazily, so a server that is down only fails the
+// calls made meanwhile.
+func Dial(addr, token string, security Security) (*Client, error) {
+	creds, err := security.clientCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	if security.Insecure && token != "" {
+		modelLog.Warn("Sending the model server token in plain text", slog.String("addr", addr))
+	}
+
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype(codecName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn, token: token}, nil
+}
+
+// Register makes the server's models available as the "remote" text model
+// backend.
+func (c *Client) Register() {
+	textmodel.Register(Backend, func(opts textmodel.Options) textmodel.TextModel {
+		return &Model{client: c, guildID: opts.Guild}
+	})
+}
+
+// Close disconnects from the server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) invoke(method string, req, resp any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	if c.token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", c.token)
+	}
+
+	return c.conn.Invoke(ctx, "/"+serviceName+"/"+method, req, resp)
+}
+
+// Model is a guild's model on the server. Its state lives there, so Save and
+// Load do nothing.
+type Model struct {
+	client  *Client
+	guildID snowflake.ID
+}
+
+// Train sends a message to the server to learn.
+func (m *Model) Train(text string) {
+	if err := m.client.invoke("Train", &TextRequest{GuildID: m.guildID.String(), Text: text}, &Empty{}); err != nil {
+		modelLog.Error("Failed to train remote model", slog.Any("guildID", m.guildID), slog.String("err", err.Error()))
+	}
+}
+
+// Forget asks the server to unlearn a message.
+func (m *Model) Forget(text string) {
+	if err := m.client.invoke("Forget", &TextRequest{GuildID: m.guildID.String(), Text: text}, &Empty{}); err != nil {
+		modelLog.Error("Failed to forget on remote model", slog.Any("guildID", m.guildID), slog.String("err", err.Error()))
+	}
+}
+
+// Generate asks the server to continue seed, returning just the seed if it
+// can't be reached.
+func (m *Model) Generate(seed string, length int) string {
+	var resp GenerateResponse
+	if err := m.client.invoke("Generate", &GenerateRequest{GuildID: m.guildID.String(), Seed: seed, Length: length}, &resp); err != nil {
+		modelLog.Error("Failed to generate with remote model", slog.Any("guildID", m.guildID), slog.String("err", err.Error()))
+		return seed
+	}
+
+	return resp.Text
+}
+
+func (m *Model) Save(w io.Writer) error { return nil }
+
+func (m *Model) Load(r io.Reader) error { return nil }
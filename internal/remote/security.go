@@ -0,0 +1,44 @@
+package remote
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Security is how calls to the model server are protected in transit. The
+// zero value is TLS verified against the system's CAs.
+type Security struct {
+	// plain text, e.g. on a private network
+	Insecure bool
+	// certificate and key the server presents
+	CertFile string
+	KeyFile  string
+	// CA clients verify the server's certificate with, empty for the
+	// system's
+	CAFile string
+}
+
+func (s Security) clientCredentials() (credentials.TransportCredentials, error) {
+	switch {
+	case s.Insecure:
+		return insecure.NewCredentials(), nil
+	case s.CAFile != "":
+		return credentials.NewClientTLSFromFile(s.CAFile, "")
+	default:
+		return credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12}), nil
+	}
+}
+
+func (s Security) serverCredentials() (credentials.TransportCredentials, error) {
+	if s.Insecure {
+		return insecure.NewCredentials(), nil
+	}
+	if s.CertFile == "" || s.KeyFile == "" {
+		return nil, errors.New("serving models over TLS needs a certificate and key file")
+	}
+
+	return credentials.NewServerTLSFromFile(s.CertFile, s.KeyFile)
+}
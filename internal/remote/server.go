@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/brain"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Server hosts the models of a brain store for remote frontends.
+type Server struct {
+	brains *brain.Store
+	// token callers must send as authorization metadata, empty for none
+	token    string
+	security Security
+}
+
+// NewServer creates a server for the brains in store, secured as security
+// says.
+func NewServer(store *brain.Store, token string, security Security) *Server {
+	return &Server{brains: store, token: token, security: security}
+}
+
+// ListenAndServe serves the brain service on addr until it fails.
+func (s *Server) ListenAndServe(addr string) error {
+	creds, err := s.security.serverCredentials()
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := grpc.NewServer(grpc.Creds(creds), grpc.UnaryInterceptor(s.authorize))
+	srv.RegisterService(&serviceDesc, s)
+
+	if s.token == "" {
+		modelLog.Warn("Model server has no token, anyone who can reach it can train and generate", slog.String("addr", addr))
+	}
+	if s.security.Insecure {
+		modelLog.Warn("Model server runs without TLS, anyone on the way can read and change what it learns", slog.String("addr", addr))
+	}
+
+	modelLog.Info("Serving models", slog.String("addr", addr))
+	return srv.Serve(lis)
+}
+
+func (s *Server) authorize(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.token != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		tokens := md.Get("authorization")
+		if len(tokens) == 0 || subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(s.token)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid token")
+		}
+	}
+
+	return handler(ctx, req)
+}
+
+func (s *Server) guildBrain(id string) (*brain.Brain, error) {
+	guildID, err := snowflake.Parse(id)
+	if err != nil || guildID == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid guild id")
+	}
+
+	return s.brains.Get(guildID), nil
+}
+
+// Train learns a message. The frontend already applied its filters, so the
+// text is learned as is.
+func (s *Server) Train(ctx context.Context, req *TextRequest) (*Empty, error) {
+	schizo, err := s.guildBrain(req.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := schizo.Train(0, req.Text); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return &Empty{}, nil
+}
+
+// Forget unlearns a message.
+func (s *Server) Forget(ctx context.Context, req *TextRequest) (*Empty, error) {
+	schizo, err := s.guildBrain(req.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	schizo.ForgetText(req.Text)
+	return &Empty{}, nil
+}
+
+// Generate continues a seed.
+func (s *Server) Generate(ctx context.Context, req *GenerateRequest) (*GenerateResponse, error) {
+	schizo, err := s.guildBrain(req.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GenerateResponse{Text: schizo.Generate(req.Seed, req.Length)}, nil
+}
@@ -0,0 +1,74 @@
+// Package remote runs guild models in a separate process behind a gRPC
+// service, so the bot frontend can stay small while heavy models live on a
+// beefier machine. Messages are JSON encoded; the service is
+// schizoid.Brain with the unary methods Train, Forget and Generate.
+package remote
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+const serviceName = "schizoid.Brain"
+
+// TextRequest carries a message to learn or unlearn.
+type TextRequest struct {
+	GuildID string `json:"guild_id"`
+	Text    string `json:"text"`
+}
+
+// GenerateRequest asks for a continuation of Seed.
+type GenerateRequest struct {
+	GuildID string `json:"guild_id"`
+	Seed    string `json:"seed"`
+	Length  int    `json:"length"`
+}
+
+// GenerateResponse holds the seed followed by the generated text.
+type GenerateResponse struct {
+	Text string `json:"text"`
+}
+
+// Empty is returned by methods with nothing to report.
+type Empty struct{}
+
+// brainService is implemented by Server
+type brainService interface {
+	Train(ctx context.Context, req *TextRequest) (*Empty, error)
+	Forget(ctx context.Context, req *TextRequest) (*Empty, error)
+	Generate(ctx context.Context, req *GenerateRequest) (*GenerateResponse, error)
+}
+
+// unaryHandler adapts a service method to grpc's handler signature
+func unaryHandler[Req any, Resp any](method string, call func(brainService, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+
+			if interceptor == nil {
+				return call(srv.(brainService), ctx, req)
+			}
+
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + serviceName + "/" + method}
+			return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+				return call(srv.(brainService), ctx, req.(*Req))
+			})
+		},
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*brainService)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("Train", brainService.Train),
+		unaryHandler("Forget", brainService.Forget),
+		unaryHandler("Generate", brainService.Generate),
+	},
+	Metadata: "remote",
+}
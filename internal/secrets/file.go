@@ -0,0 +1,18 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// readFile reads a secret mounted as a file, like Docker and Kubernetes
+// secrets, without its trailing newline
+func readFile(ctx context.Context, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,114 @@
+// Package secrets resolves settings that name a secret kept outside the
+// config, in a mounted file, Vault or AWS Secrets Manager, and notices when
+// the secret is rotated.
+//
+// A reference is the provider's prefix followed by where the secret is:
+//
+//	file:/run/secrets/discord_token
+//	vault:secret/data/schizoid#discord_token
+//	aws-sm:schizoid/prod#discord_token
+//
+// Anything else is the secret itself. Vault is reached through VAULT_ADDR
+// with VAULT_TOKEN, AWS with the usual AWS_ environment credentials.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// how long fetching a secret may take
+const fetchTimeout = 10 * time.Second
+
+var httpClient = &http.Client{Timeout: fetchTimeout}
+
+// a provider fetches the secret at a location
+type provider func(ctx context.Context, location string) (string, error)
+
+var providers = map[string]provider{
+	"file":   readFile,
+	"vault":  readVault,
+	"aws-sm": readAWSSecretsManager,
+}
+
+// split returns the provider a reference names, false for a literal secret
+func split(ref string) (provider, string, bool) {
+	prefix, location, ok := strings.Cut(ref, ":")
+	if !ok {
+		return nil, "", false
+	}
+
+	fetch, ok := providers[prefix]
+	return fetch, location, ok
+}
+
+// IsReference reports whether ref names a secret kept elsewhere rather than
+// being the secret.
+func IsReference(ref string) bool {
+	_, _, ok := split(ref)
+	return ok
+}
+
+// Resolve returns the secret ref names, or ref itself when it is the secret.
+func Resolve(ctx context.Context, ref string) (string, error) {
+	fetch, location, ok := split(ref)
+	if !ok {
+		return ref, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	secret, err := fetch(ctx, location)
+	if err != nil {
+		return "", fmt.Errorf("resolving secret %s: %w", redact(ref), err)
+	}
+
+	return secret, nil
+}
+
+// Watch resolves ref every interval until ctx is done, calling changed with
+// the secret whenever it differs from current. Failed lookups are logged and
+// keep the secret as it was.
+func Watch(ctx context.Context, ref, current string, interval time.Duration, changed func(secret string)) {
+	if !IsReference(ref) || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		secret, err := Resolve(ctx, ref)
+		if err != nil {
+			slog.Error("Failed to refresh secret", slog.String("err", err.Error()))
+			continue
+		}
+
+		if secret != current {
+			slog.Info("Secret was rotated", slog.String("secret", redact(ref)))
+			current = secret
+			changed(secret)
+		}
+	}
+}
+
+// redact keeps the provider and location of a reference for logging, and
+// nothing of a literal secret
+func redact(ref string) string {
+	if !IsReference(ref) {
+		return "(literal)"
+	}
+
+	return ref
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// readVault reads a field of a Vault secret at path#field, from either
+// version of the key/value engine
+func readVault(ctx context.Context, location string) (string, error) {
+	path, field, ok := strings.Cut(location, "#")
+	if !ok || field == "" {
+		return "", errors.New("vault reference needs a #field")
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", os.Getenv("VAULT_TOKEN"))
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault answered %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+
+	// version 2 nests the secret in data.data
+	fields := body.Data
+	if nested, ok := body.Data["data"]; ok {
+		if err := json.Unmarshal(nested, &fields); err != nil {
+			return "", err
+		}
+	}
+
+	var secret string
+	raw, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("vault secret has no field %q", field)
+	}
+	if err := json.Unmarshal(raw, &secret); err != nil {
+		return "", fmt.Errorf("vault field %q is not a string", field)
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,108 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const apiURL = "https://slack.com/api/"
+
+type userInfo struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	IsAdmin bool   `json:"is_admin"`
+	IsOwner bool   `json:"is_owner"`
+	IsBot   bool   `json:"is_bot"`
+	Profile struct {
+		RealName    string `json:"real_name"`
+		DisplayName string `json:"display_name"`
+	} `json:"profile"`
+}
+
+// names are how members may be referred to in messages
+func (u userInfo) names() []string {
+	var names []string
+	for _, name := range []string{u.Profile.DisplayName, u.Profile.RealName, u.Name} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// api calls the Slack Web API with one workspace's bot token
+type api struct {
+	token string
+	http  *http.Client
+}
+
+func newAPI(token string) *api {
+	return &api{token: token, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (a *api) call(ctx context.Context, method string, params url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+method, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("%s: %s", method, resp.Status)
+	}
+
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		return fmt.Errorf("%s: %s", method, status.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, result)
+}
+
+// authTest returns the bot's own user ID
+func (a *api) authTest(ctx context.Context) (string, error) {
+	var resp struct {
+		UserID string `json:"user_id"`
+	}
+	err := a.call(ctx, "auth.test", url.Values{}, &resp)
+	return resp.UserID, err
+}
+
+func (a *api) postMessage(ctx context.Context, channel, text string) error {
+	return a.call(ctx, "chat.postMessage", url.Values{"channel": {channel}, "text": {text}}, nil)
+}
+
+func (a *api) addReaction(ctx context.Context, channel, ts, name string) error {
+	return a.call(ctx, "reactions.add", url.Values{"channel": {channel}, "timestamp": {ts}, "name": {name}}, nil)
+}
+
+func (a *api) userInfo(ctx context.Context, userID string) (userInfo, error) {
+	var resp struct {
+		User userInfo `json:"user"`
+	}
+	err := a.call(ctx, "users.info", url.Values{"user": {userID}}, &resp)
+	return resp.User, err
+}
@@ -0,0 +1,253 @@
+// Package slack is a Slack app frontend for the same brains the Discord bot
+// uses. Slack delivers messages to an Events API endpoint the bot serves, and
+// every workspace the app is installed in gets its own brain, learning from
+// the channels a workspace admin sends !watch in. The app needs the
+// message.channels event and the chat:write, reactions:write and users:read
+// scopes.
+package slack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/config"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/pkg/brain"
+)
+
+var gatewayLog = logging.For(logging.Gateway)
+
+// Bot serves Slack workspaces with the brains in a store.
+type Bot struct {
+	config config.Slack
+	brains *brain.Store
+	ctx    context.Context
+
+	mu    sync.Mutex
+	teams map[string]*team
+}
+
+// team is a workspace the app is installed in
+type team struct {
+	api       *api
+	botUserID string
+
+	mu    sync.Mutex
+	users map[string]userInfo
+}
+
+// New creates a bot for the app configured in cfg.
+func New(cfg config.Slack, store *brain.Store) *Bot {
+	return &Bot{
+		config: cfg,
+		brains: store,
+		ctx:    context.Background(),
+		teams:  make(map[string]*team),
+	}
+}
+
+// team connects to a workspace the first time one of its events arrives
+func (b *Bot) team(id string) (*team, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t, ok := b.teams[id]; ok {
+		return t, nil
+	}
+
+	token, ok := b.config.Tokens[id]
+	if !ok {
+		token = b.config.Token
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no bot token for workspace %s", id)
+	}
+
+	t := &team{api: newAPI(token), users: make(map[string]userInfo)}
+
+	botUserID, err := t.api.authTest(b.ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.botUserID = botUserID
+
+	b.teams[id] = t
+	return t, nil
+}
+
+// user looks up a member, remembering them for the rest of the run
+func (t *team) user(ctx context.Context, userID string) (userInfo, error) {
+	t.mu.Lock()
+	info, ok := t.users[userID]
+	t.mu.Unlock()
+
+	if ok {
+		return info, nil
+	}
+
+	info, err := t.api.userInfo(ctx, userID)
+	if err != nil {
+		return info, err
+	}
+
+	t.mu.Lock()
+	t.users[userID] = info
+	t.mu.Unlock()
+
+	return info, nil
+}
+
+// parseTS turns a message timestamp like 1700000000.123456 into a time
+func parseTS(ts string) time.Time {
+	secs, micros, _ := strings.Cut(ts, ".")
+
+	s, _ := strconv.ParseInt(secs, 10, 64)
+	us, _ := strconv.ParseInt(micros, 10, 64)
+
+	return time.Unix(s, us*int64(time.Microsecond))
+}
+
+// links, mentions and channel references, optionally with a label
+var markup = regexp.MustCompile(`<([^>|]*)(?:\|([^>]*))?>`)
+
+// plainText undoes Slack's message formatting, keeping link and channel
+// labels and dropping mentions
+func plainText(text string) string {
+	text = markup.ReplaceAllStringFunc(text, func(m string) string {
+		parts := markup.FindStringSubmatch(m)
+		if parts[2] != "" {
+			return parts[2]
+		}
+		if strings.HasPrefix(parts[1], "@") || strings.HasPrefix(parts[1], "#") || strings.HasPrefix(parts[1], "!") {
+			return ""
+		}
+		return parts[1]
+	})
+
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
+
+// outbox answers in Slack channels
+type outbox struct {
+	ctx     context.Context
+	api     *api
+	channel string
+	ts      string
+}
+
+func (o outbox) Send(_ snowflake.ID, text string) error {
+	return o.api.postMessage(o.ctx, o.channel, text)
+}
+
+// React adds a reaction, which Slack only takes by name, like :thinking_face:
+func (o outbox) React(_, _ snowflake.ID, emoji string) error {
+	return o.api.addReaction(o.ctx, o.channel, o.ts, strings.Trim(emoji, ":"))
+}
+
+func (b *Bot) onEvent(teamID string, ev messageEvent) {
+	if ev.Type != "message" {
+		return
+	}
+
+	t, err := b.team(teamID)
+	if err != nil {
+		gatewayLog.Error("Failed to connect to Slack workspace", slog.String("team", teamID), slog.String("err", err.Error()))
+		return
+	}
+
+	switch ev.Subtype {
+	case "", "thread_broadcast":
+		if ev.BotID == "" && ev.User != "" && ev.User != t.botUserID {
+			b.onMessage(t, teamID, ev)
+		}
+	case "message_deleted":
+		if prev := ev.PreviousMessage; prev != nil && prev.BotID == "" && prev.User != "" {
+			chat.HandleDelete(b.brains.Get(chat.HashID(teamID)), b.toBrainMessage(t, ev.Channel, prev.User, prev.Text, prev.TS))
+		}
+	}
+}
+
+// toBrainMessage converts a Slack message, looking up its author's names
+func (b *Bot) toBrainMessage(t *team, channel, userID, text, ts string) brain.Message {
+	var names []string
+	if info, err := t.user(b.ctx, userID); err != nil {
+		gatewayLog.Error("Failed to look up Slack user", slog.String("user", userID), slog.String("err", err.Error()))
+	} else {
+		names = info.names()
+	}
+
+	return brain.Message{
+		ID:          chat.HashID(channel + "/" + ts),
+		ChannelID:   chat.HashID(channel),
+		AuthorID:    chat.HashID(userID),
+		AuthorNames: names,
+		Content:     plainText(text),
+		CreatedAt:   parseTS(ts),
+	}
+}
+
+func (b *Bot) onMessage(t *team, teamID string, ev messageEvent) {
+	schizo := b.brains.Get(chat.HashID(teamID))
+
+	if command, ok := strings.CutPrefix(ev.Text, "!"); ok {
+		if fields := strings.Fields(command); len(fields) > 0 && b.onCommand(t, schizo, ev, fields[0]) {
+			return
+		}
+	}
+
+	var mention = "<@" + t.botUserID + ">"
+	var msg = b.toBrainMessage(t, ev.Channel, ev.User, ev.Text, ev.TS)
+	var incoming = chat.Incoming{
+		Message: msg,
+		// direct messages are a conversation with the bot
+		Addressed: ev.ChannelType == "im" || strings.Contains(ev.Text, mention),
+		Prompt:    plainText(strings.ReplaceAll(ev.Text, mention, "")),
+	}
+
+	chat.HandleMessage(b.ctx, schizo, incoming, outbox{b.ctx, t.api, ev.Channel, ev.TS})
+}
+
+// onCommand handles a !command, reporting whether it was one
+func (b *Bot) onCommand(t *team, schizo *brain.Brain, ev messageEvent, command string) bool {
+	var reply string
+
+	switch command {
+	case "watch":
+		info, err := t.user(b.ctx, ev.User)
+		if err != nil {
+			gatewayLog.Error("Failed to look up Slack user", slog.String("user", ev.User), slog.String("err", err.Error()))
+			return true
+		}
+
+		if !info.IsAdmin && !info.IsOwner {
+			reply = "Only workspace admins can do that."
+			break
+		}
+
+		schizo.WhitelistChannel(chat.HashID(ev.Channel))
+		reply = "schizoid will learn from this channel."
+	case "optout":
+		schizo.SetOptOut(chat.HashID(ev.User), true)
+		reply = "schizoid will no longer learn from your messages, and your style profile was deleted."
+	case "optin":
+		schizo.SetOptOut(chat.HashID(ev.User), false)
+		reply = "schizoid will learn from your messages again."
+	default:
+		return false
+	}
+
+	if err := t.api.postMessage(b.ctx, ev.Channel, reply); err != nil && !errors.Is(err, context.Canceled) {
+		gatewayLog.Error("Failed to answer command", slog.String("command", command), slog.String("err", err.Error()))
+	}
+
+	return true
+}
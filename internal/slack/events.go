@@ -0,0 +1,119 @@
+package slack
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// requests larger than this are rejected
+const maxBodyBytes = 1 << 20
+
+// requests signed longer ago than this are rejected as replays
+const maxSignatureAge = 5 * time.Minute
+
+type messageEvent struct {
+	Type            string `json:"type"`
+	Subtype         string `json:"subtype"`
+	Channel         string `json:"channel"`
+	ChannelType     string `json:"channel_type"`
+	User            string `json:"user"`
+	BotID           string `json:"bot_id"`
+	Text            string `json:"text"`
+	TS              string `json:"ts"`
+	PreviousMessage *struct {
+		User  string `json:"user"`
+		BotID string `json:"bot_id"`
+		Text  string `json:"text"`
+		TS    string `json:"ts"`
+	} `json:"previous_message"`
+}
+
+type envelope struct {
+	Type      string       `json:"type"`
+	Challenge string       `json:"challenge"`
+	TeamID    string       `json:"team_id"`
+	Event     messageEvent `json:"event"`
+}
+
+// Run serves the Events API endpoint at /slack/events until ctx is done.
+func (b *Bot) Run(ctx context.Context) error {
+	b.ctx = ctx
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /slack/events", b.handleEvents)
+
+	server := &http.Server{Addr: b.config.Addr, Handler: mux}
+	context.AfterFunc(ctx, func() {
+		server.Shutdown(context.Background())
+	})
+
+	gatewayLog.Info("schizoid is now running on Slack", slog.String("addr", b.config.Addr))
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// verify checks that a request was signed by Slack with the app's signing
+// secret
+func (b *Bot) verify(r *http.Request, body []byte) bool {
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(secs, 0)).Abs() > maxSignatureAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(b.config.SigningSecret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature")))
+}
+
+func (b *Bot) handleEvents(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !b.verify(r, body) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch env.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, env.Challenge)
+		return
+	case "event_callback":
+		// Slack retries events it didn't get an answer to within 3 seconds,
+		// which would learn them twice, so events are acknowledged before
+		// they are handled
+		if r.Header.Get("X-Slack-Retry-Num") == "" {
+			go b.onEvent(env.TeamID, env.Event)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,137 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const apiURL = "https://api.telegram.org/bot"
+
+// how long getUpdates waits for new messages before returning empty
+const pollTimeout = 50 * time.Second
+
+type user struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Username  string `json:"username"`
+}
+
+type chatInfo struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+type message struct {
+	MessageID      int64    `json:"message_id"`
+	From           *user    `json:"from"`
+	Chat           chatInfo `json:"chat"`
+	Date           int64    `json:"date"`
+	Text           string   `json:"text"`
+	ReplyToMessage *message `json:"reply_to_message"`
+}
+
+type update struct {
+	UpdateID int64    `json:"update_id"`
+	Message  *message `json:"message"`
+}
+
+type chatMember struct {
+	Status string `json:"status"`
+}
+
+// api calls the Telegram Bot API
+type api struct {
+	token string
+	http  *http.Client
+}
+
+func (a *api) call(ctx context.Context, method string, params, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+a.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		// the token is part of the URL, keep it out of logged errors
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	if !envelope.OK {
+		return fmt.Errorf("%s: %s", method, envelope.Description)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(envelope.Result, result)
+}
+
+func (a *api) getMe(ctx context.Context) (user, error) {
+	var me user
+	err := a.call(ctx, "getMe", struct{}{}, &me)
+	return me, err
+}
+
+func (a *api) getUpdates(ctx context.Context, offset int64) ([]update, error) {
+	var updates []update
+	err := a.call(ctx, "getUpdates", map[string]any{
+		"offset":          offset,
+		"timeout":         int(pollTimeout.Seconds()),
+		"allowed_updates": []string{"message"},
+	}, &updates)
+	return updates, err
+}
+
+func (a *api) sendMessage(ctx context.Context, chatID int64, text string) error {
+	return a.call(ctx, "sendMessage", map[string]any{
+		"chat_id": chatID,
+		"text":    text,
+	}, nil)
+}
+
+func (a *api) setMessageReaction(ctx context.Context, chatID, messageID int64, emoji string) error {
+	return a.call(ctx, "setMessageReaction", map[string]any{
+		"chat_id":    chatID,
+		"message_id": messageID,
+		"reaction":   []map[string]string{{"type": "emoji", "emoji": emoji}},
+	}, nil)
+}
+
+func (a *api) getChatMember(ctx context.Context, chatID, userID int64) (chatMember, error) {
+	var member chatMember
+	err := a.call(ctx, "getChatMember", map[string]any{
+		"chat_id": chatID,
+		"user_id": userID,
+	}, &member)
+	return member, err
+}
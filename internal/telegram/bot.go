@@ -0,0 +1,186 @@
+// Package telegram is a Telegram frontend for the same brains the Discord bot
+// uses. Every Telegram chat gets its own brain, learning once someone sends
+// /watch in it. Bots only see every group message with privacy mode turned
+// off in BotFather; otherwise they only learn from commands, mentions and
+// replies. The Bot API reports no deletions, so nothing is ever forgotten.
+package telegram
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/chat"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/pkg/brain"
+)
+
+var gatewayLog = logging.For(logging.Gateway)
+
+// how long to back off after a failed poll
+const retryDelay = 5 * time.Second
+
+// Bot serves Telegram chats with the brains in a store.
+type Bot struct {
+	api    *api
+	brains *brain.Store
+	me     user
+}
+
+// New creates a bot authenticating with token.
+func New(token string, store *brain.Store) *Bot {
+	return &Bot{
+		api: &api{
+			token: token,
+			http:  &http.Client{Timeout: pollTimeout + 10*time.Second},
+		},
+		brains: store,
+	}
+}
+
+// chatID maps a Telegram chat onto the ID its brain is stored under. Group
+// chat IDs are negative, which wraps into the top of the range.
+func chatID(id int64) snowflake.ID {
+	return snowflake.ID(uint64(id))
+}
+
+// Run polls for messages until ctx is done.
+func (b *Bot) Run(ctx context.Context) error {
+	me, err := b.api.getMe(ctx)
+	if err != nil {
+		return err
+	}
+	b.me = me
+
+	gatewayLog.Info("schizoid is now running on Telegram", slog.String("username", me.Username))
+
+	var offset int64
+	for {
+		updates, err := b.api.getUpdates(ctx, offset)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			gatewayLog.Error("Failed to poll Telegram", slog.String("err", err.Error()))
+			time.Sleep(retryDelay)
+			continue
+		}
+
+		for _, u := range updates {
+			offset = max(offset, u.UpdateID+1)
+
+			if u.Message != nil && u.Message.From != nil && u.Message.Text != "" {
+				b.onMessage(ctx, u.Message)
+			}
+		}
+	}
+}
+
+// outbox answers in Telegram chats
+type outbox struct {
+	ctx context.Context
+	api *api
+}
+
+func (o outbox) Send(channelID snowflake.ID, text string) error {
+	return o.api.sendMessage(o.ctx, int64(channelID), text)
+}
+
+func (o outbox) React(channelID, messageID snowflake.ID, emoji string) error {
+	return o.api.setMessageReaction(o.ctx, int64(channelID), int64(messageID), emoji)
+}
+
+func (b *Bot) onMessage(ctx context.Context, msg *message) {
+	schizo := b.brains.Get(chatID(msg.Chat.ID))
+
+	if command, ok := b.command(msg.Text); ok {
+		b.onCommand(ctx, schizo, msg, command)
+		return
+	}
+
+	var names = []string{strings.TrimSpace(msg.From.FirstName + " " + msg.From.LastName)}
+	if msg.From.Username != "" {
+		names = append(names, msg.From.Username)
+	}
+
+	var mention = "@" + b.me.Username
+	var incoming = chat.Incoming{
+		Message: brain.Message{
+			ID:          snowflake.ID(msg.MessageID),
+			ChannelID:   chatID(msg.Chat.ID),
+			AuthorID:    snowflake.ID(msg.From.ID),
+			AuthorNames: names,
+			Bot:         msg.From.IsBot,
+			Content:     msg.Text,
+			CreatedAt:   time.Unix(msg.Date, 0),
+		},
+		// private chats are a conversation with the bot
+		Addressed: msg.Chat.Type == "private" ||
+			strings.Contains(msg.Text, mention) ||
+			(msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == b.me.ID),
+		Prompt: strings.ReplaceAll(msg.Text, mention, ""),
+	}
+
+	chat.HandleMessage(ctx, schizo, incoming, outbox{ctx, b.api})
+}
+
+// command extracts the name of a bot command, which in groups may be
+// addressed as /name@bot
+func (b *Bot) command(text string) (string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", false
+	}
+
+	name, target, addressed := strings.Cut(strings.Fields(text)[0][1:], "@")
+	if addressed && !strings.EqualFold(target, b.me.Username) {
+		return "", false
+	}
+
+	return name, true
+}
+
+// isAdmin reports whether the sender may change a chat's settings
+func (b *Bot) isAdmin(ctx context.Context, msg *message) bool {
+	if msg.Chat.Type == "private" {
+		return true
+	}
+
+	member, err := b.api.getChatMember(ctx, msg.Chat.ID, msg.From.ID)
+	if err != nil {
+		gatewayLog.Error("Failed to look up chat member", slog.String("err", err.Error()))
+		return false
+	}
+
+	return member.Status == "creator" || member.Status == "administrator"
+}
+
+func (b *Bot) onCommand(ctx context.Context, schizo *brain.Brain, msg *message, command string) {
+	var reply string
+
+	switch command {
+	case "watch":
+		if !b.isAdmin(ctx, msg) {
+			reply = "Only chat admins can do that."
+			break
+		}
+
+		schizo.WhitelistChannel(chatID(msg.Chat.ID))
+		reply = "schizoid will learn from this chat."
+	case "optout":
+		schizo.SetOptOut(snowflake.ID(msg.From.ID), true)
+		reply = "schizoid will no longer learn from your messages, and your style profile was deleted."
+	case "optin":
+		schizo.SetOptOut(snowflake.ID(msg.From.ID), false)
+		reply = "schizoid will learn from your messages again."
+	default:
+		return
+	}
+
+	if err := b.api.sendMessage(ctx, msg.Chat.ID, reply); err != nil && !errors.Is(err, context.Canceled) {
+		gatewayLog.Error("Failed to answer command", slog.String("command", command), slog.String("err", err.Error()))
+	}
+}
@@ -0,0 +1,63 @@
+// Package tracing exports spans of the message pipeline to an OpenTelemetry
+// collector, showing where the time from a message to learning it or
+// replying to it goes. Packages start spans from the global tracer provider,
+// which records nothing until Setup replaces it.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// service is what spans are reported to come from.
+const service = "schizoid"
+
+// Setup has spans exported to the collector cfg names, unless it names none.
+// The returned function flushes the spans still buffered and stops exporting.
+func Setup(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var opts = []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", service)))
+	if err != nil {
+		return nil, fmt.Errorf("describing the service: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Guild is the attribute of the guild a span works on.
+func Guild(guildID snowflake.ID) attribute.KeyValue {
+	return attribute.String("guild.id", guildID.String())
+}
+
+// Channel is the attribute of the channel a span works on.
+func Channel(channelID snowflake.ID) attribute.KeyValue {
+	return attribute.String("channel.id", channelID.String())
+}
@@ -0,0 +1,84 @@
+// Package tts turns text into speech through an external command, giving
+// back the Opus packets voice connections send.
+package tts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+var (
+	errNotOgg  = errors.New("tts: output is not an Ogg stream")
+	errNotOpus = errors.New("tts: output is not Ogg Opus")
+)
+
+// Synthesize runs command with sh, writing text to its stdin, and reads the
+// Ogg Opus it writes to stdout. The packets are returned in order, without
+// the Opus headers.
+func Synthesize(ctx context.Context, command, text string) ([][]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("tts: running command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return opusPackets(&stdout)
+}
+
+// opusPackets reassembles the packets of an Ogg stream from the segments of
+// its pages, then checks and strips the OpusHead and OpusTags headers
+func opusPackets(r io.Reader) ([][]byte, error) {
+	var packets [][]byte
+	var packet []byte
+
+	// capture pattern, version, header type, granule position, serial,
+	// sequence number, checksum and segment count
+	header := make([]byte, 27)
+	for {
+		if _, err := io.ReadFull(r, header); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("tts: reading page: %w", err)
+		}
+
+		if string(header[:4]) != "OggS" {
+			return nil, errNotOgg
+		}
+
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return nil, fmt.Errorf("tts: reading page: %w", err)
+		}
+
+		// a packet runs on through segments of 255 bytes, across pages if
+		// need be
+		for _, size := range segments {
+			segment := make([]byte, size)
+			if _, err := io.ReadFull(r, segment); err != nil {
+				return nil, fmt.Errorf("tts: reading page: %w", err)
+			}
+
+			packet = append(packet, segment...)
+			if size < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+
+	if len(packets) < 2 || !bytes.HasPrefix(packets[0], []byte("OpusHead")) || !bytes.HasPrefix(packets[1], []byte("OpusTags")) {
+		return nil, errNotOpus
+	}
+
+	return packets[2:], nil
+}
@@ -0,0 +1,65 @@
+package brain
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/denylist"
+)
+
+// shorter words of a question are mostly filler
+const minSalientLength = 3
+
+// the longer filler words of questions, which say nothing about the subject
+var questionFiller = []string{
+	"about", "all", "also", "and", "any", "are", "been", "but", "can",
+	"could", "did", "does", "doing", "for", "from", "get", "got", "had",
+	"has", "have", "her", "his", "how", "into", "its", "just", "know",
+	"like", "many", "more", "most", "much", "not", "one", "our", "should",
+	"some", "than", "that", "the", "their", "them", "then", "there",
+	"these", "they", "think", "this", "those", "very", "want", "was", "were",
+	"what", "when", "where", "which", "while", "who", "why", "will", "with",
+	"would", "you", "your",
+}
+
+// salientWords picks the words of a question that say what it is about
+func salientWords(question string) []string {
+	var words []string
+	for _, word := range denylist.SplitWords(question) {
+		text := strings.ToLower(word.Text)
+		if utf8.RuneCountInString(text) < minSalientLength || strings.ContainsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+			continue
+		}
+
+		if !slices.Contains(questionFiller, text) && !slices.Contains(words, text) {
+			words = append(words, text)
+		}
+	}
+
+	return words
+}
+
+// Ask answers a question asked in a channel, seeding generation from the
+// word of it the model saw in the most contexts, so the answer at least seems
+// to be about it. Questions about nothing the model knows get a plain reply.
+func (b *Brain) Ask(channelID snowflake.ID, question string, length int) string {
+	var seed string
+	var best float64
+
+	b.mu.RLock()
+	for _, word := range salientWords(question) {
+		if seen := b.Model.Frequency(word); seen > best {
+			seed, best = word, seen
+		}
+	}
+	b.mu.RUnlock()
+
+	if seed == "" {
+		return b.ReplyIn(channelID, question, length)
+	}
+
+	return strings.TrimSpace(b.GenerateIn(channelID, seed, length))
+}
@@ -0,0 +1,43 @@
+package brain
+
+import (
+	"strings"
+)
+
+// attachmentName replaces what would break a name out of its markup token
+var attachmentName = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_", "<", "_", ">", "_")
+
+// SetLearnAttachments starts or stops learning the names of attached files
+// and stickers, which lets messages without text be learned too.
+func (b *Brain) SetLearnAttachments(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.LearnAttachments = enabled
+	b.dirty = true
+}
+
+// learnedText is what gets learned from a message: its content, followed by
+// a token for each attachment and sticker when the guild learns those.
+func (b *Brain) learnedText(obs Message) string {
+	return learnedText(obs, b.GuildSettings().LearnAttachments)
+}
+
+func learnedText(obs Message, attachments bool) string {
+	if !attachments {
+		return obs.Content
+	}
+
+	var parts []string
+	if obs.Content != "" {
+		parts = append(parts, obs.Content)
+	}
+	for _, name := range obs.Attachments {
+		parts = append(parts, "<file:"+attachmentName.Replace(name)+">")
+	}
+	for _, name := range obs.Stickers {
+		parts = append(parts, "<sticker:"+attachmentName.Replace(name)+">")
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,140 @@
+package brain
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditAcceptPolicy = "accept-policy"
+	AuditPurgeImports = "purge-imports"
+	AuditPurgeFeeds   = "purge-feeds"
+	AuditForgetUser   = "forget-user"
+	AuditUnfeed       = "unfeed"
+	AuditPrune        = "prune"
+	AuditExport       = "export"
+	AuditBundle       = "bundle"
+	AuditUnbundle     = "unbundle"
+	AuditExportLog    = "export-audit"
+	AuditRollback     = "rollback"
+	AuditRebuild      = "rebuild"
+)
+
+// ErrAuditTampered is returned for an audit log whose chain is broken.
+var ErrAuditTampered = errors.New("audit log was tampered with")
+
+// AuditEntry is an admin action taken on a brain's data. Each entry hashes
+// the one before it, so changing or removing an entry breaks the chain from
+// there on. Removing the newest entries is only caught against a hash kept
+// from an earlier export.
+type AuditEntry struct {
+	Seq int       `json:"seq"`
+	At  time.Time `json:"at"`
+	// who took the action, zero for the command line and upkeep
+	ActorID snowflake.ID `json:"actor,omitempty"`
+	Action  string       `json:"action"`
+	Detail  string       `json:"detail,omitempty"`
+	// hash of the entry before, empty for the first
+	Prev string `json:"prev"`
+	Hash string `json:"hash"`
+}
+
+// digest hashes everything in the entry but its own hash
+func (e AuditEntry) digest() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%s\n%d\n%q\n%q\n%s\n", e.Seq, e.At.UTC().Format(time.RFC3339Nano), uint64(e.ActorID), e.Action, e.Detail, e.Prev)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RecordAction appends an admin action to the audit log and returns the
+// entry.
+func (b *Brain) RecordAction(actorID snowflake.ID, action, detail string) AuditEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entry = AuditEntry{
+		Seq:     len(b.Audit) + 1,
+		At:      time.Now().UTC(),
+		ActorID: actorID,
+		Action:  action,
+		Detail:  detail,
+	}
+	if len(b.Audit) > 0 {
+		entry.Prev = b.Audit[len(b.Audit)-1].Hash
+	}
+	entry.Hash = entry.digest()
+
+	b.Audit = append(b.Audit, entry)
+	b.dirty = true
+
+	return entry
+}
+
+// AuditLog lists the audit log, oldest first.
+func (b *Brain) AuditLog() []AuditEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return slices.Clone(b.Audit)
+}
+
+// VerifyAudit checks that every entry of an audit log is numbered in order,
+// hashes to its recorded hash and points to the hash of the entry before.
+func VerifyAudit(entries []AuditEntry) error {
+	var prev string
+	for i, entry := range entries {
+		switch {
+		case entry.Seq != i+1:
+			return fmt.Errorf("entry %d is numbered %d: %w", i+1, entry.Seq, ErrAuditTampered)
+		case entry.Prev != prev:
+			return fmt.Errorf("entry %d doesn't follow the one before: %w", entry.Seq, ErrAuditTampered)
+		case entry.digest() != entry.Hash:
+			return fmt.Errorf("entry %d doesn't match its hash: %w", entry.Seq, ErrAuditTampered)
+		}
+		prev = entry.Hash
+	}
+
+	return nil
+}
+
+// WriteAudit exports an audit log as JSON, one entry per line.
+func WriteAudit(w io.Writer, entries []AuditEntry) error {
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadAudit reads an audit log exported by WriteAudit.
+func ReadAudit(r io.Reader) ([]AuditEntry, error) {
+	var entries []AuditEntry
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,161 @@
+package brain
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/ngram"
+)
+
+// AuthorProfile tracks what the bot learned from a single user.
+type AuthorProfile struct {
+	Model    *ngram.Model
+	Messages int
+	Chars    int
+	Emoji    map[string]int
+	// imported messages, counted apart so they can be purged; their emoji
+	// aren't tracked
+	ImportedMessages int
+	ImportedChars    int
+}
+
+// newAuthorProfile creates an empty profile shaped like the guild model and
+// sharing its entities
+func (b *Brain) newAuthorProfile() *AuthorProfile {
+	tokenizer := ngram.NewCharTokenizer([]string{})
+	for _, entity := range b.Model.Tokenizer.Entities {
+		tokenizer.AddEntity(entity)
+	}
+
+	model := ngram.New(tokenizer, b.Model.N, b.Model.Smoothing)
+	model.SetImportWeight(b.Settings.importWeight())
+
+	return &AuthorProfile{
+		Model: model,
+		Emoji: make(map[string]int),
+	}
+}
+
+func (p *AuthorProfile) observe(text string, spans [][2]int) {
+	p.Model.TrainRedacted(text, spans)
+	p.Messages++
+	p.Chars += utf8.RuneCountInString(text)
+
+	for _, emoji := range findEmoji(text) {
+		p.Emoji[emoji]++
+	}
+}
+
+func (p *AuthorProfile) observeImported(text string, spans [][2]int) {
+	p.Model.TrainImported(text, spans)
+	p.ImportedMessages++
+	p.ImportedChars += utf8.RuneCountInString(text)
+}
+
+func (p *AuthorProfile) purgeImported() {
+	p.Model.PurgeImported()
+	p.ImportedMessages = 0
+	p.ImportedChars = 0
+}
+
+func (p *AuthorProfile) messages() int {
+	return p.Messages + p.ImportedMessages
+}
+
+func (p *AuthorProfile) forget(text string, spans [][2]int) {
+	p.Model.ForgetRedacted(text, spans)
+	p.Messages = max(0, p.Messages-1)
+	p.Chars = max(0, p.Chars-utf8.RuneCountInString(text))
+
+	for _, emoji := range findEmoji(text) {
+		if p.Emoji[emoji]--; p.Emoji[emoji] <= 0 {
+			delete(p.Emoji, emoji)
+		}
+	}
+}
+
+func (p *AuthorProfile) averageLength() float64 {
+	if p.messages() == 0 {
+		return 0
+	}
+
+	return float64(p.Chars+p.ImportedChars) / float64(p.messages())
+}
+
+// topEmoji lists the author's most used emoji, most frequent first
+func (p *AuthorProfile) topEmoji(limit int) []string {
+	var emoji []string
+	for e := range p.Emoji {
+		emoji = append(emoji, e)
+	}
+
+	slices.SortFunc(emoji, func(a, b string) int {
+		return cmp.Or(cmp.Compare(p.Emoji[b], p.Emoji[a]), strings.Compare(a, b))
+	})
+
+	return emoji[:min(limit, len(emoji))]
+}
+
+var customEmojiPattern = regexp.MustCompile(`<a?:\w+:\d+>`)
+
+func isEmojiRune(r rune) bool {
+	return (r >= 0x1F300 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF)
+}
+
+// findEmoji returns the custom and unicode emoji used in text
+func findEmoji(text string) []string {
+	emoji := customEmojiPattern.FindAllString(text, -1)
+
+	for _, r := range customEmojiPattern.ReplaceAllString(text, "") {
+		if isEmojiRune(r) {
+			emoji = append(emoji, string(r))
+		}
+	}
+
+	return emoji
+}
+
+// StyleReport summarizes what was learned from a user.
+type StyleReport struct {
+	Messages      int
+	AverageLength float64
+	// n-grams the user writes much more often than the guild
+	Distinctive []string
+	Emoji       []string
+}
+
+// Style summarizes what was learned from a user, or nil if nothing was.
+func (b *Brain) Style(userID snowflake.ID) *StyleReport {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	profile := b.Authors[userID]
+	if profile == nil || profile.messages() == 0 {
+		return nil
+	}
+
+	return &StyleReport{
+		Messages:      profile.messages(),
+		AverageLength: profile.averageLength(),
+		Distinctive:   ngram.Distinctive(profile.Model, b.Model, 5),
+		Emoji:         profile.topEmoji(5),
+	}
+}
+
+// Impersonate generates text in a user's style, reporting false when nothing
+// has been learned from them.
+func (b *Brain) Impersonate(userID snowflake.ID, seed string, length int) (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	profile := b.Authors[userID]
+	if profile == nil || profile.messages() == 0 {
+		return "", false
+	}
+
+	return ngram.Interpolate(b.Model, profile.Model, seed, length), true
+}
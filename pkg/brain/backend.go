@@ -0,0 +1,126 @@
+package brain
+
+import (
+	"bytes"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/schizoid/pkg/ngram"
+	"github.com/schizoid/pkg/textmodel"
+)
+
+// attachBackend sets up the generation backend picked in the options. The
+// n-gram backend is the guild model itself; any other keeps its own state,
+// which is restored if the brain was saved with the same backend.
+func (b *Brain) attachBackend() {
+	// the guild model samples for the n-gram backend and impersonations,
+	// channel models for their channels
+	b.tune(b.Model)
+	for _, model := range b.ChannelModels {
+		b.tune(model)
+	}
+
+	var name = b.opts.Backend
+	if name == "" {
+		name = ngram.Backend
+	}
+
+	if name == ngram.Backend {
+		b.Backend, b.BackendState, b.backend = name, nil, b.Model
+		return
+	}
+
+	model, err := textmodel.New(name, textmodel.Options{Guild: b.GuildID, Order: b.opts.Order, Smoothing: b.opts.Smoothing})
+	if err != nil {
+		modelLog.Error("Failed to create text model, falling back to ngram", slog.Any("guildID", b.GuildID), slog.String("err", err.Error()))
+		b.Backend, b.BackendState, b.backend = ngram.Backend, nil, b.Model
+		return
+	}
+
+	if b.Backend == name && len(b.BackendState) > 0 {
+		if err := model.Load(bytes.NewReader(b.BackendState)); err != nil {
+			modelLog.Error("Failed to restore text model, starting untrained", slog.Any("guildID", b.GuildID), slog.String("backend", name), slog.String("err", err.Error()))
+		}
+	} else if total, _ := b.Model.Totals(); total > 0 {
+		modelLog.Warn("Switched text model backend, it starts untrained", slog.Any("guildID", b.GuildID), slog.String("backend", name))
+	}
+
+	b.Backend, b.BackendState, b.backend = name, nil, model
+}
+
+// tune applies the sampling options to a model that generates
+func (b *Brain) tune(model *ngram.Model) {
+	model.SetRepetitionPenalty(b.opts.RepetitionPenalty)
+	if b.opts.SentenceMinLength > 0 {
+		model.SetSentenceStop(b.opts.SentenceMinLength)
+	} else {
+		model.SetSentenceStop(-1)
+	}
+	model.SetGoodTuring(b.opts.GoodTuring)
+	if b.opts.EstimateInterpolation {
+		model.SetInterpolation(model.EstimateInterpolation())
+	} else {
+		model.SetInterpolation(b.opts.Interpolation)
+	}
+}
+
+// separateBackend reports whether generation uses a model besides the guild
+// n-gram model, which then needs training and saving on its own
+func (b *Brain) separateBackend() bool {
+	return b.backend != b.Model
+}
+
+// trainBackend and forgetBackend pass text on to a separate backend. They are
+// called without holding mu: the remote backend waits on the network, which
+// mustn't hold up everything else the brain does.
+func (b *Brain) trainBackend(text string) {
+	if b.separateBackend() {
+		b.backend.Train(text)
+	}
+}
+
+func (b *Brain) forgetBackend(text string) {
+	if b.separateBackend() {
+		b.backend.Forget(text)
+	}
+}
+
+// saveBackend snapshots a separate backend's state into the brain so it is
+// saved along with it
+func (b *Brain) saveBackend() error {
+	if !b.separateBackend() {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	if err := b.backend.Save(&buffer); err != nil {
+		return err
+	}
+
+	b.BackendState = buffer.Bytes()
+	return nil
+}
+
+// cutSpans removes the byte spans from text, for backends that can't
+// represent redactions
+func cutSpans(text string, spans [][2]int) string {
+	spans = slices.Clone(spans)
+	slices.SortFunc(spans, func(a, b [2]int) int { return a[0] - b[0] })
+
+	var sb strings.Builder
+	var pos = 0
+
+	for _, span := range spans {
+		if span[0] < pos {
+			pos = max(pos, span[1])
+			continue
+		}
+
+		sb.WriteString(text[pos:span[0]])
+		pos = span[1]
+	}
+	sb.WriteString(text[pos:])
+
+	return sb.String()
+}
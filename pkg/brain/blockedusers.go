@@ -0,0 +1,89 @@
+package brain
+
+import (
+	"slices"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// IsBlocked reports whether moderators excluded a user from being learned.
+func (b *Brain) IsBlocked(userID snowflake.ID) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.BlockedUsers[userID]
+}
+
+// BlockedList lists the users excluded from being learned.
+func (b *Brain) BlockedList() []snowflake.ID {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var users []snowflake.ID
+	for userID := range b.BlockedUsers {
+		users = append(users, userID)
+	}
+	slices.Sort(users)
+
+	return users
+}
+
+// SetBlocked excludes a user from being learned, like spammers or bots that
+// don't say they are, or lets them be learned again, reporting false when
+// nothing changed. Unlike opting out it is up to moderators, and what was
+// learned from the user stays until ForgetUser.
+func (b *Brain) SetBlocked(userID snowflake.ID, blocked bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.BlockedUsers[userID] == blocked {
+		return false
+	}
+
+	if blocked {
+		b.BlockedUsers[userID] = true
+	} else {
+		delete(b.BlockedUsers, userID)
+	}
+	b.dirty = true
+
+	return true
+}
+
+// ForgetUser unlearns everything learned from a user, as far as their style
+// profile tells, drops the profile and reports how many messages it held.
+// Channel models and other backends than the n-gram model can't tell who
+// taught them what and keep it.
+func (b *Brain) ForgetUser(userID snowflake.ID) int {
+	defer b.takeIn()()
+
+	b.record(logEntry{AuthorID: userID, Forget: true})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	profile := b.dropAuthor(userID)
+	if profile == nil {
+		return 0
+	}
+
+	return profile.messages()
+}
+
+// dropAuthor unlearns what the guild model learned from a user, as far as
+// their style profile tells, and drops the profile, returning it or nil if
+// there was none. The caller holds the write lock.
+func (b *Brain) dropAuthor(userID snowflake.ID) *AuthorProfile {
+	profile := b.Authors[userID]
+	if profile == nil {
+		return nil
+	}
+
+	// the profile learned the same text as the guild model did
+	b.Model.Subtract(profile.Model)
+	delete(b.Authors, userID)
+	b.forgotAuthor(userID)
+	b.dirty = true
+
+	return profile
+}
@@ -0,0 +1,101 @@
+package brain
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/schizoid/pkg/denylist"
+)
+
+// generations tried for output without blocked terms before censoring
+const maxResamples = 5
+
+// Blocklist lists the terms this guild keeps out of generated text.
+func (b *Brain) Blocklist() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return slices.Clone(b.Settings.OutputBlocklist)
+}
+
+// BlockTerm keeps term out of generated text, reporting false if it already
+// was.
+func (b *Brain) BlockTerm(term string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" || slices.Contains(b.Settings.OutputBlocklist, term) {
+		return false
+	}
+
+	b.Settings.OutputBlocklist = append(b.Settings.OutputBlocklist, term)
+	b.dirty = true
+
+	return true
+}
+
+// UnblockTerm allows term in generated text again, reporting false if it
+// wasn't blocked.
+func (b *Brain) UnblockTerm(term string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	term = strings.ToLower(strings.TrimSpace(term))
+	if !slices.Contains(b.Settings.OutputBlocklist, term) {
+		return false
+	}
+
+	b.Settings.OutputBlocklist = slices.DeleteFunc(b.Settings.OutputBlocklist, func(t string) bool { return t == term })
+	b.dirty = true
+
+	return true
+}
+
+// SetResampleBlocked chooses between generating again and censoring when
+// output contains blocked terms.
+func (b *Brain) SetResampleBlocked(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.ResampleBlocked = enabled
+	b.dirty = true
+}
+
+// OutputTerms lists every term kept out of generated text: the guild's
+// blocklist and its denylist packs.
+func (b *Brain) OutputTerms() []string {
+	return append(b.DeniedTerms(), b.Blocklist()...)
+}
+
+// FilterOutput runs generate and keeps blocked terms out of its text. If the
+// guild resamples, generate is called again a few times until it comes up
+// with clean text; whatever blocked terms are left are censored. Text copying
+// recently learned messages is generated again too, and never said.
+func (b *Brain) FilterOutput(generate func() string) string {
+	var terms = b.OutputTerms()
+	var text = b.original(generate)
+
+	if b.GuildSettings().ResampleBlocked {
+		for range maxResamples - 1 {
+			if len(denylist.FindTerms(text, terms)) == 0 {
+				break
+			}
+			text = b.original(generate)
+		}
+	}
+
+	return denylist.Censor(text, terms)
+}
+
+// original runs generate until its text doesn't copy recently learned
+// messages, giving up with nothing after a few tries
+func (b *Brain) original(generate func() string) string {
+	for range maxResamples {
+		if text := generate(); !b.Regurgitates(text) {
+			return text
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,948 @@
+// Package brain holds everything schizoid learned in one guild: the n-gram
+// model, per-author profiles, learned entities, moderation settings and how
+// much of each channel's history has been read. It knows nothing about
+// Discord; adapters feed it Messages.
+//
+// Other programs can use it as a library: New or Load a brain with Options
+// naming where it is saved, Train or Observe it, Reply from it and Save it,
+// or keep many with a Store. The options that take schizoid's internal types
+// may be left nil.
+package brain
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/logging"
+	"github.com/schizoid/internal/tracing"
+	"github.com/schizoid/pkg/denylist"
+	"github.com/schizoid/pkg/ngram"
+	"github.com/schizoid/pkg/textmodel"
+	"github.com/schizoid/pkg/watchdog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	brainLog   = logging.For(logging.Brain)
+	modelLog   = logging.For(logging.Model)
+	storageLog = logging.For(logging.Storage)
+)
+
+// Message is a chat message as the brain sees it, independent of the
+// platform it came from.
+type Message struct {
+	ID        snowflake.ID
+	ChannelID snowflake.ID
+	AuthorID  snowflake.ID
+	// names the author goes by, which become entities once written
+	AuthorNames []string
+	Bot         bool
+	// posted in a channel marked as age-restricted
+	NSFW      bool
+	Content   string
+	CreatedAt time.Time
+	// names of the files and stickers attached
+	Attachments []string
+	Stickers    []string
+}
+
+// Options configures how brains are created and stored. They are not saved
+// with the brain.
+type Options struct {
+	// directory brains are saved in
+	Dir string
+	// file to save in instead of the one in Dir named after the guild
+	File string
+	// snapshots kept of the brain, the oldest deleted first; 0 to take none
+	Snapshots int
+	// generation backend registered with textmodel, empty for ngram
+	Backend string
+	// order and smoothing of newly created models
+	Order     int
+	Smoothing float64
+	// whether the guild model discounts rare counts by Good-Turing instead
+	GoodTuring bool
+	// counts kept across the guild and author models, 0 for no limit
+	MaxEntries int
+	// BudgetPrune, BudgetStop or BudgetDecay, what to do
+	// once MaxEntries is reached
+	BudgetAction string
+	// replies generated per reply, the best of which is posted
+	Candidates int
+	// what sampling divides the probability of repeating tokens by
+	RepetitionPenalty float64
+	// tokens generated before replies end with their sentence, 0 for never
+	SentenceMinLength int
+	// whether each channel gets a model of its own that replies in it are
+	// generated from
+	PerChannel bool
+	// weights of the orders the guild model mixes, nil for only the highest
+	Interpolation []float64
+	// whether to estimate the weights from the guild model's counts instead
+	EstimateInterpolation bool
+	// channel messages before the one replied to that replies follow too
+	ContextMessages int
+	// word lists the guild settings pick from, nil for none
+	Denylists *denylist.Packs
+	// messages matching any of these are never learned, in every guild
+	TrainFilters []*regexp.Regexp
+	// cancels generations that take too long, nil to let them run
+	Generations *watchdog.Watchdog
+	// keep a log of what the brain learns next to it, so it can be rebuilt
+	// from it under the rules of the day, and for how long entries are kept
+	MessageLog          bool
+	MessageLogRetention time.Duration
+	// least time between replies in a channel that doesn't set its own
+	ReplyCooldown time.Duration
+	// how long an exchange with the bot carries on without a reply, 0 for
+	// replies not to follow up on each other
+	SessionTimeout time.Duration
+}
+
+// GuildSettings are the per-guild knobs changed through commands.
+type GuildSettings struct {
+	// replies scoring below this confidence are not posted
+	ConfidenceThreshold float64
+	// emoji reacted onto the trigger message instead of posting a low
+	// confidence reply, empty to stay silent
+	LowConfidenceReaction string
+	// locales of the denylist packs filtering training and output
+	DenylistPacks []string
+	// train on messages with denied terms redacted instead of skipping them
+	RedactDenied bool
+	// post a conversation starter in channels silent for longer than this,
+	// zero to never do so
+	NecromancerSilence time.Duration
+	// how much imported history counts relative to organic messages, nil
+	// for the same
+	ImportWeight *float64
+	// channel where every message gets a reply, zero for none
+	PlaygroundChannel snowflake.ID
+	// how long a member waits between playground replies, zero for the
+	// default
+	PlaygroundCooldown time.Duration
+	// version of the privacy policy an admin accepted, zero for none, and
+	// who accepted it when
+	ConsentVersion int
+	ConsentedBy    snowflake.ID
+	ConsentedAt    time.Time
+	// version of the privacy policy the guild was last shown
+	NoticeVersion int
+	// terms kept out of generated text on top of the denylist packs
+	OutputBlocklist []string
+	// generate again when output contains blocked terms instead of only
+	// censoring them
+	ResampleBlocked bool
+	// regular expressions of messages never learned, like bot commands
+	TrainFilters []string
+	// learn from and reply in channels marked as age-restricted
+	AllowNSFW bool
+	// what happens to links before messages are learned
+	Links LinkHandling
+	// learn emails, phone numbers and long numbers instead of redacting
+	// them
+	KeepPII bool
+	// continuations beam search keeps while generating, zero to sample
+	// instead
+	BeamWidth int
+	// learn the names of attached files and stickers as tokens
+	LearnAttachments bool
+	// emoji that has the bot reply to the message it is reacted onto,
+	// empty for none
+	TriggerReaction string
+	// contribute to and generate from the brain shared across guilds
+	ShareGlobal bool
+	// channel notices about what the bot learns from are posted in, zero
+	// for none
+	LogChannel snowflake.ID
+}
+
+func (s GuildSettings) importWeight() float64 {
+	if s.ImportWeight == nil {
+		return 1
+	}
+
+	return *s.ImportWeight
+}
+
+// Brain is everything learned in one guild. Its methods are safe for
+// concurrent use.
+type Brain struct {
+	// always trained, since entities, styles and confidence build on it
+	Model *ngram.Model
+	// name of the generation backend, and its state when it isn't Model
+	Backend          string
+	BackendState     []byte
+	TrainedSpans     map[snowflake.ID]*TrainedSpan
+	ChannelWhitelist map[snowflake.ID]bool
+	GuildID          snowflake.ID
+	Settings         GuildSettings
+	Authors          map[snowflake.ID]*AuthorProfile
+	OptedOut         map[snowflake.ID]bool
+	// users moderators excluded from being learned
+	BlockedUsers map[snowflake.ID]bool
+	// each channel's own model, kept when the brain is per channel
+	ChannelModels map[snowflake.ID]*ngram.Model
+	// member and channel names that become entities once written
+	KnownNames map[string]bool
+	// mid-sentence capitalized words counted towards becoming entities,
+	// written under mu's read lock too as long as candidatesMu is held
+	EntityCandidates map[string]int
+	// how often each longer word came up per channel, seeding starters
+	ChannelTopics map[snowflake.ID]map[string]int
+	// when each dead channel was last sent a starter
+	Revived map[snowflake.ID]time.Time
+	// how often each pair of words came up per channel since its last
+	// digest, and when that was
+	DayPhrases map[snowflake.ID]map[string]int
+	Digested   map[snowflake.ID]time.Time
+	// history imported from other platforms, oldest first
+	Imports []Import
+	// messages learned as imported history, including through the API
+	ImportedMessages int
+	// digests of the messages imported from exports, to leave out repeats
+	ImportDigests map[uint64]bool
+	// phrases members fed with /feed, oldest first
+	Fed []Feed
+	// the receipt given to the last fed phrase
+	LastFeedID int
+	// settings of the channels configured apart from the guild
+	PerChannel map[snowflake.ID]ChannelSettings
+	// admin actions taken on the brain's data, oldest first
+	Audit []AuditEntry
+	// the latest learned messages, oldest first, which output mustn't copy
+	Recent []Fingerprint
+	// text unlearned since the oldest snapshot was taken, oldest first, and
+	// how much ever was
+	Tombstones []Tombstone
+	Buried     int
+	// since when the message log holds everything learned, zero while it
+	// doesn't, and when the brain was last rebuilt from it
+	LoggedSince time.Time
+	RebuiltAt   time.Time
+	// the rules learning follows, nil until noted, and those it followed
+	// before, oldest first
+	Rules     *learnRules
+	PastRules []pastRules
+
+	opts Options
+	// set up along with Model and replaced with it only by a rebuild holding
+	// changes, so it is used without holding mu while taking changes in
+	backend textmodel.TextModel
+	// what was learned and forgotten, shared with the brains replacing this
+	// one
+	log *messageLog
+	// loads the brain shared across guilds, nil for the shared brain itself
+	shared func() *Brain
+	// when each channel's reply cooldown ends, not worth persisting
+	replyTurns map[snowflake.ID]time.Time
+	// when each member's playground cooldown ends, not worth persisting
+	playgroundTurns map[snowflake.ID]time.Time
+	// likewise for feeding phrases
+	feedTurns map[snowflake.ID]time.Time
+	// when each channel posts unprompted next, scheduled afresh on startup
+	nextPosts map[snowflake.ID]time.Time
+	// each channel's latest learned messages, oldest first, not worth
+	// persisting
+	conversations map[snowflake.ID][]spoken
+	// each channel's ongoing exchange with the bot
+	sessions map[snowflake.ID]*session
+	// TrainFilters compiled
+	trainFilters []*regexp.Regexp
+	// how many recent messages have each whole and shingle hash
+	recentWhole    map[uint64]int
+	recentShingles map[uint64]int
+
+	// KnownNames by nameKey, to find them in a message without going
+	// through every one
+	names        map[string][]string
+	candidatesMu sync.Mutex
+	// when the oldest snapshot was taken, zero while there is none
+	oldestSnapshot time.Time
+	// serializes encoding, which Save and TakeSnapshot do under the read
+	// lock
+	encodeMu sync.Mutex
+
+	mu sync.RWMutex
+	// set when the brain changed since it was last saved
+	dirty bool
+
+	// held for reading from logging a change until the brain took it in and
+	// while saving, and for writing by a rebuild catching up with the log
+	// and a restore replacing the brain, so neither misses a change and a
+	// replaced brain isn't saved over its replacement
+	changes sync.RWMutex
+	// set once a restore replaced the brain, under changes
+	replaced bool
+	// set while the store has the brain unloaded, which puts it back in use
+	// with putBack once it takes a change in
+	unloaded atomic.Bool
+	putBack  func()
+}
+
+// takeIn holds changes for reading while a change is taken in, putting the
+// brain back in use if the store unloaded it while it was held. It returns
+// the function releasing them.
+func (b *Brain) takeIn() func() {
+	b.changes.RLock()
+	if b.unloaded.Load() && b.putBack != nil {
+		b.putBack()
+	}
+
+	return b.changes.RUnlock
+}
+
+// New creates an empty brain for a guild.
+func New(guildID snowflake.ID, opts Options) *Brain {
+	b := &Brain{
+		Model:            ngram.New(ngram.NewCharTokenizer([]string{}), opts.Order, opts.Smoothing),
+		TrainedSpans:     make(map[snowflake.ID]*TrainedSpan),
+		ChannelWhitelist: make(map[snowflake.ID]bool),
+		GuildID:          guildID,
+		Authors:          make(map[snowflake.ID]*AuthorProfile),
+		ChannelModels:    make(map[snowflake.ID]*ngram.Model),
+		OptedOut:         make(map[snowflake.ID]bool),
+		BlockedUsers:     make(map[snowflake.ID]bool),
+		KnownNames:       make(map[string]bool),
+		EntityCandidates: make(map[string]int),
+		names:            make(map[string][]string),
+		ChannelTopics:    make(map[snowflake.ID]map[string]int),
+		Revived:          make(map[snowflake.ID]time.Time),
+		DayPhrases:       make(map[snowflake.ID]map[string]int),
+		Digested:         make(map[snowflake.ID]time.Time),
+		ImportDigests:    make(map[uint64]bool),
+		PerChannel:       make(map[snowflake.ID]ChannelSettings),
+		opts:             opts,
+		log:              newMessageLog(opts.path(guildID)),
+	}
+	b.attachBackend()
+	b.compileTrainFilters()
+	b.noteRules()
+
+	return b
+}
+
+// Span returns how much of a channel has been learned, or nil if nothing has.
+func (b *Brain) Span(channelID snowflake.ID) *TrainedSpan {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.TrainedSpans[channelID]
+}
+
+func (b *Brain) setTrainedSpan(channelID snowflake.ID, span *TrainedSpan) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.TrainedSpans[channelID] = span
+	b.dirty = true
+}
+
+// FinishCrawl records that a channel's history was learned back to its
+// start, reporting whether that is news.
+func (b *Brain) FinishCrawl(channelID snowflake.ID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	span := b.TrainedSpans[channelID]
+	if span == nil || span.Crawled {
+		return false
+	}
+
+	span.Crawled = true
+	b.dirty = true
+	return true
+}
+
+// Channels lists the channels with learned history.
+func (b *Brain) Channels() []snowflake.ID {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var channels []snowflake.ID
+	for channelID := range b.TrainedSpans {
+		channels = append(channels, channelID)
+	}
+
+	return channels
+}
+
+// Path is the file a guild's brain is stored in under dir.
+func Path(dir string, guildID snowflake.ID) string {
+	return filepath.Join(dir, guildID.String()+".brain")
+}
+
+func (o Options) path(guildID snowflake.ID) string {
+	if o.File != "" {
+		return o.File
+	}
+
+	return Path(o.Dir, guildID)
+}
+
+// Dirty reports whether the brain changed since it was last saved.
+func (b *Brain) Dirty() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.dirty
+}
+
+// Save writes the brain to disk. The file is replaced atomically so a crash
+// mid-write never leaves a truncated brain behind.
+func (b *Brain) Save() error {
+	b.changes.RLock()
+	defer b.changes.RUnlock()
+
+	// its replacement is saved instead
+	if b.replaced {
+		return nil
+	}
+
+	var buffer bytes.Buffer
+
+	// cleared first, so whatever changes while encoding is saved next time
+	b.mu.Lock()
+	b.dirty = false
+	b.mu.Unlock()
+
+	b.mu.RLock()
+	err := b.encode(&buffer)
+	channels := b.channels()
+	b.mu.RUnlock()
+
+	if err != nil {
+		b.markDirty()
+		return fmt.Errorf("serializing brain: %w", err)
+	}
+
+	fn := b.opts.path(b.GuildID)
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		b.markDirty()
+		return fmt.Errorf("creating models directory: %w", err)
+	}
+
+	if err := os.WriteFile(fn+".tmp", buffer.Bytes(), 0644); err != nil {
+		b.markDirty()
+		return fmt.Errorf("writing brain: %w", err)
+	}
+
+	if err := os.Rename(fn+".tmp", fn); err != nil {
+		b.markDirty()
+		return fmt.Errorf("replacing brain: %w", err)
+	}
+	saveWatched(fn, channels)
+
+	storageLog.Info("Serialized guild brain with ID", slog.Any("guildID", b.GuildID))
+	return nil
+}
+
+// encode writes the brain in the format decode reads. The caller holds the
+// lock, if only for reading: the models and entity candidates, which change
+// under the read lock too, are held still meanwhile.
+func (b *Brain) encode(w io.Writer) error {
+	b.encodeMu.Lock()
+	defer b.encodeMu.Unlock()
+
+	defer func() { b.BackendState = nil }()
+
+	if err := b.saveBackend(); err != nil {
+		return err
+	}
+
+	// the guild model first, the order interpolation holds models in
+	models := b.models()
+	for _, model := range models {
+		defer model.Hold()()
+		model.Flatten()
+	}
+
+	b.candidatesMu.Lock()
+	defer b.candidatesMu.Unlock()
+
+	err := gob.NewEncoder(w).Encode(b)
+
+	// the models work from their shards, the flat copies were only for
+	// encoding
+	for _, model := range models {
+		model.Counts, model.Imported = nil, nil
+	}
+
+	return err
+}
+
+func (b *Brain) markDirty() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.dirty = true
+}
+
+// Read decodes a brain file, reporting why it could not be read.
+func Read(fn string, opts Options) (*Brain, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(data, opts)
+}
+
+// decode reads a brain in the format Save writes
+func decode(data []byte, opts Options) (*Brain, error) {
+	var brain Brain
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&brain); err != nil {
+		return nil, err
+	}
+
+	brain.opts = opts
+	brain.log = newMessageLog(opts.path(brain.GuildID))
+	brain.Model.Unflatten()
+	for _, profile := range brain.Authors {
+		profile.Model.Unflatten()
+	}
+	for _, model := range brain.ChannelModels {
+		model.Unflatten()
+	}
+	brain.attachBackend()
+	brain.applyImportWeight()
+	brain.compileTrainFilters()
+
+	// brains saved by older versions lack newer maps, and gob drops empty ones
+	if brain.TrainedSpans == nil {
+		brain.TrainedSpans = make(map[snowflake.ID]*TrainedSpan)
+	}
+	if brain.ChannelWhitelist == nil {
+		brain.ChannelWhitelist = make(map[snowflake.ID]bool)
+	}
+	if brain.Authors == nil {
+		brain.Authors = make(map[snowflake.ID]*AuthorProfile)
+	}
+	if brain.BlockedUsers == nil {
+		brain.BlockedUsers = make(map[snowflake.ID]bool)
+	}
+	if brain.ChannelModels == nil {
+		brain.ChannelModels = make(map[snowflake.ID]*ngram.Model)
+	}
+	if brain.OptedOut == nil {
+		brain.OptedOut = make(map[snowflake.ID]bool)
+	}
+	if brain.KnownNames == nil {
+		brain.KnownNames = make(map[string]bool)
+	}
+	if brain.EntityCandidates == nil {
+		brain.EntityCandidates = make(map[string]int)
+	}
+	if brain.ChannelTopics == nil {
+		brain.ChannelTopics = make(map[snowflake.ID]map[string]int)
+	}
+	if brain.Revived == nil {
+		brain.Revived = make(map[snowflake.ID]time.Time)
+	}
+	if brain.DayPhrases == nil {
+		brain.DayPhrases = make(map[snowflake.ID]map[string]int)
+	}
+	if brain.Digested == nil {
+		brain.Digested = make(map[snowflake.ID]time.Time)
+	}
+	if brain.ImportDigests == nil {
+		brain.ImportDigests = make(map[uint64]bool)
+	}
+	if brain.PerChannel == nil {
+		brain.PerChannel = make(map[snowflake.ID]ChannelSettings)
+	}
+	brain.numberFeeds()
+	brain.indexRecent()
+	brain.indexNames()
+	brain.noteSnapshots()
+	brain.noteRules()
+
+	return &brain, nil
+}
+
+// Load reads a guild's brain from disk, falling back to a new brain when there
+// is none or it cannot be read.
+func Load(guildID snowflake.ID, opts Options) *Brain {
+	fn := opts.path(guildID)
+
+	if _, err := os.Stat(fn); os.IsNotExist(err) {
+		storageLog.Info("Brain file does not exist, creating new brain", slog.Any("guildID", guildID))
+		return New(guildID, opts)
+	}
+
+	brain, err := Read(fn, opts)
+	if err != nil {
+		storageLog.Error("Failed to load brain", slog.Any("guildID", guildID), slog.String("file", fn), slog.String("err", err.Error()))
+		return New(guildID, opts)
+	}
+
+	storageLog.Info("Loaded brain for guild", slog.Any("guildID", guildID), slog.Int("trainedSpans", len(brain.TrainedSpans)))
+	if err := VerifyAudit(brain.Audit); err != nil {
+		brainLog.Warn("Audit log doesn't verify", slog.Any("guildID", guildID), slog.String("err", err.Error()))
+	}
+	return brain
+}
+
+// WhitelistChannel lets the brain learn from a channel.
+func (b *Brain) WhitelistChannel(channelID snowflake.ID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ChannelWhitelist[channelID] = true
+	b.dirty = true
+}
+
+// IsWhitelisted reports whether the brain learns from a channel.
+func (b *Brain) IsWhitelisted(channelID snowflake.ID) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.ChannelWhitelist[channelID]
+}
+
+// GuildSettings returns a copy of the guild's settings.
+func (b *Brain) GuildSettings() GuildSettings {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.Settings
+}
+
+// SetConfidenceThreshold holds back replies scoring below threshold, reacting
+// with reaction instead unless it is empty.
+func (b *Brain) SetConfidenceThreshold(threshold float64, reaction string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.ConfidenceThreshold = threshold
+	b.Settings.LowConfidenceReaction = reaction
+	b.dirty = true
+}
+
+// SetTriggerReaction sets the emoji that has the bot reply to messages it is
+// reacted onto, empty for none.
+func (b *Brain) SetTriggerReaction(emoji string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.TriggerReaction = emoji
+	b.dirty = true
+}
+
+// SetDenylistPack enables or disables the denylist pack for locale.
+func (b *Brain) SetDenylistPack(locale string, enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.DenylistPacks = slices.DeleteFunc(b.Settings.DenylistPacks, func(l string) bool { return l == locale })
+	if enabled {
+		b.Settings.DenylistPacks = append(b.Settings.DenylistPacks, locale)
+	}
+	b.dirty = true
+}
+
+// SetAllowNSFW lets the brain learn from and reply in age-restricted
+// channels, or stops it from doing so.
+func (b *Brain) SetAllowNSFW(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.AllowNSFW = enabled
+	b.dirty = true
+}
+
+// SetRedactDenied chooses between redacting denied terms and skipping
+// messages containing them.
+func (b *Brain) SetRedactDenied(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.RedactDenied = enabled
+	b.dirty = true
+}
+
+// DeniedTerms lists the terms of every denylist pack enabled in this guild.
+func (b *Brain) DeniedTerms() []string {
+	if b.opts.Denylists == nil {
+		return nil
+	}
+
+	return b.opts.Denylists.Terms(b.GuildSettings().DenylistPacks)
+}
+
+// IsOptedOut reports whether a user asked not to be learned from.
+func (b *Brain) IsOptedOut(userID snowflake.ID) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.OptedOut[userID]
+}
+
+// SetOptOut stops or resumes learning from a user. Opting out also unlearns
+// what the user taught the guild model, as far as their profile tells, like
+// ForgetUser, and drops their messages from the message log.
+func (b *Brain) SetOptOut(userID snowflake.ID, optedOut bool) {
+	defer b.takeIn()()
+
+	if optedOut {
+		b.record(logEntry{AuthorID: userID, Forget: true})
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if optedOut {
+		b.OptedOut[userID] = true
+		b.dropAuthor(userID)
+	} else {
+		delete(b.OptedOut, userID)
+	}
+	b.dirty = true
+}
+
+func (b *Brain) shouldObserve(obs Message) bool {
+	return b.IsWhitelisted(obs.ChannelID) && b.learnsFrom(obs)
+}
+
+// learnsFrom reports whether obs is learned when its channel is watched
+func (b *Brain) learnsFrom(obs Message) bool {
+	if obs.NSFW && !b.GuildSettings().AllowNSFW {
+		return false
+	}
+
+	if obs.Bot {
+		return false
+	}
+
+	if b.IsOptedOut(obs.AuthorID) || b.IsBlocked(obs.AuthorID) {
+		return false
+	}
+
+	var text = b.learnedText(obs)
+	if len(text) == 0 {
+		return false
+	}
+
+	if !b.AllowsText(text) {
+		return false
+	}
+
+	return true
+}
+
+// AllowsText reports whether text may be learned from: it must not match a
+// training filter, and be clean under the denylist unless denied terms get
+// redacted.
+func (b *Brain) AllowsText(text string) bool {
+	if b.filtered(text) {
+		return false
+	}
+
+	return b.GuildSettings().RedactDenied || len(denylist.FindTerms(text, b.DeniedTerms())) == 0
+}
+
+// Observe learns a message unless its channel's span already covers it, and
+// extends the span either way.
+func (b *Brain) Observe(obs Message) {
+	b.ObserveContext(context.Background(), obs)
+}
+
+// ObserveContext is Observe tracing as part of ctx.
+func (b *Brain) ObserveContext(ctx context.Context, obs Message) {
+	var span = b.Span(obs.ChannelID)
+
+	if span != nil {
+		if span.DuringSpan(obs.CreatedAt) {
+			return
+		}
+	}
+
+	b.observe(ctx, obs, span)
+}
+
+// ObserveMissed learns a message from a gap in the learned span, like the
+// ones left by downtime, which Observe takes for already learned. The caller
+// makes sure it wasn't.
+func (b *Brain) ObserveMissed(obs Message) {
+	b.observe(context.Background(), obs, b.Span(obs.ChannelID))
+}
+
+func (b *Brain) observe(ctx context.Context, obs Message, span *TrainedSpan) {
+	defer b.takeIn()()
+
+	ctx, traced := tracer.Start(ctx, "brain.Observe", trace.WithAttributes(tracing.Guild(b.GuildID), tracing.Channel(obs.ChannelID)))
+	defer traced.End()
+
+	// before the span grows to cover the message
+	b.noteRules()
+
+	if b.shouldObserve(obs) {
+		// nothing is learned, so the span doesn't cover the message either
+		// and it's learned once there is room again
+		if b.Full() {
+			return
+		}
+
+		b.record(logEntry{Message: &obs})
+		if text, spans, err := b.learn(ctx, obs); err == nil {
+			b.contribute(text, spans)
+		}
+	}
+
+	if span == nil {
+		b.setTrainedSpan(obs.ChannelID, makeSpan(obs))
+	} else {
+		span.ExtendSpan(obs)
+		b.setTrainedSpan(obs.ChannelID, span)
+	}
+}
+
+// learn learns a message that should be observed, returning it as the
+// models learned it and the spans of it redacted
+func (b *Brain) learn(ctx context.Context, obs Message) (string, [][2]int, error) {
+	b.rememberAuthor(obs)
+	b.noteTopics(obs.ChannelID, obs.Content)
+	b.notePhrases(obs.ChannelID, obs.Content)
+	b.noteConversation(obs)
+
+	text, spans := b.prepare(b.learnedText(obs))
+	if err := b.train(ctx, obs.AuthorID, text, spans); err != nil {
+		return "", nil, err
+	}
+	b.trainChannel(obs.ChannelID, text, spans)
+
+	return text, spans, nil
+}
+
+// Train learns text, attributing it to authorID unless that is zero. It
+// returns ErrFull when the brain stopped learning.
+func (b *Brain) Train(authorID snowflake.ID, text string) error {
+	_, _, err := b.trainText(authorID, text)
+	return err
+}
+
+// trainText is Train returning the text as the models learned it and the
+// spans of it redacted
+func (b *Brain) trainText(authorID snowflake.ID, content string) (string, [][2]int, error) {
+	defer b.takeIn()()
+
+	if b.Full() {
+		return "", nil, ErrFull
+	}
+
+	b.record(logEntry{AuthorID: authorID, Text: content})
+
+	text, spans := b.prepare(content)
+	return text, spans, b.train(context.Background(), authorID, text, spans)
+}
+
+// train learns text prepared for the models
+func (b *Brain) train(ctx context.Context, authorID snowflake.ID, text string, spans [][2]int) error {
+	if b.Full() {
+		return ErrFull
+	}
+
+	ctx, span := tracer.Start(ctx, "brain.Train", trace.WithAttributes(tracing.Guild(b.GuildID)))
+	defer span.End()
+
+	b.learnEntities(text)
+
+	// the guild model locks its own counts, so channels train it side by
+	// side and generation goes on meanwhile
+	b.rlock(ctx)
+	b.Model.TrainRedacted(text, spans)
+	b.mu.RUnlock()
+
+	b.trainBackend(cutSpans(text, spans))
+
+	b.lock(ctx)
+	defer b.mu.Unlock()
+
+	if authorID != 0 {
+		if b.Authors[authorID] == nil {
+			b.Authors[authorID] = b.newAuthorProfile()
+		}
+		b.Authors[authorID].observe(text, spans)
+	}
+	b.remember(cutSpans(text, spans))
+
+	b.dirty = true
+	b.enforceBudget()
+
+	return nil
+}
+
+// ForgetText unlearns text that was passed to Train.
+func (b *Brain) ForgetText(content string) {
+	defer b.takeIn()()
+
+	b.record(logEntry{Text: content, Forget: true})
+
+	text, spans := b.prepare(content)
+
+	b.forgetBackend(cutSpans(text, spans))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bury(0, 0, text, spans)
+	b.Model.ForgetRedacted(text, spans)
+	b.dirty = true
+}
+
+// Forget unlearns a message that was previously observed, even if its
+// channel isn't watched anymore. Whether it was learned and how is up to the
+// rules in force when its channel's span grew to cover it, not the current
+// ones.
+func (b *Brain) Forget(obs Message) {
+	defer b.takeIn()()
+
+	rules, ok := b.learnedUnder(obs)
+	if !ok || !rules.learned(obs) {
+		return
+	}
+
+	text, spans := rules.prepare(learnedText(obs, rules.LearnAttachments))
+
+	b.mu.Lock()
+	b.bury(obs.AuthorID, obs.ChannelID, text, spans)
+	b.mu.Unlock()
+	b.record(logEntry{Message: &obs, Forget: true})
+
+	b.forgetConversation(obs)
+	if rules.Forgotten[obs.AuthorID] {
+		// the guild model lost it with the author's profile already, other
+		// backends didn't
+		b.forgetBackend(cutSpans(text, spans))
+	} else {
+		b.unlearn(obs.AuthorID, text, spans)
+	}
+	b.forgetChannel(obs.ChannelID, text, spans)
+	b.withdraw(text, spans)
+}
+
+// unlearn undoes train for the same author and prepared text
+func (b *Brain) unlearn(authorID snowflake.ID, text string, spans [][2]int) {
+	b.forgetBackend(cutSpans(text, spans))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Model.ForgetRedacted(text, spans)
+	if profile := b.Authors[authorID]; profile != nil {
+		profile.forget(text, spans)
+	}
+	b.dirty = true
+}
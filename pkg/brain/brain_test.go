@@ -0,0 +1,284 @@
+package brain
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/ngram"
+)
+
+const testGuild = snowflake.ID(1)
+
+func testOptions(t *testing.T) Options {
+	return Options{Dir: t.TempDir(), Snapshots: 2, Order: 3, Smoothing: 0.1}
+}
+
+func TestSaveReadRoundTrip(t *testing.T) {
+	opts := testOptions(t)
+
+	b := New(testGuild, opts)
+	b.Train(5, "hello there, general Kenobi")
+	b.Train(6, "good morning <@123>")
+	b.ForgetText("good morning <@123>")
+	b.AddEntity("Kenobi")
+	b.Train(5, "hello there, general Kenobi")
+	b.BlockTerm("sand")
+	b.SetNecromancer(2 * time.Hour)
+	b.SetOptOut(7, true)
+
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Dirty() {
+		t.Error("dirty right after saving")
+	}
+
+	read, err := Read(Path(opts.Dir, testGuild), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"hello there", "general Kenobi", "good morning", "<@123>"} {
+		if got, want := read.Model.Frequency(text), b.Model.Frequency(text); got != want {
+			t.Errorf("Frequency(%q) = %v after reading, %v before saving", text, got, want)
+		}
+	}
+	if got, want := read.Model.Entries(), b.Model.Entries(); got != want {
+		t.Errorf("%d n-grams after reading, %d before saving", got, want)
+	}
+	if !slices.Equal(read.Entities(), b.Entities()) {
+		t.Errorf("entities %v after reading, %v before saving", read.Entities(), b.Entities())
+	}
+	if !slices.Equal(read.Blocklist(), b.Blocklist()) {
+		t.Errorf("blocklist %v after reading, %v before saving", read.Blocklist(), b.Blocklist())
+	}
+	if !reflect.DeepEqual(read.GuildSettings(), b.GuildSettings()) {
+		t.Errorf("settings %+v after reading, %+v before saving", read.GuildSettings(), b.GuildSettings())
+	}
+	if !read.IsOptedOut(7) {
+		t.Error("opt-out lost")
+	}
+	if read.Authors[5] == nil || read.Authors[5].Model.Entries() != b.Authors[5].Model.Entries() {
+		t.Error("author profile lost")
+	}
+}
+
+func TestTrainForget(t *testing.T) {
+	b := New(testGuild, testOptions(t))
+	texts := []string{"hello there", "call me at 555-123-4567", "hello there"}
+
+	for _, text := range texts {
+		b.Train(5, text)
+	}
+	for _, text := range texts {
+		prepared, spans := b.prepare(text)
+		b.unlearn(5, prepared, spans)
+	}
+
+	for name, model := range map[string]*ngram.Model{"guild": b.Model, "author": b.Authors[5].Model} {
+		model.Flatten()
+		for key, count := range model.Counts {
+			if count > 0 {
+				t.Errorf("%s model still counts %q %d times", name, key, count)
+			}
+		}
+	}
+}
+
+func TestForgetUnderLearnRules(t *testing.T) {
+	b := New(testGuild, testOptions(t))
+	b.WhitelistChannel(9)
+
+	now := time.Now()
+	message := func(id, authorID snowflake.ID, text string) Message {
+		return Message{ID: id, ChannelID: 9, AuthorID: authorID, Content: text, CreatedAt: now.Add(time.Duration(id) * time.Second)}
+	}
+	optedOut := message(1, 5, "gone with the profile")
+	kept := message(2, 6, "something else entirely")
+	b.Observe(optedOut)
+	b.Observe(kept)
+
+	// opting out unlearns the profile, the delete mustn't unlearn it again
+	b.SetOptOut(5, true)
+	if got := b.Model.Frequency("gone with"); got != 0 {
+		t.Errorf("Frequency of opted-out text = %v, want 0", got)
+	}
+	b.Forget(optedOut)
+
+	// a blocked member's message wasn't learned, so there is nothing to
+	// forget
+	b.SetBlocked(7, true)
+	b.Observe(message(3, 7, "something else entirely"))
+	b.Forget(message(3, 7, "something else entirely"))
+	if got := b.Model.Frequency("something else"); got != 1 {
+		t.Errorf("Frequency of kept text = %v, want 1", got)
+	}
+
+	// channels learned from stay forgettable once unwatched
+	b.SetLearning(9, false)
+	b.Forget(kept)
+	b.Model.Flatten()
+	for key, count := range b.Model.Counts {
+		if count > 0 {
+			t.Errorf("guild model still counts %q %d times", key, count)
+		}
+	}
+}
+
+func TestForgetAfterPreparationChanged(t *testing.T) {
+	b := New(testGuild, testOptions(t))
+	b.WhitelistChannel(9)
+
+	message := Message{ID: 1, ChannelID: 9, AuthorID: 5, Content: "see https://example.com now", CreatedAt: time.Now()}
+	b.Observe(message)
+	id, err := b.Feed(6, "mail me at someone@example.com", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// forgetting goes by how the text was learned, not how it would be now
+	b.SetLinkHandling(LinksRemove)
+	b.SetKeepPII(true)
+	b.Forget(message)
+	b.Unfeed(id)
+
+	b.Model.Flatten()
+	for key, count := range b.Model.Counts {
+		if count > 0 {
+			t.Errorf("guild model still counts %q %d times", key, count)
+		}
+	}
+}
+
+func TestRestoreKeepsTextForgotten(t *testing.T) {
+	opts := testOptions(t)
+	store := NewStore(func(snowflake.ID) Options { return opts })
+
+	b := store.Get(testGuild)
+	b.Train(5, "a secret worth deleting")
+	b.Train(6, "something else entirely")
+	if err := b.TakeSnapshot(SnapshotPrune); err != nil {
+		t.Fatal(err)
+	}
+	b.ForgetText("a secret worth deleting")
+
+	snapshots := b.Snapshots()
+	if len(snapshots) != 1 {
+		t.Fatalf("%d snapshots, want 1", len(snapshots))
+	}
+
+	restored, err := store.Restore(testGuild, snapshots[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restored.Model.Frequency("secret"); got != 0 {
+		t.Errorf("Frequency of forgotten text = %v after restoring, want 0", got)
+	}
+	if got := restored.Model.Frequency("something else"); got != 1 {
+		t.Errorf("Frequency of kept text = %v after restoring, want 1", got)
+	}
+}
+
+func TestUnloadKeepsHeldBrain(t *testing.T) {
+	opts := testOptions(t)
+	store := NewStore(func(snowflake.ID) Options { return opts })
+
+	b := store.Get(testGuild)
+	b.Train(5, "learned before unloading")
+	if n := store.Unload(0, time.Now()); n != 1 {
+		t.Fatalf("Unload unloaded %d brains, want 1", n)
+	}
+
+	b.Train(5, "learned after unloading")
+	if n := store.Unload(0, time.Now()); n != 1 {
+		t.Fatalf("Unload unloaded %d brains once written to again, want 1", n)
+	}
+	if got := Load(testGuild, opts).Model.Frequency("after unloading"); got != 1 {
+		t.Errorf("Frequency of text learned after unloading = %v on disk, want 1", got)
+	}
+	if store.Get(testGuild) != b {
+		t.Error("Get loaded a copy of a brain still held")
+	}
+}
+
+func TestLearnEntities(t *testing.T) {
+	b := New(testGuild, testOptions(t))
+	b.RememberName("Zelda")
+
+	b.Train(5, "I met zelda today")
+	if !slices.Contains(b.Entities(), "Zelda") {
+		t.Errorf("known name not learned as an entity: %v", b.Entities())
+	}
+
+	for i := range entityPromotionCount {
+		if slices.Contains(b.Entities(), "Gandalf") {
+			t.Fatalf("Gandalf promoted after %d mentions", i)
+		}
+		b.Train(5, "we saw Gandalf again")
+	}
+	if !slices.Contains(b.Entities(), "Gandalf") {
+		t.Errorf("recurring name not learned as an entity: %v", b.Entities())
+	}
+
+	b.Train(5, "Tomorrow we leave")
+	if _, ok := b.EntityCandidates["Tomorrow"]; ok {
+		t.Error("sentence start counted as a candidate")
+	}
+}
+
+func TestRebuildFromLog(t *testing.T) {
+	opts := testOptions(t)
+	opts.MessageLog, opts.MessageLogRetention = true, 24*time.Hour
+	store := NewStore(func(snowflake.ID) Options { return opts })
+
+	b := store.Get(testGuild)
+	b.WhitelistChannel(10)
+	now := time.Now()
+	for i, message := range []Message{
+		{ID: 100, ChannelID: 10, AuthorID: 5, Content: "the first message stays"},
+		{ID: 101, ChannelID: 10, AuthorID: 5, Content: "a secret worth deleting"},
+		{ID: 102, ChannelID: 10, AuthorID: 6, Content: "someone opting out later"},
+	} {
+		message.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		b.Observe(message)
+	}
+	b.Forget(Message{ID: 101, ChannelID: 10, AuthorID: 5, Content: "a secret worth deleting", CreatedAt: now.Add(time.Second)})
+	b.SetOptOut(6, true)
+	b.Train(7, "fed phrase")
+
+	if b.RebuildDue(time.Hour, now) {
+		t.Error("rebuild due before the log reaches back as far as it keeps messages")
+	}
+	b.setLoggedSince(now.Add(-48 * time.Hour))
+	if !b.RebuildDue(time.Hour, now) {
+		t.Fatal("rebuild not due")
+	}
+
+	rebuilt, err := store.Rebuild(testGuild, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt != b || store.Get(testGuild) != b {
+		t.Error("brain in use not rebuilt in place")
+	}
+
+	for text, want := range map[string]float64{"first message": 1, "fed phrase": 1, "secret": 0, "opting out": 0} {
+		if got := rebuilt.Model.Frequency(text); got != want {
+			t.Errorf("Frequency(%q) = %v after rebuilding, want %v", text, got, want)
+		}
+	}
+	if rebuilt.RebuildDue(time.Hour, now) {
+		t.Error("rebuild due right after rebuilding")
+	}
+
+	entries, err := rebuilt.log.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("%d entries left in the log, want 2", len(entries))
+	}
+}
@@ -0,0 +1,140 @@
+package brain
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/schizoid/pkg/ngram"
+)
+
+// once over budget, a brain is pruned down to this share of it, so training
+// doesn't trigger another pass with every message
+const budgetHeadroom = 0.9
+
+// What a brain does once it keeps as many counts as its budget allows.
+const (
+	// prune the rarest n-grams, the longest first
+	BudgetPrune = "prune"
+	// stop learning until counts are freed
+	BudgetStop = "stop"
+	// halve every count, so older data fades out in favor of newer
+	BudgetDecay = "decay"
+)
+
+// counts are pruned below a threshold that doubles from 2 until the brain
+// fits, up to this
+const maxBudgetThreshold = 1 << 16
+
+// Entries counts the n-gram counts kept by the guild model, every author model
+// and every channel model, which is what a brain's memory grows with.
+func (b *Brain) Entries() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.entries()
+}
+
+// Budget is how much of its budget a brain takes up.
+type Budget struct {
+	// counts kept across the guild and author models
+	Entries int
+	// counts the brain may keep, 0 for no limit
+	Max int
+	// what the brain does once it reaches Max, one of the budget actions
+	Action string
+}
+
+// Budget reports how close the brain is to its budget.
+func (b *Brain) Budget() Budget {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return Budget{Entries: b.entries(), Max: b.opts.MaxEntries, Action: b.opts.BudgetAction}
+}
+
+// ErrFull refuses to learn text once the brain stopped learning for reaching
+// its budget.
+var ErrFull = errors.New("brain is full")
+
+// Full reports whether the brain stopped learning for reaching its budget.
+func (b *Brain) Full() bool {
+	if b.opts.BudgetAction != BudgetStop || b.opts.MaxEntries <= 0 {
+		return false
+	}
+
+	return b.Entries() >= b.opts.MaxEntries
+}
+
+func (b *Brain) entries() int {
+	var n int
+	for _, model := range b.models() {
+		n += model.Entries()
+	}
+
+	return n
+}
+
+func (b *Brain) models() []*ngram.Model {
+	var models = []*ngram.Model{b.Model}
+	for _, profile := range b.Authors {
+		models = append(models, profile.Model)
+	}
+	for _, model := range b.ChannelModels {
+		models = append(models, model)
+	}
+
+	return models
+}
+
+// enforceBudget frees counts once the brain keeps more than its budget,
+// as its budget action says. The caller must hold the write lock.
+func (b *Brain) enforceBudget() {
+	var budget = b.opts.MaxEntries
+	if budget <= 0 || b.entries() <= budget {
+		return
+	}
+
+	var target = int(float64(budget) * budgetHeadroom)
+
+	switch b.opts.BudgetAction {
+	case BudgetStop:
+		// Train stops learning instead
+		return
+	case BudgetDecay:
+		b.decay(target)
+	default:
+		b.prune(target)
+	}
+
+	b.dirty = true
+}
+
+// prune drops the rarest n-grams until the brain keeps no more than target
+// counts, the longest first at each threshold
+func (b *Brain) prune(target int) {
+	var pruned, k = 0, 2
+
+	for ; b.entries() > target && k <= maxBudgetThreshold; k *= 2 {
+		for n := b.Model.N; n > 0 && b.entries() > target; n-- {
+			for _, model := range b.models() {
+				pruned += model.PruneOrder(n, k)
+			}
+		}
+	}
+
+	modelLog.Info("Pruned brain over its budget", slog.String("guildID", b.GuildID.String()),
+		slog.Int("pruned", pruned), slog.Int("entries", b.entries()), slog.Int("threshold", k/2))
+}
+
+// decay halves every count until the brain keeps no more than target
+func (b *Brain) decay(target int) {
+	var dropped, rounds = 0, 0
+	for ; b.entries() > target; rounds++ {
+		for _, model := range b.models() {
+			dropped += model.Halve()
+		}
+	}
+
+	modelLog.Info("Decayed brain over its budget", slog.String("guildID", b.GuildID.String()),
+		slog.Int("dropped", dropped), slog.Int("entries", b.entries()), slog.Int("halvings", rounds))
+}
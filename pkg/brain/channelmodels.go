@@ -0,0 +1,69 @@
+package brain
+
+import (
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/ngram"
+)
+
+// newChannelModel creates an empty model for a channel of a brain kept per
+// channel, keeping the guild's entities whole
+func (b *Brain) newChannelModel() *ngram.Model {
+	tokenizer := ngram.NewCharTokenizer([]string{})
+	for _, entity := range b.Model.Tokenizer.Entities {
+		tokenizer.AddEntity(entity)
+	}
+
+	model := ngram.New(tokenizer, b.Model.N, b.Model.Smoothing)
+	b.tune(model)
+
+	return model
+}
+
+// trainChannel learns prepared text in the model of the channel it was sent
+// in, when the brain is kept per channel. The guild model learns it too, as
+// what the brain says outside of channels.
+func (b *Brain) trainChannel(channelID snowflake.ID, text string, spans [][2]int) {
+	if !b.opts.PerChannel {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ChannelModels[channelID] == nil {
+		b.ChannelModels[channelID] = b.newChannelModel()
+	}
+	b.ChannelModels[channelID].TrainRedacted(text, spans)
+	b.dirty = true
+}
+
+// forgetChannel undoes trainChannel for the same channel and text
+func (b *Brain) forgetChannel(channelID snowflake.ID, text string, spans [][2]int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if model := b.ChannelModels[channelID]; model != nil {
+		model.ForgetRedacted(text, spans)
+		b.dirty = true
+	}
+}
+
+// channelModel returns the model generating in channelID when the brain is
+// kept per channel, nil to generate like the guild. Channels that haven't
+// learned anything yet talk like the guild. The caller holds at least the
+// read lock.
+func (b *Brain) channelModel(channelID snowflake.ID) *ngram.Model {
+	if !b.opts.PerChannel || channelID == 0 {
+		return nil
+	}
+
+	model := b.ChannelModels[channelID]
+	if model == nil {
+		return nil
+	}
+	if total, _ := model.Totals(); total == 0 {
+		return nil
+	}
+
+	return model
+}
@@ -0,0 +1,126 @@
+package brain
+
+import (
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// ChannelSettings are the per-channel knobs changed with /config. Whether a
+// channel is learned from is its whitelisting.
+type ChannelSettings struct {
+	// reply to messages that don't mention the bot, with this chance
+	AutoReply   bool
+	ReplyChance float64
+	// most tokens a reply in the channel is generated with, zero for the
+	// default
+	MaxLength int
+	// least time between replies in the channel, zero for the default
+	Cooldown time.Duration
+	// post unprompted about this often, zero to never
+	PostInterval time.Duration
+	// vary the time between posts at random around the interval
+	PostJitter bool
+	// hours of the day in UTC posts are held back in, from QuietStart up to
+	// QuietEnd, the same for none
+	QuietStart int
+	QuietEnd   int
+	// post a summary of the day's messages once a day
+	Digest bool
+}
+
+// ReplyLength is the most tokens a reply in the channel is generated with,
+// fallback unless the channel sets its own.
+func (s ChannelSettings) ReplyLength(fallback int) int {
+	if s.MaxLength > 0 {
+		return s.MaxLength
+	}
+
+	return fallback
+}
+
+// ReplyCooldown is the least time between replies in the channel, fallback
+// unless the channel sets its own.
+func (s ChannelSettings) ReplyCooldown(fallback time.Duration) time.Duration {
+	if s.Cooldown > 0 {
+		return s.Cooldown
+	}
+
+	return fallback
+}
+
+// ReplyCooldown is the least time between replies in channelID.
+func (b *Brain) ReplyCooldown(channelID snowflake.ID) time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.PerChannel[channelID].ReplyCooldown(b.opts.ReplyCooldown)
+}
+
+// ReplyTurn reports whether the bot may reply in channelID at now, starting
+// the channel's cooldown if so.
+func (b *Brain) ReplyTurn(channelID snowflake.ID, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if until, ok := b.replyTurns[channelID]; ok && now.Before(until) {
+		return false
+	}
+
+	cooldown := b.PerChannel[channelID].ReplyCooldown(b.opts.ReplyCooldown)
+	if cooldown <= 0 {
+		return true
+	}
+
+	if b.replyTurns == nil {
+		b.replyTurns = make(map[snowflake.ID]time.Time)
+	}
+
+	// drop cooldowns that ended so the map only holds busy channels
+	for id, until := range b.replyTurns {
+		if !now.Before(until) {
+			delete(b.replyTurns, id)
+		}
+	}
+
+	b.replyTurns[channelID] = now.Add(cooldown)
+
+	return true
+}
+
+// ChannelSettings returns a copy of a channel's settings.
+func (b *Brain) ChannelSettings(channelID snowflake.ID) ChannelSettings {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.PerChannel[channelID]
+}
+
+// SetChannelSettings replaces a channel's settings.
+func (b *Brain) SetChannelSettings(channelID snowflake.ID, settings ChannelSettings) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if settings == (ChannelSettings{}) {
+		delete(b.PerChannel, channelID)
+	} else {
+		b.PerChannel[channelID] = settings
+	}
+	// a changed interval applies from now on
+	delete(b.nextPosts, channelID)
+	b.dirty = true
+}
+
+// SetLearning starts or stops learning from a channel. What was learned from
+// it stays.
+func (b *Brain) SetLearning(channelID snowflake.ID, learn bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if learn {
+		b.ChannelWhitelist[channelID] = true
+	} else {
+		delete(b.ChannelWhitelist, channelID)
+	}
+	b.dirty = true
+}
@@ -0,0 +1,43 @@
+package brain
+
+import (
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Consented reports whether an admin accepted version of the privacy policy
+// or a later one.
+func (b *Brain) Consented(version int) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.Settings.ConsentVersion >= version
+}
+
+// AcceptPolicy records that userID accepted version of the privacy policy.
+func (b *Brain) AcceptPolicy(version int, userID snowflake.ID, at time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.ConsentVersion = version
+	b.Settings.ConsentedBy = userID
+	b.Settings.ConsentedAt = at
+	b.dirty = true
+}
+
+// NoticeDue reports whether the guild still has to be shown version of the
+// privacy policy, counting it as shown from then on.
+func (b *Brain) NoticeDue(version int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.Settings.ConsentVersion >= version || b.Settings.NoticeVersion >= version {
+		return false
+	}
+
+	b.Settings.NoticeVersion = version
+	b.dirty = true
+
+	return true
+}
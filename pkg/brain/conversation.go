@@ -0,0 +1,142 @@
+package brain
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// a reply spends one in this many tokens following the conversation, the
+// rest answering the message replied to
+const conversationShare = 3
+
+// a message of a channel's ongoing conversation
+type spoken struct {
+	id        snowflake.ID
+	authorID  snowflake.ID
+	text      string
+	createdAt time.Time
+}
+
+// noteConversation keeps a channel's latest learned messages to reply in the
+// context of. Crawled history is older than what is kept and left out.
+func (b *Brain) noteConversation(obs Message) {
+	// the message replied to is kept along with the ones before it
+	keep := b.opts.ContextMessages + 1
+	if keep <= 1 {
+		return
+	}
+
+	text := b.learnedText(obs)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.conversations == nil {
+		b.conversations = make(map[snowflake.ID][]spoken)
+	}
+
+	recent := b.conversations[obs.ChannelID]
+	if len(recent) >= keep && !obs.CreatedAt.After(recent[0].createdAt) {
+		return
+	}
+
+	i := slices.IndexFunc(recent, func(s spoken) bool { return s.createdAt.After(obs.CreatedAt) })
+	if i < 0 {
+		i = len(recent)
+	}
+	recent = slices.Insert(recent, i, spoken{id: obs.ID, authorID: obs.AuthorID, text: text, createdAt: obs.CreatedAt})
+	if len(recent) > keep {
+		recent = recent[len(recent)-keep:]
+	}
+	b.conversations[obs.ChannelID] = recent
+}
+
+// forgetConversation drops a deleted message from its channel's conversation
+func (b *Brain) forgetConversation(obs Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// none are kept without context messages
+	if recent, ok := b.conversations[obs.ChannelID]; ok {
+		b.conversations[obs.ChannelID] = slices.DeleteFunc(recent, func(s spoken) bool { return s.id == obs.ID })
+	}
+}
+
+// conversation returns the messages of msg's channel before msg, oldest
+// first, leaving out members who opted out since
+func (b *Brain) conversation(msg Message) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var out []string
+	for _, s := range b.conversations[msg.ChannelID] {
+		if s.id != msg.ID && s.createdAt.Before(msg.CreatedAt) && !b.OptedOut[s.authorID] {
+			out = append(out, s.text)
+		}
+	}
+
+	if len(out) > b.opts.ContextMessages {
+		out = out[len(out)-b.opts.ContextMessages:]
+	}
+
+	return out
+}
+
+// Converse replies to msg like Reply does to prompt, the part of msg
+// addressed to the bot, but also continues one of the channel's messages
+// before it, most likely the latest ones, so replies follow the conversation
+// rather than the mention alone. When msg follows up on an exchange with the
+// bot, the bot's previous replies and the author's messages since stand in
+// for the channel's.
+func (b *Brain) Converse(msg Message, prompt string, length int) string {
+	return b.ConverseContext(context.Background(), msg, prompt, length)
+}
+
+// ConverseContext is Converse tracing as part of ctx.
+func (b *Brain) ConverseContext(ctx context.Context, msg Message, prompt string, length int) string {
+	ctx, span := tracer.Start(ctx, "brain.Converse", trace.WithAttributes(tracing.Guild(b.GuildID), tracing.Channel(msg.ChannelID)))
+	defer span.End()
+
+	history := b.sessionHistory(msg)
+	if len(history) == 0 {
+		history = b.conversation(msg)
+	}
+	if len(history) == 0 {
+		return b.replyIn(ctx, msg.ChannelID, prompt, length)
+	}
+
+	return b.bestOf(ctx, b.candidates(), length, func() string {
+		budget := length / conversationShare
+		out := b.reply(ctx, msg.ChannelID, prompt, length-budget)
+
+		sentences := splitSentences(history[recentIndex(len(history))])
+		if len(sentences) == 0 {
+			return out
+		}
+		if more := b.continuation(ctx, msg.ChannelID, sentences[len(sentences)-1], budget); more != "" {
+			out = strings.TrimSpace(out + " " + more)
+		}
+
+		return out
+	})
+}
+
+// recentIndex picks an index below n, each one weighted by its position so
+// later ones are likelier
+func recentIndex(n int) int {
+	r := rand.IntN(n * (n + 1) / 2)
+	for i := range n {
+		if r -= i + 1; r < 0 {
+			return i
+		}
+	}
+
+	return n - 1
+}
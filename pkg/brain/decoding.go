@@ -0,0 +1,26 @@
+package brain
+
+import (
+	"github.com/schizoid/pkg/watchdog"
+)
+
+// SetBeamWidth has the guild's replies decoded with beam search keeping
+// width continuations, or sampled again with zero.
+func (b *Brain) SetBeamWidth(width int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.BeamWidth = width
+	b.dirty = true
+}
+
+// beam decodes with beam search when the guild picked it, reporting whether
+// it did. Only the n-gram backend can; others keep sampling. The caller holds
+// at least the read lock.
+func (b *Brain) beam(seed string, length int, task *watchdog.Task) (string, bool) {
+	if b.Settings.BeamWidth <= 0 || b.separateBackend() {
+		return "", false
+	}
+
+	return b.Model.Beam(seed, length, b.Settings.BeamWidth, task.Alive), true
+}
@@ -0,0 +1,119 @@
+package brain
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/denylist"
+)
+
+// a channel's digest covers this long
+const digestPeriod = 24 * time.Hour
+
+// a digest has a line seeded from each of this many of the day's phrases
+const digestLines = 3
+
+// phrase counts are pruned back to half of this once a channel exceeds it
+const maxDayPhrases = 2000
+
+// notePhrases counts the pairs of words said in a channel that gets a
+// digest, to seed it from what the day was about
+func (b *Brain) notePhrases(channelID snowflake.ID, text string) {
+	if !b.ChannelSettings(channelID).Digest {
+		return
+	}
+
+	var terms = b.DeniedTerms()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	phrases := b.DayPhrases[channelID]
+	if phrases == nil {
+		phrases = make(map[string]int)
+		b.DayPhrases[channelID] = phrases
+	}
+
+	var words []string
+	for _, word := range denylist.SplitWords(text) {
+		words = append(words, strings.ToLower(word.Text))
+	}
+
+	for i := 1; i < len(words); i++ {
+		first, second := words[i-1], words[i]
+		if strings.ContainsFunc(first+second, func(r rune) bool { return !unicode.IsLetter(r) }) {
+			continue
+		}
+
+		// pairs of short words are filler like "of the"
+		if max(utf8.RuneCountInString(first), utf8.RuneCountInString(second)) < minTopicLength {
+			continue
+		}
+
+		phrase := first + " " + second
+		if len(denylist.FindTerms(phrase, terms)) > 0 {
+			continue
+		}
+
+		phrases[phrase]++
+	}
+
+	if len(phrases) > maxDayPhrases {
+		for _, phrase := range rankTopics(phrases)[maxDayPhrases/2:] {
+			delete(phrases, phrase)
+		}
+	}
+}
+
+// DueDigests lists the whitelisted channels getting a digest whose last one
+// was a day or more before now. A channel's first digest comes a day after it
+// is first checked, once there is a day to sum up.
+func (b *Brain) DueDigests(now time.Time) []snowflake.ID {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var due []snowflake.ID
+	for channelID, settings := range b.PerChannel {
+		if !settings.Digest || !b.ChannelWhitelist[channelID] {
+			continue
+		}
+
+		last, ok := b.Digested[channelID]
+		if !ok {
+			b.Digested[channelID] = now
+			b.dirty = true
+			continue
+		}
+
+		if now.Sub(last) >= digestPeriod {
+			due = append(due, channelID)
+		}
+	}
+
+	return due
+}
+
+// Digest generates a channel's summary of the day, a line seeded from each
+// of its most frequent phrases, and starts counting the next day at now. It
+// returns nothing for a day without phrases.
+func (b *Brain) Digest(channelID snowflake.ID, now time.Time, length int) []string {
+	b.mu.Lock()
+	ranked := rankTopics(b.DayPhrases[channelID])
+	delete(b.DayPhrases, channelID)
+	b.Digested[channelID] = now
+	b.dirty = true
+	b.mu.Unlock()
+
+	var lines []string
+	for _, seed := range ranked[:min(digestLines, len(ranked))] {
+		if line := strings.TrimSpace(b.generate(context.Background(), channelID, seed, length)); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,234 @@
+package brain
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/schizoid/pkg/denylist"
+)
+
+// MinEntityLength is the shortest name worth keeping whole as a single token.
+const MinEntityLength = 3
+
+// capitalized words seen mid-sentence this often become entities
+const entityPromotionCount = 5
+
+// the most capitalized words counted towards becoming entities at once; past
+// it every count halves and those down to zero are dropped, so words nobody
+// writes anymore age out
+const maxEntityCandidates = 1000
+
+// Entities lists the names kept whole as single tokens.
+func (b *Brain) Entities() []string {
+	return b.Model.Entities()
+}
+
+// AddEntity keeps name whole in the guild model and every author sub-model.
+func (b *Brain) AddEntity(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.addEntityLocked(name)
+}
+
+func (b *Brain) addEntityLocked(name string) {
+	if utf8.RuneCountInString(name) < MinEntityLength || slices.Contains(b.Model.Tokenizer.Entities, name) {
+		return
+	}
+
+	b.Model.AddEntity(name)
+	for _, profile := range b.Authors {
+		profile.Model.AddEntity(name)
+	}
+	for _, model := range b.ChannelModels {
+		model.AddEntity(name)
+	}
+	delete(b.EntityCandidates, name)
+	b.dirty = true
+
+	brainLog.Info("Learned entity", slog.Any("guildID", b.GuildID), slog.String("entity", name))
+}
+
+// RemoveEntity stops keeping name whole, reporting false if it wasn't an
+// entity.
+func (b *Brain) RemoveEntity(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !slices.Contains(b.Model.Tokenizer.Entities, name) {
+		return false
+	}
+
+	b.Model.RemoveEntity(name)
+	for _, profile := range b.Authors {
+		profile.Model.RemoveEntity(name)
+	}
+	for _, model := range b.ChannelModels {
+		model.RemoveEntity(name)
+	}
+	delete(b.KnownNames, name)
+	b.unindexName(name)
+	b.dirty = true
+
+	return true
+}
+
+// RememberName records a member or channel name, which becomes an entity as
+// soon as someone actually writes it.
+func (b *Brain) RememberName(name string) {
+	if utf8.RuneCountInString(name) < MinEntityLength {
+		return
+	}
+
+	// most messages come from members already known
+	b.mu.RLock()
+	known := b.KnownNames[name]
+	b.mu.RUnlock()
+	if known {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.KnownNames[name] {
+		b.KnownNames[name] = true
+		b.indexName(name)
+		b.dirty = true
+	}
+}
+
+// nameKey is what a name is indexed by: its first word, lowercased
+func nameKey(name string) (string, bool) {
+	words := denylist.SplitWords(name)
+	if len(words) == 0 {
+		return "", false
+	}
+
+	return strings.ToLower(words[0].Text), true
+}
+
+func (b *Brain) indexName(name string) {
+	if key, ok := nameKey(name); ok && !slices.Contains(b.names[key], name) {
+		b.names[key] = append(b.names[key], name)
+	}
+}
+
+func (b *Brain) unindexName(name string) {
+	if key, ok := nameKey(name); ok {
+		b.names[key] = slices.DeleteFunc(b.names[key], func(known string) bool { return known == name })
+		if len(b.names[key]) == 0 {
+			delete(b.names, key)
+		}
+	}
+}
+
+// indexNames indexes every known name afresh
+func (b *Brain) indexNames() {
+	b.names = make(map[string][]string, len(b.KnownNames))
+	for name := range b.KnownNames {
+		b.indexName(name)
+	}
+}
+
+// rememberAuthor records the names a message's author goes by
+func (b *Brain) rememberAuthor(msg Message) {
+	for _, name := range msg.AuthorNames {
+		b.RememberName(name)
+	}
+}
+
+// learnEntities promotes names found in text to entities: known member and
+// channel names right away, recurring capitalized words once they've been
+// seen mid-sentence often enough. Only promoting takes the write lock.
+func (b *Brain) learnEntities(text string) {
+	var words = denylist.SplitWords(text)
+
+	b.mu.RLock()
+	entities := b.Model.Entities()
+	found := slices.Concat(b.namesIn(text, words), b.countCandidates(text, words, entities))
+	b.mu.RUnlock()
+
+	found = slices.DeleteFunc(found, func(name string) bool { return slices.Contains(entities, name) })
+	if len(found) == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, name := range found {
+		b.addEntityLocked(name)
+	}
+}
+
+// namesIn returns the known names written in text, which splits into words.
+// The caller holds mu.
+func (b *Brain) namesIn(text string, words []denylist.Word) []string {
+	var names []string
+
+	for _, word := range words {
+		names = append(names, b.names[strings.ToLower(word.Text)]...)
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	return slices.DeleteFunc(names, func(name string) bool {
+		return len(denylist.FindTerms(text, []string{name})) == 0
+	})
+}
+
+// countCandidates counts the capitalized words of text seen mid-sentence,
+// returning those seen often enough to promote. The caller holds mu, if only
+// for reading.
+func (b *Brain) countCandidates(text string, words []denylist.Word, entities []string) []string {
+	var promoted []string
+
+	b.candidatesMu.Lock()
+	defer b.candidatesMu.Unlock()
+
+	for i, word := range words {
+		first, _ := utf8.DecodeRuneInString(word.Text)
+		if !unicode.IsUpper(first) || utf8.RuneCountInString(word.Text) < MinEntityLength {
+			continue
+		}
+
+		// sentence starts are capitalized no matter what the word is
+		if i == 0 || sentenceEndsBetween(text[words[i-1].End:word.Start]) {
+			continue
+		}
+
+		if slices.Contains(entities, word.Text) {
+			continue
+		}
+
+		if b.EntityCandidates[word.Text]++; b.EntityCandidates[word.Text] >= entityPromotionCount {
+			promoted = append(promoted, word.Text)
+		}
+	}
+
+	for len(b.EntityCandidates) > maxEntityCandidates {
+		for word, count := range b.EntityCandidates {
+			if count /= 2; count == 0 {
+				delete(b.EntityCandidates, word)
+			} else {
+				b.EntityCandidates[word] = count
+			}
+		}
+	}
+
+	return promoted
+}
+
+func sentenceEndsBetween(gap string) bool {
+	for _, r := range gap {
+		if r == '.' || r == '!' || r == '?' || r == '\n' {
+			return true
+		}
+	}
+
+	return false
+}
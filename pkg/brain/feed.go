@@ -0,0 +1,198 @@
+package brain
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/denylist"
+)
+
+// FeedCooldown is how long a member waits between phrases fed with /feed.
+const FeedCooldown = 30 * time.Second
+
+// MaxFeedLength is the most characters a fed phrase may have.
+const MaxFeedLength = 500
+
+var (
+	// ErrFeedCooldown refuses a phrase fed before the member's cooldown ended.
+	ErrFeedCooldown = errors.New("fed too recently")
+	// ErrFeedBlocked refuses a phrase with denied, blocked or filtered text.
+	ErrFeedBlocked = errors.New("phrase is denied or filtered")
+	// ErrOptedOut refuses to learn from a member who opted out.
+	ErrOptedOut = errors.New("member opted out")
+	// ErrBlocked refuses to learn from a member moderators blocked.
+	ErrBlocked = errors.New("member is blocked")
+)
+
+// Feed is a phrase a member taught the brain on purpose. It is kept so the
+// phrase can be unlearned again.
+type Feed struct {
+	// receipt the member can unlearn the phrase with
+	ID       int
+	AuthorID snowflake.ID
+	Text     string
+	At       time.Time
+	// the phrase as the models learned it and the byte spans of it
+	// redacted, empty for phrases fed before they were kept
+	Learned    string
+	Redactions [][2]int
+}
+
+// Feed learns a phrase a member submitted at now, attributing it to them, and
+// returns its receipt. It is refused while their cooldown runs, when they
+// opted out or were blocked, when the phrase has words the guild keeps out of
+// what the bot says, and with ErrFull when the brain stopped learning.
+func (b *Brain) Feed(authorID snowflake.ID, text string, now time.Time) (int, error) {
+	if b.IsOptedOut(authorID) {
+		return 0, ErrOptedOut
+	}
+
+	if b.IsBlocked(authorID) {
+		return 0, ErrBlocked
+	}
+
+	if b.filtered(text) || len(denylist.FindTerms(text, b.OutputTerms())) > 0 {
+		return 0, ErrFeedBlocked
+	}
+
+	if !b.feedTurn(authorID, now) {
+		return 0, ErrFeedCooldown
+	}
+
+	learned, spans, err := b.trainText(authorID, text)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.LastFeedID++
+	b.Fed = append(b.Fed, Feed{ID: b.LastFeedID, AuthorID: authorID, Text: text, At: now, Learned: learned, Redactions: spans})
+	b.dirty = true
+
+	return b.LastFeedID, nil
+}
+
+// numberFeeds gives receipts to phrases fed before there were any
+func (b *Brain) numberFeeds() {
+	for i := range b.Fed {
+		if b.Fed[i].ID == 0 {
+			b.LastFeedID++
+			b.Fed[i].ID = b.LastFeedID
+		}
+	}
+}
+
+// feedTurn reports whether authorID may feed a phrase at now, starting their
+// cooldown if so
+func (b *Brain) feedTurn(authorID snowflake.ID, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if until, ok := b.feedTurns[authorID]; ok && now.Before(until) {
+		return false
+	}
+
+	if b.feedTurns == nil {
+		b.feedTurns = make(map[snowflake.ID]time.Time)
+	}
+
+	// drop cooldowns that ended so the map only holds active members
+	for id, until := range b.feedTurns {
+		if !now.Before(until) {
+			delete(b.feedTurns, id)
+		}
+	}
+
+	b.feedTurns[authorID] = now.Add(FeedCooldown)
+
+	return true
+}
+
+// FeedCounts reports how many phrases each member fed.
+func (b *Brain) FeedCounts() map[snowflake.ID]int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var counts = make(map[snowflake.ID]int)
+	for _, feed := range b.Fed {
+		counts[feed.AuthorID]++
+	}
+
+	return counts
+}
+
+// FeedByID returns the phrase fed with the receipt id.
+func (b *Brain) FeedByID(id int) (Feed, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, feed := range b.Fed {
+		if feed.ID == id {
+			return feed, true
+		}
+	}
+
+	return Feed{}, false
+}
+
+// Unfeed unlearns the phrase fed with the receipt id and reports whether
+// there was one.
+func (b *Brain) Unfeed(id int) bool {
+	b.mu.Lock()
+	i := slices.IndexFunc(b.Fed, func(feed Feed) bool { return feed.ID == id })
+	if i < 0 {
+		b.mu.Unlock()
+		return false
+	}
+	feed := b.Fed[i]
+	b.Fed = slices.Delete(b.Fed, i, i+1)
+	b.mu.Unlock()
+
+	b.unfeed(feed)
+
+	return true
+}
+
+// unfeed unlearns a phrase taken off the fed ones as it was learned
+func (b *Brain) unfeed(feed Feed) {
+	defer b.takeIn()()
+
+	text, spans := feed.Learned, feed.Redactions
+	if text == "" {
+		text, spans = b.prepare(feed.Text)
+	}
+
+	b.mu.Lock()
+	b.bury(feed.AuthorID, 0, text, spans)
+	b.mu.Unlock()
+
+	b.record(logEntry{AuthorID: feed.AuthorID, Text: feed.Text, Forget: true})
+	b.unlearn(feed.AuthorID, text, spans)
+}
+
+// PurgeFeeds unlearns every phrase authorID fed and reports how many there
+// were.
+func (b *Brain) PurgeFeeds(authorID snowflake.ID) int {
+	b.mu.Lock()
+	var purged []Feed
+	var kept []Feed
+	for _, feed := range b.Fed {
+		if feed.AuthorID == authorID {
+			purged = append(purged, feed)
+		} else {
+			kept = append(kept, feed)
+		}
+	}
+	b.Fed = kept
+	b.mu.Unlock()
+
+	for _, feed := range purged {
+		b.unfeed(feed)
+	}
+
+	return len(purged)
+}
@@ -0,0 +1,41 @@
+package brain
+
+// Reward feeds back how something the brain said was received: text that
+// went over well is reinforced by counting its n-grams once more, text that
+// didn't is decayed by counting them once less. The opposite reward undoes
+// one.
+func (b *Brain) Reward(text string, good bool) {
+	defer b.takeIn()()
+
+	if text == "" {
+		return
+	}
+
+	var reward = -1
+	if good {
+		reward = 1
+	}
+	b.record(logEntry{Text: text, Reward: reward})
+	b.reward(text, good)
+}
+
+func (b *Brain) reward(text string, good bool) {
+	b.mu.RLock()
+	if good {
+		b.Model.Train(text)
+	} else {
+		b.Model.Forget(text)
+	}
+	b.mu.RUnlock()
+
+	if good {
+		b.trainBackend(text)
+	} else {
+		b.forgetBackend(text)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.dirty = true
+}
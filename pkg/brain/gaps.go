@@ -0,0 +1,77 @@
+package brain
+
+import (
+	"slices"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Gap is a stretch of a channel's history that was sent while nothing was
+// listening: the messages after After and before Before. Gaps are kept with
+// the channel's span until they are caught up with, so a catch-up cut short
+// carries on where it stopped instead of leaving a hole.
+type Gap struct {
+	After  snowflake.ID
+	Before snowflake.ID
+}
+
+// MarkDowntime records a gap in every watched channel from the end of its
+// span up to until, when nothing was listening. A channel that learned
+// nothing since its last gap has that one grown instead.
+func (b *Brain) MarkDowntime(until snowflake.ID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, channelID := range b.watched() {
+		span := b.TrainedSpans[channelID]
+		if span == nil || span.EndID >= until {
+			continue
+		}
+
+		if n := len(span.Gaps); n > 0 && span.Gaps[n-1].Before > span.EndID {
+			span.Gaps[n-1].Before = max(span.Gaps[n-1].Before, until)
+		} else {
+			span.Gaps = append(span.Gaps, Gap{After: span.EndID, Before: until})
+		}
+		b.dirty = true
+	}
+}
+
+// Gaps lists the gaps of a channel that are yet to be caught up with, the
+// oldest first.
+func (b *Brain) Gaps(channelID snowflake.ID) []Gap {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	span := b.TrainedSpans[channelID]
+	if span == nil {
+		return nil
+	}
+
+	return slices.Clone(span.Gaps)
+}
+
+// FillGap records that gap was learned up to and including upTo, or to its
+// end if upTo is its Before. What the gap grew by meanwhile stays to be
+// caught up with.
+func (b *Brain) FillGap(channelID snowflake.ID, gap Gap, upTo snowflake.ID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	span := b.TrainedSpans[channelID]
+	if span == nil {
+		return
+	}
+
+	i := slices.IndexFunc(span.Gaps, func(g Gap) bool { return g.After == gap.After })
+	if i < 0 {
+		return
+	}
+
+	if upTo >= span.Gaps[i].Before {
+		span.Gaps = slices.Delete(span.Gaps, i, i+1)
+	} else {
+		span.Gaps[i].After = upTo
+	}
+	b.dirty = true
+}
@@ -0,0 +1,65 @@
+package brain
+
+import (
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/ngram"
+)
+
+// GlobalID is what the brain shared by the guilds that opted in to it is kept
+// under, as no guild has it.
+const GlobalID snowflake.ID = 0
+
+// SetShareGlobal has the guild contribute what it learns to the shared brain
+// and mix it into what it generates, or keeps the guild to itself again.
+// What was contributed stays in the shared brain.
+func (b *Brain) SetShareGlobal(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.ShareGlobal = enabled
+	b.dirty = true
+}
+
+// global returns the shared brain if the guild opted in to it, nil otherwise
+func (b *Brain) global() *Brain {
+	if b.shared == nil || !b.GuildSettings().ShareGlobal {
+		return nil
+	}
+
+	return b.shared()
+}
+
+// contribute teaches the shared brain text as the guild learned it, redacted
+// and without its author
+func (b *Brain) contribute(text string, spans [][2]int) {
+	if global := b.global(); global != nil {
+		global.Train(0, cutSpans(text, spans))
+	}
+}
+
+// withdraw undoes contribute for the same text
+func (b *Brain) withdraw(text string, spans [][2]int) {
+	if global := b.global(); global != nil {
+		global.ForgetText(cutSpans(text, spans))
+	}
+}
+
+// generateShared samples from the guild model mixed with the shared brain's,
+// leaning on the guild's wherever the context is its own, and reports false
+// when there is nothing to mix. The caller holds at least the read lock.
+func (b *Brain) generateShared(seed string, length int) (string, bool) {
+	// other backends can't be mixed token by token
+	if b.separateBackend() || b.Settings.BeamWidth > 0 || b.shared == nil || !b.Settings.ShareGlobal {
+		return "", false
+	}
+
+	global := b.shared()
+	global.mu.RLock()
+	defer global.mu.RUnlock()
+
+	if total, _ := global.Model.Totals(); total == 0 {
+		return "", false
+	}
+
+	return ngram.Interpolate(global.Model, b.Model, seed, length), true
+}
@@ -0,0 +1,217 @@
+package brain
+
+import (
+	"hash/fnv"
+	"slices"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/corpus"
+)
+
+// Import records where a batch of history learned from outside the guild came
+// from.
+type Import struct {
+	Source   string
+	Format   string
+	Messages int
+	Skipped  int
+	// messages left out because they were imported before
+	Duplicates int
+	// distinct authors in the batch that were mapped to users
+	Authors int
+	At      time.Time
+}
+
+// RecordImport adds a batch to the brain's import log.
+func (b *Brain) RecordImport(imp Import) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Imports = append(b.Imports, imp)
+	b.dirty = true
+}
+
+// ImportLog lists the imports in the order they happened.
+func (b *Brain) ImportLog() []Import {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return slices.Clone(b.Imports)
+}
+
+// TrainImported learns text from imported history, attributing it to authorID
+// unless that is zero. Imported counts are kept apart from organic ones. It
+// returns ErrFull when the brain stopped learning.
+func (b *Brain) TrainImported(authorID snowflake.ID, text string) error {
+	defer b.takeIn()()
+
+	if b.Full() {
+		return ErrFull
+	}
+
+	b.record(logEntry{AuthorID: authorID, Text: text, Imported: true})
+	return b.trainImported(authorID, text)
+}
+
+func (b *Brain) trainImported(authorID snowflake.ID, text string) error {
+	if b.Full() {
+		return ErrFull
+	}
+
+	text, spans := b.prepare(text)
+	b.learnEntities(text)
+
+	b.mu.RLock()
+	b.Model.TrainImported(text, spans)
+	b.mu.RUnlock()
+
+	b.trainBackend(cutSpans(text, spans))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ImportedMessages++
+
+	if authorID != 0 {
+		if b.Authors[authorID] == nil {
+			b.Authors[authorID] = b.newAuthorProfile()
+		}
+		b.Authors[authorID].observeImported(text, spans)
+	}
+
+	b.dirty = true
+	b.enforceBudget()
+
+	return nil
+}
+
+// importDigest identifies an imported message by its author and text
+func importDigest(author, text string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(author))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	return h.Sum64()
+}
+
+// ImportRecords learns an export as imported history and logs it as imp.
+// Denied text, messages of opted-out members and messages already imported,
+// by this or an earlier import, are left out, and so is the rest once the
+// brain stopped learning for reaching its budget. authors maps export
+// authors to users; unmapped authors only feed the guild model. progress, if
+// not nil, is called with how many records were handled so far.
+func (b *Brain) ImportRecords(records []corpus.Record, authors map[string]snowflake.ID, imp Import, progress func(done int)) Import {
+	var mapped = make(map[snowflake.ID]bool)
+
+	for i, record := range records {
+		if progress != nil {
+			progress(i)
+		}
+
+		if b.Full() {
+			imp.Skipped += len(records) - i
+			break
+		}
+
+		authorID := authors[record.Author]
+		if !b.AllowsText(record.Text) || (authorID != 0 && b.IsOptedOut(authorID)) {
+			imp.Skipped++
+			continue
+		}
+
+		if !b.noteImported(importDigest(record.Author, record.Text)) {
+			imp.Duplicates++
+			continue
+		}
+
+		if b.TrainImported(authorID, record.Text) != nil {
+			imp.Skipped++
+			continue
+		}
+		imp.Messages++
+
+		if authorID != 0 {
+			mapped[authorID] = true
+		}
+	}
+
+	if progress != nil {
+		progress(len(records))
+	}
+
+	imp.Authors = len(mapped)
+	b.RecordImport(imp)
+
+	return imp
+}
+
+// noteImported remembers a message as imported, reporting false if it
+// already was
+func (b *Brain) noteImported(digest uint64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ImportDigests[digest] {
+		return false
+	}
+
+	b.ImportDigests[digest] = true
+	return true
+}
+
+// SetImportWeight sets how much imported history counts relative to organic
+// messages when generating.
+func (b *Brain) SetImportWeight(weight float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.ImportWeight = &weight
+	b.dirty = true
+	b.applyImportWeightLocked()
+}
+
+func (b *Brain) applyImportWeight() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.applyImportWeightLocked()
+}
+
+func (b *Brain) applyImportWeightLocked() {
+	weight := b.Settings.importWeight()
+
+	b.Model.SetImportWeight(weight)
+	for _, profile := range b.Authors {
+		profile.Model.SetImportWeight(weight)
+	}
+}
+
+// PurgeImports forgets all imported history and clears the import log,
+// returning how many imported messages were dropped. Other backends than the
+// n-gram model can't tell imports apart and keep them.
+func (b *Brain) PurgeImports() int {
+	defer b.takeIn()()
+
+	b.record(logEntry{Imported: true, Forget: true})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var purged = b.ImportedMessages
+
+	b.Model.PurgeImported()
+	for userID, profile := range b.Authors {
+		profile.purgeImported()
+		if profile.messages() == 0 {
+			delete(b.Authors, userID)
+		}
+	}
+
+	b.Imports = nil
+	b.ImportedMessages = 0
+	b.ImportDigests = make(map[uint64]bool)
+	b.dirty = true
+
+	return purged
+}
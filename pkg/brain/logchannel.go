@@ -0,0 +1,13 @@
+package brain
+
+import "github.com/disgoorg/snowflake/v2"
+
+// SetLogChannel posts notices about what the bot learns from in channelID,
+// or nowhere for zero.
+func (b *Brain) SetLogChannel(channelID snowflake.ID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.LogChannel = channelID
+	b.dirty = true
+}
@@ -0,0 +1,578 @@
+package brain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/ngram"
+)
+
+// the message log is kept next to the brain's file
+const messageLogSuffix = ".log"
+
+// ErrCannotRebuild is returned for rebuilding a brain whose message log
+// doesn't reach back as far as messages are kept, or that generates with a
+// backend the log can't teach again.
+var ErrCannotRebuild = errors.New("brain can't be rebuilt from its message log")
+
+// logEntry is a line of a brain's message log. Most record what was learned:
+// an observed Message, or Text trained or imported on behalf of AuthorID, or
+// rewarded. The rest take back earlier entries: a Forget cancels the entries
+// it matches, and a Restored snapshot everything logged after it was taken.
+// Prunes are replayed where they happened.
+type logEntry struct {
+	At       time.Time    `json:"at"`
+	Message  *Message     `json:"message,omitempty"`
+	AuthorID snowflake.ID `json:"author_id,omitempty"`
+	Text     string       `json:"text,omitempty"`
+	Imported bool         `json:"imported,omitempty"`
+	// 1 for text that went over well, -1 for text that didn't
+	Reward   int       `json:"reward,omitempty"`
+	Prune    int       `json:"prune,omitempty"`
+	Forget   bool      `json:"forget,omitempty"`
+	Restored time.Time `json:"restored,omitzero"`
+}
+
+// logKey is what a forget entry cancels by: a message by its ID, or failing
+// one its author, channel and content, and text by its author and content
+type logKey struct {
+	MessageID snowflake.ID
+	ChannelID snowflake.ID
+	AuthorID  snowflake.ID
+	Text      string
+	Imported  bool
+}
+
+func (e logEntry) key() logKey {
+	switch {
+	case e.Message == nil:
+		return logKey{AuthorID: e.AuthorID, Text: e.Text, Imported: e.Imported}
+	case e.Message.ID != 0:
+		return logKey{MessageID: e.Message.ID}
+	default:
+		return logKey{ChannelID: e.Message.ChannelID, AuthorID: e.Message.AuthorID, Text: e.Message.Content}
+	}
+}
+
+// author is who the entry learned from, zero for nobody in particular
+func (e logEntry) author() snowflake.ID {
+	if e.Message != nil {
+		return e.Message.AuthorID
+	}
+
+	return e.AuthorID
+}
+
+// takesBack reports whether the entry takes back earlier ones rather than
+// adding to them
+func (e logEntry) takesBack() bool {
+	return e.Forget || !e.Restored.IsZero()
+}
+
+// settle applies what takes back earlier entries of a log and drops the
+// entries logged before cutoff, leaving what a rebuild replays in order
+func settle(entries []logEntry, cutoff time.Time) []logEntry {
+	var kept = make([]bool, len(entries))
+	// the kept entries of each key, the latest last
+	var byKey = make(map[logKey][]int)
+
+	for i, entry := range entries {
+		switch {
+		case !entry.Restored.IsZero():
+			for j := range i {
+				if kept[j] && entries[j].At.After(entry.Restored) {
+					kept[j] = false
+				}
+			}
+		case !entry.Forget:
+			kept[i] = true
+			if entry.Prune == 0 && entry.Reward == 0 {
+				byKey[entry.key()] = append(byKey[entry.key()], i)
+			}
+		case entry.Message != nil || entry.Text != "":
+			// forgetting text once takes back one learning of it
+			indices := byKey[entry.key()]
+			for len(indices) > 0 && !kept[indices[len(indices)-1]] {
+				indices = indices[:len(indices)-1]
+			}
+			if len(indices) > 0 {
+				kept[indices[len(indices)-1]] = false
+				indices = indices[:len(indices)-1]
+			}
+			byKey[entry.key()] = indices
+		case entry.Imported:
+			for j := range i {
+				if entries[j].Imported {
+					kept[j] = false
+				}
+			}
+		case entry.AuthorID != 0:
+			for j := range i {
+				if entries[j].author() == entry.AuthorID {
+					kept[j] = false
+				}
+			}
+		}
+	}
+
+	var settled []logEntry
+	for i, entry := range entries {
+		if kept[i] && !entry.At.Before(cutoff) {
+			settled = append(settled, entry)
+		}
+	}
+
+	return settled
+}
+
+// messageLog is a file of log entries, one JSON object per line, opened on
+// first use. The brains replacing each other on a rebuild or restore share
+// it.
+type messageLog struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newMessageLog(fn string) *messageLog {
+	return &messageLog{path: fn + messageLogSuffix}
+}
+
+// append adds an entry at the end of the log
+func (l *messageLog) append(entry logEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		// it holds members' messages word for word, unlike the brain
+		file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		l.file = file
+	}
+
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// read returns the entries of the log, none if there is no log
+func (l *messageLog) read() ([]logEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.readLocked()
+}
+
+func (l *messageLog) readLocked() ([]logEntry, error) {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []logEntry
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a line cut short by a crash is lost, the rest still counts
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var entry logEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			storageLog.Warn("Skipped unreadable message log entry", slog.String("file", l.path), slog.String("err", err.Error()))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// rewrite replaces the log with what keep leaves of its entries, deleting
+// it if that is nothing
+func (l *messageLog) rewrite(keep func(entries []logEntry) []logEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, err := l.readLocked()
+	if err != nil {
+		return err
+	}
+	entries = keep(entries)
+
+	l.closeLocked()
+	if len(entries) == 0 {
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(l.path+".tmp", buffer.Bytes(), 0600); err != nil {
+		return fmt.Errorf("writing message log: %w", err)
+	}
+	if err := os.Rename(l.path+".tmp", l.path); err != nil {
+		return fmt.Errorf("replacing message log: %w", err)
+	}
+
+	return nil
+}
+
+// closeLocked closes the log's file until the next entry is added
+func (l *messageLog) closeLocked() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+}
+
+// record adds an entry to the brain's message log if the options keep one.
+// Otherwise, or if the entry can't be added, the log stops covering what the
+// brain learned, until it is kept for as long as messages are again.
+func (b *Brain) record(entry logEntry) {
+	b.mu.RLock()
+	logging, since := b.opts.MessageLog, b.LoggedSince
+	b.mu.RUnlock()
+
+	if !logging {
+		if !since.IsZero() {
+			b.setLoggedSince(time.Time{})
+		}
+		return
+	}
+
+	entry.At = time.Now().UTC()
+	if err := b.log.append(entry); err != nil {
+		storageLog.Error("Failed to add to message log", slog.Any("guildID", b.GuildID), slog.String("err", err.Error()))
+		b.setLoggedSince(time.Time{})
+		return
+	}
+
+	if since.IsZero() {
+		b.setLoggedSince(entry.At)
+	}
+}
+
+func (b *Brain) setLoggedSince(since time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.LoggedSince = since
+	b.dirty = true
+}
+
+// logCutoff is when the oldest entries of the message log the options keep
+// were added
+func (b *Brain) logCutoff(now time.Time) time.Time {
+	return now.Add(-b.opts.MessageLogRetention)
+}
+
+// rebuildable reports whether the message log holds everything the brain
+// learned and still keeps, and the brain can learn it all again. The caller
+// holds at least the read lock.
+func (b *Brain) rebuildable(now time.Time) bool {
+	return b.opts.MessageLog && !b.separateBackend() &&
+		!b.LoggedSince.IsZero() && !b.LoggedSince.After(b.logCutoff(now))
+}
+
+// RebuildDue reports whether the brain can be rebuilt from its message log
+// and wasn't in the last every.
+func (b *Brain) RebuildDue(every time.Duration, now time.Time) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return every > 0 && b.rebuildable(now) && now.Sub(b.RebuiltAt) >= every
+}
+
+// CompactLog drops what was forgotten or is kept no longer from the brain's
+// message log, all of it when the options don't keep one.
+func (b *Brain) CompactLog(now time.Time) error {
+	b.mu.RLock()
+	logging, cutoff := b.opts.MessageLog, b.logCutoff(now)
+	b.mu.RUnlock()
+
+	if !logging {
+		return b.log.rewrite(func([]logEntry) []logEntry { return nil })
+	}
+
+	return b.log.rewrite(func(entries []logEntry) []logEntry { return settle(entries, cutoff) })
+}
+
+// relearn learns a log entry again under the brain's current rules: messages
+// as observed, and text unless its author opted out or was blocked or a
+// filter leaves it out
+func (b *Brain) relearn(entry logEntry) {
+	switch {
+	case entry.Prune > 0:
+		b.pruneRare(entry.Prune)
+	case entry.Reward != 0:
+		b.reward(entry.Text, entry.Reward > 0)
+	case entry.Message != nil:
+		if b.shouldObserve(*entry.Message) {
+			b.learn(context.Background(), *entry.Message)
+		}
+	case entry.AuthorID != 0 && (b.IsOptedOut(entry.AuthorID) || b.IsBlocked(entry.AuthorID)), !b.AllowsText(entry.Text):
+		// ruled out now
+	case entry.Imported:
+		b.trainImported(entry.AuthorID, entry.Text)
+	default:
+		text, spans := b.prepare(entry.Text)
+		b.train(context.Background(), entry.AuthorID, text, spans)
+	}
+}
+
+// clone decodes a copy of the brain, sharing its message log
+func (b *Brain) clone() (*Brain, error) {
+	var buffer bytes.Buffer
+	b.mu.RLock()
+	err := b.encode(&buffer)
+	b.mu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("serializing brain: %w", err)
+	}
+
+	copied, err := decode(buffer.Bytes(), b.opts)
+	if err != nil {
+		return nil, fmt.Errorf("deserializing brain: %w", err)
+	}
+	copied.shared = b.shared
+	copied.log = b.log
+
+	return copied, nil
+}
+
+// relearned returns a copy of the brain that forgot everything it learned
+// and learned entries instead, keeping the entities it knows
+func (b *Brain) relearned(entries []logEntry) (*Brain, error) {
+	rebuilt, err := b.clone()
+	if err != nil {
+		return nil, err
+	}
+
+	rebuilt.mu.Lock()
+	entities := rebuilt.Model.Entities()
+	rebuilt.Model = ngram.New(ngram.NewCharTokenizer([]string{}), rebuilt.opts.Order, rebuilt.opts.Smoothing)
+	for _, entity := range entities {
+		rebuilt.Model.AddEntity(entity)
+	}
+	rebuilt.attachBackend()
+	rebuilt.applyImportWeightLocked()
+	clear(rebuilt.Authors)
+	clear(rebuilt.ChannelModels)
+	clear(rebuilt.EntityCandidates)
+	rebuilt.Recent = nil
+	rebuilt.indexRecent()
+	rebuilt.ImportedMessages = 0
+	// everything is learned afresh under the current rules
+	rebuilt.Rules, rebuilt.PastRules = nil, nil
+	rebuilt.mu.Unlock()
+	rebuilt.noteRules()
+
+	for _, entry := range entries {
+		rebuilt.relearn(entry)
+	}
+
+	return rebuilt, nil
+}
+
+// adopt takes over what from learned, keeping everything else the brain
+// holds
+func (b *Brain) adopt(from *Brain) {
+	from.mu.RLock()
+	defer from.mu.RUnlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Model = from.Model
+	b.Authors = from.Authors
+	b.ChannelModels = from.ChannelModels
+	b.EntityCandidates = from.EntityCandidates
+	b.Recent = from.Recent
+	b.ImportedMessages = from.ImportedMessages
+	b.Rules, b.PastRules = from.Rules, from.PastRules
+	b.indexRecent()
+	b.attachBackend()
+	b.applyImportWeightLocked()
+	b.dirty = true
+}
+
+// Upkeep rebuilds a guild's brain from its message log if it wasn't in the
+// last every, and otherwise drops what it forgot or keeps no longer from the
+// log. It returns the rebuilt brain, nil if it only dropped entries.
+func (s *Store) Upkeep(guildID snowflake.ID, every time.Duration, now time.Time) (*Brain, error) {
+	current := s.Get(guildID)
+	if !current.RebuildDue(every, now) {
+		return nil, current.CompactLog(now)
+	}
+
+	rebuilt, err := s.Rebuild(guildID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	rebuilt.mu.RLock()
+	retention := rebuilt.opts.MessageLogRetention
+	rebuilt.mu.RUnlock()
+	rebuilt.RecordAction(0, AuditRebuild, fmt.Sprintf("messages of the last %d days", retention/(24*time.Hour)))
+
+	return rebuilt, nil
+}
+
+// UpkeepDaily keeps up every loaded brain once a day at hour UTC until ctx is
+// done, rebuilding those not rebuilt in the last every.
+func (s *Store) UpkeepDaily(ctx context.Context, hour int, every time.Duration) {
+	s.ScheduleUpkeep(ctx, func() int { return hour }, func(guildID snowflake.ID, now time.Time) {
+		if _, err := s.Upkeep(guildID, every, now); err != nil {
+			storageLog.Error("Failed to keep up message log", slog.Any("guildID", guildID), slog.String("err", err.Error()))
+		}
+	})
+}
+
+// ScheduleUpkeep calls upkeep for every loaded brain once a day, at the hour
+// UTC hour returns, until ctx is done. Unloaded brains learn nothing, so
+// their logs wait until they are used again. UpkeepDaily keeps brains up on
+// this schedule; callers doing more around it pass their own upkeep.
+func (s *Store) ScheduleUpkeep(ctx context.Context, hour func() int, upkeep func(guildID snowflake.ID, now time.Time)) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if now.UTC().Hour() != hour() {
+				continue
+			}
+
+			for _, brain := range s.All() {
+				upkeep(brain.GuildID, now)
+			}
+		}
+	}
+}
+
+// errReplaced is returned when a brain was restored from a snapshot while
+// being rebuilt or restored
+var errReplaced = errors.New("brain was replaced meanwhile")
+
+// Rebuild relearns a guild's brain from its message log under the current
+// rules, leaving out what was forgotten or is kept no longer and what opted
+// out members, blocked members, unwatched channels and filters rule out now,
+// and has the brain in use take it over, saved. Everything but what it
+// learned carries over. A snapshot is taken first if the options keep any,
+// so the rebuild can be rolled back. A rebuilt brain that fails to save is
+// saved with the rest later.
+func (s *Store) Rebuild(guildID snowflake.ID, now time.Time) (*Brain, error) {
+	current := s.Get(guildID)
+
+	current.mu.RLock()
+	rebuildable, cutoff := current.rebuildable(now), current.logCutoff(now)
+	current.mu.RUnlock()
+	if !rebuildable {
+		return nil, ErrCannotRebuild
+	}
+
+	if err := current.TakeSnapshot(SnapshotRebuild); err != nil {
+		return nil, err
+	}
+
+	// relearning takes long, so the brain goes on taking changes in
+	// meanwhile
+	entries, err := current.log.read()
+	if err != nil {
+		return nil, fmt.Errorf("reading message log: %w", err)
+	}
+	rebuilt, err := current.relearned(settle(entries, cutoff))
+	if err != nil {
+		return nil, err
+	}
+
+	// the brain takes nothing in while it catches up with what was logged
+	// meanwhile and takes over what was relearned, in place, so whatever
+	// holds it goes on with the rebuilt one
+	current.changes.Lock()
+	all, err := current.catchUp(rebuilt, entries, cutoff, now)
+	current.changes.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := current.Save(); err != nil {
+		return nil, err
+	}
+	if err := current.log.rewrite(func(entries []logEntry) []logEntry { return settle(entries, cutoff) }); err != nil {
+		storageLog.Warn("Failed to compact message log", slog.Any("guildID", guildID), slog.String("err", err.Error()))
+	}
+
+	storageLog.Info("Rebuilt guild brain from message log", slog.Any("guildID", guildID), slog.Int("entries", all))
+	return current, nil
+}
+
+// catchUp relearns into rebuilt what was logged after entries and adopts it,
+// reporting how many entries the log held. The caller holds changes for
+// writing.
+func (b *Brain) catchUp(rebuilt *Brain, entries []logEntry, cutoff, now time.Time) (int, error) {
+	if b.replaced {
+		return 0, errReplaced
+	}
+
+	all, err := b.log.read()
+	if err != nil {
+		return 0, fmt.Errorf("reading message log: %w", err)
+	}
+	// compacted meanwhile, or what was taken back may have been relearned
+	// already
+	tail := all[min(len(entries), len(all)):]
+	if len(all) < len(entries) || slices.ContainsFunc(tail, logEntry.takesBack) {
+		if rebuilt, err = b.relearned(settle(all, cutoff)); err != nil {
+			return 0, err
+		}
+	} else {
+		for _, entry := range tail {
+			rebuilt.relearn(entry)
+		}
+	}
+
+	// whatever else changed meanwhile is kept
+	b.adopt(rebuilt)
+
+	b.mu.Lock()
+	b.RebuiltAt = now
+	b.mu.Unlock()
+
+	return len(all), nil
+}
@@ -0,0 +1,126 @@
+package brain
+
+import (
+	"cmp"
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/denylist"
+)
+
+// a dead channel is revived at most this often
+const reviveCooldown = 24 * time.Hour
+
+// shorter words are mostly filler and make poor topics
+const minTopicLength = 5
+
+// topic counts are pruned back to half of this once a channel exceeds it
+const maxTopics = 200
+
+// starters are seeded from one of a channel's most common topics
+const topicChoices = 10
+
+// SetNecromancer revives whitelisted channels that have been silent for
+// longer than silence. Zero disables it.
+func (b *Brain) SetNecromancer(silence time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.NecromancerSilence = silence
+	b.dirty = true
+}
+
+// noteTopics counts the longer words of a channel's messages so starters can
+// bring up what the channel usually talks about
+func (b *Brain) noteTopics(channelID snowflake.ID, text string) {
+	var terms = b.DeniedTerms()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	topics := b.ChannelTopics[channelID]
+	if topics == nil {
+		topics = make(map[string]int)
+		b.ChannelTopics[channelID] = topics
+	}
+
+	for _, word := range denylist.SplitWords(text) {
+		if utf8.RuneCountInString(word.Text) < minTopicLength || strings.ContainsFunc(word.Text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+			continue
+		}
+
+		if len(denylist.FindTerms(word.Text, terms)) > 0 {
+			continue
+		}
+
+		topics[strings.ToLower(word.Text)]++
+	}
+
+	if len(topics) > maxTopics {
+		for _, topic := range rankTopics(topics)[maxTopics/2:] {
+			delete(topics, topic)
+		}
+	}
+}
+
+// rankTopics orders topics by how often they came up
+func rankTopics(topics map[string]int) []string {
+	var ranked []string
+	for topic := range topics {
+		ranked = append(ranked, topic)
+	}
+
+	slices.SortFunc(ranked, func(a, b string) int {
+		return cmp.Or(cmp.Compare(topics[b], topics[a]), strings.Compare(a, b))
+	})
+
+	return ranked
+}
+
+// DeadChannels lists the whitelisted channels that have been silent for
+// longer than the necromancer threshold and weren't revived in the last day.
+func (b *Brain) DeadChannels(now time.Time) []snowflake.ID {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var silence = b.Settings.NecromancerSilence
+	if silence <= 0 {
+		return nil
+	}
+
+	var dead []snowflake.ID
+	for channelID, span := range b.TrainedSpans {
+		if !b.ChannelWhitelist[channelID] || now.Sub(span.End) < silence {
+			continue
+		}
+
+		if now.Sub(b.Revived[channelID]) < reviveCooldown {
+			continue
+		}
+
+		dead = append(dead, channelID)
+	}
+
+	return dead
+}
+
+// Revive generates a conversation starter for a channel, seeded from one of
+// its usual topics, and records that the channel was revived at now.
+func (b *Brain) Revive(channelID snowflake.ID, now time.Time, length int) string {
+	b.mu.Lock()
+	b.Revived[channelID] = now
+	b.dirty = true
+	var seed string
+	if ranked := rankTopics(b.ChannelTopics[channelID]); len(ranked) > 0 {
+		seed = ranked[rand.IntN(min(topicChoices, len(ranked)))]
+	}
+	b.mu.Unlock()
+
+	return strings.TrimSpace(b.generate(context.Background(), channelID, seed, length))
+}
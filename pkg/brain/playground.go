@@ -0,0 +1,58 @@
+package brain
+
+import (
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// DefaultPlaygroundCooldown is how long members wait between playground
+// replies unless the guild picked otherwise.
+const DefaultPlaygroundCooldown = 30 * time.Second
+
+// SetPlayground makes every message in channelID get a reply, with each
+// member waiting cooldown between replies. A zero channel disables it.
+func (b *Brain) SetPlayground(channelID snowflake.ID, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.PlaygroundChannel = channelID
+	b.Settings.PlaygroundCooldown = cooldown
+	b.playgroundTurns = nil
+	b.dirty = true
+}
+
+// PlaygroundWait is how long members wait between playground replies.
+func (s GuildSettings) PlaygroundWait() time.Duration {
+	if s.PlaygroundCooldown <= 0 {
+		return DefaultPlaygroundCooldown
+	}
+
+	return s.PlaygroundCooldown
+}
+
+// PlaygroundTurn reports whether userID may get a playground reply at now,
+// starting their cooldown if so.
+func (b *Brain) PlaygroundTurn(userID snowflake.ID, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if until, ok := b.playgroundTurns[userID]; ok && now.Before(until) {
+		return false
+	}
+
+	if b.playgroundTurns == nil {
+		b.playgroundTurns = make(map[snowflake.ID]time.Time)
+	}
+
+	// drop cooldowns that ended so the map only holds active members
+	for id, until := range b.playgroundTurns {
+		if !now.Before(until) {
+			delete(b.playgroundTurns, id)
+		}
+	}
+
+	b.playgroundTurns[userID] = now.Add(b.Settings.PlaygroundWait())
+
+	return true
+}
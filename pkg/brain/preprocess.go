@@ -0,0 +1,145 @@
+package brain
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/schizoid/pkg/denylist"
+)
+
+// LinkHandling is what happens to links in messages before they are
+// learned.
+type LinkHandling int
+
+const (
+	// LinksKeep learns links like any other text.
+	LinksKeep LinkHandling = iota
+	// LinksRemove cuts links out of messages.
+	LinksRemove
+	// LinksRedact replaces each link with the redacted token, so the model
+	// learns that a link went there but never produces one.
+	LinksRedact
+)
+
+// web links, with or without a scheme, and Discord invites; angle brackets
+// suppressing an embed go with the link
+var links = regexp.MustCompile(`(?i)<?(?:https?://|www\.|discord\.gg/|discord(?:app)?\.com/invite/)[^\s>]+>?`)
+
+var (
+	emails = regexp.MustCompile(`[\w.+-]+@[\w-]+(?:\.[\w-]+)+`)
+	// digit groups split by spaces, dots, dashes or parentheses, with an
+	// optional country code
+	phones = regexp.MustCompile(`\+?\(?\d{1,4}\)?(?:[\s.-]?\(?\d{2,4}\)?){2,4}`)
+	dates  = regexp.MustCompile(`^\d{4}[.-]\d{1,2}[.-]\d{1,2}$|^\d{1,2}[.-]\d{1,2}[.-]\d{2,4}$`)
+	// account, card and ID numbers
+	longDigits = regexp.MustCompile(`\d{6,}`)
+)
+
+// fewer digits than this aren't taken for a phone number
+const minPhoneDigits = 7
+
+// a scrubber finds byte spans of personal data in text
+type scrubber func(text string) [][2]int
+
+// piiScrubbers redact personal data unless a guild keeps it
+var piiScrubbers = []scrubber{
+	matches(emails),
+	phoneNumbers,
+	matches(longDigits),
+}
+
+func matches(re *regexp.Regexp) scrubber {
+	return func(text string) [][2]int {
+		var spans [][2]int
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			spans = append(spans, [2]int{loc[0], loc[1]})
+		}
+		return spans
+	}
+}
+
+// phoneNumbers finds digit groups long enough to be a phone number, leaving
+// out dates
+func phoneNumbers(text string) [][2]int {
+	var spans [][2]int
+	for _, loc := range phones.FindAllStringIndex(text, -1) {
+		match := strings.TrimSpace(text[loc[0]:loc[1]])
+		if countDigits(match) < minPhoneDigits || dates.MatchString(match) {
+			continue
+		}
+		spans = append(spans, [2]int{loc[0], loc[1]})
+	}
+
+	return spans
+}
+
+func countDigits(s string) int {
+	var n int
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			n++
+		}
+	}
+
+	return n
+}
+
+// SetLinkHandling picks what happens to links in messages before they are
+// learned.
+func (b *Brain) SetLinkHandling(handling LinkHandling) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.Links = handling
+	b.dirty = true
+}
+
+// SetKeepPII stops or resumes redacting emails, phone numbers and long
+// numbers before messages are learned.
+func (b *Brain) SetKeepPII(keep bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.Settings.KeepPII = keep
+	b.dirty = true
+}
+
+// prepare turns a message into the text the models learn and the byte spans
+// of it to redact, under the rules learning follows now. Messages are
+// forgotten by the rules they were learned under, and phrases and tombstones
+// keep what they taught, so forgetting undoes exactly what was learned even
+// once the settings changed.
+func (b *Brain) prepare(text string) (string, [][2]int) {
+	terms := b.DeniedTerms()
+
+	b.mu.RLock()
+	rules := b.currentRules(terms)
+	b.mu.RUnlock()
+
+	return rules.prepare(text)
+}
+
+// prepare turns a message into the text the models learn and the byte spans
+// of it to redact: links are removed or redacted as the guild chose, then
+// denied terms and personal data are redacted.
+func (r *learnRules) prepare(text string) (string, [][2]int) {
+	if r.Links == LinksRemove {
+		text = strings.TrimSpace(links.ReplaceAllString(text, ""))
+	}
+
+	var spans [][2]int
+	if r.RedactDenied {
+		spans = denylist.FindTerms(text, r.DeniedTerms)
+	}
+	if r.Links == LinksRedact {
+		spans = append(spans, matches(links)(text)...)
+	}
+
+	if !r.KeepPII {
+		for _, scrub := range piiScrubbers {
+			spans = append(spans, scrub(text)...)
+		}
+	}
+
+	return text, spans
+}
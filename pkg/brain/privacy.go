@@ -0,0 +1,100 @@
+package brain
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// Privatize makes the brain fit to share: every count it holds, of n-grams,
+// emoji, topics and entity candidates alike, is dropped when below minCount
+// and then given Laplace noise of scale 1/epsilon, so rare and possibly
+// identifying phrases can't be read back out of it. An epsilon of zero adds
+// no noise. The brain generates worse text afterwards and is meant to be
+// exported, not saved.
+func (b *Brain) Privatize(minCount int, epsilon float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, profile := range b.Authors {
+		privatize(profile.Emoji, minCount, epsilon)
+	}
+
+	for _, model := range b.models() {
+		model.Flatten()
+		privatize(model.Counts, minCount, epsilon)
+		privatize(model.Imported, minCount, epsilon)
+		model.Unflatten()
+	}
+
+	for _, topics := range b.ChannelTopics {
+		privatize(topics, minCount, epsilon)
+	}
+	for _, phrases := range b.DayPhrases {
+		privatize(phrases, minCount, epsilon)
+	}
+	privatize(b.EntityCandidates, minCount, epsilon)
+
+	// member names are identifying no matter how often they come up, and
+	// fed phrases and the conversations replied in are kept word for word
+	clear(b.KnownNames)
+	clear(b.names)
+	b.Fed = nil
+	clear(b.conversations)
+	clear(b.sessions)
+}
+
+// Prune forgets the longest n-grams seen fewer than k times in the guild
+// model, every author model and every channel model, so one-off statements can't be regurgitated
+// word for word, and reports how many it dropped. Unlike Privatize it is
+// meant for the stored brain. Other backends than the n-gram model are left
+// as they are.
+func (b *Brain) Prune(k int) int {
+	defer b.takeIn()()
+
+	b.record(logEntry{Prune: k})
+	return b.pruneRare(k)
+}
+
+func (b *Brain) pruneRare(k int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var pruned int
+	for _, model := range b.models() {
+		pruned += model.Prune(k)
+	}
+
+	if pruned > 0 {
+		b.dirty = true
+	}
+
+	return pruned
+}
+
+// privatize thresholds and noises counts in place
+func privatize[T int | uint64](counts map[string]T, minCount int, epsilon float64) {
+	for key, count := range counts {
+		if int(count) < minCount {
+			delete(counts, key)
+			continue
+		}
+
+		noisy := math.Round(float64(count) + laplace(epsilon))
+		if noisy <= 0 {
+			delete(counts, key)
+			continue
+		}
+
+		counts[key] = T(noisy)
+	}
+}
+
+// laplace samples noise for a count of sensitivity 1, zero without epsilon
+func laplace(epsilon float64) float64 {
+	if epsilon <= 0 {
+		return 0
+	}
+
+	u := rand.Float64() - 0.5
+	return -math.Copysign(1/epsilon, u) * math.Log(1-2*math.Abs(u))
+}
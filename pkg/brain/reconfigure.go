@@ -0,0 +1,30 @@
+package brain
+
+// Reconfigure applies changed options to a loaded brain. Where it is saved
+// and how its models are built stay as they were loaded, so changes to Dir,
+// File, Backend, Order and Smoothing wait until it is loaded again.
+func (b *Brain) Reconfigure(opts Options) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	opts.Dir, opts.File = b.opts.Dir, b.opts.File
+	opts.Backend, opts.Order, opts.Smoothing = b.opts.Backend, b.opts.Order, b.opts.Smoothing
+	b.opts = opts
+
+	b.tune(b.Model)
+	for _, model := range b.ChannelModels {
+		b.tune(model)
+	}
+}
+
+// Reconfigure applies the options the store now picks to every loaded brain,
+// after the settings they derive from changed.
+func (s *Store) Reconfigure() {
+	for _, brain := range s.All() {
+		brain.Reconfigure(s.optionsFor(brain.GuildID))
+	}
+
+	if global := s.loadedGlobal(); global != nil {
+		global.Reconfigure(s.globalOptions())
+	}
+}
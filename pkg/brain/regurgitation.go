@@ -0,0 +1,151 @@
+package brain
+
+import (
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// how many of the latest learned messages output is checked against
+const recentMessages = 2000
+
+// words in a shingle, the overlapping runs of words messages are compared by
+const shingleWords = 5
+
+// messages with fewer words are common enough to be said by anyone
+const minCopiedWords = 3
+
+// output with at least this share of its shingles seen in recent messages is
+// a near-exact copy
+const copiedShare = 0.8
+
+// shingleBase is the multiplier of the rolling shingle hash
+const shingleBase = 1099511628211
+
+// Fingerprint identifies a learned message by hashes of its words, so
+// output can be compared against it without keeping its text.
+type Fingerprint struct {
+	// the whole message, normalized
+	Whole    uint64
+	Words    int
+	Shingles []uint64
+}
+
+// fingerprint hashes text's lowercased words, and every run of shingleWords
+// of them with a rolling hash
+func fingerprint(text string) Fingerprint {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	var whole = fnv.New64a()
+	var hashes = make([]uint64, len(words))
+	for i, word := range words {
+		h := fnv.New64a()
+		h.Write([]byte(word))
+		hashes[i] = h.Sum64()
+
+		whole.Write([]byte(word))
+		whole.Write([]byte{0})
+	}
+
+	var fp = Fingerprint{Whole: whole.Sum64(), Words: len(words)}
+	if len(words) < shingleWords {
+		return fp
+	}
+
+	// the weight of the word leaving the window
+	var top uint64 = 1
+	for range shingleWords - 1 {
+		top *= shingleBase
+	}
+
+	var rolling uint64
+	for i, h := range hashes {
+		if i >= shingleWords {
+			rolling -= hashes[i-shingleWords] * top
+		}
+		rolling = rolling*shingleBase + h
+
+		if i >= shingleWords-1 {
+			fp.Shingles = append(fp.Shingles, rolling)
+		}
+	}
+
+	return fp
+}
+
+// remember adds a learned message to the recent ones, forgetting the oldest
+// beyond about recentMessages. The caller holds the lock.
+func (b *Brain) remember(text string) {
+	fp := fingerprint(text)
+	if fp.Words < minCopiedWords {
+		return
+	}
+
+	b.Recent = append(b.Recent, fp)
+	b.indexFingerprint(fp, 1)
+
+	// the oldest are dropped in batches so not every message copies the rest
+	if over := len(b.Recent) - recentMessages; over >= recentMessages/10 {
+		for _, old := range b.Recent[:over] {
+			b.indexFingerprint(old, -1)
+		}
+		b.Recent = append([]Fingerprint(nil), b.Recent[over:]...)
+	}
+}
+
+// indexFingerprint adds delta to the index entries of fp
+func (b *Brain) indexFingerprint(fp Fingerprint, delta int) {
+	if b.recentWhole == nil {
+		b.recentWhole = make(map[uint64]int)
+		b.recentShingles = make(map[uint64]int)
+	}
+
+	if b.recentWhole[fp.Whole] += delta; b.recentWhole[fp.Whole] <= 0 {
+		delete(b.recentWhole, fp.Whole)
+	}
+	for _, shingle := range fp.Shingles {
+		if b.recentShingles[shingle] += delta; b.recentShingles[shingle] <= 0 {
+			delete(b.recentShingles, shingle)
+		}
+	}
+}
+
+// indexRecent builds the index of the recent messages after decoding
+func (b *Brain) indexRecent() {
+	b.recentWhole, b.recentShingles = nil, nil
+	for _, fp := range b.Recent {
+		b.indexFingerprint(fp, 1)
+	}
+}
+
+// Regurgitates reports whether text is an exact or near-exact copy of
+// recently learned messages: the same words as one of them, or mostly runs
+// of words they contain.
+func (b *Brain) Regurgitates(text string) bool {
+	fp := fingerprint(text)
+	if fp.Words < minCopiedWords {
+		return false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.recentWhole[fp.Whole] > 0 {
+		return true
+	}
+
+	if len(fp.Shingles) == 0 {
+		return false
+	}
+
+	var seen int
+	for _, shingle := range fp.Shingles {
+		if b.recentShingles[shingle] > 0 {
+			seen++
+		}
+	}
+
+	return float64(seen) >= copiedShare*float64(len(fp.Shingles))
+}
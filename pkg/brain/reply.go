@@ -0,0 +1,323 @@
+package brain
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/internal/tracing"
+	"github.com/schizoid/pkg/ngram"
+	"github.com/schizoid/pkg/textmodel"
+	"github.com/schizoid/pkg/watchdog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Generate samples up to length tokens following seed, returning the seed
+// followed by the generated text.
+func (b *Brain) Generate(seed string, length int) string {
+	return b.GenerateIn(0, seed, length)
+}
+
+// GenerateIn is Generate in a channel, which talks in its own voice when the
+// brain is kept per channel.
+func (b *Brain) GenerateIn(channelID snowflake.ID, seed string, length int) string {
+	return b.generateIn(context.Background(), channelID, seed, length)
+}
+
+func (b *Brain) generateIn(ctx context.Context, channelID snowflake.ID, seed string, length int) string {
+	return b.generate(ctx, channelID, seed, length)
+}
+
+// generations are told apart in the watchdog by guild and a sequence number,
+// since a guild may generate several replies at once
+var generationSeq atomic.Uint64
+
+// startGeneration has the watchdog track a generation for the guild
+func (b *Brain) startGeneration() *watchdog.Task {
+	task, _ := b.opts.Generations.Start(context.Background(), fmt.Sprintf("%s/%d", b.GuildID, generationSeq.Add(1)))
+	return task
+}
+
+// generate samples from the backend, stopping early if the watchdog finds
+// the generation taking too long. Backends that can't stream run to the end.
+// The n-gram models sample under the read lock, so replies are generated in
+// parallel; a separate backend, which may wait on the network, samples
+// without it. The caller doesn't hold the lock.
+func (b *Brain) generate(ctx context.Context, channelID snowflake.ID, seed string, length int) string {
+	ctx, span := tracer.Start(ctx, "brain.Generate", trace.WithAttributes(tracing.Guild(b.GuildID), attribute.Int("length", length)))
+	defer span.End()
+
+	task := b.startGeneration()
+	defer b.opts.Generations.Done(task)
+
+	b.rlock(ctx)
+	out, ok := b.generateLocal(channelID, seed, length, task)
+	backend := b.backend
+	b.mu.RUnlock()
+
+	if ok {
+		return out
+	}
+
+	if streamer, ok := backend.(textmodel.Streamer); ok {
+		return streamer.Stream(seed, length, func(string) bool { return task.Context().Err() == nil })
+	}
+
+	return backend.Generate(seed, length)
+}
+
+// generateLocal samples from the n-gram models, reporting false when it's
+// up to a separate backend. The caller holds at least the read lock.
+func (b *Brain) generateLocal(channelID snowflake.ID, seed string, length int, task *watchdog.Task) (string, bool) {
+	var alive = func(string) bool { return task.Context().Err() == nil }
+
+	// a channel's own model generates like the n-gram backend does
+	if model := b.channelModel(channelID); model != nil {
+		if b.Settings.BeamWidth > 0 {
+			return model.Beam(seed, length, b.Settings.BeamWidth, task.Alive), true
+		}
+		return model.Stream(seed, length, alive), true
+	}
+
+	if out, ok := b.beam(seed, length, task); ok {
+		return out, true
+	}
+
+	if out, ok := b.generateShared(seed, length); ok {
+		return out, true
+	}
+
+	if !b.separateBackend() {
+		return b.Model.Stream(seed, length, alive), true
+	}
+
+	return "", false
+}
+
+// Confidence scores how sure the model is of text, from 0 to 1.
+func (b *Brain) Confidence(text string) float64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.Model.Confidence(text)
+}
+
+// Score scores how likely the guild is to say text, or authorID unless that
+// is zero. It is false when the author has no profile.
+func (b *Brain) Score(authorID snowflake.ID, text string) (ngram.Score, bool) {
+	text, spans := b.prepare(text)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var model = b.Model
+	if authorID != 0 {
+		profile := b.Authors[authorID]
+		if profile == nil {
+			return ngram.Score{}, false
+		}
+		model = profile.Model
+	}
+
+	return model.ScoreRedacted(text, spans), true
+}
+
+// SetSmoothing changes the additive smoothing of the guild model and every
+// author model.
+func (b *Brain) SetSmoothing(smoothing float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, model := range b.models() {
+		model.Smoothing = smoothing
+	}
+	b.dirty = true
+}
+
+// prompts at least this long are split into sentences and answered piecewise
+const longPromptLength = 120
+
+// the most sentences of a long prompt that get their own continuation
+const maxEnsembleSeeds = 4
+
+func splitSentences(text string) []string {
+	var sentences []string
+	var sb strings.Builder
+
+	var flush = func() {
+		if s := strings.TrimSpace(sb.String()); s != "" {
+			sentences = append(sentences, s)
+		}
+		sb.Reset()
+	}
+
+	for _, r := range text {
+		sb.WriteRune(r)
+
+		if r == '.' || r == '!' || r == '?' || r == '\n' {
+			flush()
+		}
+	}
+	flush()
+
+	return sentences
+}
+
+// continuation generates text following seed, without the seed itself
+func (b *Brain) continuation(ctx context.Context, channelID snowflake.ID, seed string, length int) string {
+	return strings.TrimSpace(strings.TrimPrefix(b.generateIn(ctx, channelID, seed, length), seed))
+}
+
+// longestSentences keeps the n longest sentences in their original order
+func longestSentences(sentences []string, n int) []string {
+	if len(sentences) <= n {
+		return sentences
+	}
+
+	var indices = make([]int, len(sentences))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	// pick the longest sentences, then restore prompt order
+	slices.SortStableFunc(indices, func(a, b int) int { return len(sentences[b]) - len(sentences[a]) })
+	indices = indices[:n]
+	slices.Sort(indices)
+
+	var out []string
+	for _, i := range indices {
+		out = append(out, sentences[i])
+	}
+
+	return out
+}
+
+// Reply generates a response to prompt. Long prompts are split into sentences
+// and each one seeds its own continuation, so the reply engages with more of
+// the prompt than just its tail. With several candidates configured, the
+// best of them is picked.
+func (b *Brain) Reply(prompt string, length int) string {
+	return b.ReplyIn(0, prompt, length)
+}
+
+// ReplyIn is Reply in a channel, which talks in its own voice when the brain
+// is kept per channel.
+func (b *Brain) ReplyIn(channelID snowflake.ID, prompt string, length int) string {
+	return b.replyIn(context.Background(), channelID, prompt, length)
+}
+
+func (b *Brain) replyIn(ctx context.Context, channelID snowflake.ID, prompt string, length int) string {
+	return b.bestOf(ctx, b.candidates(), length, func() string { return b.reply(ctx, channelID, prompt, length) })
+}
+
+// candidates is how many replies to generate to pick the best of
+func (b *Brain) candidates() int {
+	if b.GuildSettings().BeamWidth > 0 {
+		// beam search gives the same reply every time
+		return 1
+	}
+
+	return b.opts.Candidates
+}
+
+func (b *Brain) reply(ctx context.Context, channelID snowflake.ID, prompt string, length int) string {
+	prompt = strings.TrimSpace(prompt)
+	sentences := splitSentences(prompt)
+
+	if len(prompt) < longPromptLength || len(sentences) < 2 {
+		if out := b.continuation(ctx, channelID, prompt, length); out != "" {
+			return out
+		}
+
+		return b.generateIn(ctx, channelID, "", length)
+	}
+
+	sentences = longestSentences(sentences, maxEnsembleSeeds)
+	budget := length / len(sentences)
+
+	var parts []string
+	for _, sentence := range sentences {
+		if out := b.continuation(ctx, channelID, sentence, budget); out != "" {
+			parts = append(parts, out)
+		}
+	}
+
+	if len(parts) == 0 {
+		return b.generateIn(ctx, channelID, "", length)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Stream generates a reply to prompt, handing each piece of text to emit as
+// soon as it is sampled, and stops early once emit returns false. Unlike
+// Reply, long prompts are continued as a whole. Backends that can't stream
+// hand out their reply in one piece. emit is called without holding the
+// lock.
+func (b *Brain) Stream(prompt string, length int, emit func(piece string) bool) {
+	prompt = strings.TrimSpace(prompt)
+
+	// like continuation, the reply starts at its first non-space
+	var started bool
+	var trimmed = func(piece string) bool {
+		if !started {
+			if piece = strings.TrimLeftFunc(piece, unicode.IsSpace); piece == "" {
+				return true
+			}
+			started = true
+		}
+
+		return emit(piece)
+	}
+
+	b.streamBackend(prompt, length, trimmed)
+	if !started && prompt != "" {
+		b.streamBackend("", length, trimmed)
+	}
+}
+
+// streamBackend streams from the backend. The n-gram model samples in no
+// time, so it does under the read lock and its pieces are handed out once
+// it is done; a separate backend streams without the lock.
+func (b *Brain) streamBackend(seed string, length int, emit func(string) bool) {
+	task := b.startGeneration()
+	defer b.opts.Generations.Done(task)
+
+	var pieces []string
+	b.mu.RLock()
+	out, beamed := b.beam(seed, length, task)
+	local := !beamed && !b.separateBackend()
+	if local {
+		b.Model.Stream(seed, length, func(piece string) bool {
+			pieces = append(pieces, piece)
+			return task.Context().Err() == nil
+		})
+	}
+	backend := b.backend
+	b.mu.RUnlock()
+
+	switch {
+	case beamed:
+		emit(strings.TrimPrefix(out, seed))
+	case local:
+		for _, piece := range pieces {
+			if !emit(piece) {
+				return
+			}
+		}
+	default:
+		if streamer, ok := backend.(textmodel.Streamer); ok {
+			streamer.Stream(seed, length, func(piece string) bool {
+				return task.Context().Err() == nil && emit(piece)
+			})
+			return
+		}
+
+		emit(strings.TrimPrefix(backend.Generate(seed, length), seed))
+	}
+}
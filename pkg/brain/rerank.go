@@ -0,0 +1,114 @@
+package brain
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// reranking penalties, in nats per token like the fluency they are taken off
+const (
+	// for every repeated word pair, relative to all of them
+	repetitionPenalty = 2.0
+	// for a candidate of fewer than minCandidateWords words
+	shortPenalty = 1.0
+	// for a candidate cut off at the length limit
+	truncatedPenalty = 0.5
+	// for every token the model gives no chance, relative to all of them
+	unseenPenalty = 4.0
+)
+
+// candidates shorter than this are penalized, they rarely answer anything
+const minCandidateWords = 2
+
+// bestOf generates n candidates with generate side by side and returns the
+// one rankCandidate scores highest
+func (b *Brain) bestOf(ctx context.Context, n, length int, generate func() string) string {
+	if n <= 1 {
+		return generate()
+	}
+
+	var candidates = make([]string, n)
+	var wg sync.WaitGroup
+	for i := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			candidates[i] = generate()
+		}()
+	}
+	wg.Wait()
+
+	ctx, span := tracer.Start(ctx, "brain.Rank", trace.WithAttributes(attribute.Int("candidates", n)))
+	defer span.End()
+
+	var best string
+	var bestScore = math.Inf(-1)
+	for _, candidate := range candidates {
+		if score := b.rankCandidate(ctx, candidate, length); score > bestScore || best == "" {
+			best, bestScore = candidate, score
+		}
+	}
+
+	return best
+}
+
+// rankCandidate scores a generated reply by how fluent the guild model finds
+// it at its full order, less penalties for repeating itself, being too short
+// and running into the length limit. Higher is better.
+func (b *Brain) rankCandidate(ctx context.Context, text string, length int) float64 {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return math.Inf(-1)
+	}
+
+	b.rlock(ctx)
+	score := b.Model.Score(text)
+	b.mu.RUnlock()
+
+	var scored = score.Tokens - score.ZeroProbs
+	var rank = -unseenPenalty * float64(score.ZeroProbs) / float64(score.Tokens)
+	if scored > 0 {
+		rank += score.LogProb / float64(scored)
+	} else {
+		rank -= unseenPenalty
+	}
+
+	words := strings.Fields(strings.ToLower(text))
+	rank -= repetitionPenalty * repetition(words)
+
+	if len(words) < minCandidateWords {
+		rank -= shortPenalty
+	}
+
+	// the end of text isn't part of the reply
+	if score.Tokens-1 >= length {
+		rank -= truncatedPenalty
+	}
+
+	return rank
+}
+
+// repetition is the share of word pairs that already occurred earlier in
+// words, 0 for none
+func repetition(words []string) float64 {
+	if len(words) < 2 {
+		return 0
+	}
+
+	var seen = make(map[[2]string]bool)
+	var repeated int
+	for i := 1; i < len(words); i++ {
+		pair := [2]string{words[i-1], words[i]}
+		if seen[pair] {
+			repeated++
+		}
+		seen[pair] = true
+	}
+
+	return float64(repeated) / float64(len(words)-1)
+}
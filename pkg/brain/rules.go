@@ -0,0 +1,182 @@
+package brain
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/denylist"
+)
+
+// learnRules are what decided whether a message was learned and how. A
+// brain keeps the rules it learned each stretch of its channels' history
+// under, so a message deleted after they changed is forgotten only if it was
+// learned, and as it was.
+// The maps are never written to once the rules are noted, so copies can be
+// read without the lock.
+type learnRules struct {
+	AllowNSFW        bool
+	LearnAttachments bool
+	RedactDenied     bool
+	DeniedTerms      []string
+	Links            LinkHandling
+	KeepPII          bool
+	// the patterns of the deployment's and the guild's training filters
+	TrainFilters []string
+	OptedOut     map[snowflake.ID]bool
+	Blocked      map[snowflake.ID]bool
+	// members whose messages learned under the rules were unlearned along
+	// with their profile since
+	Forgotten map[snowflake.ID]bool
+}
+
+// pastRules are rules that were replaced, with the spans learned under them
+// and earlier ones
+type pastRules struct {
+	Rules learnRules
+	Spans map[snowflake.ID]TrainedSpan
+}
+
+// currentRules returns the rules learning follows now, sharing the brain's
+// maps. terms are the denied terms. The caller holds at least the read lock.
+func (b *Brain) currentRules(terms []string) learnRules {
+	var filters []string
+	for _, re := range b.opts.TrainFilters {
+		filters = append(filters, re.String())
+	}
+	filters = append(filters, b.Settings.TrainFilters...)
+
+	return learnRules{
+		AllowNSFW:        b.Settings.AllowNSFW,
+		LearnAttachments: b.Settings.LearnAttachments,
+		RedactDenied:     b.Settings.RedactDenied,
+		DeniedTerms:      terms,
+		Links:            b.Settings.Links,
+		KeepPII:          b.Settings.KeepPII,
+		TrainFilters:     filters,
+		OptedOut:         b.OptedOut,
+		Blocked:          b.BlockedUsers,
+	}
+}
+
+// noteRules notes the rules learning follows, keeping the spans learned
+// under the ones they replace
+func (b *Brain) noteRules() {
+	terms := b.DeniedTerms()
+
+	b.mu.RLock()
+	current := b.currentRules(terms)
+	same := b.Rules != nil && b.Rules.same(current)
+	b.mu.RUnlock()
+
+	if same {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current = b.currentRules(terms)
+	if b.Rules != nil {
+		if b.Rules.same(current) {
+			return
+		}
+		b.PastRules = append(b.PastRules, pastRules{Rules: *b.Rules, Spans: b.spans()})
+	}
+	current.OptedOut = maps.Clone(current.OptedOut)
+	current.Blocked = maps.Clone(current.Blocked)
+	b.Rules = &current
+	b.dirty = true
+}
+
+// forgotAuthor notes that everything learned from userID so far was
+// unlearned along with their profile. The caller holds the write lock.
+func (b *Brain) forgotAuthor(userID snowflake.ID) {
+	for i := range b.PastRules {
+		b.PastRules[i].Rules.forget(userID)
+	}
+
+	// what is learned from them from now on isn't forgotten yet
+	if b.Rules != nil {
+		past := *b.Rules
+		past.forget(userID)
+		b.PastRules = append(b.PastRules, pastRules{Rules: past, Spans: b.spans()})
+	}
+}
+
+// spans copies the spans of every channel. The caller holds at least the
+// read lock.
+func (b *Brain) spans() map[snowflake.ID]TrainedSpan {
+	var spans = make(map[snowflake.ID]TrainedSpan, len(b.TrainedSpans))
+	for channelID, span := range b.TrainedSpans {
+		copied := *span
+		copied.Gaps = slices.Clone(span.Gaps)
+		spans[channelID] = copied
+	}
+
+	return spans
+}
+
+// learnedUnder returns the rules a message was learned under, if its
+// channel's span covers it
+func (b *Brain) learnedUnder(obs Message) (learnRules, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, past := range b.PastRules {
+		if span, ok := past.Spans[obs.ChannelID]; ok && span.covers(obs) {
+			return past.Rules, true
+		}
+	}
+
+	if span := b.TrainedSpans[obs.ChannelID]; span != nil && span.covers(obs) && b.Rules != nil {
+		return *b.Rules, true
+	}
+
+	return learnRules{}, false
+}
+
+func (r *learnRules) same(other learnRules) bool {
+	return r.AllowNSFW == other.AllowNSFW &&
+		r.LearnAttachments == other.LearnAttachments &&
+		r.RedactDenied == other.RedactDenied &&
+		slices.Equal(r.DeniedTerms, other.DeniedTerms) &&
+		r.Links == other.Links &&
+		r.KeepPII == other.KeepPII &&
+		slices.Equal(r.TrainFilters, other.TrainFilters) &&
+		maps.Equal(r.OptedOut, other.OptedOut) &&
+		maps.Equal(r.Blocked, other.Blocked)
+}
+
+// forget marks userID forgotten, copying the map so copies of the rules
+// handed out stay as they were
+func (r *learnRules) forget(userID snowflake.ID) {
+	forgotten := maps.Clone(r.Forgotten)
+	if forgotten == nil {
+		forgotten = make(map[snowflake.ID]bool)
+	}
+	forgotten[userID] = true
+	r.Forgotten = forgotten
+}
+
+// learned reports whether the rules let obs be learned, like
+// Brain.learnsFrom did when it was
+func (r *learnRules) learned(obs Message) bool {
+	if (obs.NSFW && !r.AllowNSFW) || obs.Bot || r.OptedOut[obs.AuthorID] || r.Blocked[obs.AuthorID] {
+		return false
+	}
+
+	text := learnedText(obs, r.LearnAttachments)
+	if len(text) == 0 {
+		return false
+	}
+
+	for _, pattern := range r.TrainFilters {
+		if re, err := regexp.Compile(pattern); err == nil && re.MatchString(text) {
+			return false
+		}
+	}
+
+	return r.RedactDenied || len(denylist.FindTerms(text, r.DeniedTerms)) == 0
+}
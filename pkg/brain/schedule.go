@@ -0,0 +1,84 @@
+package brain
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Quiet reports whether t falls in the channel's quiet hours.
+func (s ChannelSettings) Quiet(t time.Time) bool {
+	start, end, hour := s.QuietStart, s.QuietEnd, t.UTC().Hour()
+
+	switch {
+	case start == end:
+		return false
+	case start < end:
+		return hour >= start && hour < end
+	default:
+		// quiet over midnight
+		return hour >= start || hour < end
+	}
+}
+
+// nextPost picks when the channel posts after now
+func (s ChannelSettings) nextPost(now time.Time) time.Time {
+	interval := s.PostInterval
+	if s.PostJitter {
+		interval = interval/2 + rand.N(interval)
+	}
+
+	return now.Add(interval)
+}
+
+// PostsScheduled reports whether any channel posts unprompted, on a schedule
+// or with a digest.
+func (b *Brain) PostsScheduled() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, settings := range b.PerChannel {
+		if settings.PostInterval > 0 || settings.Digest {
+			return true
+		}
+	}
+	return false
+}
+
+// DuePosts lists the channels due an unprompted post at now and schedules
+// their next one. A channel's first post comes an interval after it is
+// first checked, and posts falling in its quiet hours are skipped.
+func (b *Brain) DuePosts(now time.Time) []snowflake.ID {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.nextPosts == nil {
+		b.nextPosts = make(map[snowflake.ID]time.Time)
+	}
+
+	for channelID := range b.nextPosts {
+		if b.PerChannel[channelID].PostInterval <= 0 {
+			delete(b.nextPosts, channelID)
+		}
+	}
+
+	var due []snowflake.ID
+	for channelID, settings := range b.PerChannel {
+		if settings.PostInterval <= 0 {
+			continue
+		}
+
+		next, ok := b.nextPosts[channelID]
+		if ok && now.Before(next) {
+			continue
+		}
+
+		b.nextPosts[channelID] = settings.nextPost(now)
+		if ok && !settings.Quiet(now) {
+			due = append(due, channelID)
+		}
+	}
+
+	return due
+}
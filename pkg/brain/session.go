@@ -0,0 +1,83 @@
+package brain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// the bot's replies a session keeps to follow up on
+const sessionReplies = 3
+
+// session is an exchange between the bot and a member in a channel, lasting
+// while they keep answering each other
+type session struct {
+	userID  snowflake.ID
+	started time.Time
+	until   time.Time
+	// the bot's latest replies to the member, oldest first
+	replies []spoken
+}
+
+// Replied notes that the bot answered msg with reply, starting a session with
+// msg's author or carrying theirs on. A session ends after the session
+// timeout passes without an exchange, or when the bot answers someone else.
+func (b *Brain) Replied(msg Message, reply string) {
+	if b.opts.SessionTimeout <= 0 || msg.AuthorID == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.sessions == nil {
+		b.sessions = make(map[snowflake.ID]*session)
+	}
+
+	s := b.sessions[msg.ChannelID]
+	if s == nil || s.userID != msg.AuthorID || msg.CreatedAt.After(s.until) {
+		s = &session{userID: msg.AuthorID, started: msg.CreatedAt}
+		b.sessions[msg.ChannelID] = s
+	}
+
+	s.until = msg.CreatedAt.Add(b.opts.SessionTimeout)
+	s.replies = append(s.replies, spoken{text: reply, createdAt: msg.CreatedAt})
+	if len(s.replies) > sessionReplies {
+		s.replies = s.replies[len(s.replies)-sessionReplies:]
+	}
+
+	// drop sessions that timed out so the map only holds ongoing ones
+	for channelID, other := range b.sessions {
+		if msg.CreatedAt.After(other.until) {
+			delete(b.sessions, channelID)
+		}
+	}
+}
+
+// sessionHistory returns the bot's replies in msg's session and its author's
+// follow-ups to them, oldest first, or nil if msg isn't part of a session
+func (b *Brain) sessionHistory(msg Message) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	s := b.sessions[msg.ChannelID]
+	if s == nil || s.userID != msg.AuthorID || msg.CreatedAt.After(s.until) {
+		return nil
+	}
+
+	var turns = slices.Clone(s.replies)
+	for _, m := range b.conversations[msg.ChannelID] {
+		if m.authorID == msg.AuthorID && m.id != msg.ID && !m.createdAt.Before(s.started) && m.createdAt.Before(msg.CreatedAt) {
+			turns = append(turns, m)
+		}
+	}
+	slices.SortStableFunc(turns, func(x, y spoken) int { return x.createdAt.Compare(y.createdAt) })
+
+	var out []string
+	for _, turn := range turns {
+		out = append(out, turn.text)
+	}
+
+	return out
+}
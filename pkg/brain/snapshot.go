@@ -0,0 +1,311 @@
+package brain
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// snapshots are kept in a directory next to the brain's file, one file each
+// named after why and when it was taken
+const (
+	snapshotsSuffix    = ".snapshots"
+	snapshotExt        = ".snapshot"
+	snapshotTimeFormat = "20060102-150405"
+)
+
+// Changes snapshots are taken before.
+const (
+	SnapshotImport       = "import"
+	SnapshotPrune        = "prune"
+	SnapshotPurgeImports = "purge-imports"
+	SnapshotRebuild      = "rebuild"
+)
+
+// ErrNoSnapshot is returned for restoring a snapshot the brain doesn't have.
+var ErrNoSnapshot = errors.New("no such snapshot")
+
+// Snapshot is a copy of a brain saved before a change that is hard to undo,
+// like an import or a prune.
+type Snapshot struct {
+	// what Restore takes, unique among the brain's snapshots
+	Name string
+	// what was about to change the brain
+	Reason string
+	At     time.Time
+	Size   int64
+}
+
+// Tombstone records text unlearned, so restoring a snapshot taken before can
+// unlearn it again. Snapshots hold what the text taught anyway, so the text is
+// only kept as long as they are.
+type Tombstone struct {
+	// numbered in order, see Brain.Buried
+	Seq       int
+	At        time.Time
+	AuthorID  snowflake.ID
+	ChannelID snowflake.ID
+	// the text as the models learned it and the byte spans of it redacted
+	Learned    string
+	Redactions [][2]int
+	// the text before it was prepared for the models, which tombstones from
+	// before Learned was kept hold instead
+	Text string
+}
+
+func snapshotDir(fn string) string {
+	return fn + snapshotsSuffix
+}
+
+// TakeSnapshot saves the brain as it is now, before what reason names changes
+// it, and deletes the oldest snapshots beyond those the options keep. It does
+// nothing when they keep none.
+func (b *Brain) TakeSnapshot(reason string) error {
+	if b.opts.Snapshots <= 0 {
+		return nil
+	}
+
+	// taken before encoding, so everything unlearned before it is in the
+	// snapshot
+	at := time.Now().UTC()
+
+	var buffer bytes.Buffer
+	b.mu.RLock()
+	err := b.encode(&buffer)
+	b.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("serializing snapshot: %w", err)
+	}
+
+	dir := snapshotDir(b.opts.path(b.GuildID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating snapshots directory: %w", err)
+	}
+
+	fn := filepath.Join(dir, reason+"-"+at.Format(snapshotTimeFormat)+snapshotExt)
+	if err := os.WriteFile(fn+".tmp", buffer.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := os.Rename(fn+".tmp", fn); err != nil {
+		return fmt.Errorf("replacing snapshot: %w", err)
+	}
+
+	snapshots := b.Snapshots()
+	for _, old := range snapshots[min(b.opts.Snapshots, len(snapshots)):] {
+		if err := os.Remove(filepath.Join(dir, old.Name+snapshotExt)); err != nil {
+			storageLog.Warn("Failed to delete old snapshot", slog.Any("guildID", b.GuildID), slog.String("snapshot", old.Name), slog.String("err", err.Error()))
+		}
+	}
+	b.noteSnapshots()
+
+	storageLog.Info("Took snapshot of guild brain", slog.Any("guildID", b.GuildID), slog.String("reason", reason))
+	return nil
+}
+
+// Snapshots lists the brain's snapshots, the newest first.
+func (b *Brain) Snapshots() []Snapshot {
+	entries, err := os.ReadDir(snapshotDir(b.opts.path(b.GuildID)))
+	if err != nil {
+		return nil
+	}
+
+	var snapshots []Snapshot
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), snapshotExt)
+		if !ok {
+			continue
+		}
+
+		reason, at, ok := parseSnapshotName(name)
+		if !ok {
+			continue
+		}
+
+		var size int64
+		if info, err := entry.Info(); err == nil {
+			size = info.Size()
+		}
+
+		snapshots = append(snapshots, Snapshot{
+			Name:   name,
+			Reason: reason,
+			At:     at,
+			Size:   size,
+		})
+	}
+
+	slices.SortFunc(snapshots, func(a, b Snapshot) int { return cmp.Or(b.At.Compare(a.At), strings.Compare(a.Name, b.Name)) })
+
+	return snapshots
+}
+
+// parseSnapshotName splits a snapshot's name into why and when it was taken
+func parseSnapshotName(name string) (string, time.Time, bool) {
+	if len(name) <= len(snapshotTimeFormat) {
+		return "", time.Time{}, false
+	}
+
+	at, err := time.Parse(snapshotTimeFormat, name[len(name)-len(snapshotTimeFormat):])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	return name[:len(name)-len(snapshotTimeFormat)-1], at, true
+}
+
+// noteSnapshots notes when the oldest snapshot was taken and drops the
+// tombstones every snapshot is past
+func (b *Brain) noteSnapshots() {
+	var oldest time.Time
+	if snapshots := b.Snapshots(); len(snapshots) > 0 {
+		oldest = snapshots[len(snapshots)-1].At
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.oldestSnapshot = oldest
+	if oldest.IsZero() {
+		b.Tombstones = nil
+		return
+	}
+
+	// the snapshot times in names are truncated, so this errs on keeping
+	b.Tombstones = slices.DeleteFunc(b.Tombstones, func(t Tombstone) bool { return t.At.Before(oldest) })
+}
+
+// bury records prepared text unlearned while there are snapshots it could
+// come back from. The caller holds the write lock.
+func (b *Brain) bury(authorID, channelID snowflake.ID, text string, spans [][2]int) {
+	if b.oldestSnapshot.IsZero() {
+		return
+	}
+
+	b.Buried++
+	b.Tombstones = append(b.Tombstones, Tombstone{
+		Seq:        b.Buried,
+		At:         time.Now(),
+		AuthorID:   authorID,
+		ChannelID:  channelID,
+		Learned:    text,
+		Redactions: spans,
+	})
+	b.dirty = true
+}
+
+// Restore replaces a guild's brain with one of its snapshots and saves it,
+// returning the brain now in use. Whatever the replaced brain learned or was
+// changed by meanwhile is lost, but for what is owed to members: the audit
+// log, who opted out and who was blocked carry over, members forgotten since
+// the snapshot stay forgotten, and so do deleted messages and withdrawn
+// phrases.
+func (s *Store) Restore(guildID snowflake.ID, name string) (*Brain, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, ErrNoSnapshot
+	}
+
+	opts := s.optionsFor(guildID)
+	restored, err := Read(filepath.Join(snapshotDir(opts.path(guildID)), name+snapshotExt), opts)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSnapshot
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot: %w", err)
+	}
+	s.setUp(guildID, restored)
+
+	// the replaced brain takes nothing in until it is, so all it learned
+	// and was changed by is what is inherited from it
+	current := s.Get(guildID)
+	current.changes.Lock()
+	defer current.changes.Unlock()
+
+	if current.replaced {
+		return nil, errReplaced
+	}
+
+	restored.log = current.log
+	restored.inherit(current)
+
+	if err := restored.Save(); err != nil {
+		return nil, err
+	}
+	if _, at, ok := parseSnapshotName(name); ok {
+		restored.record(logEntry{Restored: at})
+	}
+
+	s.mu.Lock()
+	s.reinstate(guildID, restored, time.Now())
+	s.mu.Unlock()
+	current.replaced = true
+
+	storageLog.Info("Restored guild brain from snapshot", slog.Any("guildID", guildID), slog.String("snapshot", name))
+	return restored, nil
+}
+
+// inherit takes over what a brain being replaced owes its members: its audit
+// log, opt-outs and blocks, unlearning the members it forgot and the text it
+// unlearned since b was taken
+func (b *Brain) inherit(from *Brain) {
+	from.mu.RLock()
+	audit := slices.Clone(from.Audit)
+	optedOut := maps.Clone(from.OptedOut)
+	blocked := maps.Clone(from.BlockedUsers)
+	var forgotten []snowflake.ID
+	for userID := range blocked {
+		if from.Authors[userID] == nil {
+			forgotten = append(forgotten, userID)
+		}
+	}
+	tombstones, buried := slices.Clone(from.Tombstones), from.Buried
+	loggedSince := from.LoggedSince
+	from.mu.RUnlock()
+
+	b.mu.Lock()
+	b.Audit = audit
+	b.OptedOut = optedOut
+	b.BlockedUsers = blocked
+
+	for userID := range optedOut {
+		b.dropAuthor(userID)
+	}
+	for _, userID := range forgotten {
+		b.dropAuthor(userID)
+	}
+
+	since := b.Buried
+	b.Tombstones, b.Buried = tombstones, buried
+	// the log covers what both learned from when it covers both
+	if loggedSince.IsZero() || loggedSince.After(b.LoggedSince) {
+		b.LoggedSince = loggedSince
+	}
+	b.dirty = true
+	b.mu.Unlock()
+
+	// unlearning takes the lock itself
+	for _, t := range tombstones {
+		if t.Seq <= since {
+			continue
+		}
+
+		text, spans := t.Learned, t.Redactions
+		if t.Text != "" {
+			text, spans = b.prepare(t.Text)
+		}
+
+		b.unlearn(t.AuthorID, text, spans)
+		if t.ChannelID != 0 {
+			b.forgetChannel(t.ChannelID, text, spans)
+		}
+	}
+}
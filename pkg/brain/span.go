@@ -0,0 +1,81 @@
+package brain
+
+import (
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// TrainedSpan is the stretch of a channel's history that has been learned.
+type TrainedSpan struct {
+	Start time.Time
+	End   time.Time
+
+	StartID snowflake.ID
+	EndID   snowflake.ID
+
+	// whether nothing older than Start is left to learn
+	Crawled bool
+	// stretches after Start sent while the bot was offline, not caught up
+	// with yet
+	Gaps []Gap
+}
+
+// DuringSpan reports whether t falls within the span, inclusive.
+func (ts *TrainedSpan) DuringSpan(t time.Time) bool {
+	return (t.After(ts.Start) && t.Before(ts.End)) || t.Equal(ts.Start) || t.Equal(ts.End)
+}
+
+// covers reports whether msg was learned as part of the span: it falls within
+// it and not in a gap that is yet to be caught up with
+func (ts *TrainedSpan) covers(msg Message) bool {
+	if !ts.DuringSpan(msg.CreatedAt) {
+		return false
+	}
+
+	for _, gap := range ts.Gaps {
+		if msg.ID > gap.After && msg.ID < gap.Before {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ExtendSpan grows the span to cover msg.
+func (ts *TrainedSpan) ExtendSpan(msg Message) {
+	var t = msg.CreatedAt
+
+	if t.After(ts.End) {
+		ts.End = t
+		ts.EndID = msg.ID
+	}
+
+	if t.Before(ts.Start) {
+		ts.Start = t
+		ts.StartID = msg.ID
+	}
+}
+
+// Union grows the span to cover other.
+func (ts *TrainedSpan) Union(other *TrainedSpan) {
+	if other.Start.Before(ts.Start) {
+		ts.Start = other.Start
+		ts.StartID = other.StartID
+	}
+	if other.End.After(ts.End) {
+		ts.End = other.End
+		ts.EndID = other.EndID
+	}
+	ts.Gaps = append(ts.Gaps, other.Gaps...)
+}
+
+func makeSpan(msg Message) *TrainedSpan {
+	return &TrainedSpan{
+		Start: msg.CreatedAt,
+		End:   msg.CreatedAt,
+
+		StartID: msg.ID,
+		EndID:   msg.ID,
+	}
+}
@@ -0,0 +1,381 @@
+package brain
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+	"weak"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// Store keeps the brain of every guild in use loaded, so everything serving
+// a guild shares one brain.
+type Store struct {
+	optionsFor func(guildID snowflake.ID) Options
+
+	mu     sync.Mutex
+	brains map[snowflake.ID]*Brain
+	// when each loaded brain was last asked for
+	used map[snowflake.ID]time.Time
+	// the channels of each unloaded brain, as far as the store looked them
+	// up
+	channels map[snowflake.ID]channelSets
+	// the guilds whose brain is being loaded, closed once it is, so it is
+	// loaded once and without holding the store
+	loading map[snowflake.ID]chan struct{}
+	// the brains unloaded while something may still hold them. As long as
+	// something does, it is handed out again rather than a copy loaded from
+	// disk, and it puts itself back once it takes a change in.
+	unloaded map[snowflake.ID]weak.Pointer[Brain]
+
+	// the brain shared across guilds, loaded once one needs it and never
+	// unloaded, since guild brains hold on to it. It has its own lock so
+	// guild brains can load it while the store saves them.
+	globalMu sync.Mutex
+	global   *Brain
+}
+
+// NewStore creates a store loading each guild's brain with the options
+// optionsFor returns for it.
+func NewStore(optionsFor func(guildID snowflake.ID) Options) *Store {
+	return &Store{
+		optionsFor: optionsFor,
+		brains:     make(map[snowflake.ID]*Brain),
+		used:       make(map[snowflake.ID]time.Time),
+		channels:   make(map[snowflake.ID]channelSets),
+		loading:    make(map[snowflake.ID]chan struct{}),
+		unloaded:   make(map[snowflake.ID]weak.Pointer[Brain]),
+	}
+}
+
+// Get returns a guild's brain, loading it on first use. Only the guild's
+// callers wait for it to load.
+func (s *Store) Get(guildID snowflake.ID) *Brain {
+	for {
+		s.mu.Lock()
+		if brain := s.brains[guildID]; brain != nil {
+			s.used[guildID] = time.Now()
+			s.mu.Unlock()
+			return brain
+		}
+		if loading, ok := s.loading[guildID]; ok {
+			s.mu.Unlock()
+			<-loading
+			continue
+		}
+		if brain := s.unloaded[guildID].Value(); brain != nil {
+			s.reinstate(guildID, brain, time.Now())
+			s.mu.Unlock()
+			return brain
+		}
+
+		loading := make(chan struct{})
+		s.loading[guildID] = loading
+		s.mu.Unlock()
+
+		brain := s.load(guildID)
+
+		s.mu.Lock()
+		s.reinstate(guildID, brain, time.Now())
+		delete(s.loading, guildID)
+		close(loading)
+		s.mu.Unlock()
+		return brain
+	}
+}
+
+// reinstate puts a brain in use as of now. The caller holds s.mu.
+func (s *Store) reinstate(guildID snowflake.ID, brain *Brain, now time.Time) {
+	brain.unloaded.Store(false)
+	s.brains[guildID] = brain
+	s.used[guildID] = now
+	delete(s.unloaded, guildID)
+	delete(s.channels, guildID)
+}
+
+// load loads a guild's brain, handing it the shared one
+func (s *Store) load(guildID snowflake.ID) *Brain {
+	brain := Load(guildID, s.optionsFor(guildID))
+	s.setUp(guildID, brain)
+	return brain
+}
+
+// setUp has a brain of the store use the shared one and put itself back in
+// use once it changes after being unloaded
+func (s *Store) setUp(guildID snowflake.ID, brain *Brain) {
+	brain.shared = s.Global
+	brain.putBack = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if brain.unloaded.Load() && s.brains[guildID] == nil {
+			s.reinstate(guildID, brain, time.Now())
+		}
+	}
+}
+
+// Global returns the brain shared by the guilds that opted in to it, loading
+// it on first use.
+func (s *Store) Global() *Brain {
+	s.globalMu.Lock()
+	defer s.globalMu.Unlock()
+
+	if s.global == nil {
+		s.global = Load(GlobalID, s.globalOptions())
+	}
+
+	return s.global
+}
+
+// globalOptions are the options of the shared brain
+func (s *Store) globalOptions() Options {
+	opts := s.optionsFor(GlobalID)
+	// a brain file picked for the guilds isn't the shared one
+	opts.File = ""
+	// nor is it ever rebuilt, so there's no reason to keep what it learned
+	// word for word
+	opts.MessageLog = false
+
+	return opts
+}
+
+// loadedGlobal returns the shared brain if it is loaded
+func (s *Store) loadedGlobal() *Brain {
+	s.globalMu.Lock()
+	defer s.globalMu.Unlock()
+
+	return s.global
+}
+
+// Loaded returns a guild's brain if it is loaded, without counting as a use.
+// Background work uses it to leave idle brains unloaded.
+func (s *Store) Loaded(guildID snowflake.ID) *Brain {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.brains[guildID]
+}
+
+// Watches reports whether a guild's brain takes messages from a channel,
+// without loading it when the list of its channels is on disk. Brains saved
+// before the list existed are loaded to find out.
+func (s *Store) Watches(guildID, channelID snowflake.ID) bool {
+	if brain := s.Loaded(guildID); brain != nil {
+		return slices.Contains(brain.Watched(), channelID)
+	}
+
+	return s.channelsOf(guildID).watched[channelID]
+}
+
+// Learned reports whether a guild's brain learned from a channel, watched
+// or not anymore, like Watches without loading it.
+func (s *Store) Learned(guildID, channelID snowflake.ID) bool {
+	if brain := s.Loaded(guildID); brain != nil {
+		return brain.Span(channelID) != nil
+	}
+
+	return s.channelsOf(guildID).learned[channelID]
+}
+
+// channelSets are the channels of an unloaded brain
+type channelSets struct {
+	watched map[snowflake.ID]bool
+	learned map[snowflake.ID]bool
+}
+
+func setsOf(lists channelLists) channelSets {
+	return channelSets{watched: channelSet(lists.Watched), learned: channelSet(lists.Learned)}
+}
+
+func channelSet(channels []snowflake.ID) map[snowflake.ID]bool {
+	var set = make(map[snowflake.ID]bool)
+	for _, channelID := range channels {
+		set[channelID] = true
+	}
+
+	return set
+}
+
+// channelsOf looks up the channels of a guild's brain that isn't loaded, in
+// the lists saved next to it. Brains saved before there were lists are
+// loaded to find out.
+func (s *Store) channelsOf(guildID snowflake.ID) channelSets {
+	s.mu.Lock()
+	sets, ok := s.channels[guildID]
+	s.mu.Unlock()
+	if ok {
+		return sets
+	}
+
+	fn := s.optionsFor(guildID).path(guildID)
+	if _, err := os.Stat(fn); os.IsNotExist(err) {
+		sets = channelSets{}
+	} else if lists, err := readWatched(fn); err == nil {
+		sets = setsOf(lists)
+	} else {
+		brain := s.Get(guildID)
+
+		brain.mu.RLock()
+		defer brain.mu.RUnlock()
+		return setsOf(brain.channels())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// what was read may be stale once the brain is loaded
+	if s.brains[guildID] == nil {
+		s.channels[guildID] = sets
+	}
+	return sets
+}
+
+// Unload saves and drops the brains not asked for since idle before now, and
+// reports how many it unloaded. A brain that fails to save stays loaded, and
+// so does one asked for or changed while it was saved.
+func (s *Store) Unload(idle time.Duration, now time.Time) int {
+	s.mu.Lock()
+	for guildID, ref := range s.unloaded {
+		if ref.Value() == nil {
+			delete(s.unloaded, guildID)
+		}
+	}
+
+	type idleBrain struct {
+		brain *Brain
+		used  time.Time
+	}
+	var idleBrains = make(map[snowflake.ID]idleBrain)
+	for guildID, brain := range s.brains {
+		if now.Sub(s.used[guildID]) >= idle {
+			idleBrains[guildID] = idleBrain{brain: brain, used: s.used[guildID]}
+		}
+	}
+	s.mu.Unlock()
+
+	var unloaded int
+	for guildID, entry := range idleBrains {
+		brain := entry.brain
+		if brain.Dirty() {
+			if err := brain.Save(); err != nil {
+				storageLog.Error("Failed to save idle brain", slog.Any("guildID", guildID), slog.String("err", err.Error()))
+				continue
+			}
+		}
+
+		// what was forgotten mustn't wait in the log until the brain is
+		// used again
+		if err := brain.CompactLog(now); err != nil {
+			storageLog.Warn("Failed to compact message log of idle brain", slog.Any("guildID", guildID), slog.String("err", err.Error()))
+		}
+
+		if s.drop(guildID, brain, entry.used) {
+			unloaded++
+		}
+	}
+
+	return unloaded
+}
+
+// drop unloads a saved brain unless it was replaced, asked for since used,
+// changed since it was saved or is taking a change in
+func (s *Store) drop(guildID snowflake.ID, brain *Brain, used time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.brains[guildID] != brain || !s.used[guildID].Equal(used) {
+		return false
+	}
+
+	// restores take changes before the store, so this one mustn't wait
+	if !brain.changes.TryLock() {
+		return false
+	}
+	defer brain.changes.Unlock()
+
+	brain.mu.RLock()
+	defer brain.mu.RUnlock()
+
+	if brain.dirty {
+		return false
+	}
+
+	s.channels[guildID] = setsOf(brain.channels())
+	s.unloaded[guildID] = weak.Make(brain)
+	brain.unloaded.Store(true)
+	delete(s.brains, guildID)
+	delete(s.used, guildID)
+	return true
+}
+
+// UnloadIdle unloads brains unused for idle until ctx is done. An idle time
+// of zero or less keeps every brain loaded.
+func (s *Store) UnloadIdle(ctx context.Context, idle time.Duration) {
+	if idle <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(max(idle/4, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := s.Unload(idle, now); n > 0 {
+				storageLog.Info("Unloaded idle brains", slog.Int("count", n))
+			}
+		}
+	}
+}
+
+// All lists the loaded brains.
+func (s *Store) All() []*Brain {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Collect(maps.Values(s.brains))
+}
+
+// Flush saves every brain with unsaved changes, giving up after timeout.
+func (s *Store) Flush(timeout time.Duration) {
+	var brains = s.All()
+	if global := s.loadedGlobal(); global != nil {
+		brains = append(brains, global)
+	}
+
+	var wg sync.WaitGroup
+	for _, brain := range brains {
+		if !brain.Dirty() {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := brain.Save(); err != nil {
+				storageLog.Error("Failed to save brain", slog.Any("guildID", brain.GuildID), slog.String("err", err.Error()))
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		storageLog.Info("Saved all brains")
+	case <-time.After(timeout):
+		storageLog.Error("Timed out saving brains", slog.Duration("timeout", timeout))
+	}
+}
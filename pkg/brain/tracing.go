@@ -0,0 +1,23 @@
+package brain
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("github.com/schizoid/pkg/brain")
+
+// lock takes the write lock, tracing how long it was waited for
+func (b *Brain) lock(ctx context.Context) {
+	_, span := tracer.Start(ctx, "brain.Lock")
+	b.mu.Lock()
+	span.End()
+}
+
+// rlock takes the read lock, tracing how long it was waited for
+func (b *Brain) rlock(ctx context.Context) {
+	_, span := tracer.Start(ctx, "brain.RLock")
+	b.mu.RLock()
+	span.End()
+}
@@ -0,0 +1,100 @@
+package brain
+
+import (
+	"log/slog"
+	"regexp"
+	"slices"
+)
+
+// MaxTrainFilterLength caps the length of a guild's training filter patterns.
+const MaxTrainFilterLength = 200
+
+// TrainFilters lists the patterns of messages this guild never learns.
+func (b *Brain) TrainFilters() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return slices.Clone(b.Settings.TrainFilters)
+}
+
+// AddTrainFilter skips messages matching pattern when training from now on.
+// It reports false if the guild already had the pattern, and an error if
+// pattern is not a valid regular expression.
+func (b *Brain) AddTrainFilter(pattern string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if slices.Contains(b.Settings.TrainFilters, pattern) {
+		return false, nil
+	}
+
+	b.Settings.TrainFilters = append(b.Settings.TrainFilters, pattern)
+	b.trainFilters = append(b.trainFilters, re)
+	b.dirty = true
+
+	return true, nil
+}
+
+// RemoveTrainFilter learns messages matching pattern again, reporting false
+// if the guild didn't have the pattern.
+func (b *Brain) RemoveTrainFilter(pattern string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !slices.Contains(b.Settings.TrainFilters, pattern) {
+		return false
+	}
+
+	b.Settings.TrainFilters = slices.DeleteFunc(b.Settings.TrainFilters, func(p string) bool { return p == pattern })
+	b.compileTrainFiltersLocked()
+	b.dirty = true
+
+	return true
+}
+
+// compileTrainFilters compiles the guild's patterns, after loading the brain
+func (b *Brain) compileTrainFilters() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.compileTrainFiltersLocked()
+}
+
+func (b *Brain) compileTrainFiltersLocked() {
+	b.trainFilters = nil
+
+	for _, pattern := range b.Settings.TrainFilters {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			brainLog.Error("Ignoring invalid training filter", slog.Any("guildID", b.GuildID), slog.String("pattern", pattern), slog.String("err", err.Error()))
+			continue
+		}
+		b.trainFilters = append(b.trainFilters, re)
+	}
+}
+
+// filtered reports whether text matches a training filter of the deployment
+// or the guild
+func (b *Brain) filtered(text string) bool {
+	for _, re := range b.opts.TrainFilters {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, re := range b.trainFilters {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+
+	return false
+}
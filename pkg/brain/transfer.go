@@ -0,0 +1,154 @@
+package brain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/disgoorg/snowflake/v2"
+	"github.com/schizoid/pkg/ngram"
+)
+
+// BundleVersion is the version of the bundle format this build writes and
+// reads.
+const BundleVersion = 1
+
+// Bundle carries a guild brain to another deployment: the brain file as Save
+// wrote it, with its settings, opt-outs and import log inside, and enough
+// about it to check it arrived intact and lands in the right guild.
+type Bundle struct {
+	Version    int
+	GuildID    snowflake.ID
+	Backend    string
+	ExportedAt time.Time
+	Brain      []byte
+	Checksum   [sha256.Size]byte
+}
+
+// WriteBundle packs the brain stored in fn into w. The brain is decoded
+// first, so a corrupt file is caught before it leaves the deployment.
+func WriteBundle(w io.Writer, fn string) (Bundle, error) {
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return Bundle{}, err
+	}
+
+	// decoded as stored, since attaching a backend would report the
+	// configured one rather than the one the file was saved with
+	var brain Brain
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&brain); err != nil {
+		return Bundle{}, fmt.Errorf("reading brain: %w", err)
+	}
+
+	if brain.Backend == "" {
+		brain.Backend = ngram.Backend
+	}
+
+	bundle := Bundle{
+		Version:    BundleVersion,
+		GuildID:    brain.GuildID,
+		Backend:    brain.Backend,
+		ExportedAt: time.Now(),
+		Brain:      data,
+		Checksum:   sha256.Sum256(data),
+	}
+
+	if err := gob.NewEncoder(w).Encode(bundle); err != nil {
+		return Bundle{}, fmt.Errorf("writing bundle: %w", err)
+	}
+
+	return bundle, nil
+}
+
+// ReadBundle unpacks a bundle from r and checks it is intact.
+func ReadBundle(r io.Reader) (Bundle, error) {
+	var bundle Bundle
+	if err := gob.NewDecoder(r).Decode(&bundle); err != nil {
+		return bundle, fmt.Errorf("reading bundle: %w", err)
+	}
+
+	if bundle.Version != BundleVersion {
+		return bundle, fmt.Errorf("bundle format version %d is not supported, this build reads version %d", bundle.Version, BundleVersion)
+	}
+
+	if sha256.Sum256(bundle.Brain) != bundle.Checksum {
+		return bundle, errors.New("bundle checksum mismatch, the file is damaged")
+	}
+
+	return bundle, nil
+}
+
+// Unbundle restores the brain in a bundle as guildID's. A bundle made in
+// another guild only lands when remap is set: the brain then forgets
+// everything tied to the old guild's channels, which don't exist in the new
+// one, and the new guild's admins have to accept the privacy policy again.
+// Members keep their IDs across guilds, so their profiles and opt-outs stay.
+func (bundle Bundle) Unbundle(guildID snowflake.ID, opts Options, remap bool) (*Brain, error) {
+	var backend = opts.Backend
+	if backend == "" {
+		backend = ngram.Backend
+	}
+
+	// another backend would start untrained and drop the bundled state
+	if bundle.Backend != backend {
+		return nil, fmt.Errorf("bundle uses the %s backend but this deployment is set up for %s", bundle.Backend, backend)
+	}
+
+	brain, err := decode(bundle.Brain, opts)
+	if err != nil {
+		return nil, fmt.Errorf("decoding brain: %w", err)
+	}
+
+	if brain.GuildID != bundle.GuildID {
+		return nil, fmt.Errorf("bundle claims guild %s but holds the brain of guild %s", bundle.GuildID, brain.GuildID)
+	}
+
+	if guildID != brain.GuildID {
+		if !remap {
+			return nil, fmt.Errorf("bundle is for guild %s, not %s", brain.GuildID, guildID)
+		}
+
+		storageLog.Warn(
+			"Remapping brain to another guild, dropping its channel state",
+			slog.Any("from", brain.GuildID),
+			slog.Any("to", guildID),
+			slog.Int("channels", len(brain.ChannelWhitelist)),
+			slog.Int("trainedSpans", len(brain.TrainedSpans)),
+		)
+
+		brain.remap(guildID)
+	}
+
+	brain.dirty = true
+	return brain, nil
+}
+
+// remap moves the brain to another guild
+func (b *Brain) remap(guildID snowflake.ID) {
+	b.GuildID = guildID
+
+	clear(b.ChannelWhitelist)
+	clear(b.TrainedSpans)
+	clear(b.ChannelTopics)
+	clear(b.ChannelModels)
+	clear(b.Revived)
+	clear(b.DayPhrases)
+	clear(b.Digested)
+	clear(b.PerChannel)
+	b.PastRules = nil
+	b.Settings.PlaygroundChannel = 0
+	b.Settings.LogChannel = 0
+	// most likely one of the old guild's own emojis
+	b.Settings.TriggerReaction = ""
+
+	b.Settings.ConsentVersion = 0
+	b.Settings.ConsentedBy = 0
+	b.Settings.ConsentedAt = time.Time{}
+	b.Settings.NoticeVersion = 0
+}
@@ -0,0 +1,96 @@
+package brain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// the file next to a brain listing the channels it takes messages from and
+// those it learned from, so a store can tell whether a message concerns a
+// guild without loading the whole brain
+const watchedSuffix = ".watched"
+
+// channelLists are the lists of channels saved next to a brain
+type channelLists struct {
+	Watched []snowflake.ID
+	// the channels with learned history, whose deleted messages are
+	// forgotten whether or not they are still watched
+	Learned []snowflake.ID
+}
+
+// channels returns the lists of the brain's channels. The caller holds at
+// least the read lock.
+func (b *Brain) channels() channelLists {
+	return channelLists{Watched: b.watched(), Learned: slices.Collect(maps.Keys(b.TrainedSpans))}
+}
+
+// Watched lists the channels whose messages the brain takes in: the watched
+// ones, those it replies in unprompted and the playground.
+func (b *Brain) Watched() []snowflake.ID {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.watched()
+}
+
+func (b *Brain) watched() []snowflake.ID {
+	var channels []snowflake.ID
+	for channelID, watched := range b.ChannelWhitelist {
+		if watched {
+			channels = append(channels, channelID)
+		}
+	}
+
+	for channelID, settings := range b.PerChannel {
+		if settings.AutoReply && !b.ChannelWhitelist[channelID] {
+			channels = append(channels, channelID)
+		}
+	}
+
+	if b.Settings.PlaygroundChannel != 0 {
+		channels = append(channels, b.Settings.PlaygroundChannel)
+	}
+
+	return channels
+}
+
+// saveWatched writes the lists of channels next to the brain file fn.
+// Without them the store loads the brain to find out, so a failed write only
+// costs memory and the stale lists are removed.
+func saveWatched(fn string, channels channelLists) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(channels)
+	if err == nil {
+		err = os.WriteFile(fn+watchedSuffix+".tmp", buffer.Bytes(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(fn+watchedSuffix+".tmp", fn+watchedSuffix)
+	}
+
+	if err != nil {
+		storageLog.Warn("Failed to save watched channels", slog.String("file", fn), slog.String("err", err.Error()))
+		os.Remove(fn + watchedSuffix)
+	}
+}
+
+// readWatched reads the lists of channels saved next to the brain file fn.
+// Files from before the learned channels were listed fail to decode.
+func readWatched(fn string) (channelLists, error) {
+	data, err := os.ReadFile(fn + watchedSuffix)
+	if err != nil {
+		return channelLists{}, err
+	}
+
+	var channels channelLists
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&channels); err != nil {
+		return channelLists{}, err
+	}
+
+	return channels, nil
+}
@@ -0,0 +1,78 @@
+// Package corpus reads chat history exported from other platforms so it can
+// be imported into a brain.
+package corpus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Record is one imported message.
+type Record struct {
+	// platform id of the author if the export has one, else their name
+	Author string
+	Text   string
+}
+
+// Formats lists the formats Read understands.
+var Formats = []string{"lines", "telegram", "whatsapp"}
+
+// Read parses an export in the given format.
+func Read(r io.Reader, format string) ([]Record, error) {
+	switch format {
+	case "lines":
+		return readLines(r)
+	case "telegram":
+		return readTelegram(r)
+	case "whatsapp":
+		return readWhatsApp(r)
+	default:
+		return nil, fmt.Errorf("unknown corpus format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// readLines treats every non-empty line as an anonymous message
+func readLines(r io.Reader) ([]Record, error) {
+	var records []Record
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			records = append(records, Record{Text: line})
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+// ReadAuthorMap reads a file of "author = user id" lines with # comments,
+// mapping export authors onto the users their per-user models belong to.
+func ReadAuthorMap(fn string) (map[string]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var authors = make(map[string]string)
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		author, id, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected author = user id", fn, n)
+		}
+
+		authors[strings.TrimSpace(author)] = strings.TrimSpace(id)
+	}
+
+	return authors, scanner.Err()
+}
@@ -0,0 +1,89 @@
+package corpus
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// telegramExport covers both a single chat's result.json and a full account
+// export, which lists every chat
+type telegramExport struct {
+	Messages []telegramMessage `json:"messages"`
+	Chats    struct {
+		List []struct {
+			Messages []telegramMessage `json:"messages"`
+		} `json:"list"`
+	} `json:"chats"`
+}
+
+type telegramMessage struct {
+	Type   string          `json:"type"`
+	From   string          `json:"from"`
+	FromID string          `json:"from_id"`
+	Text   json.RawMessage `json:"text"`
+}
+
+// telegramText flattens a message's text, which is either a string or a list
+// of strings and formatted entities
+func telegramText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, part := range parts {
+		var entity struct {
+			Text string `json:"text"`
+		}
+
+		if err := json.Unmarshal(part, &text); err == nil {
+			sb.WriteString(text)
+		} else if err := json.Unmarshal(part, &entity); err == nil {
+			sb.WriteString(entity.Text)
+		}
+	}
+
+	return sb.String()
+}
+
+// readTelegram parses a Telegram Desktop JSON export
+func readTelegram(r io.Reader) ([]Record, error) {
+	var export telegramExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, err
+	}
+
+	messages := export.Messages
+	for _, chat := range export.Chats.List {
+		messages = append(messages, chat.Messages...)
+	}
+
+	var records []Record
+	for _, msg := range messages {
+		// service messages (joins, pins, calls) have no author text
+		if msg.Type != "message" {
+			continue
+		}
+
+		text := strings.TrimSpace(telegramText(msg.Text))
+		if text == "" {
+			continue
+		}
+
+		author := msg.FromID
+		if author == "" {
+			author = msg.From
+		}
+
+		records = append(records, Record{Author: author, Text: text})
+	}
+
+	return records, nil
+}
@@ -0,0 +1,79 @@
+package corpus
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// whatsAppLine matches the timestamp starting a message in both the Android
+// ("31/12/2020, 21:41 - ") and iOS ("[31/12/2020, 21:41:05] ") exports
+var whatsAppLine = regexp.MustCompile(`^\x{200e}?\[?\d{1,4}[./-]\d{1,2}[./-]\d{1,4},? \d{1,2}:\d{2}(?::\d{2})?(?:\s?[AaPp]\.?\s?[Mm]\.?)?\]?(?: -|:)? `)
+
+// placeholders WhatsApp writes instead of content that wasn't exported
+var whatsAppOmitted = []string{
+	"<Media omitted>",
+	"<attached:",
+	"image omitted",
+	"video omitted",
+	"audio omitted",
+	"sticker omitted",
+	"This message was deleted",
+	"You deleted this message",
+}
+
+// readWhatsApp parses a WhatsApp "export chat" text file. Lines without a
+// timestamp continue the previous message.
+func readWhatsApp(r io.Reader) ([]Record, error) {
+	var records []Record
+	var current *Record
+
+	var flush = func() {
+		if current == nil {
+			return
+		}
+
+		current.Text = strings.TrimSpace(current.Text)
+		if current.Text != "" && !isWhatsAppPlaceholder(current.Text) {
+			records = append(records, *current)
+		}
+		current = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		loc := whatsAppLine.FindStringIndex(line)
+		if loc == nil {
+			if current != nil {
+				current.Text += "\n" + line
+			}
+			continue
+		}
+
+		flush()
+
+		// system messages (encryption notices, joins) have no author
+		author, text, ok := strings.Cut(line[loc[1]:], ": ")
+		if !ok {
+			continue
+		}
+
+		current = &Record{Author: strings.TrimSpace(author), Text: text}
+	}
+	flush()
+
+	return records, scanner.Err()
+}
+
+func isWhatsAppPlaceholder(text string) bool {
+	for _, placeholder := range whatsAppOmitted {
+		if strings.Contains(text, placeholder) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,278 @@
+// Package denylist loads per-locale word lists and finds or masks their terms
+// in text.
+package denylist
+
+import (
+	"bufio"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// how often the pack directory is checked for changed files
+const reloadInterval = 30 * time.Second
+
+// Packs holds per-locale word lists loaded from <dir>/<locale>.txt, one term
+// per line with # comments. It is safe for concurrent use.
+type Packs struct {
+	mu      sync.RWMutex
+	packs   map[string][]string
+	modTime map[string]time.Time
+}
+
+// NewPacks creates an empty set of packs.
+func NewPacks() *Packs {
+	return &Packs{
+		packs:   make(map[string][]string),
+		modTime: make(map[string]time.Time),
+	}
+}
+
+func readDenylist(fn string) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var terms []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line != "" {
+			terms = append(terms, line)
+		}
+	}
+
+	return terms, scanner.Err()
+}
+
+// Load (re)reads every pack in dir whose file changed since the last load.
+func (d *Packs) Load(dir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		slog.Error("Failed to list denylist packs", slog.String("err", err.Error()))
+		return
+	}
+
+	var seen = make(map[string]bool)
+
+	for _, fn := range files {
+		locale := strings.TrimSuffix(filepath.Base(fn), ".txt")
+		seen[locale] = true
+
+		info, err := os.Stat(fn)
+		if err != nil {
+			continue
+		}
+
+		d.mu.RLock()
+		unchanged := d.modTime[locale].Equal(info.ModTime())
+		d.mu.RUnlock()
+
+		if unchanged {
+			continue
+		}
+
+		terms, err := readDenylist(fn)
+		if err != nil {
+			slog.Error("Failed to read denylist pack", slog.String("file", fn), slog.String("err", err.Error()))
+			continue
+		}
+
+		d.mu.Lock()
+		d.packs[locale] = terms
+		d.modTime[locale] = info.ModTime()
+		d.mu.Unlock()
+
+		slog.Info("Loaded denylist pack", slog.String("locale", locale), slog.Int("terms", len(terms)))
+	}
+
+	// drop packs whose files were removed
+	d.mu.Lock()
+	for locale := range d.packs {
+		if !seen[locale] {
+			delete(d.packs, locale)
+			delete(d.modTime, locale)
+		}
+	}
+	d.mu.Unlock()
+}
+
+// Watch reloads packs from dir whenever their files change. It never returns.
+func (d *Packs) Watch(dir string) {
+	for {
+		time.Sleep(reloadInterval)
+		d.Load(dir)
+	}
+}
+
+// Available lists the loaded locales in order.
+func (d *Packs) Available() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var locales []string
+	for locale := range d.packs {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+
+	return locales
+}
+
+// Has reports whether a pack for locale is loaded.
+func (d *Packs) Has(locale string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.packs[locale]
+	return ok
+}
+
+// Terms merges the packs for the given locales.
+func (d *Packs) Terms(locales []string) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var terms []string
+	for _, locale := range locales {
+		terms = append(terms, d.packs[locale]...)
+	}
+
+	return terms
+}
+
+// Word is a word of text and its byte offsets.
+type Word struct {
+	Text       string
+	Start, End int
+}
+
+// SplitWords splits text into runs of letters, digits and apostrophes.
+func SplitWords(text string) []Word {
+	var words []Word
+	var start = -1
+
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\''
+
+		if inWord && start < 0 {
+			start = i
+		} else if !inWord && start >= 0 {
+			words = append(words, Word{text[start:i], start, i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, Word{text[start:], start, len(text)})
+	}
+
+	return words
+}
+
+// FindTerms returns the byte spans of whole-word, case-insensitive matches of
+// any of terms in text. Terms may span several words.
+func FindTerms(text string, terms []string) [][2]int {
+	var spans [][2]int
+
+	words := SplitWords(text)
+
+	for _, term := range terms {
+		termWords := strings.Fields(term)
+		if len(termWords) == 0 {
+			continue
+		}
+
+		for i := 0; i+len(termWords) <= len(words); i++ {
+			matched := true
+			for j, tw := range termWords {
+				if !strings.EqualFold(words[i+j].Text, tw) {
+					matched = false
+					break
+				}
+			}
+
+			if matched {
+				spans = append(spans, [2]int{words[i].Start, words[i+len(termWords)-1].End})
+			}
+		}
+	}
+
+	return spans
+}
+
+// Censor masks every match of terms in text.
+func Censor(text string, terms []string) string {
+	var out = []byte(text)
+
+	for _, span := range FindTerms(text, terms) {
+		for i := span[0]; i < span[1]; i++ {
+			out[i] = '*'
+		}
+	}
+
+	return string(out)
+}
+
+// Stream censors text that arrives piece by piece. Words that could still
+// turn out to be part of a term are held back until later pieces show
+// whether they are.
+type Stream struct {
+	terms []string
+	// words to hold back, the most any term spans
+	hold int
+	text string
+	// bytes of text already handed out
+	sent int
+}
+
+// NewStream creates a stream censoring terms.
+func NewStream(terms []string) *Stream {
+	var hold int
+	for _, term := range terms {
+		hold = max(hold, len(strings.Fields(term)))
+	}
+
+	return &Stream{terms: terms, hold: hold}
+}
+
+// Write adds a piece of text and returns the censored text that is safe to
+// show so far.
+func (s *Stream) Write(piece string) string {
+	s.text += piece
+
+	var safe = len(s.text)
+	if s.hold > 0 {
+		words := SplitWords(s.text)
+
+		safe = 0
+		if len(words) >= s.hold {
+			safe = words[len(words)-s.hold].Start
+		}
+	}
+
+	return s.advance(safe)
+}
+
+// Flush returns the rest of the censored text once no more pieces follow.
+func (s *Stream) Flush() string {
+	return s.advance(len(s.text))
+}
+
+func (s *Stream) advance(to int) string {
+	if to <= s.sent {
+		return ""
+	}
+
+	out := Censor(s.text, s.terms)[s.sent:to]
+	s.sent = to
+
+	return out
+}
@@ -0,0 +1,40 @@
+package ngram
+
+import (
+	"encoding/gob"
+	"io"
+
+	"github.com/schizoid/pkg/textmodel"
+)
+
+// Backend is the name the character n-gram model is registered under.
+const Backend = "ngram"
+
+func init() {
+	textmodel.Register(Backend, func(opts textmodel.Options) textmodel.TextModel {
+		return New(NewCharTokenizer(nil), opts.Order, opts.Smoothing)
+	})
+}
+
+// Save writes the model with gob.
+func (m *Model) Save(w io.Writer) error {
+	defer m.Hold()()
+
+	m.Flatten()
+	defer func() { m.Counts, m.Imported = nil, nil }()
+
+	return gob.NewEncoder(w).Encode(m)
+}
+
+// Load replaces the model with one written by Save.
+func (m *Model) Load(r io.Reader) error {
+	var loaded Model
+	if err := gob.NewDecoder(r).Decode(&loaded); err != nil {
+		return err
+	}
+
+	loaded.Unflatten()
+
+	*m = loaded
+	return nil
+}
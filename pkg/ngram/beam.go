@@ -0,0 +1,132 @@
+package ngram
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// MaxBeamWidth is the most continuations beam search keeps at once.
+const MaxBeamWidth = 16
+
+// hypothesis is a continuation beam search is considering
+type hypothesis struct {
+	text string
+	// the text of each token of the continuation, kept as text since ids
+	// shift as the vocabulary grows
+	pieces  []string
+	logProb float64
+	done    bool
+}
+
+// score is the hypothesis' log probability per token, so longer
+// continuations aren't beaten by short ones for having more factors
+func (h hypothesis) score() float64 {
+	return h.logProb / float64(len(h.pieces)+1)
+}
+
+// repeats reports whether the last n tokens of the hypothesis already
+// appeared earlier in it. Beam search over n-grams otherwise settles into the
+// likeliest loop and says it until it runs out of length.
+func (h hypothesis) repeats(n int) bool {
+	if n < 1 || len(h.pieces) < n+1 {
+		return false
+	}
+
+	var tail = h.pieces[len(h.pieces)-n:]
+	for i := 0; i+n < len(h.pieces); i++ {
+		if slices.Equal(h.pieces[i:i+n], tail) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Beam decodes up to length tokens following seed with beam search, keeping
+// the width likeliest continuations at every step, and returns the seed
+// followed by the likeliest one. Unlike Generate it always gives the same
+// text for the same seed. It stops early once alive returns false.
+func (m *Model) Beam(seed string, length, width int, alive func() bool) string {
+	width = min(max(width, 1), MaxBeamWidth)
+
+	var beams = []hypothesis{{text: seed}}
+
+	for range length {
+		if !alive() {
+			break
+		}
+
+		candidates, expanded := m.expand(beams, width)
+
+		if !expanded || len(candidates) == 0 {
+			break
+		}
+
+		slices.SortStableFunc(candidates, func(a, b hypothesis) int {
+			return cmp.Compare(b.score(), a.score())
+		})
+		beams = candidates[:min(width, len(candidates))]
+	}
+
+	return beams[0].text
+}
+
+// expand extends every beam that isn't done by its width likeliest tokens,
+// reporting false when every beam was done
+func (m *Model) expand(beams []hypothesis, width int) ([]hypothesis, bool) {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	var candidates []hypothesis
+	var expanded bool
+	for _, beam := range beams {
+		if beam.done {
+			candidates = append(candidates, beam)
+			continue
+		}
+		expanded = true
+
+		probs := m.probs(beam.text)
+		m.maskSpecial(probs)
+
+		for _, tok := range topTokens(probs, width) {
+			next := hypothesis{
+				logProb: beam.logProb + math.Log(probs[tok]),
+			}
+
+			if tok == EndOfText {
+				next.text = beam.text
+				next.pieces = append(slices.Clone(beam.pieces), "")
+				next.done = true
+			} else {
+				piece := m.decode([]Token{tok})
+				next.text = beam.text + piece
+				next.pieces = append(slices.Clone(beam.pieces), piece)
+				if next.repeats(m.N) {
+					continue
+				}
+			}
+
+			candidates = append(candidates, next)
+		}
+	}
+
+	return candidates, expanded
+}
+
+// topTokens returns up to k tokens with a chance, likeliest first
+func topTokens(probs []float64, k int) []Token {
+	var tokens []Token
+	for i, prob := range probs {
+		if prob > 0 {
+			tokens = append(tokens, Token(i))
+		}
+	}
+
+	slices.SortStableFunc(tokens, func(a, b Token) int {
+		return cmp.Compare(probs[b], probs[a])
+	})
+
+	return tokens[:min(k, len(tokens))]
+}
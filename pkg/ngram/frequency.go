@@ -0,0 +1,23 @@
+package ngram
+
+import "math"
+
+// Frequency estimates how often text came up in training: the count of its
+// least seen n-gram of the model's full order, or of text as a whole when it
+// is shorter. Imported counts are weighed in.
+func (m *Model) Frequency(text string) float64 {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	tokens := m.encode(text)
+	if len(tokens) == 0 {
+		return 0
+	}
+
+	least := math.Inf(1)
+	for _, ngram := range ngrams(tokens, min(m.N, len(tokens))) {
+		least = min(least, m.countOf(ngram))
+	}
+
+	return least
+}
@@ -0,0 +1,126 @@
+package ngram
+
+import (
+	"math"
+	"sync"
+)
+
+// counts up to this one are discounted by Good-Turing, higher ones are
+// reliable as they are
+const goodTuringMax = 5
+
+// discounts caches how many n-grams of each order were seen each number of
+// times, which Good-Turing discounting works from
+type discounts struct {
+	mu sync.Mutex
+	// what the model counted when they were worked out
+	total float64
+	// countsOfCounts[n][r] is how many n-grams of order n were seen r times
+	countsOfCounts [][goodTuringMax + 2]float64
+}
+
+// SetGoodTuring picks Good-Turing discounting instead of additive smoothing:
+// the n-grams seen a few times give up some of their count to the ones never
+// seen, as much as the n-grams seen once suggest is missing. The choice isn't
+// saved with the model.
+func (m *Model) SetGoodTuring(on bool) {
+	m.goodTuring = on
+}
+
+// countsOfCounts returns how many n-grams of each order were seen each number
+// of times up to goodTuringMax+1, worked out again once the model's counts
+// changed by a tenth
+func (m *Model) countsOfCounts() [][goodTuringMax + 2]float64 {
+	d := &m.state.discounts
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	total := m.total()
+	if d.countsOfCounts != nil && math.Abs(total-d.total) <= d.total/10 {
+		return d.countsOfCounts
+	}
+
+	var out = make([][goodTuringMax + 2]float64, m.N+1)
+	var seen = make(map[string]uint64)
+	m.eachShard(func(s *shard) {
+		for _, counts := range []map[string]uint64{s.counts, s.imported} {
+			for key, count := range counts {
+				seen[key] += count
+			}
+		}
+	})
+	for key, count := range seen {
+		if n := m.order(key); n <= m.N && count > 0 && count <= goodTuringMax+1 {
+			out[n][count]++
+		}
+	}
+
+	d.total, d.countsOfCounts = total, out
+	return out
+}
+
+// discounted is the Good-Turing estimate of a count of an order-n n-gram, in
+// Katz's form that leaves counts above goodTuringMax as they are. Counts the
+// estimate doesn't hold up for are kept too.
+func discounted(countsOfCounts [goodTuringMax + 2]float64, count float64) float64 {
+	r := int(count)
+	if r < 1 || r > goodTuringMax || float64(r) != count {
+		return count
+	}
+
+	n1, nr, next := countsOfCounts[1], countsOfCounts[r], countsOfCounts[r+1]
+	if n1 <= 0 || nr <= 0 || next <= 0 {
+		return count
+	}
+
+	cutoff := float64(goodTuringMax+1) * countsOfCounts[goodTuringMax+1] / n1
+	estimate := (float64(r+1)*next/nr - count*cutoff) / (1 - cutoff)
+	if cutoff >= 1 || estimate <= 0 || estimate > count {
+		return count
+	}
+
+	return estimate
+}
+
+// goodTuringProbs is orderProbs with Good-Turing discounting: the seen tokens
+// get their discounted counts and the tokens never seen after context share
+// what that leaves
+func (m *Model) goodTuringProbs(context []Token, vocabSize int) ([]float64, bool) {
+	var probs = make([]float64, vocabSize)
+
+	var total float64
+	if len(context) > 0 {
+		total = m.countOf(context)
+	} else {
+		total = m.unigramTotal(vocabSize, 0)
+	}
+	if total <= 0 {
+		return probs, false
+	}
+
+	countsOfCounts := m.countsOfCounts()[len(context)+1]
+	var continuation = append(context[:len(context):len(context)], 0)
+	var seen float64
+	var unseen int
+	for i := range probs {
+		continuation[len(context)] = Token(i)
+		if count := m.countOf(continuation); count > 0 {
+			probs[i] = discounted(countsOfCounts, count) / total
+			seen += probs[i]
+		} else {
+			unseen++
+		}
+	}
+
+	if unseen == 0 || seen >= 1 {
+		return Normalize(probs), true
+	}
+
+	for i := range probs {
+		if probs[i] == 0 {
+			probs[i] = (1 - seen) / float64(unseen)
+		}
+	}
+
+	return probs, true
+}
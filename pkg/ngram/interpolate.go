@@ -0,0 +1,178 @@
+package ngram
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+)
+
+// Distinctive finds the full-order n-grams the author model uses much more than
+// the base model, ranked by smoothed log-odds.
+func Distinctive(author, base *Model, limit int) []string {
+	type scored struct {
+		ngram string
+		score float64
+	}
+
+	var candidates []scored
+	authorTotal, _ := author.Totals()
+	baseTotal, _ := base.Totals()
+
+	for ngram, count := range author.organic() {
+		// only full-order n-grams seen more than once say anything about style
+		if count < 2 || strings.Contains(ngram, "<|") || author.orderOf(ngram) != author.N {
+			continue
+		}
+
+		baseCount, _ := base.counts(ngram)
+		var authorRate = (float64(count) + 1) / float64(authorTotal+1)
+		var baseRate = (float64(baseCount) + 1) / float64(baseTotal+1)
+		candidates = append(candidates, scored{ngram, math.Log(authorRate / baseRate)})
+	}
+
+	slices.SortFunc(candidates, func(a, b scored) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), strings.Compare(a.ngram, b.ngram))
+	})
+
+	var out []string
+	for _, c := range candidates[:min(limit, len(candidates))] {
+		out = append(out, c.ngram)
+	}
+
+	return out
+}
+
+// Normalize scales probs in place to sum to one and returns it.
+func Normalize(probs []float64) []float64 {
+	var total float64
+	for _, p := range probs {
+		total += p
+	}
+
+	if total > 0 {
+		for i := range probs {
+			probs[i] /= total
+		}
+	}
+
+	return probs
+}
+
+// idMap maps the base model's token ids onto the author model's, -1 for
+// tokens the author doesn't have, as of the vocabularies' versions
+type idMap struct {
+	ids          []Token
+	base, author uint64
+}
+
+// get returns the mapping, working it out again if either vocabulary changed
+// since. The caller holds both vocab locks.
+func (m *idMap) get(base, author *Model) []Token {
+	if m.ids != nil && m.base == base.state.version && m.author == author.state.version {
+		return m.ids
+	}
+
+	m.ids = make([]Token, base.vocabSize())
+	for i := range m.ids {
+		if name, special := base.specialName(Token(i)); special {
+			m.ids[i] = author.specialID(name)
+		} else if encoded := author.encode(base.decode([]Token{Token(i)})); len(encoded) == 1 {
+			m.ids[i] = encoded[0]
+		} else {
+			m.ids[i] = -1
+		}
+	}
+	m.base, m.author = base.state.version, author.state.version
+
+	return m.ids
+}
+
+// interpolateNext samples the token following text for Interpolate, which
+// generated was the text of the tokens generated so far of, reporting false
+// for the end of text
+func interpolateNext(base, author *Model, idMap *idMap, text string, generated []string) (string, bool) {
+	// the base before the author, which is the order every caller has them in
+	base.state.vocab.RLock()
+	defer base.state.vocab.RUnlock()
+	author.state.vocab.RLock()
+	defer author.state.vocab.RUnlock()
+
+	var ids = idMap.get(base, author)
+	baseProbs := Normalize(base.probs(text))
+	authorProbs := Normalize(author.probs(text))
+	lambda := authorWeight(author, base, text)
+
+	var mixed = make([]float64, len(ids))
+	for i := range mixed {
+		var authorProb float64
+		if t := ids[i]; t >= 0 && int(t) < len(authorProbs) {
+			authorProb = authorProbs[t]
+		}
+		mixed[i] = lambda*authorProb + (1-lambda)*baseProbs[i]
+	}
+
+	base.maskSpecial(mixed)
+	base.penalizeRepetition(mixed, base.tokensOf(generated[max(0, len(generated)-repetitionWindow):]))
+
+	sampled := Token(Sample(mixed))
+	if sampled == EndOfText {
+		return "", false
+	}
+
+	return base.decode([]Token{sampled}), true
+}
+
+// authorWeight decides how much to trust the author's sub-model for the context
+// ending text: the log-odds of the author using that context versus the base,
+// squashed to 0..1 and scaled down while the author has barely used it. The
+// caller holds both vocab locks.
+func authorWeight(author, base *Model, text string) float64 {
+	context := base.contextKey(text)
+	if context == "" {
+		return 0.5
+	}
+
+	authorOrganic, _ := author.counts(context)
+	baseOrganic, _ := base.counts(context)
+	authorTotal, _ := author.Totals()
+	baseTotal, _ := base.Totals()
+
+	var authorCount = float64(authorOrganic)
+	var baseCount = float64(baseOrganic)
+
+	logOdds := math.Log((authorCount+1)/(float64(authorTotal)+1)) - math.Log((baseCount+1)/(float64(baseTotal)+1))
+	confidence := authorCount / (authorCount + 1)
+
+	return confidence / (1 + math.Exp(-logOdds))
+}
+
+// Interpolate generates text in the author model's style by mixing it with the
+// base model one token at a time, weighted by how distinctive the current
+// context is for the author, so small corpora still produce recognizable
+// output.
+func Interpolate(base, author *Model, seed string, length int) string {
+	var out = seed
+	var generated []string
+	var ids idMap
+
+	for i := range length {
+		next, ok := interpolateNext(base, author, &ids, out, generated)
+		if !ok {
+			break
+		}
+
+		out += next
+		generated = append(generated, next)
+
+		if base.stopsAt(out, len(generated)) {
+			break
+		}
+
+		if i == length-1 {
+			out = seed + trimWord(out[len(seed):])
+		}
+	}
+
+	return out
+}
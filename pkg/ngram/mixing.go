@@ -0,0 +1,158 @@
+package ngram
+
+import (
+	"strings"
+)
+
+// SetInterpolation makes predictions mix every order up to the model's, the
+// order k one weighted by weights[k-1], instead of only using the highest
+// order. Orders without a weight, or whose context is shorter than the text
+// predicted from or was never seen, are left out and the rest of the weights
+// scaled up to make up for them, so sparse contexts fall back on lower-order
+// statistics smoothly. Nil turns it off. The weights aren't saved with the
+// model.
+func (m *Model) SetInterpolation(weights []float64) {
+	m.interpolation = weights
+}
+
+// EstimateInterpolation works out interpolation weights from the model's own
+// counts by deleted interpolation: every full-order n-gram votes, as often
+// as it was seen, for the order that best predicts its last token with that
+// n-gram taken out of the counts, so orders only predicting well because of
+// the n-gram itself don't get the credit. It returns nil while the model
+// hasn't seen any full-order n-gram.
+func (m *Model) EstimateInterpolation() []float64 {
+	var weights = make([]float64, m.N)
+	var voted bool
+
+	m.state.vocab.RLock()
+	unigrams := m.unigramTotal(m.vocabSize(), 0)
+	m.state.vocab.RUnlock()
+
+	for key, count := range m.organic() {
+		// special tokens are spelled out in keys and don't encode back
+		if strings.Contains(key, "<|") {
+			continue
+		}
+
+		if best := m.bestOrder(key, unigrams); best > 0 {
+			weights[best-1] += float64(count)
+			voted = true
+		}
+	}
+
+	if !voted {
+		return nil
+	}
+
+	return Normalize(weights)
+}
+
+// bestOrder is the order predicting the last token of a full-order n-gram
+// best with the n-gram taken out of the counts, 0 for none or a key of
+// another order
+func (m *Model) bestOrder(key string, unigrams float64) int {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	tokens := m.encode(key)
+	if len(tokens) != m.N || m.order(key) != m.N {
+		return 0
+	}
+
+	var best, bestRate = 0, 0.0
+	for k := 1; k <= m.N; k++ {
+		ngram, context := tokens[m.N-k:], tokens[m.N-k:m.N-1]
+
+		var total = unigrams - 1
+		if len(context) > 0 {
+			total = m.countOf(context) - 1
+		}
+		if total <= 0 {
+			continue
+		}
+
+		if rate := (m.countOf(ngram) - 1) / total; rate > bestRate {
+			best, bestRate = k, rate
+		}
+	}
+
+	return best
+}
+
+// interpolationWeight is the weight of order k, 0 when it isn't mixed in
+func (m *Model) interpolationWeight(k int) float64 {
+	if k < 1 || k > len(m.interpolation) {
+		return 0
+	}
+
+	return max(0, m.interpolation[k-1])
+}
+
+// orderProbs is the distribution of the token following context by the
+// order of context alone, reporting false when context was never seen
+func (m *Model) orderProbs(context []Token, vocabSize int) ([]float64, bool) {
+	if m.goodTuring {
+		return m.goodTuringProbs(context, vocabSize)
+	}
+
+	var probs = make([]float64, vocabSize)
+
+	var total = m.unigramTotal(vocabSize, m.Smoothing)
+	if len(context) > 0 {
+		total = m.countOf(context) + float64(vocabSize)*m.Smoothing
+	}
+	if total <= 0 {
+		return probs, false
+	}
+
+	var continuation = append(context[:len(context):len(context)], 0)
+	for i := range probs {
+		continuation[len(context)] = Token(i)
+		probs[i] = (m.countOf(continuation) + m.Smoothing) / total
+	}
+
+	return probs, true
+}
+
+// unigramTotal adds up the counts of every token, each smoothed. The model's
+// total counts the n-grams of every order, too many to mix the unigrams by.
+func (m *Model) unigramTotal(vocabSize int, smoothing float64) float64 {
+	var total float64
+	for i := range vocabSize {
+		total += m.countOf([]Token{Token(i)}) + smoothing
+	}
+
+	return total
+}
+
+// interpolatedProbs is Probs mixing every order
+func (m *Model) interpolatedProbs(context []Token, vocabSize int) []float64 {
+	var probs = make([]float64, vocabSize)
+	var sum float64
+
+	for k := 1; k <= min(len(context)+1, m.N); k++ {
+		weight := m.interpolationWeight(k)
+		if weight <= 0 {
+			continue
+		}
+
+		order, ok := m.orderProbs(context[len(context)-k+1:], vocabSize)
+		if !ok {
+			continue
+		}
+
+		for i, p := range order {
+			probs[i] += weight * p
+		}
+		sum += weight
+	}
+
+	if sum > 0 {
+		for i := range probs {
+			probs[i] /= sum
+		}
+	}
+
+	return probs
+}
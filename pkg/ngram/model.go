@@ -0,0 +1,785 @@
+package ngram
+
+import (
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// Model counts every n-gram up to order N of the text it's trained on. Counts
+// are keyed by spelled-out text so they survive vocabulary changes. Training,
+// forgetting, prediction and changing entities are safe for concurrent use, and
+// so is flattening while the model is held; pruning is not.
+//
+// Token ids shift whenever the vocabulary grows, so everything working from
+// ids holds the vocabulary for reading from encoding to the last decode or
+// count, and generation carries what it generated from one token to the next
+// as text.
+type Model struct {
+	// the counts as saved, empty while the model is in use, see Flatten
+	Counts map[string]uint64
+
+	Tokenizer Tokenizer
+	N         int
+	Smoothing float64
+
+	Total int
+
+	// counts learned from imported history, kept apart so they can be
+	// weighted differently or purged
+	Imported      map[string]uint64
+	ImportedTotal int
+
+	// how much an imported count is worth relative to an organic one, nil
+	// for the same
+	importWeight *float64
+	// what sampling divides the probability of repeating tokens by, see
+	// SetRepetitionPenalty
+	repetitionPenalty float64
+	// tokens after which generation ends with the sentence, nil to never,
+	// see SetSentenceStop
+	sentenceStop *int
+	// weights of the orders predictions mix, nil to only use the highest,
+	// see SetInterpolation
+	interpolation []float64
+	// whether predictions use Good-Turing discounting rather than additive
+	// smoothing, see SetGoodTuring
+	goodTuring bool
+
+	state *state
+}
+
+// New creates an empty model of order n with additive smoothing.
+func New(tokenizer Tokenizer, n int, smoothing float64) *Model {
+	model := &Model{
+		Counts:    make(map[string]uint64),
+		Tokenizer: tokenizer,
+		N:         n,
+		Smoothing: smoothing,
+		state:     newState(),
+	}
+
+	return model
+}
+
+func ngrams(tokens []Token, n int) [][]Token {
+	var ngrams [][]Token
+
+	if n > len(tokens) || n <= 0 {
+		return ngrams
+	}
+
+	for i := 0; i <= len(tokens)-n; i++ {
+		ngrams = append(ngrams, tokens[i:i+n])
+	}
+
+	return ngrams
+}
+
+// Train learns sample.
+func (m *Model) Train(sample string) {
+	m.TrainRedacted(sample, nil)
+}
+
+// encodeRedacted encodes text with t, each of the byte spans replaced by a
+// single redacted token, which was registered with special before. The caller
+// holds the vocab lock.
+func (m *Model) encodeRedacted(t *Tokenizer, text string, spans [][2]int) []Token {
+	if len(spans) == 0 {
+		return t.Encode(text)
+	}
+
+	spans = slices.Clone(spans)
+	slices.SortFunc(spans, func(a, b [2]int) int { return a[0] - b[0] })
+
+	var redacted = m.specialID(RedactedToken)
+
+	var tokens []Token
+	var pos = 0
+
+	for _, span := range spans {
+		// overlapping matches collapse into the redaction already emitted
+		if span[0] < pos {
+			pos = max(pos, span[1])
+			continue
+		}
+
+		tokens = append(tokens, t.Encode(text[pos:span[0]])...)
+		tokens = append(tokens, redacted)
+		pos = span[1]
+	}
+
+	return append(tokens, t.Encode(text[pos:])...)
+}
+
+// TrainRedacted learns sample with the given byte spans replaced by a single
+// redacted token.
+func (m *Model) TrainRedacted(sample string, spans [][2]int) {
+	m.count(sample, spans, false)
+}
+
+// TrainImported learns sample like TrainRedacted, but as imported history.
+func (m *Model) TrainImported(sample string, spans [][2]int) {
+	m.count(sample, spans, true)
+}
+
+func (m *Model) count(sample string, spans [][2]int, imported bool) {
+	if len(sample) == 0 {
+		return
+	}
+
+	// update the tokenizer vocab
+	m.observe(sample)
+
+	// registered before encoding, since a new special token shifts the ids
+	// of characters
+	m.special(StartOfText)
+	m.registerRedacted(spans)
+
+	keys := m.keys(func() []Token {
+		// add start and end of text tokens
+		tokens := append([]Token{m.specialID(StartOfText)}, m.encodeRedacted(&m.Tokenizer, sample, spans)...)
+		return append(tokens, EndOfText)
+	})
+
+	for _, key := range keys {
+		s := m.shardOf(key)
+		s.mu.Lock()
+		if imported {
+			s.imported[key]++
+		} else {
+			s.counts[key]++
+		}
+		s.mu.Unlock()
+	}
+
+	if imported {
+		m.state.importedTotal.Add(int64(len(keys)))
+	} else {
+		m.state.total.Add(int64(len(keys)))
+	}
+}
+
+// observe adds the characters and markup of text to the vocab, only taking
+// the tokenizer for writing when one is new
+func (m *Model) observe(text string) {
+	m.state.vocab.RLock()
+	known := !strings.ContainsFunc(text, func(r rune) bool { return !slices.Contains(m.Tokenizer.Vocab, r) })
+	for _, span := range findMarkup(text) {
+		known = known && slices.Contains(m.Tokenizer.Markup, span)
+	}
+	m.state.vocab.RUnlock()
+
+	if known {
+		return
+	}
+
+	m.state.vocab.Lock()
+	m.Tokenizer.Observe(text)
+	m.state.version++
+	m.state.vocab.Unlock()
+}
+
+// special returns the id of the named special token, registering it if
+// needed
+func (m *Model) special(name string) Token {
+	m.state.vocab.RLock()
+	tok := m.specialID(name)
+	m.state.vocab.RUnlock()
+	if tok >= 0 {
+		return tok
+	}
+
+	m.state.vocab.Lock()
+	defer m.state.vocab.Unlock()
+
+	m.state.version++
+	return m.Tokenizer.Special(name)
+}
+
+// Entities lists the names the model keeps whole as single tokens.
+func (m *Model) Entities() []string {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	return slices.Clone(m.Tokenizer.Entities)
+}
+
+// AddEntity keeps name whole as a single token from now on, see
+// Tokenizer.AddEntity.
+func (m *Model) AddEntity(name string) {
+	m.state.vocab.Lock()
+	defer m.state.vocab.Unlock()
+
+	m.Tokenizer.AddEntity(name)
+	m.state.version++
+}
+
+// RemoveEntity stops keeping name whole.
+func (m *Model) RemoveEntity(name string) {
+	m.state.vocab.Lock()
+	defer m.state.vocab.Unlock()
+
+	m.Tokenizer.RemoveEntity(name)
+	m.state.version++
+}
+
+// registerRedacted registers the redacted token before text with spans is
+// encoded
+func (m *Model) registerRedacted(spans [][2]int) {
+	if len(spans) > 0 {
+		m.special(RedactedToken)
+	}
+}
+
+// keys returns the counts keys of every n-gram up to the model's order of the
+// tokens encode returns, holding the vocab lock from encoding to the last key
+func (m *Model) keys(encode func() []Token) []string {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	return m.ngramKeys(&m.Tokenizer, encode())
+}
+
+// ngramKeys returns the counts keys of every n-gram up to the model's order of
+// tokens, which t encoded. The caller holds the vocab lock.
+func (m *Model) ngramKeys(t *Tokenizer, tokens []Token) []string {
+	var keys []string
+	for n := range m.N + 1 {
+		for _, ngram := range ngrams(tokens, n) {
+			keys = append(keys, t.key(ngram))
+		}
+	}
+
+	return keys
+}
+
+// startToken returns the start of text token if the model learned any text
+// with it; models trained before it existed didn't. The caller holds the vocab
+// lock.
+func (m *Model) startToken() (Token, bool) {
+	start := m.specialID(StartOfText)
+	if start < 0 {
+		return 0, false
+	}
+
+	return start, m.countOf([]Token{start}) > 0
+}
+
+// context returns the tokens of text that predict the next one. Text
+// shorter than that is the start of a message, so the start of text token
+// goes in front where the model learned it. The caller holds the vocab lock.
+func (m *Model) context(text string) []Token {
+	context := m.encode(text)
+	if len(context) >= m.N-1 {
+		return context[len(context)-m.N+1:]
+	}
+
+	if start, ok := m.startToken(); ok {
+		if started := append([]Token{start}, context...); m.countOf(started) > 0 {
+			return started
+		}
+	}
+
+	return context
+}
+
+// encode, decode, key and vocabSize are the tokenizer's, for a caller holding
+// the vocab lock
+func (m *Model) encode(text string) []Token {
+	return m.Tokenizer.Encode(text)
+}
+
+func (m *Model) decode(tokens []Token) string {
+	return m.Tokenizer.Decode(tokens)
+}
+
+func (m *Model) key(tokens []Token) string {
+	return m.Tokenizer.key(tokens)
+}
+
+func (m *Model) vocabSize() int {
+	return m.Tokenizer.VocabSize()
+}
+
+// orderOf counts the tokens of a counts key
+func (m *Model) orderOf(key string) int {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	return m.order(key)
+}
+
+// tokensOf encodes pieces of generated text back to the ids they have now,
+// -1 for a piece that is no longer a single token. The caller holds the vocab
+// lock.
+func (m *Model) tokensOf(pieces []string) []Token {
+	var tokens = make([]Token, len(pieces))
+	for i, piece := range pieces {
+		tokens[i] = -1
+		if encoded := m.encode(piece); len(encoded) == 1 {
+			tokens[i] = encoded[0]
+		}
+	}
+
+	return tokens
+}
+
+// specialName returns the name of a special token, reporting false for any
+// other token. The caller holds the vocab lock.
+func (m *Model) specialName(tok Token) (string, bool) {
+	if tok < 0 || int(tok) >= len(m.Tokenizer.SpecialTokens) {
+		return "", false
+	}
+
+	return m.Tokenizer.SpecialTokens[tok], true
+}
+
+// specialID returns the id of a special token by name, or -1 if the model
+// doesn't have it. The caller holds the vocab lock.
+func (m *Model) specialID(name string) Token {
+	return Token(slices.Index(m.Tokenizer.SpecialTokens, name))
+}
+
+// SetImportWeight sets how much an imported count is worth relative to an
+// organic one when predicting. The weight isn't saved with the model.
+func (m *Model) SetImportWeight(weight float64) {
+	m.importWeight = &weight
+}
+
+func (m *Model) weightOfImports() float64 {
+	if m.importWeight == nil {
+		return 1
+	}
+
+	return *m.importWeight
+}
+
+// PurgeImported forgets everything learned through TrainImported.
+func (m *Model) PurgeImported() {
+	m.eachShard(func(s *shard) { clear(s.imported) })
+	m.state.importedTotal.Store(0)
+}
+
+// ContextKey is the counts key of the context a prediction after text uses.
+func (m *Model) ContextKey(text string) string {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	return m.contextKey(text)
+}
+
+// contextKey is ContextKey for a caller holding the vocab lock
+func (m *Model) contextKey(text string) string {
+	context := m.encode(text)
+	return m.key(context[max(0, len(context)-m.N+1):])
+}
+
+// countOf weighs organic and imported counts of an n-gram together. The caller
+// holds the vocab lock.
+func (m *Model) countOf(ctx []Token) float64 {
+	organic, imported := m.counts(m.key(ctx))
+	return float64(organic) + m.weightOfImports()*float64(imported)
+}
+
+func (m *Model) total() float64 {
+	total, imported := m.Totals()
+	return float64(total) + m.weightOfImports()*float64(imported)
+}
+
+// Probs returns the probability of every token id following text. The ids
+// are those of the vocabulary at the time, which may have grown by when the
+// caller looks at them.
+func (m *Model) Probs(text string) []float64 {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	return m.probs(text)
+}
+
+// probs is Probs for a caller holding the vocab lock
+func (m *Model) probs(text string) []float64 {
+	var probs []float64
+	total := float64(0)
+
+	var vocabSize = m.vocabSize()
+
+	context := m.context(text)
+	if m.interpolation != nil {
+		return m.interpolatedProbs(context, vocabSize)
+	}
+	if m.goodTuring {
+		probs, _ := m.goodTuringProbs(context, vocabSize)
+		return probs
+	}
+
+	var continuation = func(tok Token) []Token {
+		out := make([]Token, len(context))
+		copy(out, context)
+		return append(out, tok)
+	}
+
+	if len(context) > 0 {
+		total = m.countOf(context) + float64(vocabSize)*m.Smoothing
+	} else {
+		total = m.total()
+	}
+
+	for i := range vocabSize {
+		if total > 0 {
+			var count = m.countOf(continuation(Token(i))) + m.Smoothing
+			probs = append(probs, count/total)
+		} else {
+			probs = append(probs, 0.0)
+		}
+	}
+
+	return probs
+}
+
+// Confidence scores how sure the model is of text: the average probability of
+// each token given its context, blended with how often that context had
+// actually been seen during training.
+func (m *Model) Confidence(text string) float64 {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	tokens := m.encode(text)
+	if len(tokens) == 0 {
+		return 0
+	}
+
+	var probSum float64
+	var hits int
+
+	for i, tok := range tokens {
+		// unknown tokens count as a miss with zero probability
+		if tok < 0 {
+			continue
+		}
+
+		probSum += m.probs(m.decode(tokens[:i]))[tok]
+
+		context := tokens[max(0, i-m.N+1):i]
+		if len(context) == 0 || m.countOf(context) > 0 {
+			hits++
+		}
+	}
+
+	var n = float64(len(tokens))
+
+	return (probSum/n + float64(hits)/n) / 2
+}
+
+// Sample draws an index from probs, which need not be normalized.
+func Sample(probs []float64) uint32 {
+	if len(probs) == 0 {
+		return 0
+	}
+
+	var total float64
+	for _, prob := range probs {
+		total += prob
+	}
+
+	r := rand.Float64() * total
+	for i, prob := range probs {
+		if r < prob {
+			return uint32(i)
+		}
+		r -= prob
+	}
+
+	return 0
+}
+
+// maskSpecial zeroes the special tokens other than end of text, which only
+// mark training context and should never be generated. The caller holds the
+// vocab lock.
+func (m *Model) maskSpecial(probs []float64) {
+	for i := 1; i < len(m.Tokenizer.SpecialTokens); i++ {
+		probs[i] = 0
+	}
+}
+
+// Generate samples up to length tokens following seed, returning the seed
+// followed by the generated text.
+func (m *Model) Generate(seed string, length int) string {
+	return m.Stream(seed, length, func(string) bool { return true })
+}
+
+// Stream generates like Generate, passing each token to emit as it is
+// sampled. Generation stops early once emit returns false. When the length
+// runs out mid-word, the word is left out of the returned text, though it was
+// already emitted.
+func (m *Model) Stream(seed string, length int, emit func(piece string) bool) string {
+	var out = seed
+	var generated []string
+
+	for i := range length {
+		next, ok := m.next(out, generated)
+		if !ok {
+			break
+		}
+
+		out += next
+		generated = append(generated, next)
+
+		if !emit(next) || m.stopsAt(out, len(generated)) {
+			break
+		}
+
+		if i == length-1 {
+			out = seed + trimWord(out[len(seed):])
+		}
+	}
+
+	return out
+}
+
+// next samples the token following text, which generated was the text of
+// the tokens generated so far of, reporting false for the end of text
+func (m *Model) next(text string, generated []string) (string, bool) {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	probs := m.probs(text)
+	m.maskSpecial(probs)
+	m.penalizeRepetition(probs, m.tokensOf(generated[max(0, len(generated)-repetitionWindow):]))
+
+	sampled := Token(Sample(probs))
+	if sampled == EndOfText {
+		return "", false
+	}
+
+	return m.decode([]Token{sampled}), true
+}
+
+// Forget undoes Train for the same text.
+func (m *Model) Forget(text string) {
+	m.ForgetRedacted(text, nil)
+}
+
+// ForgetRedacted undoes TrainRedacted for the same text and spans, even
+// once names in text have become entities since.
+func (m *Model) ForgetRedacted(text string, spans [][2]int) {
+	if len(text) == 0 {
+		return
+	}
+
+	m.registerRedacted(spans)
+
+	for _, key := range m.learnedKeys(text, spans) {
+		s := m.shardOf(key)
+		s.mu.Lock()
+		if s.counts[key] > 0 {
+			s.counts[key]--
+		}
+		s.mu.Unlock()
+	}
+}
+
+// the most entities in a text forgotten whose spellings are tried in every
+// combination; past it only all of them or none are
+const maxSpelledEntities = 3
+
+// learnedKeys returns the counts keys text was learned under. Text learned
+// before a name in it became an entity spells the name out, so of the ways of
+// encoding text with and without its entities, the first whose n-grams the
+// counts all hold wins, or else the one they hold most of.
+func (m *Model) learnedKeys(text string, spans [][2]int) []string {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	// once the model has the start token, text is learned with it
+	start, started := m.startToken()
+
+	var keys []string
+	var held = -1
+
+	for _, t := range m.spellings(text) {
+		tokens := append(m.encodeRedacted(t, text, spans), EndOfText)
+		if started {
+			tokens = append([]Token{start}, tokens...)
+		}
+
+		candidate := m.ngramKeys(t, tokens)
+		if n := m.held(candidate); n > held {
+			keys, held = candidate, n
+		}
+		if held == len(keys) {
+			break
+		}
+	}
+
+	return keys
+}
+
+// spellings lists the tokenizers text can have been learned with: the model's
+// own first, then ones spelling out some or all of the entities in text. The
+// caller holds the vocab lock.
+func (m *Model) spellings(text string) []*Tokenizer {
+	var tokenizers = []*Tokenizer{&m.Tokenizer}
+
+	entities := m.Tokenizer.entitiesIn(text)
+	if len(entities) > maxSpelledEntities {
+		return append(tokenizers, m.Tokenizer.without(entities))
+	}
+
+	for subset := 1; subset < 1<<len(entities); subset++ {
+		var spelled []string
+		for i, entity := range entities {
+			if subset&(1<<i) != 0 {
+				spelled = append(spelled, entity)
+			}
+		}
+		tokenizers = append(tokenizers, m.Tokenizer.without(spelled))
+	}
+
+	return tokenizers
+}
+
+// held counts the keys with organic counts
+func (m *Model) held(keys []string) int {
+	var n int
+	for _, key := range keys {
+		if organic, _ := m.counts(key); organic > 0 {
+			n++
+		}
+	}
+
+	return n
+}
+
+// order counts the tokens of a counts key, whose entities and special tokens
+// are spelled out. The caller holds the vocab lock.
+func (m *Model) order(key string) int {
+	var n int
+
+	for {
+		start := strings.Index(key, entityKeyPrefix)
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(key[start+len(entityKeyPrefix):], entityKeySuffix)
+		if end < 0 {
+			break
+		}
+
+		key = key[:start] + key[start+len(entityKeyPrefix)+end+len(entityKeySuffix):]
+		n++
+	}
+
+	for _, special := range m.Tokenizer.SpecialTokens {
+		n += strings.Count(key, special)
+		key = strings.ReplaceAll(key, special, "")
+	}
+
+	return n + m.Tokenizer.spelled(key)
+}
+
+// Prune forgets every n-gram of the model's full order seen fewer than k
+// times, organic and imported counts together, and reports how many it
+// dropped. Text the model saw only once can no longer be reproduced verbatim,
+// at the cost of less fluent output around it.
+func (m *Model) Prune(k int) int {
+	return m.PruneOrder(m.N, k)
+}
+
+// PruneOrder is Prune for the n-grams of one order. Pruning the higher orders
+// first keeps every remaining n-gram's context counted.
+func (m *Model) PruneOrder(n, k int) int {
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	var pruned int
+	m.eachShard(func(s *shard) {
+		var rare = make(map[string]bool)
+		for _, counts := range []map[string]uint64{s.counts, s.imported} {
+			for key := range counts {
+				if s.counts[key]+s.imported[key] < uint64(k) && m.order(key) == n {
+					rare[key] = true
+				}
+			}
+		}
+
+		for key := range rare {
+			m.state.total.Add(-int64(s.counts[key]))
+			m.state.importedTotal.Add(-int64(s.imported[key]))
+			delete(s.counts, key)
+			delete(s.imported, key)
+		}
+
+		pruned += len(rare)
+	})
+
+	return pruned
+}
+
+// Subtract forgets what other learned, for other trained on part of the same
+// text as the model, like an author's share of a guild's messages. Counts
+// never go below zero.
+func (m *Model) Subtract(other *Model) {
+	// copied out first, so the two models' shards are never locked together
+	var organic, imported = make(map[string]uint64), make(map[string]uint64)
+	other.eachShard(func(s *shard) {
+		maps.Copy(organic, s.counts)
+		maps.Copy(imported, s.imported)
+	})
+
+	var subtract = func(other map[string]uint64, imported bool) int64 {
+		var subtracted int64
+		for key, count := range other {
+			s := m.shardOf(key)
+			s.mu.Lock()
+			counts := s.counts
+			if imported {
+				counts = s.imported
+			}
+			n := min(count, counts[key])
+			if counts[key] -= n; counts[key] == 0 {
+				delete(counts, key)
+			}
+			s.mu.Unlock()
+
+			subtracted += int64(n)
+		}
+
+		return subtracted
+	}
+
+	m.state.total.Add(-subtract(organic, false))
+	m.state.importedTotal.Add(-subtract(imported, true))
+}
+
+// Halve halves every count, rounding down, and reports how many n-grams it
+// dropped for reaching zero. What the model learned so far fades to half the
+// weight of what it learns next, and what it saw only once is forgotten.
+func (m *Model) Halve() int {
+	var dropped int
+	m.eachShard(func(s *shard) {
+		for _, counts := range []map[string]uint64{s.counts, s.imported} {
+			for key, count := range counts {
+				if counts[key] = count / 2; counts[key] == 0 {
+					delete(counts, key)
+					dropped++
+				}
+			}
+		}
+	})
+
+	// the totals are sums of counts, so they halve about the same
+	m.state.total.Store(m.state.total.Load() / 2)
+	m.state.importedTotal.Store(m.state.importedTotal.Load() / 2)
+
+	return dropped
+}
+
+// Entries counts the organic and imported counts the model keeps, which is
+// what its memory grows with.
+func (m *Model) Entries() int {
+	organic, imported := m.Sizes()
+	return organic + imported
+}
@@ -0,0 +1,114 @@
+package ngram
+
+import (
+	"testing"
+)
+
+// learned lists the n-grams with organic counts left
+func learned(m *Model) map[string]uint64 {
+	var out = make(map[string]uint64)
+	for key, count := range m.organic() {
+		if count > 0 {
+			out[key] = count
+		}
+	}
+
+	return out
+}
+
+func TestForgetUndoesTrain(t *testing.T) {
+	samples := []struct {
+		text  string
+		spans [][2]int
+	}{
+		{"hello there", nil},
+		{"hello <@123> how are you", nil},
+		{"my number is 555 1234", [][2]int{{13, 21}}},
+		{"hello there", nil},
+	}
+
+	m := New(NewCharTokenizer(nil), 3, 0.1)
+	for _, sample := range samples {
+		m.TrainRedacted(sample.text, sample.spans)
+	}
+	if len(learned(m)) == 0 {
+		t.Fatal("nothing learned")
+	}
+
+	for _, sample := range samples {
+		m.ForgetRedacted(sample.text, sample.spans)
+	}
+	if left := learned(m); len(left) > 0 {
+		t.Errorf("counts left after forgetting everything: %v", left)
+	}
+}
+
+func TestForgetAfterEntityPromoted(t *testing.T) {
+	const text = "hi Bob and Alice"
+
+	m := New(NewCharTokenizer(nil), 3, 0.1)
+	m.Train(text)
+	m.AddEntity("Bob")
+	m.Train(text)
+	m.AddEntity("Alice")
+	m.Train(text)
+
+	for range 3 {
+		m.Forget(text)
+	}
+	if left := learned(m); len(left) > 0 {
+		t.Errorf("counts left after forgetting everything: %v", left)
+	}
+}
+
+func TestForgetLeavesOtherText(t *testing.T) {
+	m := New(NewCharTokenizer(nil), 3, 0.1)
+	m.Train("good morning")
+	m.Train("good night")
+	m.Forget("good night")
+
+	if got := m.Frequency("good morning"); got != 1 {
+		t.Errorf("Frequency of the text kept = %v, want 1", got)
+	}
+	if got := m.Frequency("night"); got != 0 {
+		t.Errorf("Frequency of the text forgotten = %v, want 0", got)
+	}
+}
+
+func TestOrderOfKeys(t *testing.T) {
+	m := New(NewCharTokenizer(nil), 3, 0.1)
+	m.Train("hi Bob <@123>")
+	m.AddEntity("Bob")
+	m.Train("hi Bob <@123>")
+
+	bob := entityKeyPrefix + "Bob" + entityKeySuffix
+	orders := map[string]int{
+		"Bob":                  3,
+		bob:                    1,
+		" " + bob + " ":        3,
+		"<@123>":               1,
+		"<|endoftext|>":        1,
+		StartOfText + "hi":     3,
+		bob + " <@123>":        3,
+		" <@123><|endoftext|>": 3,
+	}
+	for key, want := range orders {
+		if got := m.orderOf(key); got != want {
+			t.Errorf("order(%q) = %d, want %d", key, got, want)
+		}
+	}
+	for key := range learned(m) {
+		if n := m.orderOf(key); n < 1 || n > m.N {
+			t.Errorf("order(%q) = %d, want 1 to %d", key, n, m.N)
+		}
+	}
+
+	if got := m.PruneOrder(m.N, 100); got == 0 {
+		t.Error("pruned no n-grams of the full order")
+	}
+	for key := range learned(m) {
+		if m.orderOf(key) == m.N {
+			t.Errorf("%q of the full order left after pruning", key)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package ngram
+
+import (
+	"math"
+	"slices"
+)
+
+// Score is how well a model predicts a piece of text.
+type Score struct {
+	// tokens scored, including the end of text
+	Tokens int
+	// tokens the model gives no chance at all, left out of LogProb the way
+	// language model toolkits leave out unknown words
+	ZeroProbs int
+	// natural log probability of the other tokens
+	LogProb float64
+}
+
+// Add combines the scores of two texts, to score a whole corpus.
+func (s Score) Add(other Score) Score {
+	return Score{
+		Tokens:    s.Tokens + other.Tokens,
+		ZeroProbs: s.ZeroProbs + other.ZeroProbs,
+		LogProb:   s.LogProb + other.LogProb,
+	}
+}
+
+// Perplexity is the inverse geometric mean probability of the tokens with a
+// chance, lower for text more like what the model learned. It is infinite
+// when no token had a chance.
+func (s Score) Perplexity() float64 {
+	var scored = s.Tokens - s.ZeroProbs
+	if scored <= 0 {
+		return math.Inf(1)
+	}
+
+	return math.Exp(-s.LogProb / float64(scored))
+}
+
+// Score scores how likely the model finds text, as a message followed by the
+// end of text.
+func (m *Model) Score(text string) Score {
+	return m.ScoreRedacted(text, nil)
+}
+
+// ScoreRedacted scores text with the given byte spans redacted, the way
+// TrainRedacted would learn it.
+func (m *Model) ScoreRedacted(text string, spans [][2]int) Score {
+	var score Score
+	if len(text) == 0 {
+		return score
+	}
+
+	m.registerRedacted(spans)
+
+	m.state.vocab.RLock()
+	defer m.state.vocab.RUnlock()
+
+	tokens := append(m.encodeRedacted(&m.Tokenizer, text, spans), EndOfText)
+	vocabSize := m.vocabSize()
+
+	// the start of text token is context, not scored
+	var first int
+	if start, ok := m.startToken(); ok {
+		tokens = append([]Token{start}, tokens...)
+		first = 1
+	}
+
+	for i, tok := range tokens {
+		if i < first {
+			continue
+		}
+		score.Tokens++
+
+		p := m.prob(tokens[max(0, i-m.N+1):i], tok, vocabSize)
+		if p <= 0 {
+			score.ZeroProbs++
+			continue
+		}
+		score.LogProb += math.Log(p)
+	}
+
+	return score
+}
+
+// prob is the probability of tok following context, worked out like Probs
+// does for every token at once. The caller holds the vocab lock.
+func (m *Model) prob(context []Token, tok Token, vocabSize int) float64 {
+	// unknown tokens were never counted
+	if tok < 0 {
+		return 0
+	}
+	if m.interpolation != nil {
+		return m.interpolatedProbs(context, vocabSize)[tok]
+	}
+	if m.goodTuring {
+		probs, _ := m.goodTuringProbs(context, vocabSize)
+		return probs[tok]
+	}
+
+	var total float64
+	if len(context) > 0 {
+		total = m.countOf(context) + float64(vocabSize)*m.Smoothing
+	} else {
+		total = m.total()
+	}
+	if total <= 0 {
+		return 0
+	}
+
+	return (m.countOf(append(slices.Clone(context), tok)) + m.Smoothing) / total
+}
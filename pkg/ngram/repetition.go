@@ -0,0 +1,44 @@
+package ngram
+
+import (
+	"math"
+	"slices"
+)
+
+// repetitionWindow is how many of the last generated tokens the repetition
+// penalty looks back on
+const repetitionWindow = 64
+
+// SetRepetitionPenalty makes sampling divide a token's probability by
+// penalty for every time it would repeat an n-gram of the model's order in
+// the recent output, so the model stops looping on "hahahaha". 1 or less
+// turns it off. The penalty isn't saved with the model.
+func (m *Model) SetRepetitionPenalty(penalty float64) {
+	m.repetitionPenalty = penalty
+}
+
+// penalizeRepetition down-weights the tokens that would repeat an n-gram
+// within the last repetitionWindow tokens of generated: the ones that
+// followed the current context every earlier time it came up
+func (m *Model) penalizeRepetition(probs []float64, generated []Token) {
+	var k = m.N - 1
+	if m.repetitionPenalty <= 1 || k < 1 || len(generated) <= k {
+		return
+	}
+
+	window := generated[max(0, len(generated)-repetitionWindow):]
+	context := window[len(window)-k:]
+
+	var repeats = make(map[Token]int)
+	for i := 0; i+k < len(window); i++ {
+		if slices.Equal(window[i:i+k], context) {
+			repeats[window[i+k]]++
+		}
+	}
+
+	for tok, count := range repeats {
+		if int(tok) < len(probs) {
+			probs[tok] /= math.Pow(m.repetitionPenalty, float64(count))
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package ngram
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// counts are spread over this many shards, each with its own lock, so
+// training and prediction touching different n-grams don't wait on each
+// other
+const shardCount = 64
+
+type shard struct {
+	mu       sync.RWMutex
+	counts   map[string]uint64
+	imported map[string]uint64
+}
+
+// state is what a model needs at runtime besides what it saves. It sits
+// behind a pointer so models can be copied and decoded into.
+type state struct {
+	// guards the tokenizer, whose vocabulary grows while training
+	vocab sync.RWMutex
+	// changes with every change to the tokenizer, under vocab
+	version uint64
+
+	shards        [shardCount]shard
+	total         atomic.Int64
+	importedTotal atomic.Int64
+
+	discounts discounts
+}
+
+func newState() *state {
+	var s = &state{}
+	for i := range s.shards {
+		s.shards[i].counts = make(map[string]uint64)
+		s.shards[i].imported = make(map[string]uint64)
+	}
+
+	return s
+}
+
+func (m *Model) shardOf(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &m.state.shards[h.Sum32()%shardCount]
+}
+
+// counts returns the organic and imported count of an n-gram
+func (m *Model) counts(key string) (uint64, uint64) {
+	s := m.shardOf(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.counts[key], s.imported[key]
+}
+
+// eachShard calls fn with every shard locked for writing in turn
+func (m *Model) eachShard(fn func(s *shard)) {
+	for i := range m.state.shards {
+		s := &m.state.shards[i]
+		s.mu.Lock()
+		fn(s)
+		s.mu.Unlock()
+	}
+}
+
+// organic lists the organic counts, copied out so the caller holds no locks
+func (m *Model) organic() map[string]uint64 {
+	var out = make(map[string]uint64)
+	for i := range m.state.shards {
+		s := &m.state.shards[i]
+		s.mu.RLock()
+		for key, count := range s.counts {
+			out[key] = count
+		}
+		s.mu.RUnlock()
+	}
+
+	return out
+}
+
+// Flatten gathers the counts and totals from the shards into Counts,
+// Imported, Total and ImportedTotal, which is what gets encoded. The model
+// keeps working from its shards, so the maps can be set to nil once encoded.
+// Text trained meanwhile may only partly make it into the maps, and encoding
+// them along with the tokenizer needs the model held, see Hold.
+func (m *Model) Flatten() {
+	m.Counts = make(map[string]uint64)
+	m.Imported = make(map[string]uint64)
+
+	m.eachShard(func(s *shard) {
+		for key, count := range s.counts {
+			m.Counts[key] = count
+		}
+		for key, count := range s.imported {
+			m.Imported[key] = count
+		}
+	})
+
+	m.Total = int(m.state.total.Load())
+	m.ImportedTotal = int(m.state.importedTotal.Load())
+}
+
+// Hold keeps the tokenizer from changing until release is called, so the model
+// can be encoded while it goes on predicting and training. Training text that
+// brings new characters, markup or special tokens waits for it.
+func (m *Model) Hold() (release func()) {
+	m.state.vocab.RLock()
+	return m.state.vocab.RUnlock
+}
+
+// Unflatten spreads Counts and Imported over the shards, replacing what they
+// held, and empties them. Decoded models need it before use.
+func (m *Model) Unflatten() {
+	if m.state == nil {
+		m.state = newState()
+	}
+
+	m.eachShard(func(s *shard) {
+		clear(s.counts)
+		clear(s.imported)
+	})
+
+	for key, count := range m.Counts {
+		m.shardOf(key).counts[key] = count
+	}
+	for key, count := range m.Imported {
+		m.shardOf(key).imported[key] = count
+	}
+
+	m.state.total.Store(int64(m.Total))
+	m.state.importedTotal.Store(int64(m.ImportedTotal))
+	m.Counts, m.Imported = nil, nil
+}
+
+// Totals returns how many organic and imported n-grams the model counted.
+func (m *Model) Totals() (int, int) {
+	return int(m.state.total.Load()), int(m.state.importedTotal.Load())
+}
+
+// Sizes returns how many distinct organic and imported n-grams the model
+// keeps a count for.
+func (m *Model) Sizes() (int, int) {
+	var organic, imported int
+	for i := range m.state.shards {
+		s := &m.state.shards[i]
+		s.mu.RLock()
+		organic += len(s.counts)
+		imported += len(s.imported)
+		s.mu.RUnlock()
+	}
+
+	return organic, imported
+}
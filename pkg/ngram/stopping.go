@@ -0,0 +1,47 @@
+package ngram
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SetSentenceStop makes generation end at the first sentence-final
+// punctuation once minLength tokens were generated, instead of running on
+// until the end of text or the length runs out. Negative turns it off. The
+// setting isn't saved with the model.
+func (m *Model) SetSentenceStop(minLength int) {
+	if minLength < 0 {
+		m.sentenceStop = nil
+		return
+	}
+
+	m.sentenceStop = &minLength
+}
+
+// stopsAt reports whether generation ends with text so far, after generated
+// tokens
+func (m *Model) stopsAt(text string, generated int) bool {
+	return m.sentenceStop != nil && generated >= *m.sentenceStop && endsSentence(text)
+}
+
+// endsSentence reports whether text ends with sentence-final punctuation,
+// possibly followed by closing quotes or brackets
+func endsSentence(text string) bool {
+	text = strings.TrimRight(text, `"')]»”’`)
+	return strings.HasSuffix(text, ".") || strings.HasSuffix(text, "!") || strings.HasSuffix(text, "?") || strings.HasSuffix(text, "…")
+}
+
+// trimWord cuts a word the length ran out in the middle of from the end of
+// generated text, unless it is all there is
+func trimWord(text string) string {
+	i := strings.LastIndexFunc(text, unicode.IsSpace)
+	if i <= 0 || strings.TrimSpace(text[:i]) == "" {
+		return text
+	}
+
+	if last := []rune(text[i:]); unicode.IsLetter(last[len(last)-1]) || unicode.IsNumber(last[len(last)-1]) {
+		return text[:i]
+	}
+
+	return text
+}
@@ -0,0 +1,288 @@
+// Package ngram implements the character n-gram language model schizoid
+// learns from chat: a tokenizer, count-based training and forgetting, and
+// sampling. Other programs can use the chain on its own, it registers itself
+// as a schizoid generation backend but needs nothing else of schizoid.
+package ngram
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token identifies a special token, a character or an entity. Ids depend on the
+// tokenizer's current vocabulary, so they are only meaningful transiently;
+// models key their counts by spelled-out text instead, see key.
+type Token int
+
+// EndOfText terminates every trained sample.
+const EndOfText Token = 0
+
+// StartOfText precedes every trained sample, so generating from an empty seed
+// starts the way messages do.
+const StartOfText = "<|startoftext|>"
+
+// RedactedToken stands in for moderated spans so the rest of a message can
+// still be learned.
+const RedactedToken = "<|redacted|>"
+
+// entities are spelled out in counts keys between these, the way special tokens
+// spell out their names, so an entity never shares a key with the characters
+// of its name learned before it became one
+const (
+	entityKeyPrefix = "<|entity:"
+	entityKeySuffix = "|>"
+)
+
+// markup matches chat markup that only works whole: Discord user, role and
+// channel mentions, custom emoji, command mentions and timestamps, and the
+// tokens standing in for attached files and stickers
+const markup = `<(?:@[!&]?\d+|#\d+|a?:\w+:\d+|/[\w -]+:\d+|t:-?\d+(?::[tTdDfFR])?|(?:file|sticker):[^\s<>]+)>`
+
+var (
+	markupPattern       = regexp.MustCompile(markup)
+	markupPrefixPattern = regexp.MustCompile("^" + markup)
+)
+
+// Tokenizer maps text to tokens: special tokens first, then every character
+// seen so far, then entities, then markup.
+type Tokenizer struct {
+	Vocab         []rune
+	SpecialTokens []string // special tokens need strings to be displayed (e.g. <|endoftext|>)
+	Entities      []string // names kept whole as single tokens, longest first
+	Markup        []string // mentions and custom emoji seen so far, kept whole so they stay well-formed
+}
+
+// NewCharTokenizer creates a tokenizer with an empty character vocabulary,
+// defaulting to just the end of text special token.
+func NewCharTokenizer(specialTokens []string) Tokenizer {
+	if len(specialTokens) == 0 {
+		specialTokens = []string{
+			"<|endoftext|>",
+		}
+	}
+
+	return Tokenizer{
+		Vocab:         make([]rune, 0),
+		SpecialTokens: specialTokens,
+	}
+}
+
+// entityAt returns the index of the longest entity starting text, or -1. An
+// entity only matches as a whole word, so "Bob" doesn't split "Bobby".
+func (c *Tokenizer) entityAt(text string) int {
+	for i, entity := range c.Entities {
+		if !strings.HasPrefix(text, entity) {
+			continue
+		}
+
+		next, _ := utf8.DecodeRuneInString(text[len(entity):])
+		if !unicode.IsLetter(next) && !unicode.IsDigit(next) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Encode converts text to tokens, using -1 for characters outside the vocab.
+func (c *Tokenizer) Encode(text string) []Token {
+	var tokens []Token
+	var prev rune
+
+	for i := 0; i < len(text); {
+		// markup is whole wherever it appears
+		if m := c.markupAt(text[i:]); m >= 0 {
+			tokens = append(tokens, Token(len(c.SpecialTokens)+len(c.Vocab)+len(c.Entities)+m))
+			i += len(c.Markup[m])
+			prev = '>'
+			continue
+		}
+
+		// entities only start at word boundaries too
+		if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+			if e := c.entityAt(text[i:]); e >= 0 {
+				tokens = append(tokens, Token(len(c.SpecialTokens)+len(c.Vocab)+e))
+				i += len(c.Entities[e])
+				prev, _ = utf8.DecodeLastRuneInString(c.Entities[e])
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		// index by rune, not byte, so multi-byte characters don't shift ids
+		tok := slices.Index(c.Vocab, r)
+
+		// use -1 for unknown tokens and adjust the tok id for known tokens
+		if tok >= 0 {
+			tok += len(c.SpecialTokens)
+		}
+
+		tokens = append(tokens, Token(tok))
+		i += size
+		prev = r
+	}
+
+	return tokens
+}
+
+// Decode converts tokens back to text, writing � for unknown tokens.
+func (c *Tokenizer) Decode(tokens []Token) string {
+	return c.decode(tokens, false)
+}
+
+// key spells tokens out the way models key their counts: decoded, but with
+// entities marked apart from the characters of their names
+func (c *Tokenizer) key(tokens []Token) string {
+	return c.decode(tokens, true)
+}
+
+func (c *Tokenizer) decode(tokens []Token, markEntities bool) string {
+	var sb strings.Builder
+
+	for _, tok := range tokens {
+		if tok < 0 || int(tok) >= c.VocabSize() {
+			sb.WriteRune('�') // unknown token
+			continue
+		}
+
+		switch {
+		case int(tok) < len(c.SpecialTokens):
+			sb.WriteString(c.SpecialTokens[tok])
+		case int(tok) < len(c.SpecialTokens)+len(c.Vocab):
+			// adjust the token id to match the vocab index
+			sb.WriteRune(c.Vocab[int(tok)-len(c.SpecialTokens)])
+		case int(tok) < len(c.SpecialTokens)+len(c.Vocab)+len(c.Entities):
+			entity := c.Entities[int(tok)-len(c.SpecialTokens)-len(c.Vocab)]
+			if markEntities {
+				entity = entityKeyPrefix + entity + entityKeySuffix
+			}
+			sb.WriteString(entity)
+		default:
+			sb.WriteString(c.Markup[int(tok)-len(c.SpecialTokens)-len(c.Vocab)-len(c.Entities)])
+		}
+	}
+
+	return sb.String()
+}
+
+// Observe adds the characters and markup of text to the vocab.
+func (c *Tokenizer) Observe(text string) {
+	for _, r := range text {
+		if !strings.ContainsRune(string(c.Vocab), r) {
+			c.Vocab = append(c.Vocab, r)
+		}
+	}
+
+	for _, m := range findMarkup(text) {
+		if !slices.Contains(c.Markup, m) {
+			c.Markup = append(c.Markup, m)
+		}
+	}
+}
+
+// spelled counts the tokens of text encoded without any entities: markup
+// whole, everything else a character at a time
+func (c *Tokenizer) spelled(text string) int {
+	var n int
+
+	for i := 0; i < len(text); n++ {
+		if m := c.markupAt(text[i:]); m >= 0 {
+			i += len(c.Markup[m])
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+
+	return n
+}
+
+// findMarkup lists the markup in text
+func findMarkup(text string) []string {
+	if !strings.Contains(text, "<") {
+		return nil
+	}
+
+	return markupPattern.FindAllString(text, -1)
+}
+
+// markupAt returns the index of the known markup starting text, or -1
+func (c *Tokenizer) markupAt(text string) int {
+	if len(c.Markup) == 0 || !strings.HasPrefix(text, "<") {
+		return -1
+	}
+
+	m := markupPrefixPattern.FindString(text)
+	if m == "" {
+		return -1
+	}
+
+	return slices.Index(c.Markup, m)
+}
+
+// Special returns the id of the named special token, registering it first if
+// needed. Counts are keyed by spelled-out text, so growing the special tokens
+// doesn't invalidate existing models.
+func (c *Tokenizer) Special(name string) Token {
+	if i := slices.Index(c.SpecialTokens, name); i >= 0 {
+		return Token(i)
+	}
+
+	c.SpecialTokens = append(c.SpecialTokens, name)
+	return Token(len(c.SpecialTokens) - 1)
+}
+
+// AddEntity registers a name to be kept whole as a single token. Counts
+// learned before the name became an entity still spell it out character by
+// character, so only text learned afterwards benefits. Counts keys mark
+// entities, so the two never mix.
+func (c *Tokenizer) AddEntity(name string) {
+	if slices.Contains(c.Entities, name) {
+		return
+	}
+
+	c.Observe(name)
+	c.Entities = append(c.Entities, name)
+
+	// longest first so entityAt prefers the longest match
+	slices.SortStableFunc(c.Entities, func(a, b string) int { return len(b) - len(a) })
+}
+
+// RemoveEntity stops treating name as a single token.
+func (c *Tokenizer) RemoveEntity(name string) {
+	c.Entities = slices.DeleteFunc(c.Entities, func(e string) bool { return e == name })
+}
+
+// entitiesIn lists the entities text encodes with
+func (c *Tokenizer) entitiesIn(text string) []string {
+	var first = len(c.SpecialTokens) + len(c.Vocab)
+	var entities []string
+
+	for _, tok := range c.Encode(text) {
+		if int(tok) >= first && int(tok) < first+len(c.Entities) {
+			entities = append(entities, c.Entities[int(tok)-first])
+		}
+	}
+	slices.Sort(entities)
+
+	return slices.Compact(entities)
+}
+
+// without returns a copy of the tokenizer spelling out entities like any
+// other text
+func (c *Tokenizer) without(entities []string) *Tokenizer {
+	t := *c
+	t.Entities = slices.DeleteFunc(slices.Clone(c.Entities), func(e string) bool { return slices.Contains(entities, e) })
+
+	return &t
+}
+
+// VocabSize is the number of distinct token ids.
+func (c *Tokenizer) VocabSize() int {
+	return len(c.SpecialTokens) + len(c.Vocab) + len(c.Entities) + len(c.Markup)
+}
@@ -0,0 +1,75 @@
+package ngram
+
+import (
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	tokenizer := NewCharTokenizer(nil)
+	tokenizer.Special(StartOfText)
+	tokenizer.AddEntity("Bob")
+	tokenizer.AddEntity("Bob Smith")
+
+	tests := []struct {
+		name   string
+		text   string
+		tokens int
+	}{
+		{"plain", "hello there", 11},
+		{"unicode", "grüße 🙂", 7},
+		{"entity", "hi Bob", 4},
+		{"longest entity", "hi Bob Smith", 4},
+		{"entity inside a word", "Bobby", 5},
+		{"mention", "hey <@123>", 5},
+		{"custom emoji", "<:pog:456><a:dance:789>", 2},
+		{"timestamp", "at <t:1700000000:R>", 4},
+		{"entity beside markup", "<@123>Bob", 2},
+		{"unfinished markup", "<@123", 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenizer.Observe(test.text)
+
+			tokens := tokenizer.Encode(test.text)
+			if len(tokens) != test.tokens {
+				t.Errorf("Encode(%q) = %d tokens, want %d", test.text, len(tokens), test.tokens)
+			}
+			if decoded := tokenizer.Decode(tokens); decoded != test.text {
+				t.Errorf("Decode(Encode(%q)) = %q", test.text, decoded)
+			}
+		})
+	}
+}
+
+func TestEncodeUnknown(t *testing.T) {
+	tokenizer := NewCharTokenizer(nil)
+	tokenizer.Observe("ab")
+
+	tokens := tokenizer.Encode("abc")
+	if tokens[2] != -1 {
+		t.Errorf("unknown character encoded as %d, want -1", tokens[2])
+	}
+	if decoded := tokenizer.Decode(tokens); decoded != "ab�" {
+		t.Errorf("Decode = %q, want %q", decoded, "ab�")
+	}
+}
+
+func TestKeyMarksEntities(t *testing.T) {
+	tokenizer := NewCharTokenizer(nil)
+	tokenizer.Observe("Bob")
+	spelled := tokenizer.key(tokenizer.Encode("Bob"))
+
+	tokenizer.AddEntity("Bob")
+	entity := tokenizer.key(tokenizer.Encode("Bob"))
+
+	if spelled != "Bob" {
+		t.Errorf("key of spelled-out name = %q, want %q", spelled, "Bob")
+	}
+	if entity == spelled {
+		t.Errorf("entity and its spelling share the key %q", entity)
+	}
+	if decoded := tokenizer.Decode(tokenizer.Encode("Bob")); decoded != "Bob" {
+		t.Errorf("Decode of entity = %q, want %q", decoded, "Bob")
+	}
+}
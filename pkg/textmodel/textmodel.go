@@ -0,0 +1,93 @@
+// Package textmodel defines the interface generation backends implement and a
+// registry to pick one by name, so guilds can run different models.
+package textmodel
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/disgoorg/snowflake/v2"
+)
+
+// TextModel learns from chat messages and generates text like them. Brains
+// train and use it from several goroutines at once.
+type TextModel interface {
+	// Train learns a message.
+	Train(text string)
+	// Forget unlearns a message previously passed to Train.
+	Forget(text string)
+	// Generate continues seed by up to length tokens, returning the seed
+	// followed by the generated text.
+	Generate(seed string, length int) string
+	// Save writes everything learned to w.
+	Save(w io.Writer) error
+	// Load replaces the model's state with one written by Save.
+	Load(r io.Reader) error
+}
+
+// Streamer is implemented by models that can hand out text while they are
+// still generating it.
+type Streamer interface {
+	// Stream generates like Generate, passing each sampled piece of text
+	// after the seed to emit. Generation stops early once emit returns false.
+	Stream(seed string, length int, emit func(piece string) bool) string
+}
+
+// Options are the settings every backend is created with. Backends ignore
+// the ones that don't apply to them.
+type Options struct {
+	// guild the model learns for
+	Guild     snowflake.ID
+	Order     int
+	Smoothing float64
+}
+
+// Factory creates an empty model.
+type Factory func(opts Options) TextModel
+
+var (
+	backends   = make(map[string]Factory)
+	backendsMu sync.RWMutex
+)
+
+// Register makes a backend available under name, typically from the init
+// function of the package implementing it.
+func Register(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if _, exists := backends[name]; exists {
+		panic("textmodel: backend registered twice: " + name)
+	}
+
+	backends[name] = factory
+}
+
+// New creates an empty model of the named backend.
+func New(name string, opts Options) (TextModel, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown text model backend %q", name)
+	}
+
+	return factory(opts), nil
+}
+
+// Backends lists the registered backend names in order.
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,169 @@
+// Package watchdog cancels long-running work that stops making progress, so
+// a hung request or runaway loop can't pile up forever.
+package watchdog
+
+import (
+	"context"
+	"expvar"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// stalled counts the tasks cancelled by every watchdog, by kind, and is
+// served with the other expvars at /debug/vars.
+var stalled = expvar.NewMap("watchdog_stalled")
+
+// Watchdog tracks tasks of one kind and cancels those that made no progress
+// for longer than its deadline. A nil watchdog tracks nothing.
+type Watchdog struct {
+	kind     string
+	deadline time.Duration
+
+	mu    sync.Mutex
+	tasks map[string]*Task
+}
+
+// Task is a piece of work a watchdog tracks. The methods of a nil task do
+// nothing, so unwatched work can use the same code.
+type Task struct {
+	name   string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	progress time.Time
+}
+
+// New creates a watchdog for tasks of kind, cancelling those without
+// progress for deadline. A deadline of zero or less disables it.
+func New(kind string, deadline time.Duration) *Watchdog {
+	if deadline <= 0 {
+		return nil
+	}
+
+	return &Watchdog{
+		kind:     kind,
+		deadline: deadline,
+		tasks:    make(map[string]*Task),
+	}
+}
+
+// Start begins tracking a task called name, running under ctx. It reports
+// false when a task of that name is still running, which the caller usually
+// should leave to finish rather than start another.
+func (w *Watchdog) Start(ctx context.Context, name string) (*Task, bool) {
+	if w == nil {
+		return nil, true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, running := w.tasks[name]; running {
+		return nil, false
+	}
+
+	task := &Task{name: name, progress: time.Now()}
+	task.ctx, task.cancel = context.WithCancel(ctx)
+	w.tasks[name] = task
+
+	return task, true
+}
+
+// Done stops tracking a task and releases its context.
+func (w *Watchdog) Done(task *Task) {
+	if w == nil || task == nil {
+		return
+	}
+
+	w.mu.Lock()
+	if w.tasks[task.name] == task {
+		delete(w.tasks, task.name)
+	}
+	w.mu.Unlock()
+
+	task.cancel()
+}
+
+// Run checks for stalled tasks until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	if w == nil {
+		return
+	}
+
+	ticker := time.NewTicker(w.deadline / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+// check cancels the tasks without progress for longer than the deadline.
+// They stop being tracked right away, so the work can start over while the
+// stalled attempt winds down.
+func (w *Watchdog) check(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for name, task := range w.tasks {
+		idle := now.Sub(task.lastProgress())
+		if idle <= w.deadline {
+			continue
+		}
+
+		task.cancel()
+		delete(w.tasks, name)
+		stalled.Add(w.kind, 1)
+
+		slog.Warn("Cancelled stalled task", slog.String("kind", w.kind), slog.String("task", name), slog.Duration("idle", idle))
+	}
+}
+
+// Context is cancelled when the task is found stalled or done. A nil task's
+// context is never cancelled.
+func (t *Task) Context() context.Context {
+	if t == nil {
+		return context.Background()
+	}
+
+	return t.ctx
+}
+
+// Progress tells the watchdog the task is still getting somewhere.
+func (t *Task) Progress() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.progress = time.Now()
+	t.mu.Unlock()
+}
+
+// Alive reports whether the task should go on, recording progress if so.
+func (t *Task) Alive() bool {
+	if t == nil {
+		return true
+	}
+
+	if t.ctx.Err() != nil {
+		return false
+	}
+
+	t.Progress()
+	return true
+}
+
+func (t *Task) lastProgress() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.progress
+}